@@ -23,6 +23,9 @@ package cmd
 import (
 	"context"
 	"github.com/jrnd-io/jr/pkg/emitter"
+	"github.com/jrnd-io/jr/pkg/metrics"
+	"github.com/jrnd-io/jr/pkg/tracing"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
 
@@ -33,6 +36,10 @@ var emitterRunCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 
 		dryrun, _ := cmd.Flags().GetBool("dryrun")
+		if metricsAddr, _ := cmd.Flags().GetString("metricsAddr"); metricsAddr != "" {
+			defer metrics.Serve(metricsAddr).Close()
+		}
+		defer startTracing(cmd)()
 		RunEmitters(cmd.Context(), args, emitters2, dryrun)
 
 	},
@@ -42,10 +49,29 @@ func RunEmitters(ctx context.Context, emitterNames []string, ems map[string][]em
 	defer emitter.WriteStats()
 	defer emitter.CloseProducers(ctx, ems)
 	emittersToRun := emitter.Initialize(ctx, emitterNames, ems, dryrun)
+	metrics.SetReady(true)
+	defer metrics.SetReady(false)
 	emitter.DoLoop(ctx, emittersToRun)
 }
 
+// startTracing creates the tracer configured by the flags of a run command, and returns the function stopping it
+func startTracing(cmd *cobra.Command) func() {
+	mode, _ := cmd.Flags().GetString("tracing")
+	endpoint, _ := cmd.Flags().GetString("tracingEndpoint")
+	if err := tracing.Init(cmd.Context(), tracing.Config{Mode: mode, Endpoint: endpoint}); err != nil {
+		log.Fatal().Err(err).Msg("Error initializing tracing")
+	}
+	return func() {
+		if err := tracing.Shutdown(context.Background()); err != nil {
+			log.Error().Err(err).Msg("Error exporting spans")
+		}
+	}
+}
+
 func init() {
 	emitterCmd.AddCommand(emitterRunCmd)
 	emitterRunCmd.Flags().BoolP("dryrun", "d", false, "dryrun: output of the emitters to stdout")
+	emitterRunCmd.Flags().String("metricsAddr", "", "Address of the listener of /metrics, /healthz and /readyz, like :9090")
+	emitterRunCmd.Flags().String("tracing", "", "Create OpenTelemetry spans for every record or batch of records: record, batch")
+	emitterRunCmd.Flags().String("tracingEndpoint", "", "URL of the OTLP/HTTP collector of the spans, like http://localhost:4318 (default OTEL_EXPORTER_OTLP_ENDPOINT)")
 }
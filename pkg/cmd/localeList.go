@@ -0,0 +1,87 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/spf13/cobra"
+)
+
+var localeListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all available locales",
+	Long:  `List all available locales, which are in '$JR_SYSTEM_DIR/templates/data' directory, with their fallback chain and the number of missing datasets`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		noColor, _ := cmd.Flags().GetBool("nocolor")
+
+		var Red = ""
+		var Green = ""
+		var Reset = ""
+		if !noColor {
+			Red = "\033[31m"
+			Green = "\033[32m"
+			Reset = "\033[0m"
+		}
+
+		locales, err := functions.Locales()
+		if err != nil {
+			fmt.Printf("Error listing locales: %v\n", err)
+			return
+		}
+
+		fmt.Println()
+		fmt.Println("List of available JR locales:")
+		fmt.Println()
+
+		for _, l := range locales {
+			chain, err := functions.LocaleChain(l)
+			if err != nil {
+				fmt.Printf("%s%s -> %v%s\n", Red, l, err, Reset)
+				continue
+			}
+			names := make([]string, len(chain))
+			for i, c := range chain {
+				names[i] = c.Name
+			}
+			report, _ := functions.LocaleReport(l)
+			missing := 0
+			for _, d := range report {
+				if d.Fallback {
+					missing++
+				}
+			}
+			color := Green
+			if missing > 0 {
+				color = Red
+			}
+			fmt.Printf("%s%s%s (%s) %s, %s: %d missing datasets\n", color, l, Reset, chain[0].Charset, chain[0].Description, strings.Join(names, " -> "), missing)
+		}
+		fmt.Println()
+	},
+}
+
+func init() {
+	localeCmd.AddCommand(localeListCmd)
+	localeListCmd.Flags().BoolP("nocolor", "n", false, "Do not color output")
+}
@@ -0,0 +1,99 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/spf13/cobra"
+)
+
+var localeShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show a locale and where its datasets come from",
+	Long: `Show a locale, its fallback chain and where every dataset is read from.
+Datasets missing in the chain are read from the default locale, or fail with --strictLocale:
+jr locale show it`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		noColor, _ := cmd.Flags().GetBool("nocolor")
+
+		var Red = ""
+		var Green = ""
+		var Reset = ""
+		if !noColor {
+			Red = "\033[31m"
+			Green = "\033[32m"
+			Reset = "\033[0m"
+		}
+
+		chain, err := functions.LocaleChain(args[0])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		names := make([]string, len(chain))
+		for i, c := range chain {
+			names[i] = c.Name
+		}
+		report, err := functions.LocaleReport(args[0])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		fmt.Println()
+		fmt.Printf("%sName: %s%s\n", Green, Reset, chain[0].Name)
+		fmt.Printf("%sDescription: %s%s\n", Green, Reset, chain[0].Description)
+		fmt.Printf("%sCharset: %s%s\n", Green, Reset, chain[0].Charset)
+		currency, rates := functions.LocaleCurrency(args[0])
+		fmt.Printf("%sCurrency: %s%s\n", Green, Reset, currency)
+		classes := make([]string, 0, len(rates))
+		for class, rate := range rates {
+			classes = append(classes, fmt.Sprintf("%s %g%%", class, rate*100))
+		}
+		sort.Strings(classes)
+		fmt.Printf("%sTax rates: %s%s\n", Green, Reset, strings.Join(classes, ", "))
+		fmt.Printf("%sChain: %s%s\n", Green, Reset, strings.Join(names, " -> "))
+		fmt.Printf("%sDatasets:%s\n", Green, Reset)
+		for _, d := range report {
+			switch {
+			case d.Missing:
+				fmt.Printf("  %s%s: missing%s\n", Red, d.Dataset, Reset)
+			case d.Fallback:
+				fmt.Printf("  %s%s: missing, falls back to %s%s\n", Red, d.Dataset, d.Locale, Reset)
+			case d.Locale == chain[0].Name:
+				fmt.Printf("  %s\n", d.Dataset)
+			default:
+				fmt.Printf("  %s: from %s\n", d.Dataset, d.Locale)
+			}
+		}
+		fmt.Println()
+	},
+}
+
+func init() {
+	localeCmd.AddCommand(localeShowCmd)
+	localeShowCmd.Flags().BoolP("nocolor", "n", false, "Do not color output")
+}
@@ -61,6 +61,7 @@ var producerListCmd = &cobra.Command{
 		fmt.Printf("%sWASM Function%s (--output = wasm)\n", Green, Reset)
 		fmt.Printf("%sAWS DynamoDB%s (--output = awsdynamodb)\n", Green, Reset)
 		fmt.Printf("%sWAMP Topic%s (--output = wamp)\n", Green, Reset)
+		fmt.Printf("%sOpenTelemetry OTLP%s (--output = otlp)\n", Green, Reset)
 		fmt.Println()
 
 	},
@@ -26,12 +26,19 @@ import (
 	_ "embed"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"text/template"
 	"time"
 
@@ -42,6 +49,8 @@ import (
 	"github.com/jrnd-io/jr/pkg/constants"
 	"github.com/jrnd-io/jr/pkg/emitter"
 	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/jrnd-io/jr/pkg/metrics"
+	"github.com/jrnd-io/jr/pkg/openapi"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
@@ -88,7 +97,14 @@ var jr_logo_png []byte
 var firstRun = make(map[string]bool)
 var emitterToRun = make(map[string][]emitter.Emitter)
 
-var store = sessions.NewCookieStore([]byte("templates"))
+// renderLock serializes the rendering of templates by the server: emitters, streams, mock routes and
+// collections share the global JR context and the random generator, which seeded routes reseed
+var renderLock sync.Mutex
+
+var store = newSessionStore()
+
+// safeFunctions restricts the templates of remote callers to the safe function set
+var safeFunctions = true
 
 type serverKey string
 
@@ -107,6 +123,48 @@ var serverCmd = &cobra.Command{
 		if err != nil {
 			log.Fatal().Err(err).Msg("Error getting port")
 		}
+		host, _ := cmd.Flags().GetString("host")
+		tlsCert, _ := cmd.Flags().GetString("tlsCert")
+		tlsKey, _ := cmd.Flags().GetString("tlsKey")
+		clientCA, _ := cmd.Flags().GetString("clientCA")
+		authMode, _ := cmd.Flags().GetString("auth")
+		corsOrigins, _ := cmd.Flags().GetStringSlice("corsOrigins")
+		rateLimit, _ := cmd.Flags().GetFloat64("rateLimit")
+		rateBurst, _ := cmd.Flags().GetInt("rateBurst")
+		safeFunctions, _ = cmd.Flags().GetBool("safeFunctions")
+
+		if (tlsCert == "") != (tlsKey == "") {
+			log.Fatal().Msg("TLS needs both tlsCert and tlsKey")
+		}
+		if clientCA != "" && tlsCert == "" || authMode == AuthMTLS && clientCA == "" {
+			log.Fatal().Msg("mTLS authentication needs tlsCert, tlsKey and clientCA")
+		}
+		auth, err := newServerAuth(authMode)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error configuring authentication")
+		}
+		tlsConfig, err := serverTLSConfig(clientCA)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error configuring TLS")
+		}
+		store.Options.Secure = tlsCert != ""
+
+		mocks := &MockConfig{}
+		if routesFile, _ := cmd.Flags().GetString("routes"); routesFile != "" {
+			mocks, err = LoadMockConfig(routesFile)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Error loading mock routes")
+			}
+		}
+		if openAPIFile, _ := cmd.Flags().GetString("openapi"); openAPIFile != "" {
+			document, err := openapi.Load(openAPIFile)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Error loading OpenAPI document")
+			}
+			if err = mocks.AddOpenAPI(document); err != nil {
+				log.Fatal().Err(err).Msg("Error adding OpenAPI routes")
+			}
+		}
 
 		for i := 0; i < len(emitters); i++ {
 			emitters[i].Output = "http"
@@ -121,44 +179,69 @@ var serverCmd = &cobra.Command{
 		router.Use(middleware.RealIP)
 		router.Use(middleware.Logger)
 		router.Use(middleware.Recoverer)
-		router.Use(middleware.Timeout(60 * time.Second))
-		router.Use(SessionMiddleware)
-
-		// comment for local dev
-		embeddedFileRoutes(router)
-
-		// Uncomment for local dev
-		// localDevServerSetup(router)
-
-		router.Route("/emitters", func(r chi.Router) {
-			r.Get("/", listEmitters)
-			r.Post("/", addEmitter)
-
-			r.Route("/{emitter}", func(r chi.Router) {
-				r.Get("/", runEmitter)
-				r.Put("/", updateEmitter)
-				r.Delete("/", deleteEmitter)
-				r.Get("/start", startEmitter)
-				r.Get("/stop", stopEmitter)
-				r.Get("/pause", pauseEmitter)
-				r.Get("/status", statusEmitter)
-			})
-		})
 
-		router.Route("/executeTemplate", func(r chi.Router) {
-			r.Post("/", executeTemplate)
-		})
+		// probes are not authenticated
+		router.Get("/healthz", metrics.Healthz)
+		router.Get("/readyz", metrics.Readyz)
 
-		router.Route("/loadLastStatus", func(r chi.Router) {
-			r.Get("/", loadLastStatus)
-		})
+		router.Group(func(router chi.Router) {
+			if len(corsOrigins) > 0 {
+				router.Use(corsMiddleware(corsOrigins))
+			}
+			router.Use(auth.middleware)
+			if rateLimit > 0 {
+				router.Use(newRateLimiter(rateLimit, rateBurst).middleware)
+			}
+			router.Use(SessionMiddleware)
 
-		router.Route("/functionsList", func(r chi.Router) {
-			r.Post("/", webFunctionList)
+			router.Handle("/metrics", metrics.Handler())
+
+			// streams run until the client disconnects, without the request timeout
+			router.Get("/emitters/{emitter}/stream", streamEmitter)
+
+			router.Group(func(router chi.Router) {
+				router.Use(middleware.Timeout(60 * time.Second))
+
+				// comment for local dev
+				embeddedFileRoutes(router)
+
+				// Uncomment for local dev
+				// localDevServerSetup(router)
+
+				router.Route("/emitters", func(r chi.Router) {
+					r.Get("/", listEmitters)
+					r.Post("/", addEmitter)
+
+					r.Route("/{emitter}", func(r chi.Router) {
+						r.Get("/", runEmitter)
+						r.Put("/", updateEmitter)
+						r.Delete("/", deleteEmitter)
+						r.Get("/start", startEmitter)
+						r.Get("/stop", stopEmitter)
+						r.Get("/pause", pauseEmitter)
+						r.Get("/status", statusEmitter)
+					})
+				})
+
+				router.Route("/executeTemplate", func(r chi.Router) {
+					r.Post("/", executeTemplate)
+				})
+
+				router.Route("/loadLastStatus", func(r chi.Router) {
+					r.Get("/", loadLastStatus)
+				})
+
+				router.Route("/functionsList", func(r chi.Router) {
+					r.Post("/", webFunctionList)
+				})
+
+				registerMockRoutes(router, mocks.Routes)
+				registerCollections(router, mocks.Collections)
+			})
 		})
 
-		addr := fmt.Sprintf(":%d", port)
-		log.Info().Int("port", port).Msg("Starting HTTP server")
+		addr := net.JoinHostPort(host, strconv.Itoa(port))
+		log.Info().Str("host", host).Int("port", port).Bool("tls", tlsCert != "").Str("auth", authMode).Msg("Starting HTTP server")
 
 		// TODO: must validate values
 		s := &http.Server{
@@ -167,9 +250,33 @@ var serverCmd = &cobra.Command{
 			ReadTimeout:       1 * time.Minute,
 			WriteTimeout:      2 * time.Minute,
 			Handler:           router,
+			TLSConfig:         tlsConfig,
 		}
 
-		log.Fatal().Err(s.ListenAndServe())
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		metrics.SetReady(true)
+		go func() {
+			var err error
+			if tlsCert != "" {
+				err = s.ListenAndServeTLS(tlsCert, tlsKey)
+			} else {
+				err = s.ListenAndServe()
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal().Err(err).Msg("Error starting HTTP server")
+			}
+		}()
+		<-ctx.Done()
+
+		log.Info().Msg("Stopping HTTP server")
+		metrics.SetReady(false)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := s.Shutdown(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("Error stopping HTTP server")
+		}
+		saveCollections(mocks.Collections)
 	},
 }
 
@@ -305,6 +412,14 @@ func addEmitter(w http.ResponseWriter, r *http.Request) {
 
 	e.Output = "http"
 
+	if safeFunctions {
+		if err = checkRemoteEmitter(&e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		e.SafeFunctions = true
+	}
+
 	emitters = append(emitters, e)
 	response := fmt.Sprintf("Emitter %s added", e.Name)
 	_, err = w.Write([]byte(response))
@@ -359,6 +474,8 @@ func runEmitter(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	url := chi.URLParam(r, "emitter")
 
+	renderLock.Lock()
+	defer renderLock.Unlock()
 	if firstRun[url] {
 		for _, e := range emitterToRun[url] {
 			e.Run(r.Context(), e.Num, w)
@@ -372,7 +489,7 @@ func runEmitter(w http.ResponseWriter, r *http.Request) {
 			emitters[i].Initialize(r.Context(), configuration.GlobalCfg)
 			emitterToRun[url] = append(emitterToRun[url], emitters[i])
 			if emitters[i].Preload > 0 {
-				emitters[i].Run(r.Context(), emitters[i].Preload, w)
+				emitters[i].RunPreload(r.Context(), w)
 			} else {
 				emitters[i].Run(r.Context(), emitters[i].Num, w)
 			}
@@ -436,7 +553,11 @@ func executeTemplate(w http.ResponseWriter, r *http.Request) {
 	session.Values["lastTemplateSubmittedisJsonOutputValue"] = lastTemplateSubmittedisJsonOutputValue
 	session.Save(r, w)
 
-	templateParsed, errValidity := template.New("").Funcs(functions.FunctionsMap()).Parse(lastTemplateSubmittedValue)
+	funcs := functions.FunctionsMap()
+	if safeFunctions {
+		funcs = functions.SafeFunctionsMap()
+	}
+	templateParsed, errValidity := template.New("").Funcs(funcs).Parse(lastTemplateSubmittedValue)
 	if errValidity != nil {
 		log.Error().Err(errValidity).Msg("Error parsing template")
 		http.Error(w, errValidity.Error(), http.StatusInternalServerError)
@@ -445,7 +566,9 @@ func executeTemplate(w http.ResponseWriter, r *http.Request) {
 
 	var b bytes.Buffer
 	dummy := struct{ Name string }{""}
+	renderLock.Lock()
 	errValidityRendering := templateParsed.Execute(&b, dummy)
+	renderLock.Unlock()
 
 	if errValidityRendering != nil {
 		log.Error().Err(errValidityRendering).Msg("Error rendering template")
@@ -537,4 +660,15 @@ func findFunctonsByRegex(name string) []string {
 func init() {
 	rootCmd.AddCommand(serverCmd)
 	serverCmd.Flags().IntP("port", "p", constants.DEFAULT_HTTP_PORT, "Server port")
+	serverCmd.Flags().String("routes", "", "JSON or YAML file with the mock routes and collections to serve with templates")
+	serverCmd.Flags().String("host", "", "Host or address to listen on, all interfaces by default")
+	serverCmd.Flags().String("tlsCert", "", "TLS certificate file, to serve HTTPS")
+	serverCmd.Flags().String("tlsKey", "", "TLS private key file, to serve HTTPS")
+	serverCmd.Flags().String("clientCA", "", "CA certificates file verifying client certificates, for mTLS authentication")
+	serverCmd.Flags().String("auth", AuthNone, "Authentication: none, bearer (tokens in "+ServerTokensEnv+"), basic (users in "+ServerUsersEnv+") or mtls")
+	serverCmd.Flags().StringSlice("corsOrigins", nil, "Origins allowed to call the server from browsers, or *")
+	serverCmd.Flags().Float64("rateLimit", 0, "Requests per second allowed to every client, 0 for no limit")
+	serverCmd.Flags().Int("rateBurst", 0, "Requests allowed in a burst to every client, the rate limit by default")
+	serverCmd.Flags().Bool("safeFunctions", true, "Restrict the templates of remote callers to functions not reading local files")
+	serverCmd.Flags().String("openapi", "", "OpenAPI 3 document with the operations to serve as mock routes, validating request bodies")
 }
@@ -0,0 +1,580 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jrnd-io/jr/pkg/constants"
+	jrctx "github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/jrnd-io/jr/pkg/tpl"
+	"github.com/rs/zerolog/log"
+)
+
+// sortParam is the query parameter with the sort fields of a collection
+const sortParam = "sort"
+
+// MockCollection is a stateful REST resource, seeded with records rendered from a template.
+// The values of ListField of its records are kept in the JR context list List,
+// so emitters can pick them with random_v_from_list.
+type MockCollection struct {
+	Name             string `mapstructure:"name"`
+	Path             string `mapstructure:"path"`
+	Template         string `mapstructure:"template"`
+	EmbeddedTemplate string `mapstructure:"embeddedTemplate"`
+	Locale           string `mapstructure:"locale"`
+	Records          int    `mapstructure:"records"`
+	IDField          string `mapstructure:"idField"`
+	List             string `mapstructure:"list"`
+	ListField        string `mapstructure:"listField"`
+	// Persist is a JSON file: records are loaded from it at start, if it exists, and saved to it on shutdown
+	Persist    string         `mapstructure:"persist"`
+	Pagination MockPagination `mapstructure:"pagination"`
+
+	valueTpl tpl.Tpl
+	lock     sync.RWMutex
+	ids      []string
+	records  map[string]map[string]any
+	nextID   int64
+}
+
+// init validates a collection, sets its defaults and seeds or loads its records
+func (c *MockCollection) init() error {
+	if c.Name == "" {
+		return fmt.Errorf("no name")
+	}
+	if c.Path == "" {
+		c.Path = "/" + c.Name
+	}
+	c.Path = strings.TrimSuffix(c.Path, "/")
+	if !strings.HasPrefix(c.Path, "/") {
+		return fmt.Errorf("path must start with /")
+	}
+	if isReservedPath(c.Path) {
+		return fmt.Errorf("path is reserved by the server")
+	}
+	if c.Records < 0 {
+		return fmt.Errorf("records must not be negative")
+	}
+	if c.IDField == "" {
+		c.IDField = "id"
+	}
+	if c.List == "" {
+		c.List = c.Name
+	}
+	if c.ListField == "" {
+		c.ListField = c.IDField
+	}
+	if c.Locale == "" {
+		c.Locale = constants.LOCALE
+	}
+	p := &c.Pagination
+	if p.Size <= 0 {
+		p.Size = 20
+	}
+	if p.MaxSize <= 0 {
+		p.MaxSize = 100
+	}
+	if p.PageParam == "" {
+		p.PageParam = "page"
+	}
+	if p.SizeParam == "" {
+		p.SizeParam = "size"
+	}
+	if p.Envelope == "" {
+		p.Envelope = "data"
+	}
+
+	var err error
+	if c.valueTpl, err = mockTemplate(c.Template, c.EmbeddedTemplate); err != nil {
+		return err
+	}
+	c.records = make(map[string]map[string]any)
+	c.nextID = 1
+
+	if c.Persist != "" {
+		b, err := os.ReadFile(c.Persist)
+		if err == nil {
+			return c.load(b)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return c.seed()
+}
+
+// seed renders the template once per record
+func (c *MockCollection) seed() error {
+	renderLock.Lock()
+	defer renderLock.Unlock()
+	jrctx.JrContext.Locale = c.Locale
+	for i := 0; i < c.Records; i++ {
+		jrctx.JrContext.CurrentIterationLoopIndex++
+		mr := MockRequest{Params: map[string]string{}, Query: map[string]string{}, Headers: map[string]string{}, Index: i}
+		var b bytes.Buffer
+		if err := c.valueTpl.Template.Execute(&b, mr); err != nil {
+			return err
+		}
+		record, err := decodeRecord(b.Bytes())
+		if err != nil {
+			return fmt.Errorf("template doesn't render a JSON object: %w", err)
+		}
+		if _, err = c.insert(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load reads the records saved in a JSON array
+func (c *MockCollection) load(b []byte) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var records []map[string]any
+	if err := d.Decode(&records); err != nil {
+		return fmt.Errorf("can't load %s: %w", c.Persist, err)
+	}
+	for _, record := range records {
+		if _, err := c.insert(record); err != nil {
+			return err
+		}
+	}
+	log.Info().Str("collection", c.Name).Int("records", len(records)).Str("file", c.Persist).Msg("Collection loaded")
+	return nil
+}
+
+// Save writes the records of the collection to its Persist file
+func (c *MockCollection) Save() error {
+	if c.Persist == "" {
+		return nil
+	}
+	// the records are marshalled holding the lock, as patch changes them in place
+	c.lock.RLock()
+	records := make([]map[string]any, len(c.ids))
+	for i, id := range c.ids {
+		records[i] = c.records[id]
+	}
+	b, err := json.MarshalIndent(records, "", "  ")
+	c.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(c.Persist, b, 0644); err != nil {
+		return err
+	}
+	log.Info().Str("collection", c.Name).Int("records", len(records)).Str("file", c.Persist).Msg("Collection saved")
+	return nil
+}
+
+// saveCollections persists the collections with a Persist file
+func saveCollections(collections []*MockCollection) {
+	for _, c := range collections {
+		if err := c.Save(); err != nil {
+			log.Error().Err(err).Str("collection", c.Name).Msg("Error saving collection")
+		}
+	}
+}
+
+// insert adds a record, assigning it the next numeric id if it has none. The caller holds the lock.
+func (c *MockCollection) insert(record map[string]any) (string, error) {
+	if v, ok := record[c.IDField]; !ok || v == nil || v == "" {
+		record[c.IDField] = json.Number(strconv.FormatInt(c.nextID, 10))
+	}
+	id := valueString(record[c.IDField])
+	if _, exists := c.records[id]; exists {
+		return "", fmt.Errorf("duplicate %s %s", c.IDField, id)
+	}
+	if n, err := strconv.ParseInt(id, 10, 64); err == nil && n >= c.nextID {
+		c.nextID = n + 1
+	}
+	c.ids = append(c.ids, id)
+	c.records[id] = record
+	c.enlist(record)
+	return id, nil
+}
+
+// remove deletes a record. The caller holds the lock.
+func (c *MockCollection) remove(id string) {
+	c.unlist(c.records[id])
+	delete(c.records, id)
+	for i := range c.ids {
+		if c.ids[i] == id {
+			c.ids = append(c.ids[:i], c.ids[i+1:]...)
+			break
+		}
+	}
+}
+
+// enlist adds the list field of a record to the JR context list of the collection
+func (c *MockCollection) enlist(record map[string]any) {
+	if v, ok := lookup(record, c.ListField); ok && v != nil {
+		functions.AddValueToList(c.List, valueString(v))
+	}
+}
+
+// unlist removes the list field of a record from the JR context list of the collection
+func (c *MockCollection) unlist(record map[string]any) {
+	v, ok := lookup(record, c.ListField)
+	if !ok || v == nil {
+		return
+	}
+	s := valueString(v)
+	jrctx.JrContext.CtxListLock.Lock()
+	defer jrctx.JrContext.CtxListLock.Unlock()
+	list := jrctx.JrContext.CtxList[c.List]
+	for i := range list {
+		if list[i] == s {
+			jrctx.JrContext.CtxList[c.List] = append(list[:i], list[i+1:]...)
+			return
+		}
+	}
+}
+
+// registerCollections adds the routes of the collections to the router
+func registerCollections(router chi.Router, collections []*MockCollection) {
+	for _, c := range collections {
+		router.Route(c.Path, func(r chi.Router) {
+			r.Get("/", c.list)
+			r.Post("/", c.create)
+			r.Get("/{id}", c.get)
+			r.Put("/{id}", c.replace)
+			r.Patch("/{id}", c.patch)
+			r.Delete("/{id}", c.delete)
+		})
+		log.Info().Str("collection", c.Name).Str("path", c.Path).Int("records", len(c.ids)).Msg("Mock collection")
+	}
+}
+
+// list returns a page of the records matching the query, sorted by the sort parameter
+func (c *MockCollection) list(w http.ResponseWriter, r *http.Request) {
+	p := c.Pagination
+	query := r.URL.Query()
+	page, err := positiveInt(query.Get(p.PageParam), 1)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s: %v", p.PageParam, err))
+		return
+	}
+	size, err := positiveInt(query.Get(p.SizeParam), p.Size)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s: %v", p.SizeParam, err))
+		return
+	}
+	size = min(size, p.MaxSize)
+
+	data, total, err := c.page(query, page, size)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	pages := int(math.Ceil(float64(total) / float64(size)))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	fmt.Fprintf(w, `{"%s":%s,"page":%d,"size":%d,"total":%d,"pages":%d}`, p.Envelope, data, page, size, total, pages)
+}
+
+// page marshals a page of the records matching the query, and returns the number of matches.
+// The page is marshalled holding the lock, as patch changes the records in place
+func (c *MockCollection) page(query url.Values, page int, size int) ([]byte, int, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	var matches []map[string]any
+	for _, id := range c.ids {
+		if matchRecord(c.records[id], query, c.Pagination.PageParam, c.Pagination.SizeParam) {
+			matches = append(matches, c.records[id])
+		}
+	}
+	if s := query.Get(sortParam); s != "" {
+		sortRecords(matches, strings.Split(s, ","))
+	}
+	// pages past the last one are empty, checked before multiplying so that huge pages cannot overflow
+	if page-1 > len(matches)/size {
+		return []byte("[]"), len(matches), nil
+	}
+	from := min((page-1)*size, len(matches))
+	to := min(from+size, len(matches))
+	if from == to {
+		return []byte("[]"), len(matches), nil
+	}
+	data, err := json.Marshal(matches[from:to])
+	return data, len(matches), err
+}
+
+func (c *MockCollection) get(w http.ResponseWriter, r *http.Request) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	record, ok := c.records[chi.URLParam(r, "id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+	writeJSON(w, http.StatusOK, record)
+}
+
+// create adds the record in the body, with a new id if it has none
+func (c *MockCollection) create(w http.ResponseWriter, r *http.Request) {
+	record, err := readRecord(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	id, err := c.insert(record)
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	w.Header().Set("Location", c.Path+"/"+id)
+	writeJSON(w, http.StatusCreated, record)
+}
+
+// replace replaces the record with the body, or creates it if it doesn't exist
+func (c *MockCollection) replace(w http.ResponseWriter, r *http.Request) {
+	record, err := readRecord(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	id := chi.URLParam(r, "id")
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	old, exists := c.records[id]
+	if exists {
+		record[c.IDField] = old[c.IDField]
+		c.unlist(old)
+		c.records[id] = record
+		c.enlist(record)
+		writeJSON(w, http.StatusOK, record)
+		return
+	}
+	record[c.IDField] = id
+	if _, err := strconv.ParseInt(id, 10, 64); err == nil {
+		record[c.IDField] = json.Number(id)
+	}
+	if _, err = c.insert(record); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	w.Header().Set("Location", c.Path+"/"+id)
+	writeJSON(w, http.StatusCreated, record)
+}
+
+// patch merges the body into the record, as a JSON merge patch: null values remove fields
+func (c *MockCollection) patch(w http.ResponseWriter, r *http.Request) {
+	changes, err := readRecord(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	id := chi.URLParam(r, "id")
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	record, ok := c.records[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+	delete(changes, c.IDField)
+	c.unlist(record)
+	mergePatch(record, changes)
+	c.enlist(record)
+	writeJSON(w, http.StatusOK, record)
+}
+
+func (c *MockCollection) delete(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.records[id]; !ok {
+		writeError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+	c.remove(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// matchRecord tells if the fields of a record, like name or address.city, have the values of the query
+func matchRecord(record map[string]any, query map[string][]string, pageParam string, sizeParam string) bool {
+	for field, values := range query {
+		if field == pageParam || field == sizeParam || field == sortParam {
+			continue
+		}
+		v, ok := lookup(record, field)
+		if !ok || valueString(v) != values[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// sortRecords sorts records by fields; fields starting with - are sorted in descending order
+func sortRecords(records []map[string]any, fields []string) {
+	sort.SliceStable(records, func(i, j int) bool {
+		for _, field := range fields {
+			descending := strings.HasPrefix(field, "-")
+			field = strings.TrimPrefix(field, "-")
+			a, _ := lookup(records[i], field)
+			b, _ := lookup(records[j], field)
+			cmp := compareValues(a, b)
+			if cmp == 0 {
+				continue
+			}
+			if descending {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+}
+
+// compareValues compares numbers as numbers and other values as strings; missing values come first
+func compareValues(a any, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	an, aErr := strconv.ParseFloat(valueString(a), 64)
+	bn, bErr := strconv.ParseFloat(valueString(b), 64)
+	if _, ok := a.(json.Number); ok && aErr == nil && bErr == nil {
+		switch {
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(valueString(a), valueString(b))
+}
+
+// lookup returns the value of a field of a record; fields of nested objects are separated by dots
+func lookup(record map[string]any, field string) (any, bool) {
+	var v any = record
+	for _, key := range strings.Split(field, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// valueString returns the string of a JSON value, as it's used in ids, filters and context lists
+func valueString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case nil:
+		return ""
+	case map[string]any, []any:
+		b, _ := json.Marshal(v)
+		return string(b)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// mergePatch applies a JSON merge patch to a record
+func mergePatch(record map[string]any, patch map[string]any) {
+	for k, v := range patch {
+		if v == nil {
+			delete(record, k)
+			continue
+		}
+		if p, ok := v.(map[string]any); ok {
+			if m, ok := record[k].(map[string]any); ok {
+				mergePatch(m, p)
+				continue
+			}
+		}
+		record[k] = v
+	}
+}
+
+func decodeRecord(b []byte) (map[string]any, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var record map[string]any
+	if err := d.Decode(&record); err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, fmt.Errorf("null is not an object")
+	}
+	return record, nil
+}
+
+func readRecord(r *http.Request) (map[string]any, error) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	record, err := decodeRecord(b)
+	if err != nil {
+		return nil, fmt.Errorf("body is not a JSON object: %w", err)
+	}
+	return record, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err = w.Write(b); err != nil {
+		log.Error().Err(err).Msg("Error writing response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	b, _ := json.Marshal(map[string]string{"error": message})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
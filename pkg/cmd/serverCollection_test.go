@@ -0,0 +1,238 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	jrctx "github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/stretchr/testify/require"
+)
+
+const mockCollections = `
+collections:
+  - name: customers
+    records: 30
+    list: customer_ids
+    embeddedTemplate: '{"name":"{{name}}","age":{{integer 18 90}},"address":{"city":"{{if eq (mod .Index 2) 0}}Rome{{else}}Milan{{end}}"}}'
+    pagination:
+      size: 10
+  - name: products
+    path: /api/products
+    idField: sku
+    listField: name
+    embeddedTemplate: '{"sku":"P{{.Index}}","name":"product {{.Index}}"}'
+    records: 3
+`
+
+type customersPage struct {
+	Data  []map[string]any `json:"data"`
+	Page  int              `json:"page"`
+	Size  int              `json:"size"`
+	Total int              `json:"total"`
+	Pages int              `json:"pages"`
+}
+
+func sendJSON(t *testing.T, method string, url string, body string, v any) *http.Response {
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if v != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+	return resp
+}
+
+func TestMockCollectionList(t *testing.T) {
+	s := mockServer(t, mockCollections)
+
+	var page customersPage
+	resp := getJSON(t, s.URL+"/customers?page=3", &page)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "30", resp.Header.Get("X-Total-Count"))
+	require.Equal(t, 3, page.Pages)
+	require.Len(t, page.Data, 10)
+	require.EqualValues(t, 21, page.Data[0]["id"])
+
+	getJSON(t, s.URL+"/customers?address.city=Rome&size=100", &page)
+	require.Equal(t, 15, page.Total)
+	for _, c := range page.Data {
+		require.Equal(t, "Rome", c["address"].(map[string]any)["city"])
+	}
+
+	getJSON(t, s.URL+"/customers?sort=-age,id&size=30", &page)
+	for i := 1; i < len(page.Data); i++ {
+		require.GreaterOrEqual(t, page.Data[i-1]["age"], page.Data[i]["age"])
+	}
+
+	getJSON(t, s.URL+"/customers?name=nobody", &page)
+	require.Equal(t, 0, page.Total)
+	require.NotNil(t, page.Data)
+
+	resp = getJSON(t, s.URL+"/customers?page=0", nil)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestMockCollectionHugePage(t *testing.T) {
+	s := mockServer(t, mockCollections)
+
+	var page customersPage
+	resp := getJSON(t, s.URL+"/customers?page=9223372036854775807&size=2", &page)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 30, page.Total)
+	require.Empty(t, page.Data)
+	getJSON(t, s.URL+"/customers?page=4", &page)
+	require.Empty(t, page.Data)
+
+	// the read lock is released, so records can still be created
+	resp = sendJSON(t, http.MethodPost, s.URL+"/customers", `{"id":1000,"name":"Ada"}`, nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+}
+
+func TestMockCollectionCRUD(t *testing.T) {
+	s := mockServer(t, mockCollections)
+
+	var created map[string]any
+	resp := sendJSON(t, http.MethodPost, s.URL+"/customers", `{"name":"Ada","age":36}`, &created)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, "/customers/31", resp.Header.Get("Location"))
+	require.EqualValues(t, 31, created["id"])
+	require.Contains(t, jrctx.JrContext.CtxList["customer_ids"], "31")
+
+	var customer map[string]any
+	getJSON(t, s.URL+"/customers/31", &customer)
+	require.Equal(t, "Ada", customer["name"])
+
+	var patched map[string]any
+	resp = sendJSON(t, http.MethodPatch, s.URL+"/customers/31", `{"age":37,"name":null,"id":99}`, &patched)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, map[string]any{"id": float64(31), "age": float64(37)}, patched)
+
+	var replaced map[string]any
+	resp = sendJSON(t, http.MethodPut, s.URL+"/customers/31", `{"name":"Grace"}`, &replaced)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, map[string]any{"id": float64(31), "name": "Grace"}, replaced)
+
+	resp = sendJSON(t, http.MethodPut, s.URL+"/customers/100", `{"name":"Linus"}`, nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp = sendJSON(t, http.MethodPost, s.URL+"/customers", `{"id":100}`, nil)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp = sendJSON(t, http.MethodPost, s.URL+"/customers", `[1,2]`, nil)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = sendJSON(t, http.MethodDelete, s.URL+"/customers/31", "", nil)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.NotContains(t, jrctx.JrContext.CtxList["customer_ids"], "31")
+	resp = getJSON(t, s.URL+"/customers/31", nil)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = sendJSON(t, http.MethodDelete, s.URL+"/customers/31", "", nil)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	var product map[string]any
+	getJSON(t, s.URL+"/api/products/P1", &product)
+	require.Equal(t, "product 1", product["name"])
+	require.Contains(t, jrctx.JrContext.CtxList["products"], "product 1")
+}
+
+func TestMockCollectionConcurrentPatch(t *testing.T) {
+	router := mockRouter(t, mockCollections)
+
+	// patches change the records in place while they are listed and saved: run with -race.
+	// The handlers are called directly, as network I/O would synchronize them for the race detector
+	start := make(chan struct{})
+	var patches sync.WaitGroup
+	patches.Add(1)
+	go func() {
+		defer patches.Done()
+		<-start
+		for i := 0; i < 100; i++ {
+			body := fmt.Sprintf(`{"age":%d,"address":{"city":"Turin","zip":"%d"}}`, i, i)
+			req := httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/customers/%d", i%30+1), strings.NewReader(body))
+			router.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	}()
+	close(start)
+	for i := 0; i < 100; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/customers?size=30&sort=age", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var page customersPage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		require.Len(t, page.Data, 30)
+	}
+	patches.Wait()
+}
+
+func TestMockCollectionPersist(t *testing.T) {
+	dir := t.TempDir()
+	persist := filepath.Join(dir, "books.json")
+	content := fmt.Sprintf(`
+collections:
+  - name: books
+    records: 5
+    persist: %s
+    embeddedTemplate: '{"title":"{{sentence 3}}"}'
+`, persist)
+	filename := filepath.Join(dir, "routes.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0644))
+
+	mocks, err := LoadMockConfig(filename)
+	require.NoError(t, err)
+	books := mocks.Collections[0]
+	_, err = books.insert(map[string]any{"title": "Dune"})
+	require.NoError(t, err)
+	saveCollections(mocks.Collections)
+
+	mocks, err = LoadMockConfig(filename)
+	require.NoError(t, err)
+	reloaded := mocks.Collections[0]
+	require.Equal(t, books.ids, reloaded.ids)
+	require.Equal(t, "Dune", reloaded.records["6"]["title"])
+	require.Equal(t, int64(7), reloaded.nextID)
+}
+
+func TestMockCollectionValidation(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"name":      "collections:\n  - embeddedTemplate: '{}'",
+		"reserved":  "collections:\n  - name: x\n    path: /emitters\n    embeddedTemplate: '{}'",
+		"object":    "collections:\n  - name: x\n    records: 1\n    embeddedTemplate: '[]'",
+		"overlap":   "routes:\n  - path: /x/{id}\n    embeddedTemplate: '{}'\ncollections:\n  - name: x\n    embeddedTemplate: '{}'",
+		"duplicate": "collections:\n  - name: x\n    records: 2\n    embeddedTemplate: '{\"id\":1}'",
+	} {
+		filename := filepath.Join(dir, name+".yaml")
+		require.NoError(t, os.WriteFile(filename, []byte(content), 0644))
+		_, err := LoadMockConfig(filename)
+		require.Error(t, err, name)
+	}
+}
@@ -0,0 +1,461 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jrnd-io/jr/pkg/constants"
+	jrctx "github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/jrnd-io/jr/pkg/openapi"
+	"github.com/jrnd-io/jr/pkg/tpl"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const (
+	LatencyFixed       = "fixed"
+	LatencyUniform     = "uniform"
+	LatencyNormal      = "normal"
+	LatencyExponential = "exponential"
+)
+
+// reservedPaths are the paths of the server that mock routes can't use
+var reservedPaths = []string{"/emitters", "/executeTemplate", "/loadLastStatus", "/functionsList", "/metrics", "/healthz", "/readyz"}
+
+// MockRoute maps a method and a path pattern, like /users/{id}, to a template.
+// Templates get a MockRequest, with the path and query parameters of the request.
+type MockRoute struct {
+	Method           string            `mapstructure:"method"`
+	Path             string            `mapstructure:"path"`
+	Template         string            `mapstructure:"template"`
+	EmbeddedTemplate string            `mapstructure:"embeddedTemplate"`
+	Locale           string            `mapstructure:"locale"`
+	Status           int               `mapstructure:"status"`
+	ContentType      string            `mapstructure:"contentType"`
+	Headers          map[string]string `mapstructure:"headers"`
+	Latency          MockLatency       `mapstructure:"latency"`
+	ErrorRate        float64           `mapstructure:"errorRate"`
+	ErrorStatus      int               `mapstructure:"errorStatus"`
+	ErrorBody        string            `mapstructure:"errorBody"`
+	// Seed is a template: responses with the same seed, like {{.Params.id}}, are always the same
+	Seed       string          `mapstructure:"seed"`
+	Pagination *MockPagination `mapstructure:"pagination"`
+
+	valueTpl tpl.Tpl
+	seedTpl  *tpl.Tpl
+	// requestSchema validates the request bodies of the routes of OpenAPI operations
+	requestSchema *openapi.Schema
+	bodyRequired  bool
+}
+
+// MockLatency is the distribution of the latency of a route
+type MockLatency struct {
+	Distribution string        `mapstructure:"distribution"`
+	Min          time.Duration `mapstructure:"min"`
+	Max          time.Duration `mapstructure:"max"`
+	Mean         time.Duration `mapstructure:"mean"`
+	StdDev       time.Duration `mapstructure:"stddev"`
+}
+
+// MockPagination renders the template once per item of the requested page, in an envelope
+type MockPagination struct {
+	Total     int    `mapstructure:"total"`
+	Size      int    `mapstructure:"size"`
+	MaxSize   int    `mapstructure:"maxSize"`
+	PageParam string `mapstructure:"pageParam"`
+	SizeParam string `mapstructure:"sizeParam"`
+	Envelope  string `mapstructure:"envelope"`
+}
+
+// MockRequest is the context of the templates of the mock routes.
+// Index is the position of the item in paginated routes, from 0.
+type MockRequest struct {
+	Method  string
+	Path    string
+	Params  map[string]string
+	Query   map[string]string
+	Headers map[string]string
+	Index   int
+	Page    int
+	Size    int
+}
+
+// mockRandom reseeds the template functions after a seeded response
+var mockRandom = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// MockConfig is the content of a route file: stateless routes and stateful collections
+type MockConfig struct {
+	Routes      []*MockRoute      `mapstructure:"routes"`
+	Collections []*MockCollection `mapstructure:"collections"`
+}
+
+// LoadMockConfig reads a JSON or YAML route file, compiles its templates and seeds its collections
+func LoadMockConfig(filename string) (*MockConfig, error) {
+	v := viper.New()
+	v.SetConfigFile(filename)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	var config MockConfig
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, err
+	}
+	if len(config.Routes) == 0 && len(config.Collections) == 0 {
+		return nil, fmt.Errorf("no routes or collections in %s", filename)
+	}
+	for _, r := range config.Routes {
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("route %s %s: %w", r.Method, r.Path, err)
+		}
+	}
+	for _, c := range config.Collections {
+		if err := c.init(); err != nil {
+			return nil, fmt.Errorf("collection %s: %w", c.Name, err)
+		}
+		for _, r := range config.Routes {
+			if r.Path == c.Path || strings.HasPrefix(r.Path, c.Path+"/") {
+				return nil, fmt.Errorf("route %s %s: path is used by collection %s", r.Method, r.Path, c.Name)
+			}
+		}
+	}
+	return &config, nil
+}
+
+// compile validates a route, sets its defaults and parses its templates
+func (r *MockRoute) compile() error {
+	r.Method = strings.ToUpper(r.Method)
+	if r.Method == "" {
+		r.Method = http.MethodGet
+	}
+	if !strings.HasPrefix(r.Path, "/") {
+		return fmt.Errorf("path must start with /")
+	}
+	if isReservedPath(r.Path) {
+		return fmt.Errorf("path is reserved by the server")
+	}
+	if r.Status == 0 {
+		r.Status = http.StatusOK
+	}
+	if r.ContentType == "" {
+		r.ContentType = "application/json"
+	}
+	if r.Locale == "" {
+		r.Locale = constants.LOCALE
+	}
+	if r.ErrorRate < 0 || r.ErrorRate > 1 {
+		return fmt.Errorf("errorRate must be between 0 and 1")
+	}
+	if r.ErrorStatus == 0 {
+		r.ErrorStatus = http.StatusInternalServerError
+	}
+	if r.ErrorBody == "" {
+		r.ErrorBody = fmt.Sprintf(`{"error":"%s"}`, http.StatusText(r.ErrorStatus))
+	}
+	switch r.Latency.Distribution {
+	case "", LatencyFixed, LatencyNormal, LatencyExponential:
+	case LatencyUniform:
+		if r.Latency.Max < r.Latency.Min {
+			return fmt.Errorf("latency max is less than min")
+		}
+	default:
+		return fmt.Errorf("unknown latency distribution %s", r.Latency.Distribution)
+	}
+	if p := r.Pagination; p != nil {
+		if p.Total <= 0 {
+			p.Total = 100
+		}
+		if p.Size <= 0 {
+			p.Size = 20
+		}
+		if p.MaxSize <= 0 {
+			p.MaxSize = 100
+		}
+		if p.PageParam == "" {
+			p.PageParam = "page"
+		}
+		if p.SizeParam == "" {
+			p.SizeParam = "size"
+		}
+		if p.Envelope == "" {
+			p.Envelope = "data"
+		}
+	}
+
+	var err error
+	if r.valueTpl, err = mockTemplate(r.Template, r.EmbeddedTemplate); err != nil {
+		return err
+	}
+	if r.Seed != "" {
+		seedTpl, err := tpl.NewTpl("seed", r.Seed, functions.FunctionsMap(), nil)
+		if err != nil {
+			return err
+		}
+		seedTpl.Template.Option("missingkey=zero")
+		r.seedTpl = &seedTpl
+	}
+	return nil
+}
+
+// isReservedPath tells if a path is used by the server
+func isReservedPath(path string) bool {
+	for _, reserved := range reservedPaths {
+		if path == "/" || path == reserved || strings.HasPrefix(path, reserved+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// mockTemplate parses an embedded template or, if empty, the named template.
+// Without both, responses have no body.
+func mockTemplate(name string, embedded string) (tpl.Tpl, error) {
+	template := embedded
+	if template == "" && name != "" {
+		path := os.ExpandEnv(fmt.Sprintf("%s/%s/%s.tpl", constants.JR_SYSTEM_DIR, "templates", name))
+		t, err := os.ReadFile(path)
+		if err != nil {
+			return tpl.Tpl{}, fmt.Errorf("template %s not found: %w", name, err)
+		}
+		template = string(t)
+	}
+	valueTpl, err := tpl.NewTpl("value", template, functions.FunctionsMap(), nil)
+	if err != nil {
+		return tpl.Tpl{}, err
+	}
+	// missing parameters are empty strings
+	valueTpl.Template.Option("missingkey=zero")
+	return valueTpl, nil
+}
+
+// registerMockRoutes adds the mock routes to the router
+func registerMockRoutes(router chi.Router, routes []*MockRoute) {
+	for _, r := range routes {
+		router.Method(r.Method, r.Path, r)
+		log.Info().Str("method", r.Method).Str("path", r.Path).Msg("Mock route")
+	}
+}
+
+func (r *MockRoute) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.requestSchema != nil || r.bodyRequired {
+		if err := r.validateBody(req); err != nil {
+			var invalid *openapi.ValidationError
+			if errors.As(err, &invalid) {
+				writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid request body", "details": invalid.Errors})
+				return
+			}
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	mr := newMockRequest(req)
+
+	renderLock.Lock()
+	latency := r.latency()
+	failed := r.ErrorRate > 0 && functions.Random.Float64() < r.ErrorRate
+	var body []byte
+	var err error
+	if !failed {
+		jrctx.JrContext.Locale = r.Locale
+		if r.Pagination != nil {
+			body, err = r.renderPage(w, mr)
+		} else {
+			body, err = r.render(mr)
+		}
+	}
+	renderLock.Unlock()
+
+	select {
+	case <-time.After(latency):
+	case <-req.Context().Done():
+		return
+	}
+
+	if failed {
+		w.Header().Set("Content-Type", r.ContentType)
+		w.WriteHeader(r.ErrorStatus)
+		_, _ = w.Write([]byte(r.ErrorBody))
+		return
+	}
+	var badRequest *badRequestError
+	if errors.As(err, &badRequest) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("path", r.Path).Msg("Error rendering mock response")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", r.ContentType)
+	for k, v := range r.Headers {
+		w.Header().Set(k, v)
+	}
+	w.WriteHeader(r.Status)
+	if _, err = w.Write(body); err != nil {
+		log.Error().Err(err).Msg("Error writing response")
+	}
+}
+
+// validateBody validates the JSON body of a request with the request schema of the route
+func (r *MockRoute) validateBody(req *http.Request) error {
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(b)) == 0 {
+		if r.bodyRequired {
+			return fmt.Errorf("request body is required")
+		}
+		return nil
+	}
+	var body any
+	if err = json.Unmarshal(b, &body); err != nil {
+		return fmt.Errorf("request body is not valid JSON: %w", err)
+	}
+	return r.requestSchema.Validate(body)
+}
+
+// render renders the template of the route, seeding the random generator if the route has a seed
+func (r *MockRoute) render(mr MockRequest) ([]byte, error) {
+	jrctx.JrContext.CurrentIterationLoopIndex++
+	var b bytes.Buffer
+	if r.seedTpl != nil {
+		if err := r.seedTpl.Template.Execute(&b, mr); err != nil {
+			return nil, err
+		}
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(r.Method + " " + r.Path + " " + b.String()))
+		functions.SetSeed(int64(h.Sum64()))
+		defer functions.SetSeed(mockRandom.Int63())
+		b.Reset()
+	}
+	if err := r.valueTpl.Template.Execute(&b, mr); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// renderPage renders the items of the requested page in the pagination envelope
+func (r *MockRoute) renderPage(w http.ResponseWriter, mr MockRequest) ([]byte, error) {
+	p := r.Pagination
+	page, err := positiveInt(mr.Query[p.PageParam], 1)
+	if err != nil {
+		return nil, &badRequestError{fmt.Errorf("invalid %s: %w", p.PageParam, err)}
+	}
+	size, err := positiveInt(mr.Query[p.SizeParam], p.Size)
+	if err != nil {
+		return nil, &badRequestError{fmt.Errorf("invalid %s: %w", p.SizeParam, err)}
+	}
+	size = min(size, p.MaxSize)
+	mr.Page, mr.Size = page, size
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `{"%s":[`, p.Envelope)
+	for i := (page - 1) * size; i < min(page*size, p.Total); i++ {
+		mr.Index = i
+		item, err := r.render(mr)
+		if err != nil {
+			return nil, err
+		}
+		if i > (page-1)*size {
+			b.WriteByte(',')
+		}
+		b.Write(bytes.TrimSpace(item))
+	}
+	pages := int(math.Ceil(float64(p.Total) / float64(size)))
+	fmt.Fprintf(&b, `],"page":%d,"size":%d,"total":%d,"pages":%d}`, page, size, p.Total, pages)
+	w.Header().Set("X-Total-Count", strconv.Itoa(p.Total))
+	return b.Bytes(), nil
+}
+
+// latency returns a random latency with the distribution of the route
+func (r *MockRoute) latency() time.Duration {
+	l := r.Latency
+	var d time.Duration
+	switch l.Distribution {
+	case LatencyUniform:
+		d = l.Min + time.Duration(functions.Random.Int63n(int64(l.Max-l.Min)+1))
+	case LatencyNormal:
+		d = l.Mean + time.Duration(functions.Random.NormFloat64()*float64(l.StdDev))
+	case LatencyExponential:
+		d = time.Duration(functions.Random.ExpFloat64() * float64(l.Mean))
+	default:
+		d = l.Mean
+	}
+	return max(d, 0)
+}
+
+func newMockRequest(req *http.Request) MockRequest {
+	mr := MockRequest{
+		Method:  req.Method,
+		Path:    req.URL.Path,
+		Params:  map[string]string{},
+		Query:   map[string]string{},
+		Headers: map[string]string{},
+	}
+	if rctx := chi.RouteContext(req.Context()); rctx != nil {
+		for i, k := range rctx.URLParams.Keys {
+			mr.Params[k] = rctx.URLParams.Values[i]
+		}
+	}
+	for k, v := range req.URL.Query() {
+		mr.Query[k] = v[0]
+	}
+	for k, v := range req.Header {
+		mr.Headers[k] = v[0]
+	}
+	return mr
+}
+
+// badRequestError is an error in the parameters of a request
+type badRequestError struct {
+	error
+}
+
+func positiveInt(s string, defaultValue int) (int, error) {
+	if s == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("%d is not positive", n)
+	}
+	return n, nil
+}
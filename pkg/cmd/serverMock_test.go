@@ -0,0 +1,190 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+const mockRoutes = `
+routes:
+  - path: /users/{id}
+    embeddedTemplate: '{"id":"{{.Params.id}}","name":"{{name}}","uuid":"{{uuid}}","verbose":"{{.Query.verbose}}"}'
+    seed: '{{.Params.id}}'
+    headers:
+      X-Mock: jr
+  - path: /users
+    embeddedTemplate: '{"index":{{.Index}},"name":"{{name}}"}'
+    seed: '{{.Index}}'
+    pagination:
+      total: 45
+      size: 10
+  - method: post
+    path: /orders
+    embeddedTemplate: '{"id":"{{uuid}}"}'
+    status: 201
+  - path: /broken
+    embeddedTemplate: '{}'
+    errorRate: 1
+    errorStatus: 503
+  - path: /slow
+    embeddedTemplate: '{}'
+    latency:
+      distribution: uniform
+      min: 100ms
+      max: 150ms
+`
+
+// mockServer serves the routes of a route file
+func mockRouter(t *testing.T, content string) chi.Router {
+	filename := filepath.Join(t.TempDir(), "routes.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0644))
+	mocks, err := LoadMockConfig(filename)
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	registerMockRoutes(router, mocks.Routes)
+	registerCollections(router, mocks.Collections)
+	return router
+}
+
+func mockServer(t *testing.T, content string) *httptest.Server {
+	s := httptest.NewServer(mockRouter(t, content))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func getJSON(t *testing.T, url string, v any) *http.Response {
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if v != nil {
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, v), string(body))
+	}
+	return resp
+}
+
+func TestMockRouteParams(t *testing.T) {
+	s := mockServer(t, mockRoutes)
+
+	var first, second, other map[string]string
+	resp := getJSON(t, s.URL+"/users/42?verbose=true", &first)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	require.Equal(t, "jr", resp.Header.Get("X-Mock"))
+	require.Equal(t, "42", first["id"])
+	require.Equal(t, "true", first["verbose"])
+
+	// the same id gets the same response
+	getJSON(t, s.URL+"/users/42", &second)
+	getJSON(t, s.URL+"/users/43", &other)
+	require.Equal(t, first["uuid"], second["uuid"])
+	require.Equal(t, first["name"], second["name"])
+	require.Empty(t, second["verbose"])
+	require.NotEqual(t, first["uuid"], other["uuid"])
+}
+
+func TestMockRoutePagination(t *testing.T) {
+	s := mockServer(t, mockRoutes)
+
+	type page struct {
+		Data []struct {
+			Index int
+			Name  string
+		}
+		Page, Size, Total, Pages int
+	}
+	var p page
+	resp := getJSON(t, s.URL+"/users?page=5", &p)
+	require.Equal(t, "45", resp.Header.Get("X-Total-Count"))
+	require.Equal(t, 5, p.Page)
+	require.Equal(t, 10, p.Size)
+	require.Equal(t, 5, p.Pages)
+	require.Len(t, p.Data, 5)
+	require.Equal(t, 40, p.Data[0].Index)
+
+	var small, again page
+	getJSON(t, s.URL+"/users?page=2&size=20", &small)
+	getJSON(t, s.URL+"/users?page=4&size=10", &again)
+	require.Len(t, small.Data, 20)
+	require.Equal(t, 3, small.Pages)
+	// items are stable across page sizes
+	require.Equal(t, small.Data[10], again.Data[0])
+
+	var empty page
+	getJSON(t, s.URL+"/users?page=9", &empty)
+	require.Empty(t, empty.Data)
+
+	resp = getJSON(t, s.URL+"/users?page=zero", nil)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestMockRouteStatusAndErrors(t *testing.T) {
+	s := mockServer(t, mockRoutes)
+
+	resp, err := http.Post(s.URL+"/orders", "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp = getJSON(t, s.URL+"/orders", nil)
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	var body map[string]string
+	resp = getJSON(t, s.URL+"/broken", &body)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Equal(t, "Service Unavailable", body["error"])
+
+	start := time.Now()
+	getJSON(t, s.URL+"/slow", nil)
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestMockRouteValidation(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"empty":    "routes: []",
+		"reserved": "routes:\n  - path: /emitters/x\n    embeddedTemplate: '{}'",
+		"relative": "routes:\n  - path: users\n    embeddedTemplate: '{}'",
+		"template": "routes:\n  - path: /x\n    template: does_not_exist",
+		"parse":    "routes:\n  - path: /x\n    embeddedTemplate: '{{'",
+		"latency":  "routes:\n  - path: /x\n    embeddedTemplate: '{}'\n    latency:\n      distribution: pareto",
+		"rate":     "routes:\n  - path: /x\n    embeddedTemplate: '{}'\n    errorRate: 2",
+	} {
+		filename := filepath.Join(dir, name+".yaml")
+		require.NoError(t, os.WriteFile(filename, []byte(content), 0644))
+		_, err := LoadMockConfig(filename)
+		require.Error(t, err, name)
+	}
+}
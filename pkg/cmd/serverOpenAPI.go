@@ -0,0 +1,154 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jrnd-io/jr/pkg/openapi"
+	"github.com/rs/zerolog/log"
+)
+
+// AddOpenAPI adds a mock route for every operation of an OpenAPI document, answering with the schema of
+// its success response and validating its request body. Routes of the route file and collections take precedence.
+func (c *MockConfig) AddOpenAPI(d *openapi.Document) error {
+	paths := make([]string, 0, len(d.Paths))
+	for path := range d.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var routes []*MockRoute
+	for _, path := range paths {
+		item := d.Paths[path]
+		if item == nil {
+			continue
+		}
+		operations := item.Operations()
+		for _, method := range openapi.Methods {
+			o, ok := operations[method]
+			if !ok {
+				continue
+			}
+			r, err := openAPIRoute(d.BasePath()+path, strings.ToUpper(method), o, item.Parameters)
+			if err != nil {
+				return fmt.Errorf("%s %s: %w", strings.ToUpper(method), path, err)
+			}
+			if isReservedPath(r.Path) || c.overrides(r) {
+				log.Warn().Str("method", r.Method).Str("path", r.Path).Msg("Skipping OpenAPI operation")
+				continue
+			}
+			if err = r.compile(); err != nil {
+				return fmt.Errorf("%s %s: %w", r.Method, r.Path, err)
+			}
+			routes = append(routes, r)
+		}
+	}
+	c.Routes = append(routes, c.Routes...)
+	return nil
+}
+
+// overrides tells if a route or a collection of the configuration serves the path of r
+func (c *MockConfig) overrides(r *MockRoute) bool {
+	for _, route := range c.Routes {
+		if route.Method == r.Method && route.Path == r.Path {
+			return true
+		}
+	}
+	for _, collection := range c.Collections {
+		if r.Path == collection.Path || strings.HasPrefix(r.Path, collection.Path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// openAPIRoute returns the route of an operation. Responses with the same path parameters are the same,
+// and response properties named as path parameters have their values.
+func openAPIRoute(path string, method string, o *openapi.Operation, parameters []*openapi.Parameter) (*MockRoute, error) {
+	r := &MockRoute{Method: method, Path: path, Status: http.StatusOK}
+
+	var seed []string
+	pathParameters := make(map[string]*openapi.Schema)
+	for _, p := range append(parameters, o.Parameters...) {
+		if p.In == "path" {
+			pathParameters[p.Name] = p.Schema
+			seed = append(seed, fmt.Sprintf("{{index .Params %q}}", p.Name))
+		}
+	}
+	r.Seed = strings.Join(seed, " ")
+
+	code, response := successResponse(o.Responses)
+	if code != "" {
+		status, err := strconv.Atoi(strings.ReplaceAll(strings.ToUpper(code), "X", "0"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid response code %s", code)
+		}
+		r.Status = status
+	}
+	if response != nil {
+		if m, ok := openapi.JSONSchema(response.Content); ok {
+			switch {
+			case m.Schema != nil:
+				values := make(map[string]string)
+				for name := range pathParameters {
+					if p, ok := m.Schema.Property(name); ok {
+						if p.Type.Is("string") {
+							values[name] = fmt.Sprintf(`"{{json_escape (index .Params %q)}}"`, name)
+						} else {
+							values[name] = fmt.Sprintf("{{index .Params %q}}", name)
+						}
+					}
+				}
+				r.EmbeddedTemplate = openapi.Template(m.Schema, values)
+			case m.Example != nil:
+				r.EmbeddedTemplate = openapi.Template(&openapi.Schema{Example: m.Example}, nil)
+			}
+		}
+	}
+
+	if rb := o.RequestBody; rb != nil {
+		r.bodyRequired = rb.Required
+		if m, ok := openapi.JSONSchema(rb.Content); ok {
+			r.requestSchema = m.Schema
+		}
+	}
+	return r, nil
+}
+
+// successResponse returns the response with the lowest 2xx code, or the default response
+func successResponse(responses map[string]*openapi.Response) (string, *openapi.Response) {
+	codes := make([]string, 0, len(responses))
+	for code := range responses {
+		if strings.HasPrefix(code, "2") {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		return "", responses["default"]
+	}
+	sort.Strings(codes)
+	return codes[0], responses[codes[0]]
+}
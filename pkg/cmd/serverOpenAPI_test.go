@@ -0,0 +1,141 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jrnd-io/jr/pkg/openapi"
+	"github.com/stretchr/testify/require"
+)
+
+func openAPIServer(t *testing.T, config *MockConfig) *httptest.Server {
+	document, err := openapi.Load("../../testfiles/petstore.yaml")
+	require.NoError(t, err)
+	require.NoError(t, config.AddOpenAPI(document))
+
+	router := chi.NewRouter()
+	registerMockRoutes(router, config.Routes)
+	registerCollections(router, config.Collections)
+	s := httptest.NewServer(router)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	s := openAPIServer(t, &MockConfig{})
+
+	var pet, same map[string]any
+	resp := getJSON(t, s.URL+"/v1/pets/42", &pet)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.EqualValues(t, 42, pet["petId"])
+	require.Contains(t, []any{"dog", "cat", "parrot"}, pet["species"])
+	require.Regexp(t, `^[A-Z]{2}-[0-9]{4}$`, pet["tag"])
+	getJSON(t, s.URL+"/v1/pets/42", &same)
+	require.Equal(t, pet, same)
+
+	var pets []map[string]any
+	getJSON(t, s.URL+"/v1/pets", &pets)
+	require.NotEmpty(t, pets)
+	require.LessOrEqual(t, len(pets), 5)
+
+	resp = sendJSON(t, http.MethodPost, s.URL+"/v1/pets", `{"name":"Rex","species":"dog","weight":12}`, &pet)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var invalid struct {
+		Error   string   `json:"error"`
+		Details []string `json:"details"`
+	}
+	resp = sendJSON(t, http.MethodPost, s.URL+"/v1/pets", `{"name":"Rex","species":"cow","weight":0}`, &invalid)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Equal(t, "invalid request body", invalid.Error)
+	require.ElementsMatch(t, []string{`body.species: must be one of ["dog","cat","parrot"]`, "body.weight: must be greater than 0"}, invalid.Details)
+
+	resp = sendJSON(t, http.MethodPost, s.URL+"/v1/pets", "", nil)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = sendJSON(t, http.MethodPost, s.URL+"/v1/pets", "{", nil)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = sendJSON(t, http.MethodDelete, s.URL+"/v1/pets/42", "", nil)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestOpenAPIRoutesPrecedence(t *testing.T) {
+	route := &MockRoute{Method: http.MethodGet, Path: "/v1/pets/{petId}", EmbeddedTemplate: `{"petId":"mine"}`}
+	require.NoError(t, route.compile())
+	collection := &MockCollection{Name: "pets", Path: "/v1/pets", EmbeddedTemplate: `{}`}
+	require.NoError(t, collection.init())
+
+	config := &MockConfig{Routes: []*MockRoute{route}}
+	openAPIServer(t, config)
+	require.Len(t, config.Routes, 4)
+	require.Same(t, route, config.Routes[3])
+
+	config = &MockConfig{Collections: []*MockCollection{collection}}
+	openAPIServer(t, config)
+	require.Empty(t, config.Routes)
+}
+
+func TestOpenAPIRoutesParameterNames(t *testing.T) {
+	document, err := openapi.Parse([]byte(`
+openapi: 3.0.3
+info:
+  title: Owners
+  version: 1.0.0
+paths:
+  /owners/{owner-id}:
+    get:
+      parameters:
+        - name: owner-id
+          in: path
+          required: true
+          schema:
+            type: string
+      responses:
+        "200":
+          description: The owner
+          content:
+            application/json:
+              schema:
+                type: object
+                properties:
+                  owner-id:
+                    type: string
+                  name:
+                    type: string
+`))
+	require.NoError(t, err)
+	config := &MockConfig{}
+	require.NoError(t, config.AddOpenAPI(document))
+
+	router := chi.NewRouter()
+	registerMockRoutes(router, config.Routes)
+	s := httptest.NewServer(router)
+	t.Cleanup(s.Close)
+
+	var owner map[string]any
+	resp := getJSON(t, s.URL+"/owners/ab-12", &owner)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "ab-12", owner["owner-id"])
+}
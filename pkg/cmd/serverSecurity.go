@@ -0,0 +1,328 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/jrnd-io/jr/pkg/emitter"
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+)
+
+// Environment variables with the secrets of jr server
+const (
+	ServerTokensEnv        = "JR_SERVER_TOKENS"
+	ServerUsersEnv         = "JR_SERVER_USERS"
+	ServerSessionSecretEnv = "JR_SERVER_SESSION_SECRET"
+)
+
+// Authentication modes of jr server
+const (
+	AuthNone   = "none"
+	AuthBearer = "bearer"
+	AuthBasic  = "basic"
+	AuthMTLS   = "mtls"
+)
+
+const clientKey serverKey = "client"
+
+// serverAuth authenticates the clients of jr server, and names them for logs and rate limits
+type serverAuth struct {
+	mode string
+	// tokens maps bearer tokens to client names
+	tokens map[string]string
+	// users maps users to passwords
+	users map[string]string
+}
+
+// newServerAuth reads the credentials of the authentication mode from the environment.
+// Tokens are a comma separated list of name=token or token, users a list of user:password.
+func newServerAuth(mode string) (*serverAuth, error) {
+	a := &serverAuth{mode: mode, tokens: map[string]string{}, users: map[string]string{}}
+	switch mode {
+	case "", AuthNone, AuthMTLS:
+	case AuthBearer:
+		for i, t := range splitList(os.Getenv(ServerTokensEnv)) {
+			name, token, found := strings.Cut(t, "=")
+			if !found {
+				name, token = fmt.Sprintf("token-%d", i+1), t
+			}
+			a.tokens[token] = name
+		}
+		if len(a.tokens) == 0 {
+			return nil, fmt.Errorf("bearer authentication without tokens in %s", ServerTokensEnv)
+		}
+	case AuthBasic:
+		for _, u := range splitList(os.Getenv(ServerUsersEnv)) {
+			user, password, found := strings.Cut(u, ":")
+			if !found || user == "" || password == "" {
+				return nil, fmt.Errorf("invalid user in %s, must be user:password", ServerUsersEnv)
+			}
+			a.users[user] = password
+		}
+		if len(a.users) == 0 {
+			return nil, fmt.Errorf("basic authentication without users in %s", ServerUsersEnv)
+		}
+	default:
+		return nil, fmt.Errorf("unknown authentication %s", mode)
+	}
+	return a, nil
+}
+
+// middleware rejects unauthenticated requests and adds the client name to the request context
+func (a *serverAuth) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, ok := a.authenticate(r)
+		if !ok {
+			switch a.mode {
+			case AuthBearer:
+				w.Header().Set("WWW-Authenticate", `Bearer realm="jr"`)
+			case AuthBasic:
+				w.Header().Set("WWW-Authenticate", `Basic realm="jr"`)
+			}
+			writeError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+			return
+		}
+		if client != "" {
+			r = r.WithContext(context.WithValue(r.Context(), clientKey, client))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *serverAuth) authenticate(r *http.Request) (string, bool) {
+	switch a.mode {
+	case AuthBearer:
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found {
+			return "", false
+		}
+		for t, name := range a.tokens {
+			if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+				return name, true
+			}
+		}
+		return "", false
+	case AuthBasic:
+		user, password, ok := r.BasicAuth()
+		if !ok {
+			return "", false
+		}
+		expected, exists := a.users[user]
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(password)) != 1 || !exists {
+			return "", false
+		}
+		return user, true
+	case AuthMTLS:
+		// the TLS handshake verified the certificate
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			return "", false
+		}
+		return r.TLS.PeerCertificates[0].Subject.CommonName, true
+	}
+	return "", true
+}
+
+// serverTLSConfig returns the TLS configuration of jr server, requiring client certificates signed by clientCA if set
+func serverTLSConfig(clientCA string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCA == "" {
+		return config, nil
+	}
+	pem, err := os.ReadFile(clientCA)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in %s", clientCA)
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	return config, nil
+}
+
+// corsMiddleware allows browsers on origins to call jr server, answering preflight requests
+func corsMiddleware(origins []string) func(http.Handler) http.Handler {
+	anyOrigin := slices.Contains(origins, "*")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" || !anyOrigin && !slices.Contains(origins, origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Origin")
+			if anyOrigin {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			w.Header().Set("Access-Control-Expose-Headers", "Location, X-Total-Count, Retry-After")
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+				w.Header().Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimiter limits the requests per second of every client, named by authentication or by IP address
+type rateLimiter struct {
+	limit     rate.Limit
+	burst     int
+	lock      sync.Mutex
+	clients   map[string]*clientLimiter
+	lastPrune time.Time
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// limiterIdle is the time after which the limiters of idle clients are removed
+const limiterIdle = 10 * time.Minute
+
+func newRateLimiter(limit float64, burst int) *rateLimiter {
+	if burst <= 0 {
+		burst = max(1, int(math.Ceil(limit)))
+	}
+	return &rateLimiter{limit: rate.Limit(limit), burst: burst, clients: make(map[string]*clientLimiter), lastPrune: time.Now()}
+}
+
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reservation := l.reserve(clientName(r))
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *rateLimiter) reserve(client string) *rate.Reservation {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	if now.Sub(l.lastPrune) > limiterIdle {
+		for name, c := range l.clients {
+			if now.Sub(c.lastSeen) > limiterIdle {
+				delete(l.clients, name)
+			}
+		}
+		l.lastPrune = now
+	}
+	c, exists := l.clients[client]
+	if !exists {
+		c = &clientLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[client] = c
+	}
+	c.lastSeen = now
+	return c.limiter.ReserveN(now, 1)
+}
+
+// clientName is the authenticated name of the client, or its IP address
+func clientName(r *http.Request) string {
+	if client, ok := r.Context().Value(clientKey).(string); ok {
+		return client
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// newSessionStore returns the cookie store of the sessions of the web UI, with the secret in the environment.
+// Without it, the secret is random and sessions don't survive restarts.
+func newSessionStore() *sessions.CookieStore {
+	secret := []byte(os.Getenv(ServerSessionSecretEnv))
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatal().Err(err).Msg("Error generating session secret")
+		}
+	}
+	store := sessions.NewCookieStore(secret)
+	store.Options.HttpOnly = true
+	store.Options.SameSite = http.SameSiteLaxMode
+	return store
+}
+
+// checkRemoteEmitter rejects emitters of remote callers using local files, or locales that are not installed
+func checkRemoteEmitter(e *emitter.Emitter) error {
+	switch {
+	case !functions.IsLocale(e.Locale):
+		return fmt.Errorf("locale %s is not installed", e.Locale)
+	case e.Csv != "" || len(e.CsvFiles) > 0:
+		return fmt.Errorf("csv files are not allowed")
+	case e.GeoJson != "" || len(e.GeoJsonFiles) > 0:
+		return fmt.Errorf("geojson files are not allowed")
+	case e.ValueSpec != "":
+		return fmt.Errorf("value specs are not allowed")
+	case e.Faults.Sidecar != "":
+		return fmt.Errorf("fault sidecar files are not allowed")
+	case strings.ContainsAny(e.ValueTemplate, `/\`) || strings.Contains(e.ValueTemplate, ".."):
+		return fmt.Errorf("template %s is not allowed", e.ValueTemplate)
+	}
+	for _, c := range e.Corpora {
+		if c.Path != "" || c.Chain != "" {
+			return fmt.Errorf("corpus files are not allowed")
+		}
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,280 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jrnd-io/jr/pkg/constants"
+	"github.com/jrnd-io/jr/pkg/emitter"
+	"github.com/stretchr/testify/require"
+)
+
+// whoami answers with the name of the client
+var whoami = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte(clientName(r)))
+})
+
+func request(t *testing.T, client *http.Client, req *http.Request) (int, string) {
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(b)
+}
+
+func TestServerAuthBearer(t *testing.T) {
+	t.Setenv(ServerTokensEnv, "ci=secret1, secret2")
+	auth, err := newServerAuth(AuthBearer)
+	require.NoError(t, err)
+	s := httptest.NewServer(auth.middleware(whoami))
+	defer s.Close()
+
+	for token, expected := range map[string]string{"secret1": "ci", "secret2": "token-2"} {
+		req, _ := http.NewRequest(http.MethodGet, s.URL, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		status, body := request(t, http.DefaultClient, req)
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, expected, body)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, s.URL, nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	status, _ := request(t, http.DefaultClient, req)
+	require.Equal(t, http.StatusUnauthorized, status)
+
+	resp, err := http.Get(s.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.Equal(t, `Bearer realm="jr"`, resp.Header.Get("WWW-Authenticate"))
+}
+
+func TestServerAuthBasic(t *testing.T) {
+	t.Setenv(ServerUsersEnv, "ada:lovelace,alan:turing")
+	auth, err := newServerAuth(AuthBasic)
+	require.NoError(t, err)
+	s := httptest.NewServer(auth.middleware(whoami))
+	defer s.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, s.URL, nil)
+	req.SetBasicAuth("alan", "turing")
+	status, body := request(t, http.DefaultClient, req)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "alan", body)
+
+	for _, credentials := range [][2]string{{"alan", "lovelace"}, {"grace", ""}, {"grace", "hopper"}} {
+		req.SetBasicAuth(credentials[0], credentials[1])
+		status, _ = request(t, http.DefaultClient, req)
+		require.Equal(t, http.StatusUnauthorized, status, credentials[0])
+	}
+}
+
+func TestServerAuthConfig(t *testing.T) {
+	t.Setenv(ServerTokensEnv, "")
+	t.Setenv(ServerUsersEnv, "nopassword")
+	for _, mode := range []string{AuthBearer, AuthBasic, "kerberos"} {
+		_, err := newServerAuth(mode)
+		require.Error(t, err, mode)
+	}
+}
+
+// writeCert writes a PEM certificate signed by parent, or self signed, and returns it with its key
+func writeCert(t *testing.T, dir string, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".pem"), pemBytes, 0644))
+	return cert, key, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestServerMTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey, _ := writeCert(t, dir, "ca", nil, nil)
+	_, _, clientCert := writeCert(t, dir, "tester", ca, caKey)
+	_, _, strangerCert := writeCert(t, dir, "stranger", nil, nil)
+
+	tlsConfig, err := serverTLSConfig(filepath.Join(dir, "ca.pem"))
+	require.NoError(t, err)
+	auth, err := newServerAuth(AuthMTLS)
+	require.NoError(t, err)
+	s := httptest.NewUnstartedServer(auth.middleware(whoami))
+	s.TLS = tlsConfig
+	s.StartTLS()
+	defer s.Close()
+
+	client := func(cert tls.Certificate) *http.Client {
+		c := s.Client()
+		transport := c.Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+		return &http.Client{Transport: transport}
+	}
+	req, _ := http.NewRequest(http.MethodGet, s.URL, nil)
+	status, body := request(t, client(clientCert), req)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "tester", body)
+
+	_, err = client(strangerCert).Get(s.URL)
+	require.Error(t, err)
+	_, err = s.Client().Get(s.URL)
+	require.Error(t, err)
+
+	_, err = serverTLSConfig(filepath.Join(dir, "missing.pem"))
+	require.Error(t, err)
+}
+
+func TestServerCORS(t *testing.T) {
+	s := httptest.NewServer(corsMiddleware([]string{"https://app.example.com"})(whoami))
+	defer s.Close()
+
+	req, _ := http.NewRequest(http.MethodOptions, s.URL, nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Equal(t, "https://app.example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "true", resp.Header.Get("Access-Control-Allow-Credentials"))
+	require.Contains(t, resp.Header.Get("Access-Control-Allow-Headers"), "Authorization")
+
+	req, _ = http.NewRequest(http.MethodGet, s.URL, nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+
+	s = httptest.NewServer(corsMiddleware([]string{"*"})(whoami))
+	defer s.Close()
+	req, _ = http.NewRequest(http.MethodGet, s.URL, nil)
+	req.Header.Set("Origin", "https://any.example.com")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+}
+
+func TestServerRateLimit(t *testing.T) {
+	t.Setenv(ServerTokensEnv, "a=token-a,b=token-b")
+	auth, err := newServerAuth(AuthBearer)
+	require.NoError(t, err)
+	s := httptest.NewServer(auth.middleware(newRateLimiter(0.5, 2).middleware(whoami)))
+	defer s.Close()
+
+	get := func(token string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, s.URL, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	require.Equal(t, http.StatusOK, get("token-a").StatusCode)
+	require.Equal(t, http.StatusOK, get("token-a").StatusCode)
+	resp := get("token-a")
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	require.Equal(t, "2", resp.Header.Get("Retry-After"))
+	require.Equal(t, http.StatusOK, get("token-b").StatusCode)
+}
+
+func TestServerSafeFunctions(t *testing.T) {
+	router := chi.NewRouter()
+	router.Use(SessionMiddleware)
+	router.Post("/executeTemplate", executeTemplate)
+	router.Post("/emitters", addEmitter)
+	s := httptest.NewServer(router)
+	defer s.Close()
+	defer func(previous []emitter.Emitter) { emitters = previous }(emitters)
+	defer func(dir string) { constants.JR_SYSTEM_DIR = dir }(constants.JR_SYSTEM_DIR)
+	constants.JR_SYSTEM_DIR = "../.."
+
+	execute := func(template string) (int, string) {
+		resp, err := http.PostForm(s.URL+"/executeTemplate", url.Values{"template": {template}})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+	status, body := execute(`{{add 40 2}}`)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "42", body)
+	status, body = execute(`{{fromcsv "NAME"}}`)
+	require.Equal(t, http.StatusInternalServerError, status)
+	require.Contains(t, body, `function "fromcsv" not defined`)
+	status, body = execute(`{{from "../../../../etc/passwd"}}`)
+	require.Equal(t, http.StatusInternalServerError, status)
+	require.Contains(t, body, "is not allowed")
+
+	for _, e := range []string{
+		`{"name":"a","csv":"/etc/passwd"}`,
+		`{"name":"a","valueTemplate":"../../secret"}`,
+		`{"name":"a","corpora":[{"name":"c","path":"/etc"}]}`,
+		`{"name":"a","valueTemplate":"user","locale":"../../../../etc"}`,
+		`{"name":"a","valueTemplate":"user","locale":"xx"}`,
+	} {
+		resp, err := http.Post(s.URL+"/emitters", "application/json", strings.NewReader(e))
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, e)
+	}
+	resp, err := http.Post(s.URL+"/emitters", "application/json", strings.NewReader(`{"name":"safe","valueTemplate":"user"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.True(t, emitters[len(emitters)-1].SafeFunctions)
+}
@@ -0,0 +1,308 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/jrnd-io/jr/pkg/configuration"
+	"github.com/jrnd-io/jr/pkg/emitter"
+	"github.com/jrnd-io/jr/pkg/producers/server"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	StreamSSE       = "sse"
+	StreamNDJSON    = "ndjson"
+	StreamWebSocket = "websocket"
+)
+
+// defaultStreamFrequency is used for emitters without a frequency
+const defaultStreamFrequency = time.Second
+
+// streamEmitters are the emitters initialized for streaming, by name, guarded by renderLock
+var streamEmitters = make(map[string][]emitter.Emitter)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// recordWriter writes the records of a stream to a client
+type recordWriter interface {
+	write(seq int, r server.Record) error
+	end() error
+}
+
+// streamEmitter streams the records of an emitter as Server-Sent Events, WebSocket messages or NDJSON.
+// The emitter frequency is used, unless the rate (records per second) is set, and the stream ends after
+// limit records, if set, or when the client disconnects.
+func streamEmitter(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "emitter")
+
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rate := 0.0
+	if q := r.URL.Query().Get("rate"); q != "" {
+		if rate, err = strconv.ParseFloat(q, 64); err != nil || rate <= 0 {
+			http.Error(w, fmt.Sprintf("invalid rate %s", q), http.StatusBadRequest)
+			return
+		}
+	}
+
+	es := initStreamEmitters(r.Context(), name)
+	if len(es) == 0 {
+		http.Error(w, fmt.Sprintf("emitter %s not found", name), http.StatusNotFound)
+		return
+	}
+	es = clientEmitters(es)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var rw recordWriter
+	switch streamFormat(r) {
+	case StreamWebSocket:
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Error().Err(err).Msg("Error upgrading to websocket")
+			return
+		}
+		defer conn.Close()
+		// the connection is read to handle the close and ping messages of the client
+		go func() {
+			defer cancel()
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+		rw = &wsWriter{conn: conn}
+	case StreamSSE:
+		rw = newFlushWriter(w, "text/event-stream")
+	default:
+		rw = newFlushWriter(w, "application/x-ndjson")
+	}
+
+	// streams last longer than the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Debug().Err(err).Msg("Error removing write deadline")
+	}
+
+	frequency := es[0].Frequency
+	if rate > 0 {
+		frequency = time.Duration(float64(time.Second) / rate)
+	}
+	if frequency <= 0 {
+		frequency = defaultStreamFrequency
+	}
+
+	log.Info().Str("emitter", name).Int("limit", limit).Dur("frequency", frequency).Msg("Stream started")
+	seq := 0
+	ticker := time.NewTicker(frequency)
+	defer ticker.Stop()
+	for {
+		for _, record := range generateStream(ctx, es, rate > 0) {
+			if limit > 0 && seq >= limit {
+				break
+			}
+			seq++
+			if err := rw.write(seq, record); err != nil {
+				log.Debug().Err(err).Str("emitter", name).Msg("Stream closed by client")
+				return
+			}
+		}
+		if limit > 0 && seq >= limit {
+			if err := rw.end(); err != nil {
+				log.Debug().Err(err).Msg("Error ending stream")
+			}
+			log.Info().Str("emitter", name).Int("records", seq).Msg("Stream ended")
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Info().Str("emitter", name).Int("records", seq).Msg("Stream closed by client")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// initStreamEmitters initializes the emitters with a name once, with the stream output
+func initStreamEmitters(ctx context.Context, name string) []emitter.Emitter {
+	renderLock.Lock()
+	defer renderLock.Unlock()
+	if es, exists := streamEmitters[name]; exists {
+		return es
+	}
+	// emitters added to the server, or else the emitters of the configuration
+	var configured []emitter.Emitter
+	for _, e := range emitters {
+		if e.Name == name {
+			configured = append(configured, e)
+		}
+	}
+	if len(configured) == 0 {
+		configured = emitters2[name]
+	}
+
+	var es []emitter.Emitter
+	for _, e := range configured {
+		e.Output = "stream"
+		e.Initialize(ctx, configuration.GlobalCfg)
+		es = append(es, e)
+	}
+	if len(es) > 0 {
+		streamEmitters[name] = es
+	}
+	return es
+}
+
+// clientEmitters copies the stream emitters for a client, with csv formatters of their own,
+// so that every client gets the csv header
+func clientEmitters(es []emitter.Emitter) []emitter.Emitter {
+	copied := make([]emitter.Emitter, len(es))
+	for i, e := range es {
+		if e.Formatter != nil {
+			e.Formatter = e.Formatter.Clone()
+		}
+		copied[i] = e
+	}
+	return copied
+}
+
+// generateStream generates the records of a tick: one per emitter with a rate, Num per emitter otherwise
+func generateStream(ctx context.Context, es []emitter.Emitter, perRecord bool) []server.Record {
+	renderLock.Lock()
+	defer renderLock.Unlock()
+	var records []server.Record
+	for _, e := range es {
+		num := e.Num
+		if perRecord || num <= 0 {
+			num = 1
+		}
+		e.Run(ctx, num, &records)
+	}
+	return records
+}
+
+// streamFormat returns the format of a stream, from the websocket upgrade, the format parameter or the Accept header
+func streamFormat(r *http.Request) string {
+	if websocket.IsWebSocketUpgrade(r) {
+		return StreamWebSocket
+	}
+	switch r.URL.Query().Get("format") {
+	case StreamSSE:
+		return StreamSSE
+	case StreamNDJSON:
+		return StreamNDJSON
+	}
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return StreamSSE
+	}
+	return StreamNDJSON
+}
+
+func queryInt(r *http.Request, name string) (int, error) {
+	q := r.URL.Query().Get(name)
+	if q == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(q)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %s", name, q)
+	}
+	return n, nil
+}
+
+// oneLine returns a value on a single line, compacting JSON values
+func oneLine(value []byte) []byte {
+	var b bytes.Buffer
+	if json.Compact(&b, value) == nil {
+		return b.Bytes()
+	}
+	return bytes.ReplaceAll(bytes.ReplaceAll(value, []byte("\r"), nil), []byte("\n"), nil)
+}
+
+// flushWriter writes Server-Sent Events or NDJSON lines, flushing every record
+type flushWriter struct {
+	w   http.ResponseWriter
+	rc  *http.ResponseController
+	sse bool
+}
+
+func newFlushWriter(w http.ResponseWriter, contentType string) *flushWriter {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	return &flushWriter{w: w, rc: http.NewResponseController(w), sse: contentType == "text/event-stream"}
+}
+
+func (f *flushWriter) write(seq int, r server.Record) error {
+	var err error
+	if f.sse {
+		_, err = fmt.Fprintf(f.w, "id: %d\ndata: %s\n\n", seq, oneLine(r.Value))
+	} else {
+		_, err = fmt.Fprintf(f.w, "%s\n", oneLine(r.Value))
+	}
+	if err != nil {
+		return err
+	}
+	return f.rc.Flush()
+}
+
+// end tells SSE clients that the stream is over, so that they don't reconnect
+func (f *flushWriter) end() error {
+	if !f.sse {
+		return nil
+	}
+	if _, err := fmt.Fprint(f.w, "event: end\ndata: \n\n"); err != nil {
+		return err
+	}
+	return f.rc.Flush()
+}
+
+type wsWriter struct {
+	conn *websocket.Conn
+}
+
+func (ws *wsWriter) write(_ int, r server.Record) error {
+	return ws.conn.WriteMessage(websocket.TextMessage, r.Value)
+}
+
+func (ws *wsWriter) end() error {
+	return ws.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "limit reached"), time.Now().Add(time.Second))
+}
@@ -0,0 +1,264 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/jrnd-io/jr/pkg/constants"
+	jrctx "github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/jrnd-io/jr/pkg/emitter"
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/jrnd-io/jr/pkg/producers/server"
+	"github.com/stretchr/testify/require"
+)
+
+// streamServer serves the stream endpoint of an emitter with a counter template
+func streamServer(t *testing.T) *httptest.Server {
+	previous, previousStreams := emitters, streamEmitters
+	t.Cleanup(func() {
+		emitters, streamEmitters = previous, previousStreams
+	})
+	emitters = []emitter.Emitter{{
+		Name:             "counter",
+		Locale:           "us",
+		Num:              2,
+		Frequency:        10 * time.Millisecond,
+		KeyTemplate:      "null",
+		OutputTemplate:   "{{.V}}",
+		EmbeddedTemplate: "{\n  \"n\": {{counter \"stream\" 1 1}}\n}",
+	}}
+	streamEmitters = make(map[string][]emitter.Emitter)
+
+	router := chi.NewRouter()
+	router.Get("/emitters/{emitter}/stream", streamEmitter)
+	s := httptest.NewServer(router)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestStreamNDJSON(t *testing.T) {
+	s := streamServer(t)
+	resp, err := http.Get(s.URL + "/emitters/counter/stream?limit=5")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	var lines []map[string]int
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var v map[string]int
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &v))
+		lines = append(lines, v)
+	}
+	require.Len(t, lines, 5)
+	for i := 1; i < len(lines); i++ {
+		require.Equal(t, lines[i-1]["n"]+1, lines[i]["n"])
+	}
+}
+
+func TestStreamSSE(t *testing.T) {
+	s := streamServer(t)
+	req, err := http.NewRequest(http.MethodGet, s.URL+"/emitters/counter/stream?limit=3&rate=100", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var ids, data []string
+	ended := false
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			ids = append(ids, strings.TrimPrefix(line, "id: "))
+		case line == "event: end":
+			ended = true
+		case strings.HasPrefix(line, "data: {"):
+			data = append(data, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	require.Equal(t, []string{"1", "2", "3"}, ids)
+	require.Len(t, data, 3)
+	require.True(t, ended)
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	s := streamServer(t)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/emitters/counter/stream?limit=4", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	for i := 0; i < 4; i++ {
+		_, message, err := conn.ReadMessage()
+		require.NoError(t, err)
+		require.Contains(t, string(message), `"n"`)
+	}
+	_, _, err = conn.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), err)
+}
+
+func TestStreamDisconnect(t *testing.T) {
+	s := streamServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL+"/emitters/counter/stream", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(resp.Body)
+	_, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	cancel()
+	resp.Body.Close()
+
+	// the handler returns and the server can close without waiting for it
+	done := make(chan struct{})
+	go func() {
+		s.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream not closed after client disconnect")
+	}
+}
+
+func TestStreamCsvHeader(t *testing.T) {
+	s := streamServer(t)
+	emitters = append(emitters, emitter.Emitter{
+		Name:             "rows",
+		Num:              1,
+		Frequency:        10 * time.Millisecond,
+		KeyTemplate:      "null",
+		OutputTemplate:   "{{.V}}",
+		EmbeddedTemplate: `{"a":1,"b":"x"}`,
+		OutputFormat:     "csv",
+		CsvHeader:        emitter.CsvHeaderOnce,
+	})
+
+	// every client gets the header
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(s.URL + "/emitters/rows/stream?limit=2")
+		require.NoError(t, err)
+		var lines []string
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		resp.Body.Close()
+		require.Equal(t, []string{"a,b", "1,x"}, lines)
+	}
+}
+
+func TestStreamLocale(t *testing.T) {
+	// streams use the locale of the emitter, not the one left by another emitter
+	s := streamServer(t)
+	dir, strict := constants.JR_SYSTEM_DIR, jrctx.JrContext.StrictLocale
+	t.Cleanup(func() {
+		constants.JR_SYSTEM_DIR, jrctx.JrContext.StrictLocale = dir, strict
+		functions.ClearCache()
+	})
+	constants.JR_SYSTEM_DIR = "../.."
+	functions.ClearCache()
+	emitters[0].Locale = "it"
+	emitters[0].EmbeddedTemplate = `{"country":"{{country}}"}`
+	jrctx.JrContext.StrictLocale = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL+"/emitters/counter/stream?limit=1", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var v map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&v))
+	require.NotEmpty(t, v["country"])
+}
+
+func TestStreamErrors(t *testing.T) {
+	s := streamServer(t)
+	for url, status := range map[string]int{
+		"/emitters/nothing/stream":         http.StatusNotFound,
+		"/emitters/counter/stream?limit=x": http.StatusBadRequest,
+		"/emitters/counter/stream?rate=0":  http.StatusBadRequest,
+	} {
+		resp, err := http.Get(s.URL + url)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, status, resp.StatusCode, url)
+	}
+}
+
+func TestStreamWithSeededRoutes(t *testing.T) {
+	streamServer(t)
+	emitters[0].EmbeddedTemplate = "{\n  \"n\": {{integer 1 1000}}\n}"
+	router := mockRouter(t, `
+routes:
+  - method: GET
+    path: /users/{id}
+    seed: "{{.Params.id}}"
+    embeddedTemplate: '{"score":{{integer 1 1000000}},"name":"{{name}}"}'
+`)
+	get := func() string {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/7", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+	first := get()
+
+	// streams and seeded routes share the random generator: run with -race.
+	// The handlers are called directly, as network I/O would synchronize them for the race detector
+	ctx := context.Background()
+	es := initStreamEmitters(ctx, "counter")
+	require.NotEmpty(t, es)
+	start := make(chan struct{})
+	done := make(chan struct{})
+	var records []server.Record
+	go func() {
+		defer close(done)
+		<-start
+		for i := 0; i < 50; i++ {
+			records = append(records, generateStream(ctx, es, false)...)
+		}
+	}()
+	close(start)
+	for i := 0; i < 50; i++ {
+		require.Equal(t, first, get())
+	}
+	<-done
+	require.Len(t, records, 100)
+}
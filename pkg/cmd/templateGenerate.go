@@ -0,0 +1,121 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jrnd-io/jr/pkg/openapi"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var templateGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate templates from a schema",
+	Long: `Generate templates from the component schemas of an OpenAPI 3 document, using jr functions for formats, enums and patterns.
+Templates are printed, or written to a directory with the snake case names of the schemas.
+Example:
+  jr template generate --from-openapi petstore.yaml --schema Pet
+  jr template generate --from-openapi petstore.yaml --dir templates`,
+	Run: func(cmd *cobra.Command, args []string) {
+		openAPIFile, _ := cmd.Flags().GetString("from-openapi")
+		schemas, _ := cmd.Flags().GetStringSlice("schema")
+		dir, _ := cmd.Flags().GetString("dir")
+		if openAPIFile == "" {
+			log.Fatal().Msg("Missing --from-openapi")
+		}
+
+		document, err := openapi.Load(openAPIFile)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error loading OpenAPI document")
+		}
+		templates, err := openAPITemplates(document, schemas)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error generating templates")
+		}
+
+		for _, t := range templates {
+			valid, err := isValidTemplate([]byte(t.template))
+			if !valid {
+				log.Fatal().Err(err).Str("schema", t.schema).Msg("Invalid template")
+			}
+			if dir != "" {
+				path := filepath.Join(dir, snakeCase(t.schema)+".tpl")
+				if err = os.WriteFile(path, []byte(t.template+"\n"), 0644); err != nil {
+					log.Fatal().Err(err).Msg("Error writing template")
+				}
+				fmt.Println(path)
+				continue
+			}
+			if len(templates) > 1 {
+				fmt.Printf("{{/* %s */}}\n", t.schema)
+			}
+			fmt.Println(t.template)
+		}
+	},
+}
+
+type schemaTemplate struct {
+	schema   string
+	template string
+}
+
+// openAPITemplates returns the templates of the named schemas of a document, or of all of them
+func openAPITemplates(d *openapi.Document, schemas []string) ([]schemaTemplate, error) {
+	names := d.Components.Schemas.Names
+	if len(schemas) > 0 {
+		for _, name := range schemas {
+			if !slices.Contains(names, name) {
+				return nil, fmt.Errorf("no schema %s", name)
+			}
+		}
+		names = schemas
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no component schemas")
+	}
+	templates := make([]schemaTemplate, len(names))
+	for i, name := range names {
+		templates[i] = schemaTemplate{schema: name, template: openapi.Template(d.Components.Schemas.Schemas[name], nil)}
+	}
+	return templates, nil
+}
+
+var camelCase = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+
+// snakeCase turns schema names, like NewPet, into template names, like new_pet
+func snakeCase(name string) string {
+	name = camelCase.ReplaceAllString(name, "${1}_${2}")
+	return strings.ToLower(strings.NewReplacer("-", "_", " ", "_", ".", "_").Replace(name))
+}
+
+func init() {
+	templateCmd.AddCommand(templateGenerateCmd)
+	templateGenerateCmd.Flags().String("from-openapi", "", "OpenAPI 3 document, in YAML or JSON")
+	templateGenerateCmd.Flags().StringSlice("schema", nil, "Component schemas to generate templates for, all by default")
+	templateGenerateCmd.Flags().String("dir", "", "Directory to write the templates to, instead of printing them")
+}
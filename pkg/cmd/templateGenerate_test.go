@@ -0,0 +1,51 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/jrnd-io/jr/pkg/openapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPITemplates(t *testing.T) {
+	document, err := openapi.Load("../../testfiles/petstore.yaml")
+	require.NoError(t, err)
+
+	templates, err := openAPITemplates(document, nil)
+	require.NoError(t, err)
+	require.Len(t, templates, 4)
+	for _, tpl := range templates {
+		valid, err := isValidTemplate([]byte(tpl.template))
+		require.True(t, valid, err)
+	}
+
+	templates, err = openAPITemplates(document, []string{"Error"})
+	require.NoError(t, err)
+	require.Equal(t, "Error", templates[0].schema)
+
+	_, err = openAPITemplates(document, []string{"Missing"})
+	require.Error(t, err)
+
+	require.Equal(t, "new_pet", snakeCase("NewPet"))
+	require.Equal(t, "order_line_v2", snakeCase("order-lineV2"))
+}
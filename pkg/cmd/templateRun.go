@@ -21,12 +21,16 @@
 package cmd
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jrnd-io/jr/pkg/configuration"
 	"github.com/jrnd-io/jr/pkg/constants"
 	"github.com/jrnd-io/jr/pkg/emitter"
 	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/jrnd-io/jr/pkg/metrics"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -40,6 +44,8 @@ var templateRunCmd = &cobra.Command{
 jr template run net_device
   With the --embedded flag, [template] is a string containing a full template. Example:
 jr template run --template "{{name}}"
+  With the --spec flag, [template] is the path of a YAML or JSON record spec. Example:
+jr template run --spec user.yaml
 `,
 	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
@@ -47,10 +53,20 @@ jr template run --template "{{name}}"
 		keyTemplate, _ := cmd.Flags().GetString("key")
 		outputTemplate, _ := cmd.Flags().GetString("outputTemplate")
 		embeddedTemplate, _ := cmd.Flags().GetBool("embedded")
+		recordSpec, _ := cmd.Flags().GetBool("spec")
 		kcat, _ := cmd.Flags().GetBool("kcat")
 		output, _ := cmd.Flags().GetString("output")
 		oneline, _ := cmd.Flags().GetBool("oneline")
+		outputFormat, _ := cmd.Flags().GetString("outputFormat")
+		csvDelimiter, _ := cmd.Flags().GetString("csvDelimiter")
+		csvHeader, _ := cmd.Flags().GetString("csvHeader")
+		csvColumns, _ := cmd.Flags().GetStringSlice("csvColumns")
 		locale, _ := cmd.Flags().GetString("locale")
+		strictLocale, _ := cmd.Flags().GetBool("strictLocale")
+		faultRate, _ := cmd.Flags().GetFloat64("faultRate")
+		faultTypes, _ := cmd.Flags().GetStringSlice("faultTypes")
+		faultSidecar, _ := cmd.Flags().GetString("faultSidecar")
+		faultHeader, _ := cmd.Flags().GetString("faultHeader")
 
 		num, _ := cmd.Flags().GetInt("num")
 		frequency, _ := cmd.Flags().GetDuration("frequency")
@@ -61,7 +77,70 @@ jr template run --template "{{name}}"
 		preload, _ := cmd.Flags().GetInt("preload")
 
 		csv, _ := cmd.Flags().GetString("csv")
+		csvFileFlags, _ := cmd.Flags().GetStringArray("csvFile")
+		csvFiles := make([]functions.CsvConfig, 0, len(csvFileFlags))
+		for _, f := range csvFileFlags {
+			c, err := parseCsvFile(f)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Invalid csvFile")
+			}
+			csvFiles = append(csvFiles, c)
+		}
 		geojson, _ := cmd.Flags().GetString("geojson")
+		geojsonFileFlags, _ := cmd.Flags().GetStringArray("geojsonFile")
+		geojsonFiles := make([]functions.GeoConfig, 0, len(geojsonFileFlags))
+		for _, f := range geojsonFileFlags {
+			g, err := parseGeoJsonFile(f)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Invalid geojsonFile")
+			}
+			geojsonFiles = append(geojsonFiles, g)
+		}
+		entityFlags, _ := cmd.Flags().GetStringArray("entity")
+		entities := make([]functions.EntityConfig, 0, len(entityFlags))
+		for _, f := range entityFlags {
+			c, err := parseEntity(f)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Invalid entity")
+			}
+			entities = append(entities, c)
+		}
+		networkFlags, _ := cmd.Flags().GetStringArray("network")
+		networks := make([]functions.NetworkConfig, 0, len(networkFlags))
+		for _, f := range networkFlags {
+			c, err := parseNetwork(f)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Invalid network")
+			}
+			networks = append(networks, c)
+		}
+		uniqueFlags, _ := cmd.Flags().GetStringArray("unique")
+		uniques := make([]functions.UniqueConfig, 0, len(uniqueFlags))
+		for _, f := range uniqueFlags {
+			c, err := parseUnique(f)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Invalid unique scope")
+			}
+			uniques = append(uniques, c)
+		}
+		corpusFlags, _ := cmd.Flags().GetStringArray("corpus")
+		corpora := make([]functions.CorpusConfig, 0, len(corpusFlags))
+		for _, f := range corpusFlags {
+			c, err := parseCorpus(f)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Invalid corpus")
+			}
+			corpora = append(corpora, c)
+		}
+		catalogFlags, _ := cmd.Flags().GetStringArray("catalog")
+		catalogs := make([]functions.CatalogConfig, 0, len(catalogFlags))
+		for _, f := range catalogFlags {
+			c, err := parseCatalog(f)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Invalid catalog")
+			}
+			catalogs = append(catalogs, c)
+		}
 
 		if kcat {
 			oneline = true
@@ -69,8 +148,10 @@ jr template run --template "{{name}}"
 			outputTemplate = constants.DEFAULT_OUTPUT_KCAT_TEMPLATE
 		}
 
-		var vTemplate, eTemplate string
-		if embeddedTemplate {
+		var vTemplate, eTemplate, vSpec string
+		if recordSpec {
+			vSpec = args[0]
+		} else if embeddedTemplate {
 			vTemplate = ""
 			eTemplate = args[0]
 		} else {
@@ -128,6 +209,8 @@ jr template run --template "{{name}}"
 					configuration.GlobalCfg.WASMConfig, _ = cmd.Flags().GetString(f.Name)
 				case "wampConfig":
 					configuration.GlobalCfg.WAMPConfig, _ = cmd.Flags().GetString(f.Name)
+				case "otlpConfig":
+					configuration.GlobalCfg.OTLPConfig, _ = cmd.Flags().GetString(f.Name)
 				}
 			}
 		})
@@ -135,11 +218,13 @@ jr template run --template "{{name}}"
 		e := emitter.Emitter{
 			Name:             constants.DEFAULT_EMITTER_NAME,
 			Locale:           locale,
+			StrictLocale:     strictLocale,
 			Num:              num,
 			Frequency:        frequency,
 			Duration:         duration,
 			Preload:          preload,
 			ValueTemplate:    vTemplate,
+			ValueSpec:        vSpec,
 			EmbeddedTemplate: eTemplate,
 			KeyTemplate:      keyTemplate,
 			OutputTemplate:   outputTemplate,
@@ -147,16 +232,249 @@ jr template run --template "{{name}}"
 			Topic:            topic,
 			Kcat:             kcat,
 			Oneline:          oneline,
+			OutputFormat:     outputFormat,
+			CsvDelimiter:     csvDelimiter,
+			CsvHeader:        csvHeader,
+			CsvColumns:       csvColumns,
 			Csv:              csv,
+			CsvFiles:         csvFiles,
 			GeoJson:          geojson,
+			GeoJsonFiles:     geojsonFiles,
+			Entities:         entities,
+			Networks:         networks,
+			Uniques:          uniques,
+			Corpora:          corpora,
+			Catalogs:         catalogs,
+			Faults: emitter.FaultConfig{
+				Rate:    faultRate,
+				Types:   faultTypes,
+				Sidecar: faultSidecar,
+				Header:  faultHeader,
+			},
 		}
 
 		functions.SetSeed(seed)
 		es := map[string][]emitter.Emitter{constants.DEFAULT_EMITTER_NAME: {e}}
+		if metricsAddr, _ := cmd.Flags().GetString("metricsAddr"); metricsAddr != "" {
+			defer metrics.Serve(metricsAddr).Close()
+		}
+		defer startTracing(cmd)()
 		RunEmitters(cmd.Context(), []string{e.Name}, es, false)
 	},
 }
 
+// parseCsvFile parses a --csvFile flag value
+func parseCsvFile(s string) (functions.CsvConfig, error) {
+	var c functions.CsvConfig
+	for i, option := range strings.Split(s, ",") {
+		k, v, found := strings.Cut(option, "=")
+		if !found {
+			return c, fmt.Errorf("invalid option '%s' in '%s'", option, s)
+		}
+		if i == 0 {
+			c.Name, c.Path = k, v
+			continue
+		}
+		switch k {
+		case "mode":
+			c.Mode = v
+		case "perCall":
+			c.PerCall = v == "true"
+		case "delimiter":
+			c.Delimiter = v
+		default:
+			return c, fmt.Errorf("unknown option '%s' in '%s'", k, s)
+		}
+	}
+	return c, nil
+}
+
+// parseCorpus parses a --corpus flag value
+func parseCorpus(s string) (functions.CorpusConfig, error) {
+	var c functions.CorpusConfig
+	for i, option := range strings.Split(s, ",") {
+		k, v, found := strings.Cut(option, "=")
+		if !found {
+			return c, fmt.Errorf("invalid option '%s' in '%s'", option, s)
+		}
+		if i == 0 {
+			c.Name, c.Path = k, v
+			continue
+		}
+		switch k {
+		case "prefixLen":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return c, fmt.Errorf("invalid value for '%s' in '%s': %w", k, s, err)
+			}
+			c.PrefixLen = n
+		case "chain":
+			c.Chain = v
+		default:
+			return c, fmt.Errorf("unknown option '%s' in '%s'", k, s)
+		}
+	}
+	return c, nil
+}
+
+// parseGeoJsonFile parses a --geojsonFile flag value
+func parseGeoJsonFile(s string) (functions.GeoConfig, error) {
+	var g functions.GeoConfig
+	for i, option := range strings.Split(s, ",") {
+		k, v, found := strings.Cut(option, "=")
+		if !found {
+			return g, fmt.Errorf("invalid option '%s' in '%s'", option, s)
+		}
+		if i == 0 {
+			g.Name, g.Path = k, v
+			continue
+		}
+		switch k {
+		case "nameProperty":
+			g.NameProperty = v
+		case "weightProperty":
+			g.WeightProperty = v
+		default:
+			return g, fmt.Errorf("unknown option '%s' in '%s'", k, s)
+		}
+	}
+	return g, nil
+}
+
+// parseEntity parses an --entity flag value
+func parseEntity(s string) (functions.EntityConfig, error) {
+	options := strings.Split(s, ",")
+	c := functions.EntityConfig{Name: options[0]}
+	for _, option := range options[1:] {
+		k, v, found := strings.Cut(option, "=")
+		if !found {
+			return c, fmt.Errorf("invalid option '%s' in '%s'", option, s)
+		}
+		var err error
+		switch k {
+		case "count":
+			c.Count, err = strconv.Atoi(v)
+		case "geojson":
+			c.GeoJson = v
+		case "feature":
+			c.Feature = v
+		case "latitude":
+			c.Latitude, err = strconv.ParseFloat(v, 64)
+		case "longitude":
+			c.Longitude, err = strconv.ParseFloat(v, 64)
+		case "radius":
+			c.Radius, err = strconv.ParseFloat(v, 64)
+		case "minSpeed":
+			c.MinSpeed, err = strconv.ParseFloat(v, 64)
+		case "maxSpeed":
+			c.MaxSpeed, err = strconv.ParseFloat(v, 64)
+		case "tick":
+			c.Tick, err = time.ParseDuration(v)
+		case "initialStatus":
+			c.InitialStatus = v
+		default:
+			return c, fmt.Errorf("unknown option '%s' in '%s'", k, s)
+		}
+		if err != nil {
+			return c, fmt.Errorf("invalid value for '%s' in '%s': %w", k, s, err)
+		}
+	}
+	return c, nil
+}
+
+// parseNetwork parses a --network flag value, where ranges are separated by '|'
+func parseNetwork(s string) (functions.NetworkConfig, error) {
+	options := strings.Split(s, ",")
+	c := functions.NetworkConfig{Name: options[0]}
+	for _, option := range options[1:] {
+		k, v, found := strings.Cut(option, "=")
+		if !found {
+			return c, fmt.Errorf("invalid option '%s' in '%s'", option, s)
+		}
+		var err error
+		switch k {
+		case "internal":
+			c.Internal = strings.Split(v, "|")
+		case "external":
+			c.External = strings.Split(v, "|")
+		case "ipv6Prefix":
+			c.IPv6Prefix = v
+		case "ipv6Ratio":
+			c.IPv6Ratio, err = strconv.ParseFloat(v, 64)
+		case "clients":
+			c.Clients, err = strconv.Atoi(v)
+		case "servers":
+			c.Servers, err = strconv.Atoi(v)
+		default:
+			return c, fmt.Errorf("unknown option '%s' in '%s'", k, s)
+		}
+		if err != nil {
+			return c, fmt.Errorf("invalid value for '%s' in '%s': %w", k, s, err)
+		}
+	}
+	return c, nil
+}
+
+// parseCatalog parses a --catalog flag value
+func parseCatalog(s string) (functions.CatalogConfig, error) {
+	options := strings.Split(s, ",")
+	c := functions.CatalogConfig{Name: options[0]}
+	for _, option := range options[1:] {
+		k, v, found := strings.Cut(option, "=")
+		if !found {
+			return c, fmt.Errorf("invalid option '%s' in '%s'", option, s)
+		}
+		var err error
+		switch k {
+		case "products":
+			c.Products, err = strconv.Atoi(v)
+		case "maxItems":
+			c.MaxItems, err = strconv.Atoi(v)
+		case "discountRate":
+			var rate float64
+			rate, err = strconv.ParseFloat(v, 64)
+			c.DiscountRate = &rate
+		default:
+			return c, fmt.Errorf("unknown option '%s' in '%s'", k, s)
+		}
+		if err != nil {
+			return c, fmt.Errorf("invalid value for '%s' in '%s': %w", k, s, err)
+		}
+	}
+	return c, nil
+}
+
+// parseUnique parses a --unique flag value
+func parseUnique(s string) (functions.UniqueConfig, error) {
+	options := strings.Split(s, ",")
+	c := functions.UniqueConfig{Name: options[0]}
+	for _, option := range options[1:] {
+		k, v, found := strings.Cut(option, "=")
+		if !found {
+			return c, fmt.Errorf("invalid option '%s' in '%s'", option, s)
+		}
+		var err error
+		switch k {
+		case "mode":
+			c.Mode = v
+		case "retries":
+			c.Retries, err = strconv.Atoi(v)
+		case "shards":
+			c.Shards, err = strconv.Atoi(v)
+		case "capacity":
+			c.Capacity, err = strconv.ParseInt(v, 10, 64)
+		case "fpRate":
+			c.FPRate, err = strconv.ParseFloat(v, 64)
+		default:
+			return c, fmt.Errorf("unknown option '%s' in '%s'", k, s)
+		}
+		if err != nil {
+			return c, fmt.Errorf("invalid value for '%s' in '%s': %w", k, s, err)
+		}
+	}
+	return c, nil
+}
+
 func init() {
 	templateCmd.AddCommand(templateRunCmd)
 	templateRunCmd.Flags().IntP("num", "n", constants.NUM, "Number of elements to create for each pass")
@@ -167,23 +485,43 @@ func init() {
 	templateRunCmd.Flags().Int64("seed", time.Now().UTC().UnixNano(), "Seed to init pseudorandom generator")
 
 	templateRunCmd.Flags().String("csv", "", "Path to csv file to use")
+	templateRunCmd.Flags().StringArray("csvFile", []string{}, "Named csv dataset to use with fromcsv_named, as name=path[,mode=sequential|random|shuffle][,perCall=true][,delimiter=;]")
 
 	templateRunCmd.Flags().String("geojson", "", "Path to geojson file to use")
+	templateRunCmd.Flags().StringArray("entity", []string{}, "Simulation of moving entities to use with entity functions, as name[,count=10][,geojson=dataset][,feature=name][,latitude=..,longitude=..,radius=meters][,minSpeed=5][,maxSpeed=30][,tick=1s][,initialStatus=idle]")
+	templateRunCmd.Flags().StringArray("catalog", []string{}, "Product catalog to use with product and basket, as name[,products=200][,maxItems=5][,discountRate=0.2]")
+	templateRunCmd.Flags().StringArray("corpus", []string{}, "Named corpus to use with markov_sentence and markov_paragraph, as name=path[,prefixLen=2][,chain=file], where path is a text file, a directory or a chain file")
+	templateRunCmd.Flags().StringArray("unique", []string{}, "Unique scope to use with unique functions, as name[,mode=exact|sharded|bloom][,retries=100][,shards=64][,capacity=10000000][,fpRate=0.001]")
+	templateRunCmd.Flags().StringArray("network", []string{}, "Network to use with flow and dns functions, as name[,internal=cidr|cidr][,external=cidr|cidr][,ipv6Prefix=cidr][,ipv6Ratio=0.2][,clients=50][,servers=10]")
+	templateRunCmd.Flags().StringArray("geojsonFile", []string{}, "Named geojson dataset to use with geo functions, as name=path[,nameProperty=name][,weightProperty=weight]")
 
 	templateRunCmd.Flags().StringP("kafkaConfig", "F", "", "Kafka configuration")
 	templateRunCmd.Flags().String("registryConfig", "", "Kafka configuration")
 	templateRunCmd.Flags().Bool("embedded", false, "If enabled, [template] must be a string containing a template, to be embedded directly in the script")
+	templateRunCmd.Flags().Bool("spec", false, "If enabled, [template] must be the path of a YAML or JSON record spec")
 	templateRunCmd.Flags().Int("preload", constants.DEFAULT_PRELOAD_SIZE, "Number of elements to create during the preload phase")
 
 	templateRunCmd.Flags().StringP("key", "k", constants.DEFAULT_KEY, "A template to generate a key")
 	templateRunCmd.Flags().StringP("topic", "t", constants.DEFAULT_TOPIC, "Kafka topic")
 
 	templateRunCmd.Flags().Bool("kcat", false, "If you want to pipe jr with kcat, use this flag: it is equivalent to --output stdout --outputTemplate '{{key}},{{value}}' --oneline")
-	templateRunCmd.Flags().StringP("output", "o", constants.DEFAULT_OUTPUT, "can be one of stdout, kafka, http, redis, mongo, elastic, s3, gcs, azblobstorage, azcosmosdb, cassandra, luascript, wasm, awsdynamodb")
+	templateRunCmd.Flags().StringP("output", "o", constants.DEFAULT_OUTPUT, "can be one of stdout, kafka, http, redis, mongo, elastic, s3, gcs, azblobstorage, azcosmosdb, cassandra, luascript, wasm, awsdynamodb, otlp")
 	templateRunCmd.Flags().String("outputTemplate", constants.DEFAULT_OUTPUT_TEMPLATE, "Formatting of K,V on standard output")
 	templateRunCmd.Flags().BoolP("oneline", "l", false, "strips /n from output, for example to be pipelined to tools like kcat")
+	templateRunCmd.Flags().String("outputFormat", "", "can be one of json, csv, tsv: csv and tsv flatten a JSON value in a row")
+	templateRunCmd.Flags().String("csvDelimiter", "", "Delimiter for csv output, defaults to ','")
+	templateRunCmd.Flags().String("csvHeader", "", "When to write the csv header: once, always, never")
+	templateRunCmd.Flags().StringSlice("csvColumns", []string{}, "Columns of the csv output, with dotted names for nested fields (default the fields of the first value)")
 	templateRunCmd.Flags().BoolP("autocreate", "a", false, "if enabled, autocreate topics")
 	templateRunCmd.Flags().String("locale", constants.LOCALE, "Locale")
+	templateRunCmd.Flags().Float64("faultRate", 0, "Fraction of the records to corrupt, between 0 and 1")
+	templateRunCmd.Flags().StringSlice("faultTypes", []string{}, "Faults to inject, among "+strings.Join(emitter.FaultTypes, ", ")+" (default all)")
+	templateRunCmd.Flags().String("faultSidecar", "", "File where the injected faults are labelled, as JSON lines")
+	templateRunCmd.Flags().String("faultHeader", "", "Header where the injected faults are labelled, for kafka and http outputs")
+	templateRunCmd.Flags().String("metricsAddr", "", "Address of the listener of /metrics, /healthz and /readyz, like :9090")
+	templateRunCmd.Flags().String("tracing", "", "Create OpenTelemetry spans for every record or batch of records: record, batch")
+	templateRunCmd.Flags().String("tracingEndpoint", "", "URL of the OTLP/HTTP collector of the spans, like http://localhost:4318 (default OTEL_EXPORTER_OTLP_ENDPOINT)")
+	templateRunCmd.Flags().Bool("strictLocale", false, "Fail when a dataset is not found in the locale and its parents, instead of using the default locale")
 
 	templateRunCmd.Flags().BoolP("schemaRegistry", "s", false, "If you want to use Confluent Schema Registry")
 	templateRunCmd.Flags().String("serializer", "", "Type of serializer: json-schema, avro-generic, avro, protobuf")
@@ -201,5 +539,6 @@ func init() {
 	templateRunCmd.Flags().String("luascriptConfig", "", "LUA Script configuration")
 	templateRunCmd.Flags().String("wasmConfig", "", "WASM configuration")
 	templateRunCmd.Flags().String("wampConfig", "", "WAMP configuration")
+	templateRunCmd.Flags().String("otlpConfig", "", "OpenTelemetry OTLP configuration")
 
 }
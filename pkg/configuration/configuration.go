@@ -45,6 +45,7 @@ type GlobalConfiguration struct {
 	LUAScriptConfig     string
 	WASMConfig          string
 	WAMPConfig          string
+	OTLPConfig          string
 	Url                 string
 	EmbeddedTemplate    bool
 	FileNameTemplate    bool
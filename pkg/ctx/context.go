@@ -34,6 +34,7 @@ type Context struct {
 	ExpectedObjects           int64
 	GeneratedBytes            int64
 	Locale                    string
+	StrictLocale              bool
 	CtxCounters               map[string]int
 	CtxCountersLock           sync.RWMutex
 	Ctx                       map[string]string
@@ -50,6 +51,8 @@ type Context struct {
 	CountryIndex              int
 	CityIndex                 int
 	CurrentIterationLoopIndex int
+	// PreloadedRecords are the records generated by the preload of the emitters, which don't move the rows of fromcsv
+	PreloadedRecords int
 }
 
 func init() {
@@ -0,0 +1,160 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package emitter
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/jrnd-io/jr/pkg/spec"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	CsvHeaderOnce   = "once"
+	CsvHeaderAlways = "always"
+	CsvHeaderNever  = "never"
+)
+
+// CsvFormatter converts JSON values in CSV rows, with nested objects flattened in dotted columns.
+type CsvFormatter struct {
+	Delimiter rune
+	Header    string
+	// Inline writes the header in the value of the row, for outputs writing every value in its own file.
+	// Otherwise the header is returned by PendingHeader, to be produced as its own record.
+	Inline bool
+	// Columns of the rows, like the Header of a record spec. When empty, they are taken from the first value
+	Columns []string
+
+	columns     []string
+	wroteHeader bool
+	pending     string
+	ignored     map[string]bool
+	lock        sync.Mutex
+}
+
+// NewCsvFormatter creates a formatter for outputFormat csv or tsv
+func NewCsvFormatter(outputFormat string, delimiter string, header string) (*CsvFormatter, error) {
+	f := &CsvFormatter{Delimiter: ',', Header: header}
+	if outputFormat == "tsv" {
+		f.Delimiter = '\t'
+	}
+
+	switch delimiter {
+	case "":
+	case "tab", "\\t":
+		f.Delimiter = '\t'
+	default:
+		r, size := utf8.DecodeRuneInString(delimiter)
+		if size != len(delimiter) || r == '"' || r == '\r' || r == '\n' {
+			return nil, fmt.Errorf("invalid csv delimiter '%s'", delimiter)
+		}
+		f.Delimiter = r
+	}
+
+	switch f.Header {
+	case "":
+		f.Header = CsvHeaderOnce
+	case CsvHeaderOnce, CsvHeaderAlways, CsvHeaderNever:
+	default:
+		return nil, fmt.Errorf("invalid csv header mode '%s'", header)
+	}
+	return f, nil
+}
+
+// Format converts a JSON value in a CSV row. When the header is needed, it prefixes the row
+// if the formatter is inline, and it is pending otherwise
+func (f *CsvFormatter) Format(v string) (string, error) {
+	decoded, err := spec.DecodeJSON([]byte(v))
+	if err != nil {
+		return "", fmt.Errorf("csv output needs a JSON value: %w", err)
+	}
+	o, ok := decoded.(spec.Object)
+	if !ok {
+		return "", fmt.Errorf("csv output needs a JSON object")
+	}
+	return f.FormatObject(o)
+}
+
+// FormatObject converts a record in a CSV row, like Format
+func (f *CsvFormatter) FormatObject(o spec.Object) (string, error) {
+	flat := spec.Flatten(o)
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.columns == nil {
+		f.columns = f.Columns
+		if len(f.columns) == 0 {
+			f.columns = flat.Names()
+		}
+	}
+
+	row := make([]string, len(f.columns))
+	for i, c := range f.columns {
+		value, _ := flat.Get(c)
+		row[i] = spec.FormatValue(value)
+	}
+	for _, name := range flat.Names() {
+		if !slices.Contains(f.columns, name) && !f.ignored[name] {
+			if f.ignored == nil {
+				f.ignored = make(map[string]bool)
+			}
+			f.ignored[name] = true
+			log.Warn().Str("field", name).Msg("Ignoring field not present in the csv columns")
+		}
+	}
+
+	line, err := spec.EncodeCSV(row, f.Delimiter)
+	if err != nil {
+		return "", err
+	}
+
+	if f.Header == CsvHeaderAlways || (f.Header == CsvHeaderOnce && !f.wroteHeader) {
+		header, err := spec.EncodeCSV(f.columns, f.Delimiter)
+		if err != nil {
+			return "", err
+		}
+		f.wroteHeader = true
+		if f.Inline {
+			return strings.Join([]string{string(header), string(line)}, "\n"), nil
+		}
+		f.pending = string(header)
+	}
+	return string(line), nil
+}
+
+// Clone returns a formatter with the same options, which has written no header yet
+func (f *CsvFormatter) Clone() *CsvFormatter {
+	return &CsvFormatter{Delimiter: f.Delimiter, Header: f.Header, Inline: f.Inline, Columns: f.Columns}
+}
+
+// PendingHeader returns the header to write before the last formatted row, if any, once
+func (f *CsvFormatter) PendingHeader() string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	header := f.pending
+	f.pending = ""
+	return header
+}
@@ -0,0 +1,137 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package emitter_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jrnd-io/jr/pkg/configuration"
+	"github.com/jrnd-io/jr/pkg/emitter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCsvFormatter(t *testing.T) {
+	f, err := emitter.NewCsvFormatter("csv", "", "")
+	require.NoError(t, err)
+
+	row, err := f.Format(`{"name":"Ugo","company":"Acme, Inc.","quote":"say \"hi\"","address":{"city":"Roma","zip":"00100"},"age":42.5}`)
+	require.NoError(t, err)
+	require.Equal(t, "Ugo,\"Acme, Inc.\",\"say \"\"hi\"\"\",Roma,00100,42.5", row)
+	require.Equal(t, "name,company,quote,address.city,address.zip,age", f.PendingHeader())
+	require.Empty(t, f.PendingHeader())
+
+	// header is written once, columns are kept in the order of the first value
+	row, err = f.Format(`{"age":1,"name":"Anna","address":{"city":"Milano"},"extra":true}`)
+	require.NoError(t, err)
+	require.Equal(t, "Anna,,,Milano,,1", row)
+	require.Empty(t, f.PendingHeader())
+
+	_, err = f.Format(`not json`)
+	require.Error(t, err)
+	_, err = f.Format(`[1,2]`)
+	require.Error(t, err)
+}
+
+func TestCsvFormatterColumns(t *testing.T) {
+	// preset columns are kept also when the first value has a null nested object
+	f, err := emitter.NewCsvFormatter("csv", "", emitter.CsvHeaderNever)
+	require.NoError(t, err)
+	f.Columns = []string{"name", "address.city"}
+
+	for value, expected := range map[string]string{
+		`{"name":"Ugo","address":null}`:                      "Ugo,",
+		`{"name":"Anna","address":{"city":"Roma"},"age":30}`: "Anna,Roma",
+	} {
+		row, err := f.Format(value)
+		require.NoError(t, err)
+		require.Equal(t, expected, row)
+	}
+}
+
+func TestTsvFormatter(t *testing.T) {
+	f, err := emitter.NewCsvFormatter("tsv", "", emitter.CsvHeaderAlways)
+	require.NoError(t, err)
+	f.Inline = true
+
+	for i := 0; i < 2; i++ {
+		row, err := f.Format(`{"a":"x\ty","b":null,"c":[1,"2"]}`)
+		require.NoError(t, err)
+		require.Equal(t, "a\tb\tc\n\"x\ty\"\t\t\"[1,\"\"2\"\"]\"", row)
+		require.Empty(t, f.PendingHeader())
+	}
+}
+
+func TestEmitterCsvHeader(t *testing.T) {
+	// the header is its own record, before the first row
+	f, err := emitter.NewCsvFormatter("csv", "", "")
+	require.NoError(t, err)
+	r := &recorder{}
+	e := emitter.Emitter{Producer: r, Formatter: f}
+	for _, v := range []string{`{"a":1,"b":"x"}`, `{"a":2,"b":"y"}`} {
+		row, err := f.Format(v)
+		require.NoError(t, err)
+		e.Produce(context.Background(), "k", row, nil)
+	}
+	require.Equal(t, []string{"a,b", "1,x", "2,y"}, r.values)
+}
+
+func TestEmitterCsvSpec(t *testing.T) {
+	// a csv spec has the header of its fields, also when the first value is null
+	path := filepath.Join(t.TempDir(), "spec.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+format: csv
+fields:
+  id:
+    type: int
+    value: '42'
+  address:
+    nullable: 0.5
+    fields:
+      city: 'Roma'
+`), 0644))
+	e := emitter.Emitter{Name: "spec", Output: "stdout", KeyTemplate: "k", ValueSpec: path, CsvHeader: emitter.CsvHeaderOnce}
+	e.Initialize(context.Background(), configuration.GlobalConfiguration{})
+	r := &recorder{}
+	e.Producer = r
+	e.Run(context.Background(), 3, nil)
+
+	require.Len(t, r.values, 4)
+	require.Equal(t, "id,address.city", r.values[0])
+	require.Regexp(t, `^42,(Roma)?$`, r.values[1])
+}
+
+func TestCsvFormatterOptions(t *testing.T) {
+	f, err := emitter.NewCsvFormatter("csv", ";", emitter.CsvHeaderNever)
+	require.NoError(t, err)
+	row, err := f.Format(`{"a":"1;2","b":"3"}`)
+	require.NoError(t, err)
+	require.Equal(t, "\"1;2\";3", row)
+
+	_, err = emitter.NewCsvFormatter("csv", "\"", "")
+	require.Error(t, err)
+	_, err = emitter.NewCsvFormatter("csv", ",,", "")
+	require.Error(t, err)
+	_, err = emitter.NewCsvFormatter("csv", "", "sometimes")
+	require.Error(t, err)
+}
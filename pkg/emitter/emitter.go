@@ -22,8 +22,10 @@ package emitter
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/jrnd-io/jr/pkg/producers/wasm"
@@ -32,6 +34,7 @@ import (
 	"github.com/jrnd-io/jr/pkg/constants"
 	jtctx "github.com/jrnd-io/jr/pkg/ctx"
 	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/jrnd-io/jr/pkg/metrics"
 	"github.com/jrnd-io/jr/pkg/producers/awsdynamodb"
 	"github.com/jrnd-io/jr/pkg/producers/azblobstorage"
 	"github.com/jrnd-io/jr/pkg/producers/azcosmosdb"
@@ -43,44 +46,118 @@ import (
 	"github.com/jrnd-io/jr/pkg/producers/kafka"
 	"github.com/jrnd-io/jr/pkg/producers/luascript"
 	"github.com/jrnd-io/jr/pkg/producers/mongodb"
+	"github.com/jrnd-io/jr/pkg/producers/otlp"
 	"github.com/jrnd-io/jr/pkg/producers/redis"
 	"github.com/jrnd-io/jr/pkg/producers/s3"
 	"github.com/jrnd-io/jr/pkg/producers/server"
 	"github.com/jrnd-io/jr/pkg/producers/wamp"
+	"github.com/jrnd-io/jr/pkg/spec"
 	"github.com/jrnd-io/jr/pkg/tpl"
+	"github.com/jrnd-io/jr/pkg/tracing"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Emitter struct {
-	Name             string        `mapstructure:"name"`
-	Locale           string        `mapstructure:"locale"`
-	Num              int           `mapstructure:"num"`
-	Frequency        time.Duration `mapstructure:"frequency"`
-	Duration         time.Duration `mapstructure:"duration"`
-	Preload          int           `mapstructure:"preload"`
-	ValueTemplate    string        `mapstructure:"valueTemplate"`
-	EmbeddedTemplate string        `mapstructure:"embeddedTemplate"`
-	KeyTemplate      string        `mapstructure:"keyTemplate"`
-	OutputTemplate   string        `mapstructure:"outputTemplate"`
-	Output           string        `mapstructure:"output"`
-	Topic            string        `mapstructure:"topic"`
-	Kcat             bool          `mapstructure:"kcat"`
-	Oneline          bool          `mapstructure:"oneline"`
-	Csv              string        `mapstructure:"csv"`
-	GeoJson          string        `mapstructure:"geojson"`
+	Name             string                    `mapstructure:"name"`
+	Locale           string                    `mapstructure:"locale"`
+	StrictLocale     bool                      `mapstructure:"strictLocale"`
+	Num              int                       `mapstructure:"num"`
+	Frequency        time.Duration             `mapstructure:"frequency"`
+	Duration         time.Duration             `mapstructure:"duration"`
+	Preload          int                       `mapstructure:"preload"`
+	ValueTemplate    string                    `mapstructure:"valueTemplate"`
+	ValueSpec        string                    `mapstructure:"valueSpec"`
+	EmbeddedTemplate string                    `mapstructure:"embeddedTemplate"`
+	KeyTemplate      string                    `mapstructure:"keyTemplate"`
+	OutputTemplate   string                    `mapstructure:"outputTemplate"`
+	Output           string                    `mapstructure:"output"`
+	Topic            string                    `mapstructure:"topic"`
+	Kcat             bool                      `mapstructure:"kcat"`
+	Oneline          bool                      `mapstructure:"oneline"`
+	OutputFormat     string                    `mapstructure:"outputFormat"`
+	CsvDelimiter     string                    `mapstructure:"csvDelimiter"`
+	CsvHeader        string                    `mapstructure:"csvHeader"`
+	CsvColumns       []string                  `mapstructure:"csvColumns"`
+	Csv              string                    `mapstructure:"csv"`
+	CsvFiles         []functions.CsvConfig     `mapstructure:"csvFiles"`
+	GeoJson          string                    `mapstructure:"geojson"`
+	GeoJsonFiles     []functions.GeoConfig     `mapstructure:"geojsonFiles"`
+	Entities         []functions.EntityConfig  `mapstructure:"entities"`
+	Networks         []functions.NetworkConfig `mapstructure:"networks"`
+	Uniques          []functions.UniqueConfig  `mapstructure:"uniques"`
+	Corpora          []functions.CorpusConfig  `mapstructure:"corpora"`
+	Catalogs         []functions.CatalogConfig `mapstructure:"catalogs"`
+	Faults           FaultConfig               `mapstructure:"faults"`
+	SafeFunctions    bool                      `mapstructure:"-" json:"-"`
 	Producer         Producer
 	KTpl             tpl.Tpl
 	VTpl             tpl.Tpl
+	VSpec            *spec.Spec
+	VEncoder         *spec.Encoder
+	Formatter        *CsvFormatter
+	Injector         *FaultInjector
+
+	// ids of the current span, returned by trace_id and span_id
+	traceID string
+	spanID  string
 }
 
 func (e *Emitter) Initialize(ctx context.Context, conf configuration.GlobalConfiguration) {
 
-	functions.InitCSV(e.Csv)
+	if e.StrictLocale {
+		if _, err := functions.LocaleChain(e.Locale); err != nil {
+			log.Fatal().Err(err).Msg("Failed to load locale")
+		}
+	}
 
-	functions.InitGeoJson(e.GeoJson)
+	if err := functions.InitCSV(e.Csv); err != nil {
+		log.Fatal().Err(err).Msg("Failed to load csv file")
+	}
+	for _, c := range e.CsvFiles {
+		if err := functions.InitCsvDataset(c); err != nil {
+			log.Fatal().Err(err).Msg("Failed to load csv dataset")
+		}
+	}
+
+	if err := functions.InitGeoJson(e.GeoJson); err != nil {
+		log.Fatal().Err(err).Msg("Failed to load geojson file")
+	}
+	for _, g := range e.GeoJsonFiles {
+		if err := functions.InitGeoDataset(g); err != nil {
+			log.Fatal().Err(err).Msg("Failed to load geojson dataset")
+		}
+	}
+	for _, c := range e.Entities {
+		if err := functions.InitEntities(c); err != nil {
+			log.Fatal().Err(err).Msg("Failed to create entity simulation")
+		}
+	}
+	for _, c := range e.Networks {
+		if err := functions.InitNetwork(c); err != nil {
+			log.Fatal().Err(err).Msg("Failed to create network")
+		}
+	}
+	for _, c := range e.Uniques {
+		if err := functions.InitUnique(c); err != nil {
+			log.Fatal().Err(err).Msg("Failed to create unique scope")
+		}
+	}
+	for _, c := range e.Corpora {
+		if err := functions.InitCorpus(c); err != nil {
+			log.Fatal().Err(err).Msg("Failed to load corpus")
+		}
+	}
+	for _, c := range e.Catalogs {
+		if err := functions.InitCatalog(c); err != nil {
+			log.Fatal().Err(err).Msg("Failed to create catalog")
+		}
+	}
 
 	templateName := e.ValueTemplate
-	if e.EmbeddedTemplate == "" {
+	if e.ValueSpec != "" {
+		e.initializeSpec()
+	} else if e.EmbeddedTemplate == "" {
 		path := os.ExpandEnv(fmt.Sprintf("%s/%s", constants.JR_SYSTEM_DIR, "templates"))
 		templateFullPath := fmt.Sprintf("%s/%s.tpl", path, templateName)
 		vt, err := os.ReadFile(templateFullPath)
@@ -90,11 +167,11 @@ func (e *Emitter) Initialize(ctx context.Context, conf configuration.GlobalConfi
 		}
 	}
 
-	keyTpl, err := tpl.NewTpl("key", e.KeyTemplate, functions.FunctionsMap(), &jtctx.JrContext)
+	keyTpl, err := tpl.NewTpl("key", e.KeyTemplate, e.functionsMap(), &jtctx.JrContext)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to create key template")
 	}
-	valueTpl, err := tpl.NewTpl("value", e.EmbeddedTemplate, functions.FunctionsMap(), &jtctx.JrContext)
+	valueTpl, err := tpl.NewTpl("value", e.EmbeddedTemplate, e.functionsMap(), &jtctx.JrContext)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to create value template")
 	}
@@ -102,7 +179,17 @@ func (e *Emitter) Initialize(ctx context.Context, conf configuration.GlobalConfi
 	e.KTpl = keyTpl
 	e.VTpl = valueTpl
 
-	o, _ := tpl.NewTpl("out", e.OutputTemplate, functions.FunctionsMap(), nil)
+	e.initializeFormatter()
+
+	if e.Faults.Rate > 0 {
+		injector, err := NewFaultInjector(e.Faults)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create fault injector")
+		}
+		e.Injector = injector
+	}
+
+	o, _ := tpl.NewTpl("out", e.OutputTemplate, e.functionsMap(), nil)
 	if e.Output == "stdout" {
 		e.Producer = &console.Producer{OutputTpl: &o}
 		return
@@ -161,6 +248,11 @@ func (e *Emitter) Initialize(ctx context.Context, conf configuration.GlobalConfi
 		return
 	}
 
+	if e.Output == "stream" {
+		e.Producer = &server.StreamProducer{}
+		return
+	}
+
 	if e.Output == "http" {
 		e.Producer = createHTTPProducer(ctx, conf.HTTPConfig)
 		return
@@ -182,27 +274,261 @@ func (e *Emitter) Initialize(ctx context.Context, conf configuration.GlobalConfi
 		e.Producer = createWAMPProducer(ctx, conf.WAMPConfig)
 		return
 	}
+	if e.Output == "otlp" {
+		e.Producer = createOTLPProducer(ctx, conf.OTLPConfig)
+		return
+	}
+
+}
+
+// functionsMap returns the template functions of the emitter: the safe ones for emitters of remote callers
+func (e *Emitter) functionsMap() map[string]interface{} {
+	if e.SafeFunctions {
+		return functions.SafeFunctionsMap()
+	}
+	return functions.FunctionsMap()
+}
+
+func (e *Emitter) initializeSpec() {
+	s, err := spec.Load(e.ValueSpec)
+	if err != nil {
+		log.Fatal().Err(err).Str("spec", e.ValueSpec).Msg("Failed to load record spec")
+	}
+	if err = s.Compile(e.functionsMap()); err != nil {
+		log.Fatal().Err(err).Str("spec", e.ValueSpec).Msg("Failed to compile record spec")
+	}
+	encoder, err := spec.NewEncoder(s)
+	if err != nil {
+		log.Fatal().Err(err).Str("spec", e.ValueSpec).Msg("Failed to create record spec encoder")
+	}
+	e.VSpec = s
+	e.VEncoder = encoder
+}
+
+func (e *Emitter) initializeFormatter() {
+	outputFormat := e.OutputFormat
+	if e.VSpec != nil && e.VSpec.Format == spec.CSV {
+		// a csv spec is written by the csv formatter, as outputFormat csv
+		if outputFormat != "" {
+			log.Fatal().Str("spec", e.ValueSpec).Str("outputFormat", outputFormat).Msg("A record spec with csv format can't have an output format")
+		}
+		outputFormat = "csv"
+	}
+	switch outputFormat {
+	case "", "json":
+		return
+	case "csv", "tsv":
+	default:
+		log.Fatal().Str("outputFormat", outputFormat).Msg("Output format not supported")
+	}
+
+	header, inline := e.CsvHeader, false
+	switch e.Output {
+	case "stdout", "json":
+	case "s3", "gcs", "azblobstorage":
+		// every value is written in its own file, with its header
+		inline = true
+		if header == "" {
+			header = CsvHeaderAlways
+		}
+	default:
+		// every value is a message, where a header would be a message without data
+		if header == "" {
+			header = CsvHeaderNever
+		}
+	}
+	formatter, err := NewCsvFormatter(outputFormat, e.CsvDelimiter, header)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create csv formatter")
+	}
+	formatter.Inline = inline
+	switch {
+	case len(e.CsvColumns) > 0:
+		formatter.Columns = e.CsvColumns
+	case e.VSpec != nil:
+		formatter.Columns = e.VSpec.Header()
+	}
+	e.Formatter = formatter
+}
+
+// Record generates the key and the value of a record. A record with a value already seen by unique_value is
+// generated again, up to the retries of the scope, and it is skipped, without stopping jr, when the scope is exhausted
+func (e *Emitter) Record() (string, string, bool) {
+	for attempt := 0; ; attempt++ {
+		k, v, err := e.record()
+		var duplicate *functions.DuplicateError
+		switch {
+		case err == nil:
+			return k, v, true
+		case errors.As(err, &duplicate) && attempt < duplicate.Retries:
+			continue
+		case errors.As(err, &duplicate) || errors.Is(err, functions.ErrUniqueExhausted) || errors.Is(err, functions.ErrStrictLocale):
+			metrics.Skipped(e.Name)
+			log.Error().Err(err).Str("emitter", e.Name).Msg("Record skipped")
+			return "", "", false
+		default:
+			log.Fatal().Err(err).Msg("Error executing template")
+		}
+	}
+}
+
+func (e *Emitter) record() (string, string, error) {
+	var k, v string
+	err := functions.WithTraceContext(e.traceID, e.spanID, func() error {
+		// a dataset missing from a strict locale fails the record, not the process
+		_ = functions.LocaleError()
+		var err error
+		if k, err = e.KTpl.TryExecute(); err != nil {
+			return err
+		}
+		if v, err = e.Value(); err != nil {
+			return err
+		}
+		return functions.LocaleError()
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return k, v, nil
+}
+
+// Value generates a value from the record spec, if any, or from the value template
+func (e *Emitter) Value() (string, error) {
+	var v string
+	if e.VSpec == nil {
+		var err error
+		if v, err = e.VTpl.TryExecute(); err != nil {
+			return "", err
+		}
+	} else {
+		record, err := e.VSpec.Generate(jtctx.JrContext)
+		if err != nil {
+			return "", err
+		}
+		if e.Formatter != nil {
+			return e.Formatter.FormatObject(record)
+		}
+		b, err := e.VEncoder.Encode(record)
+		if err != nil {
+			return "", err
+		}
+		v = string(b)
+	}
 
+	if e.Formatter != nil {
+		row, err := e.Formatter.Format(v)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error formatting value")
+		}
+		return row, nil
+	}
+	return v, nil
 }
 
+// RunPreload runs the preload records of the emitter. The rows of fromcsv start again from the first one after them.
+func (e *Emitter) RunPreload(ctx context.Context, o any) {
+	e.Run(ctx, e.Preload, o)
+	jtctx.JrContext.PreloadedRecords += e.Preload
+}
+
+// Run generates and produces num records, with the locale of the emitter
 func (e *Emitter) Run(ctx context.Context, num int, o any) {
+	jtctx.JrContext.Locale = e.Locale
+	jtctx.JrContext.StrictLocale = e.StrictLocale
+	// the country index is looked up also when the locale has no country dataset
+	jtctx.JrContext.CountryIndex = functions.LenientIndexOf(strings.ToUpper(e.Locale), "country")
 
+	ctx, endBatch := e.StartSpan(ctx, tracing.ModeBatch, num)
+	defer endBatch()
 	for i := 0; i < num; i++ {
+		jtctx.JrContext.CurrentIterationLoopIndex++
 
-		k := e.KTpl.Execute()
-		v := e.VTpl.Execute()
+		rctx, endRecord := e.StartSpan(ctx, tracing.ModeRecord, 1)
+		k, v, ok := e.Record()
+		if !ok {
+			endRecord()
+			continue
+		}
+		if e.Oneline && e.Formatter == nil {
+			v = strings.ReplaceAll(v, "\n", "")
+		}
 		kInValue := functions.GetV("KEY")
 
 		if kInValue != "" {
-			e.Producer.Produce(ctx, []byte(kInValue), []byte(v), o)
+			e.Produce(rctx, kInValue, v, o)
 		} else {
-			e.Producer.Produce(ctx, []byte(k), []byte(v), o)
+			e.Produce(rctx, k, v, o)
 		}
-		jtctx.JrContext.GeneratedObjects++
-		jtctx.JrContext.GeneratedBytes += int64(len(v))
+		endRecord()
+	}
+
+}
+
+// StartSpan starts the span of a record or of a batch of records, if tracing is in that mode, and sets the ids
+// returned by trace_id and span_id. The returned function ends the span
+func (e *Emitter) StartSpan(ctx context.Context, mode string, records int) (context.Context, func()) {
+	current := tracing.Mode()
+	if current != mode {
+		if current == tracing.ModeNone && mode == tracing.ModeRecord {
+			// every record gets new random ids
+			e.traceID, e.spanID = "", ""
+		}
+		return ctx, func() {}
+	}
+	ctx, span := tracing.Start(ctx, e.Name+" "+mode,
+		attribute.String("jr.emitter", e.Name),
+		attribute.String("jr.output", e.Output),
+		attribute.Int("jr.records", records),
+		attribute.String("messaging.destination.name", e.Topic),
+	)
+	sc := span.SpanContext()
+	e.traceID, e.spanID = sc.TraceID().String(), sc.SpanID().String()
+	return ctx, func() { span.End() }
+}
+
+// Produce sends a key and a value to the producer, injecting faults if configured
+func (e *Emitter) Produce(ctx context.Context, key string, value string, o any) {
+	if e.Formatter != nil {
+		// the csv header is its own record, which faults don't change
+		if header := e.Formatter.PendingHeader(); header != "" {
+			e.send(ctx, Message{Value: header}, o)
+		}
+	}
+	if e.Injector == nil {
+		e.send(ctx, Message{Key: key, Value: value}, o)
+		return
+	}
+	for _, m := range e.Injector.Inject(key, value) {
+		e.send(ctx, m, o)
+	}
+}
 
+// Flush sends the messages held by the fault injector, if any
+func (e *Emitter) Flush(ctx context.Context, o any) {
+	if e.Injector == nil {
+		return
+	}
+	for _, m := range e.Injector.Flush() {
+		e.send(ctx, m, o)
 	}
+}
 
+func (e *Emitter) send(ctx context.Context, m Message, o any) {
+	headers := map[string]string{}
+	if e.Injector != nil {
+		for k, v := range e.Injector.Headers(m) {
+			headers[k] = v
+		}
+	}
+	tracing.Inject(ctx, headers)
+	if len(headers) > 0 {
+		ctx = jtctx.WithHeaders(ctx, headers)
+	}
+	start := time.Now()
+	e.Producer.Produce(ctx, []byte(m.Key), []byte(m.Value), o)
+	metrics.Produced(e.Name, e.Output, len(m.Value), time.Since(start))
+	jtctx.JrContext.GeneratedObjects++
+	jtctx.JrContext.GeneratedBytes += int64(len(m.Value))
 }
 
 func createRedisProducer(_ context.Context, ttl time.Duration, redisConfig string) Producer {
@@ -297,6 +623,13 @@ func createWAMPProducer(ctx context.Context, config string) Producer {
 	return producer
 }
 
+func createOTLPProducer(_ context.Context, config string) Producer {
+	producer := &otlp.Producer{}
+	producer.Initialize(config)
+
+	return producer
+}
+
 func createKafkaProducer(ctx context.Context, conf configuration.GlobalConfiguration, topic string, templateType string) *kafka.Manager {
 
 	kManager := &kafka.Manager{
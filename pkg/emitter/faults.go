@@ -0,0 +1,475 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package emitter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/jrnd-io/jr/pkg/functions"
+)
+
+const (
+	FaultDropField     = "drop_field"
+	FaultNullField     = "null_field"
+	FaultWrongType     = "wrong_type"
+	FaultTruncate      = "truncate"
+	FaultDuplicate     = "duplicate"
+	FaultNearDuplicate = "near_duplicate"
+	FaultReorder       = "reorder"
+	FaultEncoding      = "encoding"
+	FaultSchemaDrift   = "schema_drift"
+)
+
+// FaultTypes are all the supported faults
+var FaultTypes = []string{FaultDropField, FaultNullField, FaultWrongType, FaultTruncate, FaultDuplicate,
+	FaultNearDuplicate, FaultReorder, FaultEncoding, FaultSchemaDrift}
+
+// fieldFaults are the faults that need a JSON object value
+var fieldFaults = []string{FaultDropField, FaultNullField, FaultWrongType, FaultSchemaDrift}
+
+// FaultConfig configures the corruption of a fraction of the records of an emitter. Every record is corrupted with
+// probability Rate, with one of the Types (all of them by default). Faults are labelled in the Sidecar file, as
+// JSON lines, and in the Header of the message, for the producers supporting headers.
+type FaultConfig struct {
+	Rate    float64  `mapstructure:"rate"`
+	Types   []string `mapstructure:"types"`
+	Sidecar string   `mapstructure:"sidecar"`
+	Header  string   `mapstructure:"header"`
+}
+
+// FaultLabel describes a fault injected in a message. Seq is the position of the message in the emitter output,
+// Record the index of the generated record, and Of the position of the original message of a duplicate.
+type FaultLabel struct {
+	Seq    int64  `json:"seq"`
+	Record int    `json:"record"`
+	Key    string `json:"key"`
+	Fault  string `json:"fault"`
+	Field  string `json:"field,omitempty"`
+	Of     *int64 `json:"of,omitempty"`
+}
+
+// String returns the label as a header value, like 'drop_field:name'
+func (l FaultLabel) String() string {
+	if l.Field == "" {
+		return l.Fault
+	}
+	return l.Fault + ":" + l.Field
+}
+
+// Message is a message to produce, with its fault label if it is corrupted
+type Message struct {
+	Key   string
+	Value string
+	Label *FaultLabel
+
+	// duplicateOf is the position of the original in the messages of the record, plus one: 0 if not a duplicate
+	duplicateOf int
+	seq         int64
+}
+
+// FaultInjector corrupts the messages of an emitter
+type FaultInjector struct {
+	config  FaultConfig
+	seq     int64
+	held    *Message
+	sidecar *os.File
+	encoder *json.Encoder
+	lock    sync.Mutex
+}
+
+// NewFaultInjector validates the configuration and creates the sidecar file, if any
+func NewFaultInjector(config FaultConfig) (*FaultInjector, error) {
+	if config.Rate < 0 || config.Rate > 1 {
+		return nil, fmt.Errorf("fault rate must be between 0 and 1, got %v", config.Rate)
+	}
+	if len(config.Types) == 0 {
+		config.Types = FaultTypes
+	}
+	for _, t := range config.Types {
+		if !slices.Contains(FaultTypes, t) {
+			return nil, fmt.Errorf("unknown fault type '%s', must be one of %s", t, strings.Join(FaultTypes, ", "))
+		}
+	}
+
+	f := &FaultInjector{config: config}
+	if config.Sidecar != "" {
+		file, err := os.Create(config.Sidecar)
+		if err != nil {
+			return nil, fmt.Errorf("error creating fault sidecar: %w", err)
+		}
+		f.sidecar = file
+		f.encoder = json.NewEncoder(file)
+	}
+	return f, nil
+}
+
+// Inject returns the messages to produce for a record, in order: none if the record is held to be reordered,
+// two if it is duplicated or if a held record is released
+func (f *FaultInjector) Inject(key string, value string) []Message {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	m := Message{Key: key, Value: value}
+	var messages []Message
+	if functions.Random.Float64() < f.config.Rate {
+		messages = f.corrupt(m)
+	} else {
+		messages = []Message{m}
+	}
+
+	if f.held != nil && len(messages) > 0 {
+		messages = append(messages, *f.held)
+		f.held = nil
+	}
+	return f.emit(messages)
+}
+
+// Flush returns the held message, if any
+func (f *FaultInjector) Flush() []Message {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.held == nil {
+		return nil
+	}
+	messages := []Message{*f.held}
+	f.held = nil
+	return f.emit(messages)
+}
+
+// Close closes the sidecar file
+func (f *FaultInjector) Close() error {
+	if f.sidecar == nil {
+		return nil
+	}
+	return f.sidecar.Close()
+}
+
+// Headers returns the headers of a message
+func (f *FaultInjector) Headers(m Message) map[string]string {
+	if f.config.Header == "" || m.Label == nil {
+		return nil
+	}
+	return map[string]string{f.config.Header: m.Label.String()}
+}
+
+// emit assigns the position in the output to the messages and writes their labels in the sidecar
+func (f *FaultInjector) emit(messages []Message) []Message {
+	for i := range messages {
+		messages[i].seq = f.seq
+		f.seq++
+	}
+	for i := range messages {
+		m := &messages[i]
+		if m.Label == nil {
+			continue
+		}
+		m.Label.Seq = m.seq
+		if m.duplicateOf > 0 {
+			of := messages[m.duplicateOf-1].seq
+			m.Label.Of = &of
+			m.duplicateOf = 0
+		}
+		if f.encoder != nil {
+			_ = f.encoder.Encode(m.Label)
+		}
+	}
+	return messages
+}
+
+// corrupt applies a random fault, among the ones that can be applied to the message
+func (f *FaultInjector) corrupt(m Message) []Message {
+	fields, isObject := parseObject(m.Value)
+	var types []string
+	for _, t := range f.config.Types {
+		if slices.Contains(fieldFaults, t) && (!isObject || len(fields) == 0) {
+			continue
+		}
+		if t == FaultReorder && f.held != nil {
+			continue
+		}
+		types = append(types, t)
+	}
+	if len(types) == 0 || m.Value == "" {
+		return []Message{m}
+	}
+
+	fault := types[functions.Random.Intn(len(types))]
+	label := &FaultLabel{Record: ctx.JrContext.CurrentIterationLoopIndex, Key: m.Key, Fault: fault}
+	corrupted := m
+	corrupted.Label = label
+
+	switch fault {
+	case FaultDropField:
+		i := functions.Random.Intn(len(fields))
+		label.Field = fields[i].key
+		corrupted.Value = fields.without(i).String()
+	case FaultNullField:
+		i := functions.Random.Intn(len(fields))
+		label.Field = fields[i].key
+		fields[i].value = json.RawMessage("null")
+		corrupted.Value = fields.String()
+	case FaultWrongType:
+		i := functions.Random.Intn(len(fields))
+		label.Field = fields[i].key
+		fields[i].value = wrongType(fields[i].value)
+		corrupted.Value = fields.String()
+	case FaultSchemaDrift:
+		i := functions.Random.Intn(len(fields))
+		if functions.Random.Intn(2) == 0 {
+			label.Field = renameField(fields[i].key)
+			fields[i].key = label.Field
+		} else {
+			label.Field = fmt.Sprintf("extra_%d", functions.Random.Intn(1000))
+			fields = append(fields, field{key: label.Field, value: json.RawMessage(strconv.Quote(functions.RandomString(4, 12)))})
+		}
+		corrupted.Value = fields.String()
+	case FaultTruncate:
+		corrupted.Value = truncate(m.Value)
+	case FaultEncoding:
+		if isObject {
+			if i, ok := stringField(fields); ok {
+				label.Field = fields[i].key
+				// the raw content keeps its JSON escapes, and the invalid bytes go at its start
+				content := string(fields[i].value[1 : len(fields[i].value)-1])
+				if s, ok := mojibake(content); ok {
+					content = s
+				} else {
+					content = invalidUTF8 + content
+				}
+				fields[i].value = json.RawMessage(`"` + content + `"`)
+				corrupted.Value = fields.String()
+				break
+			}
+		}
+		corrupted.Value = badEncoding(m.Value)
+	case FaultDuplicate:
+		corrupted.duplicateOf = 1
+		return []Message{m, corrupted}
+	case FaultNearDuplicate:
+		if isObject {
+			if i, ok := stringField(fields); ok {
+				label.Field = fields[i].key
+				var s string
+				_ = json.Unmarshal(fields[i].value, &s)
+				fields[i].value = json.RawMessage(strconv.Quote(typo(s)))
+				corrupted.Value = fields.String()
+			} else {
+				corrupted.Value = typo(m.Value)
+			}
+		} else {
+			corrupted.Value = typo(m.Value)
+		}
+		corrupted.duplicateOf = 1
+		return []Message{m, corrupted}
+	case FaultReorder:
+		f.held = &corrupted
+		return nil
+	}
+	return []Message{corrupted}
+}
+
+// field is a field of a JSON object, in the original order
+type field struct {
+	key   string
+	value json.RawMessage
+}
+
+type fieldList []field
+
+// parseObject returns the fields of a JSON object, keeping their order
+func parseObject(value string) (fieldList, bool) {
+	dec := json.NewDecoder(strings.NewReader(value))
+	dec.UseNumber()
+	t, err := dec.Token()
+	if err != nil || t != json.Delim('{') {
+		return nil, false
+	}
+	var fields fieldList
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, false
+		}
+		key, ok := t.(string)
+		if !ok {
+			return nil, false
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, false
+		}
+		fields = append(fields, field{key: key, value: raw})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, false
+	}
+	return fields, true
+}
+
+func (fields fieldList) without(i int) fieldList {
+	return append(slices.Clone(fields[:i]), fields[i+1:]...)
+}
+
+// String returns the fields as a compact JSON object
+func (fields fieldList) String() string {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Quote(f.key))
+		b.WriteByte(':')
+		if err := json.Compact(&b, f.value); err != nil {
+			b.Write(f.value)
+		}
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// stringField returns the index of a random string field
+func stringField(fields fieldList) (int, bool) {
+	var candidates []int
+	for i, f := range fields {
+		if len(f.value) > 2 && f.value[0] == '"' {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return 0, false
+	}
+	return candidates[functions.Random.Intn(len(candidates))], true
+}
+
+// wrongType returns a value of a different JSON type
+func wrongType(value json.RawMessage) json.RawMessage {
+	switch v := strings.TrimSpace(string(value)); {
+	case strings.HasPrefix(v, `"`):
+		var s string
+		_ = json.Unmarshal(value, &s)
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			// a number in a string becomes a number
+			return json.RawMessage(s)
+		}
+		return json.RawMessage(strconv.Itoa(len(s)))
+	case v == "true" || v == "false":
+		return json.RawMessage(strconv.Quote(strings.ToUpper(v[:1]) + v[1:]))
+	case v == "null":
+		return json.RawMessage("0")
+	case strings.HasPrefix(v, "{") || strings.HasPrefix(v, "["):
+		return json.RawMessage(strconv.Quote(v))
+	default:
+		return json.RawMessage(strconv.Quote(v))
+	}
+}
+
+// renameField changes the naming convention of a field, from camelCase to snake_case and vice versa
+func renameField(key string) string {
+	if strings.Contains(key, "_") {
+		parts := strings.Split(key, "_")
+		for i := 1; i < len(parts); i++ {
+			if parts[i] != "" {
+				parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+			}
+		}
+		return strings.Join(parts, "")
+	}
+	var b strings.Builder
+	for i, r := range key {
+		if unicode.IsUpper(r) && i > 0 {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	if b.String() == key {
+		return strings.ToUpper(key)
+	}
+	return b.String()
+}
+
+// truncate cuts a value at a random rune boundary
+func truncate(value string) string {
+	if len(value) < 2 {
+		return ""
+	}
+	i := 1 + functions.Random.Intn(len(value)-1)
+	for i > 0 && !utf8.RuneStart(value[i]) {
+		i--
+	}
+	return value[:i]
+}
+
+// invalidUTF8 is a truncated two bytes UTF-8 sequence
+const invalidUTF8 = "\xc3\x28"
+
+// mojibake double encodes the non ASCII characters of a string, as if UTF-8 were read as Latin-1.
+// It returns false if the string is ASCII.
+func mojibake(s string) (string, bool) {
+	var b strings.Builder
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			ascii = false
+			b.WriteRune(rune(s[i]))
+		} else {
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), !ascii
+}
+
+// badEncoding returns the mojibake of a string, or adds an invalid UTF-8 sequence to ASCII strings
+func badEncoding(s string) string {
+	if m, ok := mojibake(s); ok {
+		return m
+	}
+	i := functions.Random.Intn(len(s) + 1)
+	return s[:i] + invalidUTF8 + s[i:]
+}
+
+// typo swaps two adjacent characters, or changes the last one
+func typo(s string) string {
+	r := []rune(s)
+	if len(r) < 2 {
+		return s + "x"
+	}
+	i := functions.Random.Intn(len(r) - 1)
+	if r[i] == r[i+1] {
+		r[len(r)-1] = 'x'
+		if s == string(r) {
+			r[len(r)-1] = 'y'
+		}
+		return string(r)
+	}
+	r[i], r[i+1] = r[i+1], r[i]
+	return string(r)
+}
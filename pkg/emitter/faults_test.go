@@ -0,0 +1,241 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package emitter_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"unicode/utf8"
+
+	jrctx "github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/jrnd-io/jr/pkg/emitter"
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/stretchr/testify/require"
+)
+
+const faultValue = `{"name":"Anna","city":"Roma","age":42,"active":true}`
+
+// injectOne corrupts faultValue with a single fault type
+func injectOne(t *testing.T, fault string) []emitter.Message {
+	f, err := emitter.NewFaultInjector(emitter.FaultConfig{Rate: 1, Types: []string{fault}})
+	require.NoError(t, err)
+	return f.Inject("k", faultValue)
+}
+
+func decode(t *testing.T, value string) map[string]any {
+	var m map[string]any
+	require.NoError(t, json.Unmarshal([]byte(value), &m), value)
+	return m
+}
+
+func TestFieldFaults(t *testing.T) {
+	functions.SetSeed(1)
+	for i := 0; i < 20; i++ {
+		m := injectOne(t, emitter.FaultDropField)
+		require.Len(t, m, 1)
+		require.Equal(t, emitter.FaultDropField, m[0].Label.Fault)
+		v := decode(t, m[0].Value)
+		require.Len(t, v, 3)
+		require.NotContains(t, v, m[0].Label.Field)
+
+		m = injectOne(t, emitter.FaultNullField)
+		v = decode(t, m[0].Value)
+		require.Len(t, v, 4)
+		require.Nil(t, v[m[0].Label.Field])
+
+		m = injectOne(t, emitter.FaultWrongType)
+		v = decode(t, m[0].Value)
+		original := decode(t, faultValue)
+		require.NotEqual(t, typeName(original[m[0].Label.Field]), typeName(v[m[0].Label.Field]))
+
+		m = injectOne(t, emitter.FaultSchemaDrift)
+		v = decode(t, m[0].Value)
+		require.Contains(t, v, m[0].Label.Field)
+		require.NotContains(t, original, m[0].Label.Field)
+	}
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	case nil:
+		return "null"
+	default:
+		return "object"
+	}
+}
+
+func TestValueFaults(t *testing.T) {
+	functions.SetSeed(2)
+	for i := 0; i < 20; i++ {
+		m := injectOne(t, emitter.FaultTruncate)
+		require.Less(t, len(m[0].Value), len(faultValue))
+		require.True(t, len(m[0].Value) > 0 && faultValue[:len(m[0].Value)] == m[0].Value)
+		require.False(t, json.Valid([]byte(m[0].Value)))
+
+		m = injectOne(t, emitter.FaultEncoding)
+		require.Contains(t, []string{"name", "city"}, m[0].Label.Field)
+		require.False(t, utf8.ValidString(m[0].Value))
+	}
+
+	// non JSON values get only the faults that don't need fields
+	f, err := emitter.NewFaultInjector(emitter.FaultConfig{Rate: 1, Types: []string{emitter.FaultDropField}})
+	require.NoError(t, err)
+	m := f.Inject("k", "a,b,c")
+	require.Equal(t, []emitter.Message{{Key: "k", Value: "a,b,c"}}, m)
+
+	f, err = emitter.NewFaultInjector(emitter.FaultConfig{Rate: 1, Types: []string{emitter.FaultEncoding}})
+	require.NoError(t, err)
+	m = f.Inject("k", "città")
+	require.Equal(t, "cittÃ ", m[0].Value)
+}
+
+func TestDuplicateFaults(t *testing.T) {
+	m := injectOne(t, emitter.FaultDuplicate)
+	require.Len(t, m, 2)
+	require.Nil(t, m[0].Label)
+	require.Equal(t, m[0].Value, m[1].Value)
+	require.Equal(t, int64(0), *m[1].Label.Of)
+	require.Equal(t, int64(1), m[1].Label.Seq)
+
+	m = injectOne(t, emitter.FaultNearDuplicate)
+	require.Len(t, m, 2)
+	require.Equal(t, faultValue, m[0].Value)
+	require.NotEqual(t, m[0].Value, m[1].Value)
+	require.Len(t, decode(t, m[1].Value), 4)
+
+	// duplicates point to the position of their original in the output, after the earlier records
+	f, err := emitter.NewFaultInjector(emitter.FaultConfig{Rate: 1, Types: []string{emitter.FaultDuplicate}})
+	require.NoError(t, err)
+	for i := int64(0); i < 3; i++ {
+		m = f.Inject("k", faultValue)
+		require.Len(t, m, 2)
+		require.Equal(t, 2*i+1, m[1].Label.Seq)
+		require.Equal(t, 2*i, *m[1].Label.Of)
+	}
+}
+
+func TestReorderFault(t *testing.T) {
+	f, err := emitter.NewFaultInjector(emitter.FaultConfig{Rate: 1, Types: []string{emitter.FaultReorder}})
+	require.NoError(t, err)
+
+	require.Empty(t, f.Inject("1", "first"))
+	// a second record can't be held, so it goes out clean before the first one
+	m := f.Inject("2", "second")
+	require.Len(t, m, 2)
+	require.Equal(t, "second", m[0].Value)
+	require.Nil(t, m[0].Label)
+	require.Equal(t, "first", m[1].Value)
+	require.Equal(t, emitter.FaultReorder, m[1].Label.Fault)
+	require.Equal(t, int64(1), m[1].Label.Seq)
+
+	require.Empty(t, f.Inject("3", "third"))
+	m = f.Flush()
+	require.Len(t, m, 1)
+	require.Equal(t, "third", m[0].Value)
+	require.Empty(t, f.Flush())
+}
+
+func TestFaultRateAndLabels(t *testing.T) {
+	functions.SetSeed(3)
+	sidecar := filepath.Join(t.TempDir(), "faults.jsonl")
+	f, err := emitter.NewFaultInjector(emitter.FaultConfig{Rate: 0.2, Sidecar: sidecar, Header: "jr-fault"})
+	require.NoError(t, err)
+
+	var messages []emitter.Message
+	for i := 0; i < 1000; i++ {
+		messages = append(messages, f.Inject(strconv.Itoa(i), faultValue)...)
+	}
+	messages = append(messages, f.Flush()...)
+	require.NoError(t, f.Close())
+
+	labelled := map[int64]emitter.FaultLabel{}
+	for i, m := range messages {
+		if m.Label != nil {
+			labelled[int64(i)] = *m.Label
+			require.Equal(t, map[string]string{"jr-fault": m.Label.String()}, f.Headers(m))
+		} else {
+			require.Nil(t, f.Headers(m))
+			require.Equal(t, faultValue, m.Value)
+		}
+	}
+	require.InDelta(t, 200, len(labelled), 50)
+
+	file, err := os.Open(sidecar)
+	require.NoError(t, err)
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	lines := 0
+	for scanner.Scan() {
+		var l emitter.FaultLabel
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &l))
+		require.Equal(t, labelled[l.Seq], l)
+		lines++
+	}
+	require.Equal(t, len(labelled), lines)
+}
+
+func TestFaultConfig(t *testing.T) {
+	_, err := emitter.NewFaultInjector(emitter.FaultConfig{Rate: 2})
+	require.Error(t, err)
+	_, err = emitter.NewFaultInjector(emitter.FaultConfig{Rate: 0.1, Types: []string{"explode"}})
+	require.Error(t, err)
+}
+
+// recorder is a producer keeping the produced values
+type recorder struct {
+	values  []string
+	headers []map[string]string
+}
+
+func (r *recorder) Produce(ctx context.Context, _ []byte, v []byte, _ any) {
+	r.values = append(r.values, string(v))
+	r.headers = append(r.headers, jrctx.Headers(ctx))
+}
+
+func (r *recorder) Close(_ context.Context) error {
+	return nil
+}
+
+func TestEmitterFaults(t *testing.T) {
+	injector, err := emitter.NewFaultInjector(emitter.FaultConfig{Rate: 1, Types: []string{emitter.FaultReorder}, Header: "jr-fault"})
+	require.NoError(t, err)
+	r := &recorder{}
+	e := emitter.Emitter{Producer: r, Injector: injector}
+
+	e.Produce(context.Background(), "k", "a", nil)
+	e.Produce(context.Background(), "k", "b", nil)
+	e.Produce(context.Background(), "k", "c", nil)
+	e.Flush(context.Background(), nil)
+	require.Equal(t, []string{"b", "a", "c"}, r.values)
+	require.Nil(t, r.headers[0])
+	require.Equal(t, map[string]string{"jr-fault": "reorder"}, r.headers[1])
+}
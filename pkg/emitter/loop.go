@@ -26,9 +26,9 @@ import (
 	"github.com/jrnd-io/jr/pkg/configuration"
 	jrctx "github.com/jrnd-io/jr/pkg/ctx"
 	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/jrnd-io/jr/pkg/metrics"
 	"os"
 	"os/signal"
-	"strings"
 	"sync"
 	"time"
 )
@@ -65,8 +65,9 @@ func InitializeEmitters(ctx context.Context, emitters []Emitter, dryrun bool, em
 			emitters[i].Output = "stdout"
 		}
 		emitters[i].Initialize(ctx, configuration.GlobalCfg)
+		metrics.Track(emitters[i].Name, emitters[i].Output, emitters[i].Producer)
 		emittersToRun = append(emittersToRun, emitters[i])
-		emitters[i].Run(ctx, emitters[i].Preload, nil)
+		emitters[i].RunPreload(ctx, nil)
 	}
 	return emittersToRun
 }
@@ -104,7 +105,8 @@ func DoLoop(ctx context.Context, es []Emitter) {
 					case <-controlC.Done():
 						stop()
 						return
-					case <-ticker.C:
+					case tick := <-ticker.C:
+						metrics.TickLag(es[index].Name, time.Since(tick))
 						doTemplate(ctx, es[index])
 					case <-stopChannels[timerIndex]:
 						return
@@ -125,35 +127,19 @@ func DoLoop(ctx context.Context, es []Emitter) {
 }
 
 func doTemplate(ctx context.Context, emitter Emitter) {
-	jrctx.JrContext.Locale = emitter.Locale
-	jrctx.JrContext.CountryIndex = functions.IndexOf(strings.ToUpper(emitter.Locale), "country")
-
-	for i := 0; i < emitter.Num; i++ {
-		jrctx.JrContext.CurrentIterationLoopIndex++
-
-		k := emitter.KTpl.Execute()
-		v := emitter.VTpl.Execute()
-		if emitter.Oneline {
-			v = strings.ReplaceAll(v, "\n", "")
-		}
-		kInValue := functions.GetV("KEY")
-
-		if (kInValue) != "" {
-			emitter.Producer.Produce(ctx, []byte(kInValue), []byte(v), nil)
-		} else {
-			emitter.Producer.Produce(ctx, []byte(k), []byte(v), nil)
-		}
-
-		jrctx.JrContext.GeneratedObjects++
-		jrctx.JrContext.GeneratedBytes += int64(len(v))
-	}
-
+	emitter.Run(ctx, emitter.Num, nil)
 }
 
 func CloseProducers(ctx context.Context, es map[string][]Emitter) {
 	for _, v := range es {
 		for i := 0; i < len(v); i++ {
 			p := v[i].Producer
+			if p != nil && v[i].Injector != nil {
+				v[i].Flush(ctx, nil)
+				if err := v[i].Injector.Close(); err != nil {
+					fmt.Printf("Error in closing fault sidecar: %v\n", err)
+				}
+			}
 			if p != nil {
 				if err := p.Close(ctx); err != nil {
 					fmt.Printf("Error in closing producers: %v\n", err)
@@ -161,6 +147,7 @@ func CloseProducers(ctx context.Context, es map[string][]Emitter) {
 			}
 		}
 	}
+	functions.CloseCsvDatasets()
 	time.Sleep(100 * time.Millisecond)
 }
 
@@ -0,0 +1,53 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package emitter_test
+
+import (
+	"context"
+	"testing"
+
+	jrctx "github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/jrnd-io/jr/pkg/emitter"
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/jrnd-io/jr/pkg/tpl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmitterPreloadCsvRows(t *testing.T) {
+	index, preloaded := jrctx.JrContext.CurrentIterationLoopIndex, jrctx.JrContext.PreloadedRecords
+	jrctx.JrContext.CurrentIterationLoopIndex, jrctx.JrContext.PreloadedRecords = 0, 0
+	t.Cleanup(func() {
+		jrctx.JrContext.CurrentIterationLoopIndex, jrctx.JrContext.PreloadedRecords = index, preloaded
+		jrctx.JrContext.CtxCSV = make(map[int]map[string]string)
+	})
+	require.NoError(t, functions.InitCSV("../../testfiles/test3.csv"))
+
+	k, err := tpl.NewTpl("key", "k", functions.FunctionsMap(), &jrctx.JrContext)
+	require.NoError(t, err)
+	v, err := tpl.NewTpl("value", `{{fromcsv "NAME"}}`, functions.FunctionsMap(), &jrctx.JrContext)
+	require.NoError(t, err)
+	r := &recorder{}
+	e := emitter.Emitter{Name: "preload", Output: "test", Preload: 2, Producer: r, KTpl: k, VTpl: v}
+
+	// the records after the preload start again from the first row, as without preload
+	e.RunPreload(context.Background(), nil)
+	e.Run(context.Background(), 3, nil)
+	require.Equal(t, []string{"John", "Mary", "John", "Mary", "Anna"}, r.values)
+}
@@ -0,0 +1,157 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package emitter_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	jrctx "github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/jrnd-io/jr/pkg/emitter"
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/jrnd-io/jr/pkg/tpl"
+	"github.com/jrnd-io/jr/pkg/tracing"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// tracedEmitter returns an emitter of records carrying their trace and span ids
+func tracedEmitter(t *testing.T, r *recorder) emitter.Emitter {
+	k, err := tpl.NewTpl("key", "k", functions.FunctionsMap(), &jrctx.JrContext)
+	require.NoError(t, err)
+	v, err := tpl.NewTpl("value", "{{trace_id}} {{span_id}} {{trace_id}}", functions.FunctionsMap(), &jrctx.JrContext)
+	require.NoError(t, err)
+	return emitter.Emitter{Name: "traced", Output: "test", Producer: r, KTpl: k, VTpl: v}
+}
+
+// keepingExporter keeps the spans on shutdown
+type keepingExporter struct {
+	*tracetest.InMemoryExporter
+}
+
+func (keepingExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+func useTracing(t *testing.T, mode string) keepingExporter {
+	exporter := keepingExporter{tracetest.NewInMemoryExporter()}
+	require.NoError(t, tracing.Init(context.Background(), tracing.Config{Mode: mode, Exporter: exporter}))
+	t.Cleanup(func() {
+		require.NoError(t, tracing.Shutdown(context.Background()))
+	})
+	return exporter
+}
+
+func TestEmitterRecordSpans(t *testing.T) {
+	exporter := useTracing(t, tracing.ModeRecord)
+	r := &recorder{}
+	e := tracedEmitter(t, r)
+	e.Run(context.Background(), 3, nil)
+	require.NoError(t, tracing.Shutdown(context.Background()))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	require.Len(t, r.values, 3)
+	for i, span := range spans {
+		traceID, spanID := span.SpanContext.TraceID().String(), span.SpanContext.SpanID().String()
+		require.Equal(t, "traced record", span.Name)
+		require.Equal(t, traceID+" "+spanID+" "+traceID, r.values[i])
+		require.Equal(t, "00-"+traceID+"-"+spanID+"-01", r.headers[i]["traceparent"])
+	}
+	require.NotEqual(t, spans[0].SpanContext.TraceID(), spans[1].SpanContext.TraceID())
+}
+
+func TestEmitterConcurrentSpans(t *testing.T) {
+	// an emitter rendering a record keeps the ids of its span, also when another emitter starts one meanwhile
+	useTracing(t, tracing.ModeRecord)
+	waiting, started := make(chan struct{}), make(chan struct{})
+	fmap := map[string]any{
+		"wait": func() string {
+			close(waiting)
+			select {
+			case <-started:
+			case <-time.After(200 * time.Millisecond):
+			}
+			return ""
+		},
+		"started": func() string {
+			close(started)
+			return ""
+		},
+	}
+	for name, f := range functions.FunctionsMap() {
+		fmap[name] = f
+	}
+	traced := func(r *recorder, value string) emitter.Emitter {
+		k, err := tpl.NewTpl("key", "k", fmap, &jrctx.JrContext)
+		require.NoError(t, err)
+		v, err := tpl.NewTpl("value", value, fmap, &jrctx.JrContext)
+		require.NoError(t, err)
+		return emitter.Emitter{Name: "traced", Output: "test", Producer: r, KTpl: k, VTpl: v}
+	}
+
+	first, second := &recorder{}, &recorder{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e := traced(first, "{{wait}}{{trace_id}} {{span_id}}")
+		e.Run(context.Background(), 1, nil)
+	}()
+	<-waiting
+	e := traced(second, "{{started}}{{trace_id}} {{span_id}}")
+	e.Run(context.Background(), 1, nil)
+	<-done
+
+	for _, r := range []*recorder{first, second} {
+		require.Len(t, r.values, 1)
+		ids := strings.Fields(r.values[0])
+		require.Equal(t, "00-"+ids[0]+"-"+ids[1]+"-01", r.headers[0]["traceparent"])
+	}
+}
+
+func TestEmitterBatchSpans(t *testing.T) {
+	exporter := useTracing(t, tracing.ModeBatch)
+	r := &recorder{}
+	e := tracedEmitter(t, r)
+	e.Run(context.Background(), 3, nil)
+	require.NoError(t, tracing.Shutdown(context.Background()))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	require.Equal(t, "traced batch", spans[0].Name)
+	for i := range r.values {
+		require.Equal(t, r.values[0], r.values[i])
+		require.Contains(t, r.headers[i]["traceparent"], spans[0].SpanContext.TraceID().String())
+	}
+}
+
+func TestEmitterWithoutSpans(t *testing.T) {
+	r := &recorder{}
+	e := tracedEmitter(t, r)
+	e.Run(context.Background(), 2, nil)
+
+	require.Len(t, r.values, 2)
+	require.NotEqual(t, r.values[0], r.values[1])
+	require.Regexp(t, `^[0-9a-f]{32} [0-9a-f]{16} [0-9a-f]{32}$`, r.values[0])
+	require.Nil(t, r.headers[0])
+}
@@ -0,0 +1,88 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package emitter_test
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	jrctx "github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/jrnd-io/jr/pkg/emitter"
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/jrnd-io/jr/pkg/spec"
+	"github.com/jrnd-io/jr/pkg/tpl"
+	"github.com/stretchr/testify/require"
+)
+
+func uniqueEmitter(t *testing.T, r *recorder, value string) emitter.Emitter {
+	functions.ResetUniques()
+	t.Cleanup(functions.ResetUniques)
+	k, err := tpl.NewTpl("key", "k", functions.FunctionsMap(), &jrctx.JrContext)
+	require.NoError(t, err)
+	v, err := tpl.NewTpl("value", value, functions.FunctionsMap(), &jrctx.JrContext)
+	require.NoError(t, err)
+	return emitter.Emitter{Name: "unique", Output: "test", Producer: r, KTpl: k, VTpl: v}
+}
+
+func TestEmitterUniqueValue(t *testing.T) {
+	// duplicates are generated again, and records are skipped without stopping jr when the values are exhausted
+	r := &recorder{}
+	e := uniqueEmitter(t, r, `{{unique_value "digits" (integer 0 10)}}`)
+	e.Run(context.Background(), 15, nil)
+
+	sort.Strings(r.values)
+	require.Equal(t, []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}, r.values)
+	require.EqualValues(t, 10, functions.UniqueCount("digits"))
+}
+
+func TestEmitterUniqueExhausted(t *testing.T) {
+	r := &recorder{}
+	e := uniqueEmitter(t, r, `{{unique "pair" "integer" 0 2}}`)
+	require.NoError(t, functions.InitUnique(functions.UniqueConfig{Name: "pair", Retries: 20}))
+	e.Run(context.Background(), 4, nil)
+
+	sort.Strings(r.values)
+	require.Equal(t, []string{"0", "1"}, r.values)
+}
+
+func TestEmitterUniqueSpec(t *testing.T) {
+	// records from a spec are generated again and skipped too
+	r := &recorder{}
+	e := uniqueEmitter(t, r, "")
+	s, err := spec.Parse([]byte(`
+fields:
+  digit:
+    type: int
+    value: '{{unique_value "spec_digits" (integer 0 1000)}}'
+  pair: '{{unique "spec_pair" "integer" 0 2}}'
+`))
+	require.NoError(t, err)
+	require.NoError(t, s.Compile(functions.FunctionsMap()))
+	e.VSpec = s
+	e.VEncoder, err = spec.NewEncoder(s)
+	require.NoError(t, err)
+	require.NoError(t, functions.InitUnique(functions.UniqueConfig{Name: "spec_pair", Retries: 20}))
+	e.Run(context.Background(), 4, nil)
+
+	require.Len(t, r.values, 2)
+	require.EqualValues(t, 2, functions.UniqueCount("spec_pair"))
+}
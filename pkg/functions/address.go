@@ -133,7 +133,11 @@ func NearbyGPS(latitude float64, longitude float64, radius int) string {
 // NearbyGPSIntoPolygon generates a random latitude and longitude within a specified radius (in meters)
 // from an initial point and checks if the generated point falls within the boundaries of a polygon
 // defined in a GeoJSON file. If successful, it returns the coordinates as a formatted string.
-func NearbyGPSIntoPolygon(latitude float64, longitude float64, radius int) string {
+// With selectors, the polygons are the ones of a feature of a named GeoJSON dataset, see nearbyGPSIntoFeature.
+func NearbyGPSIntoPolygon(latitude float64, longitude float64, radius int, selectors ...string) string {
+	if len(selectors) > 0 {
+		return nearbyGPSIntoFeature(selectors, radius, latitude, longitude, true)
+	}
 	// Lock the GeoJSON context to ensure thread safety
 	ctx.JrContext.CtxGeoJsonLock.Lock()
 	defer ctx.JrContext.CtxGeoJsonLock.Unlock()
@@ -160,14 +164,54 @@ func NearbyGPSIntoPolygon(latitude float64, longitude float64, radius int) strin
 		return fmt.Sprintf("%.12f %.12f", lastLat, lastLon)
 	}
 
+	inside := func(lat, lon float64) bool {
+		return isPointInPolygon([]float64{lat, lon}, ctx.JrContext.CtxGeoJson)
+	}
+	newLatitude, newLongitude, found := nearbyPoint(lastLat, lastLon, radius, inside)
+	if !found && len(ctx.JrContext.CtxLastPointLat) > 0 && len(ctx.JrContext.CtxLastPointLon) > 0 {
+		// the predicted point drifted away from the polygon: restart from the last known point
+		lastLat = ctx.JrContext.CtxLastPointLat[len(ctx.JrContext.CtxLastPointLat)-1]
+		lastLon = ctx.JrContext.CtxLastPointLon[len(ctx.JrContext.CtxLastPointLon)-1]
+		newLatitude, newLongitude, found = nearbyPoint(lastLat, lastLon, radius, inside)
+	}
+	if !found {
+		newLatitude, newLongitude = lastLat, lastLon
+	}
+
+	// Update the context with the new valid point, maintaining a maximum ctx of 10 points
+	ctx.JrContext.CtxLastPointLat, ctx.JrContext.CtxLastPointLon = appendToTrail(ctx.JrContext.CtxLastPointLat, ctx.JrContext.CtxLastPointLon, newLatitude, newLongitude)
+
+	// Return the coordinates of the valid point
+	return fmt.Sprintf("%.12f %.12f", newLatitude, newLongitude)
+}
+
+// nearbyPointInto returns a random point within radius meters from the point predicted by the trail
+// of the last points, for which inside returns true. If no point is found, the last point of the trail is returned.
+func nearbyPointInto(trailLat, trailLon []float64, radius int, inside func(float64, float64) bool) (float64, float64) {
+	lastLat := trailLat[len(trailLat)-1]
+	lastLon := trailLon[len(trailLon)-1]
+	// Predict the next point if there is enough data for interpolation
+	if len(trailLat) >= 2 && len(trailLon) >= 2 {
+		predictedLat, predictedLon := predictNextPoint(trailLat, trailLon)
+		if lat, lon, found := nearbyPoint(predictedLat, predictedLon, radius, inside); found {
+			return lat, lon
+		}
+	}
+	if lat, lon, found := nearbyPoint(lastLat, lastLon, radius, inside); found {
+		return lat, lon
+	}
+	return lastLat, lastLon
+}
+
+// nearbyPoint returns a random point within radius meters from the given one, for which inside returns true.
+// The radius is slowly expanded if no point is found, giving up after maxNearbyAttempts.
+func nearbyPoint(lastLat, lastLon float64, radius int, inside func(float64, float64) bool) (float64, float64, bool) {
 	// Convert radius to float for calculations
 	radiusInMeters := float64(radius)
 
-	attempts := 0
-
 	// Loop until a valid point within the polygon is found
-	for {
-		if attempts > 10 {
+	for attempts := 0; attempts < maxNearbyAttempts; attempts++ {
+		if attempts > 10 && attempts < 50 {
 			// Slightly expand the search radius to ensure coverage
 			radiusInMeters *= 1.1
 		}
@@ -183,29 +227,34 @@ func NearbyGPSIntoPolygon(latitude float64, longitude float64, radius int) strin
 		newLongitude := lastLon + (distanceInDegrees * math.Sin(randomAngle))
 
 		// Check if the generated point lies within the specified polygon
-		if isPointInPolygon([]float64{newLatitude, newLongitude}, ctx.JrContext.CtxGeoJson) {
-			// Update the context with the new valid point, maintaining a maximum ctx of 10 points
-			ctx.JrContext.CtxLastPointLat = append(ctx.JrContext.CtxLastPointLat, newLatitude)
-			ctx.JrContext.CtxLastPointLon = append(ctx.JrContext.CtxLastPointLon, newLongitude)
-
-			// Keep the last 10 points in the ctx
-			if len(ctx.JrContext.CtxLastPointLat) > 10 {
-				ctx.JrContext.CtxLastPointLat = ctx.JrContext.CtxLastPointLat[1:]
-			}
-			if len(ctx.JrContext.CtxLastPointLon) > 10 {
-				ctx.JrContext.CtxLastPointLon = ctx.JrContext.CtxLastPointLon[1:]
-			}
-			// Return the coordinates of the valid point
-			return fmt.Sprintf("%.12f %.12f", newLatitude, newLongitude)
-			// return fmt.Sprintf("%.12f %.12f %d %.12f", newLatitude, newLongitude, attempts, radiusInMeters)
+		if inside(newLatitude, newLongitude) {
+			return newLatitude, newLongitude, true
 		}
-		attempts++
 		// Retry if the generated point is not within the polygon boundaries
 	}
+	return lastLat, lastLon, false
 }
 
-// NearbyGPSIntoPolygonWithoutStart
-func NearbyGPSIntoPolygonWithoutStart(radius int) string {
+const maxNearbyAttempts = 1000
+
+// appendToTrail appends a point to a trail, keeping the last 10 points
+func appendToTrail(trailLat, trailLon []float64, latitude, longitude float64) ([]float64, []float64) {
+	trailLat = append(trailLat, latitude)
+	trailLon = append(trailLon, longitude)
+	if len(trailLat) > 10 {
+		trailLat = trailLat[1:]
+	}
+	if len(trailLon) > 10 {
+		trailLon = trailLon[1:]
+	}
+	return trailLat, trailLon
+}
+
+// NearbyGPSIntoPolygonWithoutStart is NearbyGPSIntoPolygon starting from a random point of the polygon
+func NearbyGPSIntoPolygonWithoutStart(radius int, selectors ...string) string {
+	if len(selectors) > 0 {
+		return nearbyGPSIntoFeature(selectors, radius, 0, 0, false)
+	}
 	latitude, longitude := selectRandomPoint(ctx.JrContext.CtxGeoJson)
 	return NearbyGPSIntoPolygon(latitude, longitude, radius)
 }
@@ -0,0 +1,395 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/jrnd-io/jr/pkg/constants"
+	"github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/rs/zerolog/log"
+)
+
+// CatalogFile is the file with the product types in '$JR_SYSTEM_DIR/templates/data', as category path,
+// product type, minimum and maximum price and tax class
+const CatalogFile = "catalog"
+
+// CatalogConfig is the configuration of a named product catalog
+type CatalogConfig struct {
+	Name     string `mapstructure:"name" json:"name"`
+	Products int    `mapstructure:"products" json:"products"`
+	// MaxItems is the maximum number of line items of a basket
+	MaxItems int `mapstructure:"maxItems" json:"maxItems"`
+	// DiscountRate is the probability of a discount on a line item, 0.2 when it is not set
+	DiscountRate *float64 `mapstructure:"discountRate" json:"discountRate,omitempty"`
+}
+
+// Product is a product of a catalog. Prices are in the currency of the locale, before taxes.
+type Product struct {
+	SKU          string   `json:"sku"`
+	Name         string   `json:"name"`
+	Category     string   `json:"category"`
+	CategoryPath []string `json:"category_path"`
+	Price        float64  `json:"price"`
+	Currency     string   `json:"currency"`
+	TaxClass     string   `json:"tax_class"`
+	TaxRate      float64  `json:"tax_rate"`
+	cents        int64
+}
+
+// LineItem is a line of a basket, where Subtotal is Quantity × UnitPrice and Total is Subtotal - Discount + Tax
+type LineItem struct {
+	SKU       string  `json:"sku"`
+	Name      string  `json:"name"`
+	Category  string  `json:"category"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+	Subtotal  float64 `json:"subtotal"`
+	Discount  float64 `json:"discount"`
+	TaxRate   float64 `json:"tax_rate"`
+	Tax       float64 `json:"tax"`
+	Total     float64 `json:"total"`
+}
+
+// Basket is a set of line items, with the sums of their amounts
+type Basket struct {
+	ID        string     `json:"id"`
+	Currency  string     `json:"currency"`
+	Items     []LineItem `json:"items"`
+	ItemCount int        `json:"item_count"`
+	Subtotal  float64    `json:"subtotal"`
+	Discount  float64    `json:"discount"`
+	Tax       float64    `json:"tax"`
+	Total     float64    `json:"total"`
+}
+
+// productType is a line of the catalog file
+type productType struct {
+	path     []string
+	name     string
+	min      float64
+	max      float64
+	taxClass string
+}
+
+type catalog struct {
+	config     CatalogConfig
+	products   []*Product
+	popularity *aliasTable
+	basket     *Basket
+	record     int
+	lock       sync.Mutex
+}
+
+var catalogs = map[string]*catalog{}
+var catalogsLock sync.RWMutex
+
+var productTypes []productType
+var productTypesLock sync.Mutex
+
+// defaultProductTypes are used when the catalog file is not available
+var defaultProductTypes = []productType{
+	{[]string{"Electronics", "Audio", "Headphones"}, "Headphones", 29, 349, "standard"},
+	{[]string{"Home", "Kitchen", "Appliances"}, "Coffee Maker", 29, 399, "standard"},
+	{[]string{"Books", "Fiction", "Novels"}, "Novel", 7, 29, "reduced"},
+}
+
+var productAdjectives = []string{"Classic", "Pro", "Compact", "Deluxe", "Eco", "Ultra", "Essential", "Premium", "Smart", "Urban", "Vintage", "Lite"}
+
+// discountPercents are the discounts of the discounted line items
+var discountPercents = []int64{5, 10, 15, 20, 25}
+
+// quantities are the weights of the quantities of a line item, from 1
+var quantities = newAliasTable([]float64{60, 22, 9, 5, 4})
+
+// loadProductTypes reads the catalog file once
+func loadProductTypes() {
+	productTypesLock.Lock()
+	defer productTypesLock.Unlock()
+	if productTypes != nil {
+		return
+	}
+
+	templateDir := fmt.Sprintf("%s/%s", constants.JR_SYSTEM_DIR, "templates")
+	filename := fmt.Sprintf("%s/data/%s", os.ExpandEnv(templateDir), CatalogFile)
+	file, err := os.Open(filename)
+	if err != nil {
+		log.Warn().Err(err).Msg("Catalog file not found, using default product types")
+		productTypes = defaultProductTypes
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 5 {
+			continue
+		}
+		minPrice, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			continue
+		}
+		maxPrice, err := strconv.ParseFloat(fields[3], 64)
+		if err != nil || maxPrice < minPrice {
+			continue
+		}
+		productTypes = append(productTypes, productType{strings.Split(fields[0], "/"), fields[1], minPrice, maxPrice, fields[4]})
+	}
+	if len(productTypes) == 0 {
+		productTypes = defaultProductTypes
+	}
+}
+
+// defaultDiscountRate is the discount rate of the catalogs without one
+const defaultDiscountRate = 0.2
+
+// InitCatalog creates a named catalog, replacing the one with the same name
+func InitCatalog(config CatalogConfig) error {
+	c, err := newCatalog(config)
+	if err != nil {
+		return err
+	}
+	catalogsLock.Lock()
+	defer catalogsLock.Unlock()
+	catalogs[config.Name] = c
+	return nil
+}
+
+func newCatalog(config CatalogConfig) (*catalog, error) {
+	if config.Name == "" {
+		return nil, fmt.Errorf("catalog without name")
+	}
+	if config.Products <= 0 {
+		config.Products = 200
+	}
+	if config.MaxItems <= 0 {
+		config.MaxItems = 5
+	}
+	discountRate := defaultDiscountRate
+	if config.DiscountRate != nil {
+		discountRate = *config.DiscountRate
+	}
+	if discountRate < 0 || discountRate > 1 {
+		return nil, fmt.Errorf("catalog %s: discountRate must be between 0 and 1", config.Name)
+	}
+	config.DiscountRate = &discountRate
+
+	loadProductTypes()
+	c := &catalog{config: config, record: -1}
+	skus := map[string]bool{}
+	weights := make([]float64, config.Products)
+	for i := 0; i < config.Products; i++ {
+		t := productTypes[Random.Intn(len(productTypes))]
+		p := &Product{
+			Name:         productAdjectives[Random.Intn(len(productAdjectives))] + " " + t.name,
+			Category:     t.path[len(t.path)-1],
+			CategoryPath: t.path,
+			TaxClass:     t.taxClass,
+		}
+		// prices end in .99, like most retail prices
+		p.cents = int64(t.min+Random.Float64()*(t.max-t.min))*100 + 99
+		for p.SKU == "" || skus[p.SKU] {
+			p.SKU = fmt.Sprintf("%s-%s-%05d", skuPart(t.path[0]), skuPart(p.Category), Random.Intn(100000))
+		}
+		skus[p.SKU] = true
+		c.products = append(c.products, p)
+		// few products sell a lot, most products sell a little
+		weights[i] = 1 / float64(i+1)
+	}
+	c.popularity = newAliasTable(weights)
+	return c, nil
+}
+
+// skuPart returns the first three letters of a category, in upper case
+func skuPart(category string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(category) {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteRune(r)
+			if b.Len() == 3 {
+				break
+			}
+		}
+	}
+	return b.String()
+}
+
+// ResetCatalogs removes all the catalogs
+func ResetCatalogs() {
+	catalogsLock.Lock()
+	defer catalogsLock.Unlock()
+	catalogs = map[string]*catalog{}
+}
+
+// checkCatalog fails with the name of a new catalog when there are already max catalogs
+func checkCatalog(name string, max int) error {
+	catalogsLock.RLock()
+	defer catalogsLock.RUnlock()
+	if _, exists := catalogs[name]; exists || len(catalogs) < max {
+		return nil
+	}
+	return fmt.Errorf("catalog %q is not allowed: at most %d catalogs", name, max)
+}
+
+// getCatalog returns a named catalog, creating it with the default configuration if it doesn't exist
+func getCatalog(name string) (*catalog, error) {
+	catalogsLock.RLock()
+	c, exists := catalogs[name]
+	catalogsLock.RUnlock()
+	if exists {
+		return c, nil
+	}
+
+	log.Debug().Str("catalog", name).Msg("Creating catalog with default configuration")
+	c, err := newCatalog(CatalogConfig{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	catalogsLock.Lock()
+	defer catalogsLock.Unlock()
+	// another record may have created it in the meantime
+	if existing, exists := catalogs[name]; exists {
+		return existing, nil
+	}
+	catalogs[name] = c
+	return c, nil
+}
+
+// pick returns a copy of a product, by popularity, priced in the currency of the locale
+func (c *catalog) pick(currency string, rates map[string]float64) Product {
+	p := *c.products[c.popularity.pick()]
+	p.Currency = currency
+	p.TaxRate = rates[p.TaxClass]
+	p.Price = toMoney(p.cents)
+	return p
+}
+
+func (c *catalog) newBasket() *Basket {
+	currency, rates := LocaleCurrency(ctx.JrContext.Locale)
+	b := &Basket{ID: uuid.NewString(), Currency: currency}
+	var subtotal, discount, tax, total int64
+	seen := map[string]bool{}
+	for n := 1 + Random.Intn(c.config.MaxItems); len(b.Items) < n && len(seen) < len(c.products); {
+		p := c.pick(currency, rates)
+		if seen[p.SKU] {
+			continue
+		}
+		seen[p.SKU] = true
+
+		quantity := 1 + quantities.pick()
+		lineSubtotal := p.cents * int64(quantity)
+		var lineDiscount int64
+		if Random.Float64() < *c.config.DiscountRate {
+			lineDiscount = roundCents(float64(lineSubtotal*discountPercents[Random.Intn(len(discountPercents))]) / 100)
+		}
+		lineTax := roundCents(float64(lineSubtotal-lineDiscount) * p.TaxRate)
+		lineTotal := lineSubtotal - lineDiscount + lineTax
+
+		b.Items = append(b.Items, LineItem{
+			SKU:       p.SKU,
+			Name:      p.Name,
+			Category:  p.Category,
+			Quantity:  quantity,
+			UnitPrice: p.Price,
+			Subtotal:  toMoney(lineSubtotal),
+			Discount:  toMoney(lineDiscount),
+			TaxRate:   p.TaxRate,
+			Tax:       toMoney(lineTax),
+			Total:     toMoney(lineTotal),
+		})
+		b.ItemCount += quantity
+		subtotal += lineSubtotal
+		discount += lineDiscount
+		tax += lineTax
+		total += lineTotal
+	}
+	b.Subtotal, b.Discount, b.Tax, b.Total = toMoney(subtotal), toMoney(discount), toMoney(tax), toMoney(total)
+	return b
+}
+
+// roundCents rounds an amount in cents, half away from zero
+func roundCents(cents float64) int64 {
+	return int64(math.Round(cents))
+}
+
+// toMoney converts cents to an amount with two decimals
+func toMoney(cents int64) float64 {
+	return float64(cents) / 100
+}
+
+// CatalogProduct returns a product of a named catalog, where popular products are returned more often
+func CatalogProduct(name string) (*Product, error) {
+	c, err := getCatalog(name)
+	if err != nil {
+		return nil, err
+	}
+	currency, rates := LocaleCurrency(ctx.JrContext.Locale)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	p := c.pick(currency, rates)
+	return &p, nil
+}
+
+// GetBasket returns the basket of the current record, built from the products of a named catalog
+func GetBasket(name string) (*Basket, error) {
+	c, err := getCatalog(name)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.basket == nil || c.record != ctx.JrContext.CurrentIterationLoopIndex {
+		c.basket = c.newBasket()
+		c.record = ctx.JrContext.CurrentIterationLoopIndex
+	}
+	return c.basket, nil
+}
+
+// String returns the product as JSON
+func (p *Product) String() string {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// String returns the basket as JSON
+func (b *Basket) String() string {
+	j, err := json.Marshal(b)
+	if err != nil {
+		return "{}"
+	}
+	return string(j)
+}
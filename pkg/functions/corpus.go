@@ -0,0 +1,305 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/rs/zerolog/log"
+)
+
+// CorporaDir is the directory of the locale corpora in '$JR_SYSTEM_DIR/templates/data/<locale>'
+const CorporaDir = "corpora"
+
+// chainMagic starts the binary chain files
+const chainMagic = "JRCHAIN1"
+
+// maxSentenceWords limits the sentences of corpora without punctuation
+const maxSentenceWords = 50
+
+// CorpusConfig is the configuration of a named corpus, read from a text file, a directory of text files
+// or a binary chain file. When Chain is set, the chain built from Path is saved there.
+type CorpusConfig struct {
+	Name      string `mapstructure:"name" json:"name"`
+	Path      string `mapstructure:"path" json:"path"`
+	PrefixLen int    `mapstructure:"prefixLen" json:"prefixLen"`
+	Chain     string `mapstructure:"chain" json:"chain"`
+}
+
+var corpora = map[string]*Chain{}
+var corporaLock sync.RWMutex
+
+// BuildSentences reads text from the provided Reader like Build, but restarts the prefix at the end of
+// every sentence and at every empty line, so that generated sentences start like the ones of the text
+func (c *Chain) BuildSentences(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	p := make(Prefix, c.prefixLen)
+	for scanner.Scan() {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			p = make(Prefix, c.prefixLen)
+			continue
+		}
+		for _, s := range words {
+			key := p.String()
+			c.chain[key] = append(c.chain[key], s)
+			p.Shift(s)
+			if endsSentence(s) {
+				p = make(Prefix, c.prefixLen)
+			}
+		}
+	}
+}
+
+// GenerateSentence returns a sentence generated from Chain, capitalized and ending with a punctuation mark
+func (c *Chain) GenerateSentence() string {
+	p := make(Prefix, c.prefixLen)
+	var words []string
+	for len(words) < maxSentenceWords {
+		choices := c.chain[p.String()]
+		if len(choices) == 0 {
+			break
+		}
+		next := choices[Random.Intn(len(choices))]
+		words = append(words, next)
+		if endsSentence(next) {
+			break
+		}
+		p.Shift(next)
+	}
+	if len(words) == 0 {
+		return ""
+	}
+
+	words[0] = capitalize(words[0])
+	last := len(words) - 1
+	if !endsSentence(words[last]) {
+		words[last] = strings.TrimRight(words[last], ",;:-–—") + "."
+	}
+	return strings.Join(words, " ")
+}
+
+// Save writes the chain in binary form
+func (c *Chain) Save(w io.Writer) error {
+	if _, err := io.WriteString(w, chainMagic); err != nil {
+		return err
+	}
+	return gob.NewEncoder(w).Encode(savedChain{PrefixLen: c.prefixLen, Chain: c.chain})
+}
+
+// LoadChain reads a chain written by Save
+func LoadChain(r io.Reader) (*Chain, error) {
+	magic := make([]byte, len(chainMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != chainMagic {
+		return nil, fmt.Errorf("not a chain file")
+	}
+	var s savedChain
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	if s.PrefixLen <= 0 || s.Chain == nil {
+		return nil, fmt.Errorf("invalid chain file")
+	}
+	return &Chain{chain: s.Chain, prefixLen: s.PrefixLen}, nil
+}
+
+type savedChain struct {
+	PrefixLen int
+	Chain     map[string][]string
+}
+
+// endsSentence tells if a word ends a sentence, also when followed by closing quotes or parentheses
+func endsSentence(word string) bool {
+	word = strings.TrimRight(word, `"')]”’»`)
+	return strings.HasSuffix(word, ".") || strings.HasSuffix(word, "!") || strings.HasSuffix(word, "?") || strings.HasSuffix(word, "…")
+}
+
+// capitalize uppercases the first letter of a word, skipping opening quotes and parentheses
+func capitalize(word string) string {
+	for i, r := range word {
+		if unicode.IsLetter(r) {
+			return word[:i] + string(unicode.ToUpper(r)) + word[i+utf8.RuneLen(r):]
+		}
+	}
+	return word
+}
+
+// InitCorpus builds, or loads, the chain of a named corpus, replacing the one with the same name
+func InitCorpus(config CorpusConfig) error {
+	if config.Name == "" {
+		return fmt.Errorf("corpus without name")
+	}
+	if config.Path == "" {
+		return fmt.Errorf("corpus %s without path", config.Name)
+	}
+	if config.PrefixLen <= 0 {
+		config.PrefixLen = 2
+	}
+
+	c, err := readCorpus(config.Path, config.PrefixLen, "")
+	if err != nil {
+		return fmt.Errorf("corpus %s: %w", config.Name, err)
+	}
+	if config.Chain != "" {
+		if err := saveChain(c, config.Chain); err != nil {
+			return fmt.Errorf("corpus %s: %w", config.Name, err)
+		}
+	}
+
+	corporaLock.Lock()
+	defer corporaLock.Unlock()
+	corpora[config.Name] = c
+	return nil
+}
+
+// ResetCorpora removes all the corpora, configured and loaded from the locales
+func ResetCorpora() {
+	corporaLock.Lock()
+	defer corporaLock.Unlock()
+	corpora = map[string]*Chain{}
+}
+
+// getCorpus returns the chain of a named corpus. Corpora that are not configured are read from
+// the corpora directory of the current locale, following the locale chain, and cached per locale.
+func getCorpus(name string) (*Chain, error) {
+	locale := strings.ToLower(ctx.JrContext.Locale)
+	key := locale + "/" + name
+	corporaLock.RLock()
+	c, exists := corpora[name]
+	if !exists {
+		c, exists = corpora[key]
+	}
+	corporaLock.RUnlock()
+	if exists {
+		return c, nil
+	}
+
+	filename, charset, err := datasetFile(filepath.Join(CorporaDir, name), ctx.JrContext.StrictLocale)
+	if err != nil {
+		return nil, err
+	}
+	c, err = readCorpus(filename, 2, charset)
+	if err != nil {
+		return nil, fmt.Errorf("corpus %s: %w", name, err)
+	}
+	log.Debug().Str("corpus", name).Str("locale", locale).Msg("Corpus loaded")
+
+	corporaLock.Lock()
+	defer corporaLock.Unlock()
+	corpora[key] = c
+	return c, nil
+}
+
+// readCorpus builds a chain from a text file or from all the files of a directory, or loads a binary chain file
+func readCorpus(path string, prefixLen int, charset string) (*Chain, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		files = files[:0]
+		for _, entry := range entries {
+			if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+		sort.Strings(files)
+	}
+
+	c := NewChain(prefixLen)
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(content, []byte(chainMagic)) {
+			if len(files) > 1 {
+				return nil, fmt.Errorf("chain file %s in a directory", file)
+			}
+			return LoadChain(bytes.NewReader(content))
+		}
+		if charset != "" {
+			if content, err = decodeCharset(content, charset); err != nil {
+				return nil, err
+			}
+		}
+		c.BuildSentences(bytes.NewReader(content))
+	}
+	if len(c.chain) == 0 {
+		return nil, fmt.Errorf("no text in %s", path)
+	}
+	return c, nil
+}
+
+func saveChain(c *Chain, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := c.Save(file); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// MarkovSentence returns a sentence generated from a named corpus
+func MarkovSentence(name string) (string, error) {
+	c, err := getCorpus(name)
+	if err != nil {
+		return "", err
+	}
+	return c.GenerateSentence(), nil
+}
+
+// MarkovParagraph returns a paragraph of n sentences generated from a named corpus
+func MarkovParagraph(name string, n int) (string, error) {
+	if n < 0 {
+		return "", fmt.Errorf("invalid number of sentences %d", n)
+	}
+	c, err := getCorpus(name)
+	if err != nil {
+		return "", err
+	}
+	sentences := make([]string, n)
+	for i := range sentences {
+		sentences[i] = c.GenerateSentence()
+	}
+	return strings.Join(sentences, " "), nil
+}
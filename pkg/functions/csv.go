@@ -0,0 +1,269 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	CsvSequential = "sequential"
+	CsvRandom     = "random"
+	CsvShuffle    = "shuffle"
+)
+
+// CsvConfig describes a named csv dataset.
+// Rows are read in Mode: sequential (cyclically), random, or shuffle (random without replacement).
+// A row is selected once per record, so all the fromcsv_named calls in a template get the same row,
+// unless PerCall is set. Types maps columns to string, int, float or bool.
+type CsvConfig struct {
+	Name      string            `mapstructure:"name" json:"name"`
+	Path      string            `mapstructure:"path" json:"path"`
+	Mode      string            `mapstructure:"mode" json:"mode"`
+	PerCall   bool              `mapstructure:"perCall" json:"perCall"`
+	Delimiter string            `mapstructure:"delimiter" json:"delimiter"`
+	Types     map[string]string `mapstructure:"types" json:"types"`
+}
+
+type csvDataset struct {
+	config CsvConfig
+	file   *os.File
+	header map[string]int
+	start  int64
+
+	// sequential mode streams the file, random modes keep only the offset of each row
+	reader  *csv.Reader
+	offsets []int64
+	order   []int
+	next    int
+
+	record int
+	row    []string
+	lock   sync.Mutex
+}
+
+var csvDatasets = map[string]*csvDataset{}
+var csvDatasetsLock sync.RWMutex
+
+// InitCsvDataset opens a named csv dataset, replacing any dataset with the same name
+func InitCsvDataset(config CsvConfig) error {
+	if config.Name == "" {
+		return fmt.Errorf("csv dataset without name: %s", config.Path)
+	}
+	if config.Mode == "" {
+		config.Mode = CsvSequential
+	}
+	if config.Mode != CsvSequential && config.Mode != CsvRandom && config.Mode != CsvShuffle {
+		return fmt.Errorf("csv dataset %s: unknown mode %s", config.Name, config.Mode)
+	}
+	for column, t := range config.Types {
+		switch t {
+		case "string", "int", "float", "bool":
+		default:
+			return fmt.Errorf("csv dataset %s: unknown type %s for column %s", config.Name, t, column)
+		}
+	}
+
+	file, err := os.Open(config.Path)
+	if err != nil {
+		return fmt.Errorf("csv dataset %s: %w", config.Name, err)
+	}
+
+	d := &csvDataset{config: config, file: file, record: -1}
+	if err = d.init(); err != nil {
+		file.Close()
+		return fmt.Errorf("csv dataset %s: %w", config.Name, err)
+	}
+
+	csvDatasetsLock.Lock()
+	defer csvDatasetsLock.Unlock()
+	if old, exists := csvDatasets[config.Name]; exists {
+		old.file.Close()
+	}
+	csvDatasets[config.Name] = d
+	return nil
+}
+
+// CloseCsvDatasets closes all the named csv datasets
+func CloseCsvDatasets() {
+	csvDatasetsLock.Lock()
+	defer csvDatasetsLock.Unlock()
+	for name, d := range csvDatasets {
+		if err := d.file.Close(); err != nil {
+			log.Error().Err(err).Str("dataset", name).Msg("Error in closing csv dataset")
+		}
+		delete(csvDatasets, name)
+	}
+}
+
+func (d *csvDataset) newReader(r io.Reader) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	if d.config.Delimiter != "" {
+		reader.Comma, _ = utf8.DecodeRuneInString(d.config.Delimiter)
+	}
+	return reader
+}
+
+func (d *csvDataset) init() error {
+	reader := d.newReader(d.file)
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("cannot read header: %w", err)
+	}
+	d.header = make(map[string]int, len(header))
+	for i, h := range header {
+		d.header[strings.TrimSpace(h)] = i
+	}
+	for column := range d.config.Types {
+		if _, ok := d.header[column]; !ok {
+			return fmt.Errorf("typed column %s not in header", column)
+		}
+	}
+	d.start = reader.InputOffset()
+
+	if d.config.Mode == CsvSequential {
+		return d.rewind()
+	}
+
+	for {
+		offset := reader.InputOffset()
+		_, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		d.offsets = append(d.offsets, offset)
+	}
+	if len(d.offsets) == 0 {
+		return fmt.Errorf("no rows found")
+	}
+	if d.config.Mode == CsvShuffle {
+		d.order = Random.Perm(len(d.offsets))
+	}
+	return nil
+}
+
+func (d *csvDataset) rewind() error {
+	if _, err := d.file.Seek(d.start, io.SeekStart); err != nil {
+		return err
+	}
+	d.reader = d.newReader(d.file)
+	return nil
+}
+
+func (d *csvDataset) nextRow() ([]string, error) {
+	switch d.config.Mode {
+	case CsvRandom:
+		return d.rowAt(Random.Intn(len(d.offsets)))
+	case CsvShuffle:
+		if d.next == len(d.order) {
+			d.order = Random.Perm(len(d.offsets))
+			d.next = 0
+		}
+		d.next++
+		return d.rowAt(d.order[d.next-1])
+	default:
+		row, err := d.reader.Read()
+		if errors.Is(err, io.EOF) {
+			if err = d.rewind(); err != nil {
+				return nil, err
+			}
+			row, err = d.reader.Read()
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("no rows found")
+			}
+		}
+		return row, err
+	}
+}
+
+func (d *csvDataset) rowAt(index int) ([]string, error) {
+	offset := d.offsets[index]
+	return d.newReader(io.NewSectionReader(d.file, offset, math.MaxInt64-offset)).Read()
+}
+
+func (d *csvDataset) value(column string) (any, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	record := ctx.JrContext.CurrentIterationLoopIndex
+	if d.row == nil || d.config.PerCall || d.record != record {
+		row, err := d.nextRow()
+		if err != nil {
+			return nil, err
+		}
+		d.row = row
+		d.record = record
+	}
+
+	i, ok := d.header[column]
+	if !ok {
+		return nil, fmt.Errorf("unknown column %s", column)
+	}
+	if i >= len(d.row) {
+		return "", nil
+	}
+	v := strings.TrimSpace(d.row[i])
+
+	switch d.config.Types[column] {
+	case "int":
+		return strconv.Atoi(v)
+	case "float":
+		return strconv.ParseFloat(v, 64)
+	case "bool":
+		return strconv.ParseBool(v)
+	default:
+		return v, nil
+	}
+}
+
+// FromCsvNamed gets the column value from the current row of a named csv dataset, typed as configured
+func FromCsvNamed(name string, column string) any {
+	csvDatasetsLock.RLock()
+	d, exists := csvDatasets[name]
+	csvDatasetsLock.RUnlock()
+	if !exists {
+		log.Error().Str("dataset", name).Msg("Csv dataset not found")
+		return ""
+	}
+
+	v, err := d.value(column)
+	if err != nil {
+		log.Error().Err(err).Str("dataset", name).Str("column", column).Msg("Error reading csv dataset")
+		return ""
+	}
+	return v
+}
@@ -0,0 +1,376 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	EntityIdle    = "idle"
+	EntityMoving  = "moving"
+	EntityStopped = "stopped"
+)
+
+// EntityConfig describes a simulation of moving entities, like the vehicles of a fleet.
+// Entities move inside a feature of a GeoJson dataset (following its route, if any), inside a circle of Radius meters
+// around Latitude and Longitude, or freely if neither is set.
+// Every Tick of simulated time the status of each entity changes following the Transitions probabilities,
+// by default idle -> moving -> stopped: an empty, non nil, Transitions map keeps the InitialStatus forever.
+type EntityConfig struct {
+	Name           string                        `mapstructure:"name" json:"name"`
+	Count          int                           `mapstructure:"count" json:"count"`
+	GeoJson        string                        `mapstructure:"geojson" json:"geojson"`
+	Feature        string                        `mapstructure:"feature" json:"feature"`
+	Latitude       float64                       `mapstructure:"latitude" json:"latitude"`
+	Longitude      float64                       `mapstructure:"longitude" json:"longitude"`
+	Radius         float64                       `mapstructure:"radius" json:"radius"`
+	MinSpeed       float64                       `mapstructure:"minSpeed" json:"minSpeed"`
+	MaxSpeed       float64                       `mapstructure:"maxSpeed" json:"maxSpeed"`
+	Acceleration   float64                       `mapstructure:"acceleration" json:"acceleration"`
+	TurnRate       float64                       `mapstructure:"turnRate" json:"turnRate"`
+	Tick           time.Duration                 `mapstructure:"tick" json:"tick"`
+	InitialStatus  string                        `mapstructure:"initialStatus" json:"initialStatus"`
+	MovingStatuses []string                      `mapstructure:"movingStatuses" json:"movingStatuses"`
+	Transitions    map[string]map[string]float64 `mapstructure:"transitions" json:"transitions"`
+}
+
+// Entity is the state of a simulated entity
+type Entity struct {
+	ID        string
+	Latitude  float64
+	Longitude float64
+	Heading   float64
+	Speed     float64
+	Status    string
+	Distance  float64
+	Ticks     int
+
+	targetSpeed float64
+	record      int
+}
+
+type entitySimulation struct {
+	config   EntityConfig
+	feature  *GeoFeature
+	moving   map[string]bool
+	entities map[string]*Entity
+	next     int
+	lock     sync.Mutex
+}
+
+var entitySimulations = map[string]*entitySimulation{}
+var entitySimulationsLock sync.RWMutex
+
+// defaultTransitions is the idle -> moving -> stopped state machine used if no transitions are configured
+func defaultTransitions() map[string]map[string]float64 {
+	return map[string]map[string]float64{
+		EntityIdle:    {EntityMoving: 0.3},
+		EntityMoving:  {EntityStopped: 0.05},
+		EntityStopped: {EntityMoving: 0.2, EntityIdle: 0.05},
+	}
+}
+
+// InitEntities creates a simulation of moving entities, replacing any simulation with the same name.
+// Simulations with a GeoJson dataset must be initialized after the dataset.
+func InitEntities(config EntityConfig) error {
+	if config.Name == "" {
+		return fmt.Errorf("entity simulation without name")
+	}
+	if config.Count <= 0 {
+		config.Count = 10
+	}
+	if config.MaxSpeed <= 0 {
+		config.MaxSpeed = 30
+	}
+	if config.MinSpeed <= 0 || config.MinSpeed > config.MaxSpeed {
+		config.MinSpeed = config.MaxSpeed / 6
+	}
+	if config.Acceleration <= 0 {
+		config.Acceleration = 2
+	}
+	if config.TurnRate <= 0 {
+		config.TurnRate = 15
+	}
+	if config.Tick <= 0 {
+		config.Tick = time.Second
+	}
+	if config.InitialStatus == "" {
+		config.InitialStatus = EntityIdle
+	}
+	if len(config.MovingStatuses) == 0 {
+		config.MovingStatuses = []string{EntityMoving}
+	}
+	if config.Transitions == nil {
+		config.Transitions = defaultTransitions()
+	}
+	for from, to := range config.Transitions {
+		total := 0.0
+		for status, p := range to {
+			if p < 0 {
+				return fmt.Errorf("entity simulation %s: negative probability from %s to %s", config.Name, from, status)
+			}
+			total += p
+		}
+		if total > 1 {
+			return fmt.Errorf("entity simulation %s: probabilities from %s sum to more than 1", config.Name, from)
+		}
+	}
+
+	s := &entitySimulation{
+		config:   config,
+		moving:   make(map[string]bool),
+		entities: make(map[string]*Entity),
+	}
+	for _, status := range config.MovingStatuses {
+		s.moving[status] = true
+	}
+	if config.GeoJson != "" {
+		f, err := GeoFeatureByName(config.GeoJson, config.Feature)
+		if err != nil {
+			return fmt.Errorf("entity simulation %s: %w", config.Name, err)
+		}
+		s.feature = f
+	}
+
+	entitySimulationsLock.Lock()
+	defer entitySimulationsLock.Unlock()
+	entitySimulations[config.Name] = s
+	return nil
+}
+
+// ResetEntities removes all the entity simulations
+func ResetEntities() {
+	entitySimulationsLock.Lock()
+	defer entitySimulationsLock.Unlock()
+	entitySimulations = map[string]*entitySimulation{}
+}
+
+// simulation returns a named simulation, creating it with the default configuration if it doesn't exist
+func simulation(name string) *entitySimulation {
+	entitySimulationsLock.RLock()
+	s, exists := entitySimulations[name]
+	entitySimulationsLock.RUnlock()
+	if exists {
+		return s
+	}
+
+	log.Debug().Str("simulation", name).Msg("Creating entity simulation with default configuration")
+	if err := InitEntities(EntityConfig{Name: name}); err != nil {
+		log.Error().Err(err).Msg("Error creating entity simulation")
+	}
+	entitySimulationsLock.RLock()
+	defer entitySimulationsLock.RUnlock()
+	return entitySimulations[name]
+}
+
+// GetEntity returns the state of an entity, advancing it by one tick once per generated value
+func GetEntity(name string, id string) Entity {
+	s := simulation(name)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	record := ctx.JrContext.CurrentIterationLoopIndex
+	e, exists := s.entities[id]
+	if !exists {
+		e = s.newEntity(id)
+		e.record = record
+		s.entities[id] = e
+	} else if e.record != record {
+		s.advance(e)
+		e.record = record
+	}
+	return *e
+}
+
+func (s *entitySimulation) newEntity(id string) *Entity {
+	e := &Entity{
+		ID:      id,
+		Status:  s.config.InitialStatus,
+		Heading: Random.Float64() * 360,
+	}
+	switch {
+	case s.feature != nil && len(s.feature.Route) > 1:
+		e.Distance = Random.Float64() * s.feature.RouteLength()
+		e.Latitude, e.Longitude, e.Heading = s.feature.RoutePosition(e.Distance)
+	case s.feature != nil:
+		e.Latitude, e.Longitude = s.feature.RandomPoint()
+	case s.config.Radius > 0:
+		e.Latitude, e.Longitude = destination(s.config.Latitude, s.config.Longitude, Random.Float64()*360, math.Sqrt(Random.Float64())*s.config.Radius)
+	case s.config.Latitude != 0 || s.config.Longitude != 0:
+		e.Latitude, e.Longitude = s.config.Latitude, s.config.Longitude
+	default:
+		e.Latitude, e.Longitude = -60+Random.Float64()*120, -180+Random.Float64()*360
+	}
+	if s.moving[e.Status] {
+		e.targetSpeed = s.randomSpeed()
+		e.Speed = e.targetSpeed
+	}
+	return e
+}
+
+func (s *entitySimulation) randomSpeed() float64 {
+	return s.config.MinSpeed + Random.Float64()*(s.config.MaxSpeed-s.config.MinSpeed)
+}
+
+// nextStatus returns the status after a tick, following the transition probabilities
+func (s *entitySimulation) nextStatus(status string) string {
+	transitions := s.config.Transitions[status]
+	// statuses are sorted to keep the simulation reproducible with a seed
+	next := make([]string, 0, len(transitions))
+	for n := range transitions {
+		next = append(next, n)
+	}
+	sort.Strings(next)
+
+	r := Random.Float64()
+	for _, n := range next {
+		if r < transitions[n] {
+			return n
+		}
+		r -= transitions[n]
+	}
+	return status
+}
+
+// advance moves an entity by one tick
+func (s *entitySimulation) advance(e *Entity) {
+	dt := s.config.Tick.Seconds()
+	e.Ticks++
+
+	wasMoving := s.moving[e.Status]
+	e.Status = s.nextStatus(e.Status)
+	moving := s.moving[e.Status]
+
+	// speed changes smoothly, towards a target speed that sometimes changes while moving
+	if !moving {
+		e.targetSpeed = 0
+	} else if !wasMoving || Random.Float64() < 0.1 {
+		e.targetSpeed = s.randomSpeed()
+	}
+	delta := s.config.Acceleration * dt
+	switch {
+	case e.Speed < e.targetSpeed:
+		e.Speed = math.Min(e.Speed+delta, e.targetSpeed)
+	case e.Speed > e.targetSpeed:
+		e.Speed = math.Max(e.Speed-delta, e.targetSpeed)
+	}
+	if e.Speed == 0 {
+		return
+	}
+	meters := e.Speed * dt
+
+	if s.feature != nil && len(s.feature.Route) > 1 {
+		e.Distance += meters
+		e.Latitude, e.Longitude, e.Heading = s.feature.RoutePosition(e.Distance)
+		return
+	}
+
+	heading := math.Mod(e.Heading+Random.NormFloat64()*s.config.TurnRate+360, 360)
+	lat, lon := destination(e.Latitude, e.Longitude, heading, meters)
+	if !s.inside(lat, lon) {
+		// turn towards a random point of the area
+		targetLat, targetLon := s.randomPoint()
+		heading = bearing(e.Latitude, e.Longitude, targetLat, targetLon)
+		lat, lon = destination(e.Latitude, e.Longitude, heading, meters)
+		if !s.inside(lat, lon) {
+			e.Heading = heading
+			return
+		}
+	}
+	e.Latitude, e.Longitude, e.Heading = lat, lon, heading
+	e.Distance += meters
+}
+
+func (s *entitySimulation) inside(lat, lon float64) bool {
+	switch {
+	case s.feature != nil:
+		return s.feature.Contains(lat, lon)
+	case s.config.Radius > 0:
+		return haversine(s.config.Latitude, s.config.Longitude, lat, lon) <= s.config.Radius
+	}
+	return true
+}
+
+func (s *entitySimulation) randomPoint() (float64, float64) {
+	if s.feature != nil {
+		return s.feature.RandomPoint()
+	}
+	return destination(s.config.Latitude, s.config.Longitude, Random.Float64()*360, math.Sqrt(Random.Float64())*s.config.Radius)
+}
+
+// destination returns the point reached moving from a point for a distance in meters with the given bearing in degrees
+func destination(lat, lon, bearing, meters float64) (float64, float64) {
+	φ1, λ1 := lat*math.Pi/180, lon*math.Pi/180
+	θ := bearing * math.Pi / 180
+	δ := meters / earthRadius
+	φ2 := math.Asin(math.Sin(φ1)*math.Cos(δ) + math.Cos(φ1)*math.Sin(δ)*math.Cos(θ))
+	λ2 := λ1 + math.Atan2(math.Sin(θ)*math.Sin(δ)*math.Cos(φ1), math.Cos(δ)-math.Sin(φ1)*math.Sin(φ2))
+	return φ2 * 180 / math.Pi, math.Mod(λ2*180/math.Pi+540, 360) - 180
+}
+
+// EntityID returns the IDs of the entities of a simulation, from 1 to its count, in round-robin
+func EntityID(name string) string {
+	s := simulation(name)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.next = s.next%s.config.Count + 1
+	return strconv.Itoa(s.next)
+}
+
+// EntityPosition returns latitude and longitude of an entity
+func EntityPosition(name string, id string) string {
+	e := GetEntity(name, id)
+	return fmt.Sprintf("%.12f %.12f", e.Latitude, e.Longitude)
+}
+
+// EntityLatitude returns the latitude of an entity
+func EntityLatitude(name string, id string) float64 {
+	return GetEntity(name, id).Latitude
+}
+
+// EntityLongitude returns the longitude of an entity
+func EntityLongitude(name string, id string) float64 {
+	return GetEntity(name, id).Longitude
+}
+
+// EntityHeading returns the heading of an entity in degrees, clockwise from north
+func EntityHeading(name string, id string) float64 {
+	return math.Round(GetEntity(name, id).Heading*100) / 100
+}
+
+// EntitySpeed returns the speed of an entity in meters per second
+func EntitySpeed(name string, id string) float64 {
+	return math.Round(GetEntity(name, id).Speed*100) / 100
+}
+
+// EntityStatus returns the status of an entity
+func EntityStatus(name string, id string) string {
+	return GetEntity(name, id).Status
+}
@@ -0,0 +1,504 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jrnd-io/jr/pkg/constants"
+	"github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	FlowOutbound = "outbound"
+	FlowInbound  = "inbound"
+	FlowInternal = "internal"
+)
+
+// ServicesFile is the file with the IANA services in '$JR_SYSTEM_DIR/templates/data', as service, port, protocol and weight
+const ServicesFile = "services"
+
+// privateRanges are the RFC 1918 private IPv4 ranges
+var privateRanges = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"}
+
+// Service is a network service, with its port and transport protocol
+type Service struct {
+	Name     string
+	Port     int
+	Protocol string
+}
+
+var services []Service
+var servicesTable *aliasTable
+var servicesLock sync.Mutex
+
+// defaultServices are used when the services file is not available
+var defaultServices = []Service{{"https", 443, "tcp"}, {"http", 80, "tcp"}, {"domain", 53, "udp"}, {"ssh", 22, "tcp"}, {"ntp", 123, "udp"}}
+
+// loadServices reads the services file once
+func loadServices() {
+	servicesLock.Lock()
+	defer servicesLock.Unlock()
+	if services != nil {
+		return
+	}
+
+	templateDir := fmt.Sprintf("%s/%s", constants.JR_SYSTEM_DIR, "templates")
+	filename := fmt.Sprintf("%s/data/%s", os.ExpandEnv(templateDir), ServicesFile)
+	file, err := os.Open(filename)
+	if err != nil {
+		log.Warn().Err(err).Msg("Services file not found, using default services")
+		services = defaultServices
+		servicesTable = newAliasTable([]float64{50, 20, 20, 5, 5})
+		return
+	}
+	defer file.Close()
+
+	var weights []float64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			continue
+		}
+		port, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		weight := 1.0
+		if len(fields) > 3 {
+			if weight, err = strconv.ParseFloat(fields[3], 64); err != nil {
+				continue
+			}
+		}
+		services = append(services, Service{Name: fields[0], Port: port, Protocol: fields[2]})
+		weights = append(weights, weight)
+	}
+	if len(services) == 0 {
+		services = defaultServices
+		weights = []float64{50, 20, 20, 5, 5}
+	}
+	servicesTable = newAliasTable(weights)
+}
+
+// RandomService returns a random service, weighted by its share of the traffic
+func RandomService() Service {
+	loadServices()
+	return services[servicesTable.pick()]
+}
+
+// PortService returns the IANA name of the service on a port and protocol, or an empty string
+func PortService(port int, protocol string) string {
+	loadServices()
+	protocol = strings.ToLower(protocol)
+	for _, s := range services {
+		if s.Port == port && s.Protocol == protocol {
+			return s.Name
+		}
+	}
+	return ""
+}
+
+// protocolNumber returns the IANA number of a transport protocol
+func protocolNumber(protocol string) int {
+	switch protocol {
+	case "udp":
+		return 17
+	case "sctp":
+		return 132
+	case "icmp":
+		return 1
+	default:
+		return 6
+	}
+}
+
+// randomIPInNet returns a random address in a network, IPv4 or IPv6
+func randomIPInNet(ipnet *net.IPNet) net.IP {
+	ip := make(net.IP, len(ipnet.IP))
+	Random.Read(ip)
+	for i := range ip {
+		ip[i] = ipnet.IP[i]&ipnet.Mask[i] | ip[i]&^ipnet.Mask[i]
+	}
+	return ip
+}
+
+// IpPrivate returns a random private IPv4 address, in one of the RFC 1918 ranges
+func IpPrivate() string {
+	return Ip(privateRanges[Random.Intn(len(privateRanges))])
+}
+
+// IpPublic returns a random public unicast IPv4 address
+func IpPublic() string {
+	return publicIPv4()
+}
+
+// NetworkConfig describes a network with internal clients and servers, talking to each other and to external hosts.
+// Internal and External are lists of CIDRs: Internal defaults to the private ranges, and without External the
+// external hosts have random public addresses. With an IPv6Prefix, IPv6Ratio of the flows are IPv6.
+type NetworkConfig struct {
+	Name       string   `mapstructure:"name" json:"name"`
+	Internal   []string `mapstructure:"internal" json:"internal"`
+	External   []string `mapstructure:"external" json:"external"`
+	IPv6Prefix string   `mapstructure:"ipv6Prefix" json:"ipv6Prefix"`
+	IPv6Ratio  float64  `mapstructure:"ipv6Ratio" json:"ipv6Ratio"`
+	Clients    int      `mapstructure:"clients" json:"clients"`
+	Servers    int      `mapstructure:"servers" json:"servers"`
+}
+
+// networkHost is an internal host, with its IPv4 and IPv6 addresses and, for servers, its services
+type networkHost struct {
+	ipv4     string
+	ipv6     string
+	services []Service
+}
+
+type network struct {
+	config   NetworkConfig
+	internal []*net.IPNet
+	external []*net.IPNet
+	ipv6     *net.IPNet
+	clients  []*networkHost
+	servers  []*networkHost
+	resolver *networkHost
+	flow     *Flow
+	record   int
+	lock     sync.Mutex
+}
+
+// Flow is a NetFlow/IPFIX style record of a connection between a client and a server
+type Flow struct {
+	Direction    string
+	IPVersion    int
+	SrcAddr      string
+	DstAddr      string
+	SrcPort      int
+	DstPort      int
+	Protocol     int
+	ProtocolName string
+	Service      string
+	Packets      int
+	Bytes        int
+	TCPFlags     int
+	Start        time.Time
+	End          time.Time
+}
+
+var networks = map[string]*network{}
+var networksLock sync.RWMutex
+
+// InitNetwork creates a network, replacing any network with the same name
+func InitNetwork(config NetworkConfig) error {
+	if config.Name == "" {
+		return fmt.Errorf("network without name")
+	}
+	if len(config.Internal) == 0 {
+		config.Internal = privateRanges
+	}
+	if config.Clients <= 0 {
+		config.Clients = 50
+	}
+	if config.Servers <= 0 {
+		config.Servers = 10
+	}
+	if config.IPv6Ratio < 0 || config.IPv6Ratio > 1 {
+		return fmt.Errorf("network %s: ipv6Ratio must be between 0 and 1", config.Name)
+	}
+
+	n := &network{config: config, record: -1}
+	for _, cidr := range config.Internal {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil || ipnet.IP.To4() == nil {
+			return fmt.Errorf("network %s: invalid internal IPv4 range %s", config.Name, cidr)
+		}
+		n.internal = append(n.internal, ipnet)
+	}
+	for _, cidr := range config.External {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil || ipnet.IP.To4() == nil {
+			return fmt.Errorf("network %s: invalid external IPv4 range %s", config.Name, cidr)
+		}
+		n.external = append(n.external, ipnet)
+	}
+	if config.IPv6Prefix != "" {
+		_, ipnet, err := net.ParseCIDR(config.IPv6Prefix)
+		if err != nil || ipnet.IP.To4() != nil {
+			return fmt.Errorf("network %s: invalid IPv6 prefix %s", config.Name, config.IPv6Prefix)
+		}
+		n.ipv6 = ipnet
+		if config.IPv6Ratio == 0 {
+			n.config.IPv6Ratio = 0.2
+		}
+	}
+
+	for i := 0; i < config.Clients; i++ {
+		n.clients = append(n.clients, n.newHost())
+	}
+	for i := 0; i < config.Servers; i++ {
+		h := n.newHost()
+		for j := 0; j <= Random.Intn(3); j++ {
+			h.services = append(h.services, RandomService())
+		}
+		n.servers = append(n.servers, h)
+	}
+	n.resolver = n.newHost()
+	n.resolver.services = []Service{{"domain", 53, "udp"}}
+
+	networksLock.Lock()
+	defer networksLock.Unlock()
+	networks[config.Name] = n
+	return nil
+}
+
+// ResetNetworks removes all the networks
+func ResetNetworks() {
+	networksLock.Lock()
+	defer networksLock.Unlock()
+	networks = map[string]*network{}
+}
+
+// getNetwork returns a named network, creating it with the default configuration if it doesn't exist
+func getNetwork(name string) *network {
+	networksLock.RLock()
+	n, exists := networks[name]
+	networksLock.RUnlock()
+	if exists {
+		return n
+	}
+
+	log.Debug().Str("network", name).Msg("Creating network with default configuration")
+	if err := InitNetwork(NetworkConfig{Name: name}); err != nil {
+		log.Error().Err(err).Msg("Error creating network")
+	}
+	networksLock.RLock()
+	defer networksLock.RUnlock()
+	return networks[name]
+}
+
+func (n *network) newHost() *networkHost {
+	h := &networkHost{ipv4: randomIPInNet(n.internal[Random.Intn(len(n.internal))]).String()}
+	if n.ipv6 != nil {
+		h.ipv6 = randomIPInNet(n.ipv6).String()
+	}
+	return h
+}
+
+// externalAddress returns the address of a random external host
+func (n *network) externalAddress(ipv6 bool) string {
+	if ipv6 {
+		return Ipv6("2000::/3")
+	}
+	if len(n.external) > 0 {
+		return randomIPInNet(n.external[Random.Intn(len(n.external))]).String()
+	}
+	return publicIPv4()
+}
+
+func (h *networkHost) address(ipv6 bool) string {
+	if ipv6 {
+		return h.ipv6
+	}
+	return h.ipv4
+}
+
+// newFlow creates a random flow: internal clients connect to external servers, external clients to the
+// internal servers, and internal clients to internal servers
+func (n *network) newFlow() *Flow {
+	f := &Flow{IPVersion: 4}
+	ipv6 := n.ipv6 != nil && Random.Float64() < n.config.IPv6Ratio
+	if ipv6 {
+		f.IPVersion = 6
+	}
+
+	var service Service
+	switch p := Random.Float64(); {
+	case p < 0.7:
+		f.Direction = FlowOutbound
+		service = RandomService()
+		f.SrcAddr = n.clients[Random.Intn(len(n.clients))].address(ipv6)
+		f.DstAddr = n.externalAddress(ipv6)
+	case p < 0.85:
+		f.Direction = FlowInbound
+		server := n.servers[Random.Intn(len(n.servers))]
+		service = server.services[Random.Intn(len(server.services))]
+		f.SrcAddr = n.externalAddress(ipv6)
+		f.DstAddr = server.address(ipv6)
+	default:
+		f.Direction = FlowInternal
+		server := n.servers[Random.Intn(len(n.servers))]
+		service = server.services[Random.Intn(len(server.services))]
+		f.SrcAddr = n.clients[Random.Intn(len(n.clients))].address(ipv6)
+		f.DstAddr = server.address(ipv6)
+	}
+
+	f.SrcPort = 49152 + Random.Intn(16384)
+	f.DstPort = service.Port
+	f.Service = service.Name
+	f.ProtocolName = service.Protocol
+	f.Protocol = protocolNumber(service.Protocol)
+
+	switch {
+	case f.Protocol == 6 && Random.Intn(10) == 0:
+		// rejected or unanswered connection
+		f.Packets = 1 + Random.Intn(3)
+		f.Bytes = f.Packets * 60
+		f.TCPFlags = 0x02
+	case f.Protocol == 6:
+		f.Packets = 4 + Random.Intn(1000)
+		f.Bytes = f.Packets * (60 + Random.Intn(1400))
+		f.TCPFlags = 0x1b
+	case service.Port == 53:
+		f.Packets = 1
+		f.Bytes = 60 + Random.Intn(200)
+	default:
+		f.Packets = 1 + Random.Intn(100)
+		f.Bytes = f.Packets * (60 + Random.Intn(1200))
+	}
+
+	f.End = time.Now().UTC()
+	f.Start = f.End.Add(-time.Duration(Random.Intn(f.Packets*50+1)) * time.Millisecond)
+	return f
+}
+
+// GetFlow returns the flow of the current record in a network: all the calls for the same record get the same flow
+func GetFlow(name string) *Flow {
+	n := getNetwork(name)
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.flow == nil || n.record != ctx.JrContext.CurrentIterationLoopIndex {
+		n.flow = n.newFlow()
+		n.record = ctx.JrContext.CurrentIterationLoopIndex
+	}
+	return n.flow
+}
+
+// NetflowRecord returns the flow of the current record as JSON, with IPFIX information element names
+func NetflowRecord(name string) string {
+	f := GetFlow(name)
+	src, dst := "sourceIPv4Address", "destinationIPv4Address"
+	if f.IPVersion == 6 {
+		src, dst = "sourceIPv6Address", "destinationIPv6Address"
+	}
+	doc := map[string]any{
+		src:                        f.SrcAddr,
+		dst:                        f.DstAddr,
+		"sourceTransportPort":      f.SrcPort,
+		"destinationTransportPort": f.DstPort,
+		"protocolIdentifier":       f.Protocol,
+		"ipVersion":                f.IPVersion,
+		"packetDeltaCount":         f.Packets,
+		"octetDeltaCount":          f.Bytes,
+		"tcpControlBits":           f.TCPFlags,
+		"flowStartMilliseconds":    f.Start.UnixMilli(),
+		"flowEndMilliseconds":      f.End.UnixMilli(),
+		"flowDirection":            f.Direction,
+		"applicationName":          f.Service,
+	}
+	return marshalLog(doc)
+}
+
+var dnsDomains = []string{"google.com", "microsoft.com", "amazonaws.com", "apple.com", "cloudflare.com", "github.com",
+	"office365.com", "akamaiedge.net", "facebook.com", "slack.com", "zoom.us", "example.com"}
+var dnsSubdomains = []string{"www", "api", "mail", "cdn", "login", "static", "s3", "update", "telemetry"}
+var dnsTypes = []string{"A", "AAAA", "CNAME", "MX", "TXT", "PTR"}
+var dnsTypesTable = newAliasTable([]float64{60, 25, 5, 3, 4, 3})
+var dnsCodes = []string{"NOERROR", "NXDOMAIN", "SERVFAIL"}
+var dnsCodesTable = newAliasTable([]float64{90, 8, 2})
+
+// DnsLog returns a DNS query and its answers as a JSON log, with Zeek dns.log field names.
+// Queries go from the internal clients of a network to its resolver.
+func DnsLog(name string) string {
+	n := getNetwork(name)
+	n.lock.Lock()
+	client := n.clients[Random.Intn(len(n.clients))]
+	resolver := n.resolver
+	n.lock.Unlock()
+
+	ipv6 := n.ipv6 != nil && Random.Float64() < n.config.IPv6Ratio
+	query := dnsSubdomains[Random.Intn(len(dnsSubdomains))] + "." + dnsDomains[Random.Intn(len(dnsDomains))]
+	qtype := dnsTypes[dnsTypesTable.pick()]
+	rcode := dnsCodes[dnsCodesTable.pick()]
+	if rcode == "NXDOMAIN" {
+		query = strings.ToLower(RandomString(8, 16)) + "." + dnsDomains[Random.Intn(len(dnsDomains))]
+	}
+
+	answers := []string{}
+	ttls := []int{}
+	if rcode == "NOERROR" {
+		for i := 0; i <= Random.Intn(3); i++ {
+			switch qtype {
+			case "A":
+				answers = append(answers, publicIPv4())
+			case "AAAA":
+				answers = append(answers, Ipv6("2000::/3"))
+			case "CNAME":
+				answers = append(answers, query+".edgekey.net")
+			case "MX":
+				answers = append(answers, fmt.Sprintf("%d mx%d.%s", 10*(i+1), i+1, query))
+			case "TXT":
+				answers = append(answers, "v=spf1 include:_spf."+query+" ~all")
+			case "PTR":
+				answers = append(answers, "host-"+strconv.Itoa(Random.Intn(1000))+"."+query)
+			}
+			ttls = append(ttls, []int{60, 300, 3600, 86400}[Random.Intn(4)])
+		}
+	}
+	if qtype == "PTR" {
+		ip := net.ParseIP(publicIPv4()).To4()
+		query = fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", ip[3], ip[2], ip[1], ip[0])
+	}
+
+	doc := map[string]any{
+		"ts":          float64(time.Now().UnixMicro()) / 1e6,
+		"uid":         "C" + strings.ReplaceAll(uuid.NewString(), "-", "")[:17],
+		"id.orig_h":   client.address(ipv6),
+		"id.orig_p":   49152 + Random.Intn(16384),
+		"id.resp_h":   resolver.address(ipv6),
+		"id.resp_p":   53,
+		"proto":       "udp",
+		"trans_id":    Random.Intn(65536),
+		"query":       query,
+		"qclass":      1,
+		"qclass_name": "C_INTERNET",
+		"qtype_name":  qtype,
+		"rcode_name":  rcode,
+		"AA":          false,
+		"RD":          true,
+		"RA":          rcode != "SERVFAIL",
+		"answers":     answers,
+		"TTLs":        ttls,
+		"rejected":    false,
+	}
+	return marshalLog(doc)
+}
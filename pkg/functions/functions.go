@@ -22,9 +22,12 @@ package functions
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
 	"os"
@@ -34,7 +37,6 @@ import (
 	"text/template"
 
 	"github.com/google/uuid"
-	"github.com/jrnd-io/jr/pkg/constants"
 	"github.com/jrnd-io/jr/pkg/ctx"
 	geojson "github.com/paulmach/go.geojson"
 	"github.com/rs/zerolog/log"
@@ -62,10 +64,13 @@ var fmap = map[string]interface{}{
 	"from_shuffle":             WordShuffle,
 	"from_n":                   WordShuffleN,
 	"join":                     strings.Join,
+	"json_escape":              JsonEscape,
 	"len":                      Len,
 	"lower":                    strings.ToLower,
 	"lorem":                    Lorem,
 	"markov":                   Nonsense,
+	"markov_paragraph":         MarkovParagraph,
+	"markov_sentence":          MarkovSentence,
 	"random":                   func(s []string) string { return s[Random.Intn(len(s))] },
 	"randoms":                  func(s string) string { a := strings.Split(s, "|"); return a[Random.Intn(len(a))] },
 	"random_index":             RandomIndex,
@@ -84,6 +89,9 @@ var fmap = map[string]interface{}{
 	"trimchars":                strings.Trim,
 	"title":                    cases.Title(language.English).String,
 	"upper":                    strings.ToUpper,
+	"unique":                   Unique,
+	"unique_count":             UniqueCount,
+	"unique_value":             UniqueValue,
 
 	// math utilities
 	"add":          func(a, b int) int { return a + b },
@@ -106,25 +114,64 @@ var fmap = map[string]interface{}{
 	"ipv6":              Ipv6,
 	"ip_known_protocol": IpKnownProtocol,
 	"ip_known_port":     IpKnownPort,
+	"ip_private":        IpPrivate,
+	"ip_public":         IpPublic,
 	"mac":               Mac,
 	"password":          Password,
+	"port_service":      PortService,
 	"useragent":         UserAgent,
 
+	// e-commerce
+	"basket":  GetBasket,
+	"product": CatalogProduct,
+
+	// network flows
+	"dns_log":        DnsLog,
+	"flow":           GetFlow,
+	"netflow_record": NetflowRecord,
+
+	// log lines
+	"apache_log":        ApacheLog,
+	"cef_log":           CefLog,
+	"cloudtrail_log":    CloudTrailLog,
+	"ecs_log":           EcsLog,
+	"leef_log":          LeefLog,
+	"log_session":       NewLogSession,
+	"nginx_log":         ApacheLog,
+	"syslog_3164":       Syslog3164,
+	"syslog_5424":       Syslog5424,
+	"vpc_flow_log":      VpcFlowLog,
+	"windows_event_log": WindowsEventLog,
+
 	// people related utilities
-	"cf":             CodiceFiscale,
-	"company":        Company,
-	"email":          Email,
-	"email_provider": EmailProvider,
-	"email_work":     WorkEmail,
-	"gender":         Gender,
-	"middlename":     Middlename,
-	"name":           Name,
-	"name_m":         NameM,
-	"name_f":         NameF,
-	"ssn":            Ssn,
-	"surname":        Surname,
-	"user":           User,
-	"username":       Username,
+	"cf":                CodiceFiscale,
+	"company":           Company,
+	"email":             Email,
+	"email_provider":    EmailProvider,
+	"email_work":        WorkEmail,
+	"gender":            Gender,
+	"middlename":        Middlename,
+	"name":              Name,
+	"name_m":            NameM,
+	"name_f":            NameF,
+	"person":            NewPerson,
+	"steuer_id":         SteuerID,
+	"nir":               Nir,
+	"dni":               Dni,
+	"nie":               Nie,
+	"nino":              Nino,
+	"national_id":       NationalID,
+	"valid_steuer_id":   ValidSteuerID,
+	"valid_nir":         ValidNir,
+	"valid_dni":         ValidDni,
+	"valid_nino":        ValidNino,
+	"valid_cf":          ValidCodiceFiscale,
+	"valid_ssn":         ValidSsn,
+	"valid_national_id": ValidNationalID,
+	"ssn":               Ssn,
+	"surname":           Surname,
+	"user":              User,
+	"username":          Username,
 
 	// address
 	"building":                              BuildingNumber,
@@ -141,11 +188,22 @@ var fmap = map[string]interface{}{
 	"nearby_gps":                            NearbyGPS,
 	"nearby_gps_into_polygon":               NearbyGPSIntoPolygon,
 	"nearby_gps_into_polygon_without_start": NearbyGPSIntoPolygonWithoutStart,
+	"geo_feature":                           GeoFeatureName,
+	"geo_property":                          GeoProperty,
+	"gps_along_route":                       GPSAlongRoute,
+	"entity_id":                             EntityID,
+	"entity_position":                       EntityPosition,
+	"entity_latitude":                       EntityLatitude,
+	"entity_longitude":                      EntityLongitude,
+	"entity_heading":                        EntityHeading,
+	"entity_speed":                          EntitySpeed,
+	"entity_status":                         EntityStatus,
 	"state":                                 State,
 	"state_at":                              StateAt,
 	"state_short":                           StateShort,
 	"state_short_at":                        StateShortAt,
 	"street":                                Street,
+	"address":                               NewAddress,
 	"zip":                                   Zip,
 	"zip_at":                                ZipAt,
 
@@ -163,6 +221,15 @@ var fmap = map[string]interface{}{
 	"swift":        Swift,
 	"valor":        Valor,
 	"wkn":          Wkn,
+	"iban":         Iban,
+	"iban_country": IbanCountry,
+	"bic":          Bic,
+	"bic_country":  BicCountry,
+	"vat":          Vat,
+	"vat_country":  VatCountry,
+	"valid_iban":   ValidIban,
+	"valid_bic":    ValidBic,
+	"valid_vat":    ValidVat,
 
 	// time and dates
 	"birthdate":        BirthDate,
@@ -196,6 +263,8 @@ var fmap = map[string]interface{}{
 	"index_of": IndexOf,
 	"key":      func(name string, n int) string { return fmt.Sprintf("%s%d", name, Random.Intn(n)) },
 	"seed":     Seed,
+	"span_id":  SpanId,
+	"trace_id": TraceId,
 	"uuid":     UniqueId,
 	"yesorno":  YesOrNo,
 	"inject":   Inject,
@@ -208,6 +277,7 @@ var fmap = map[string]interface{}{
 	"get_v":                    GetV,
 	"set_v":                    SetV,
 	"fromcsv":                  FromCsv,
+	"fromcsv_named":            FromCsvNamed,
 }
 
 func Atoi(s string) int {
@@ -260,7 +330,34 @@ func IndexOf(s string, name string) int {
 	if err != nil {
 		return -1
 	}
-	words := data[name]
+	_, weighted := weights[name]
+	return indexOfWord(s, data[name], weighted)
+}
+
+// LenientIndexOf is IndexOf, reading the dataset from the default locale when it is not in the locale
+// chain also for a strict locale. The dataset is not cached then, so strict lookups still fail on it.
+func LenientIndexOf(s string, name string) int {
+	if !ctx.JrContext.StrictLocale || data[name] != nil {
+		return IndexOf(s, name)
+	}
+	filename, charset, err := datasetFile(name, false)
+	if err != nil {
+		return -1
+	}
+	words, _, weighted := splitWeights(initialize(filename, charset))
+	return indexOfWord(s, words, weighted)
+}
+
+func indexOfWord(s string, words []string, weighted bool) int {
+	if weighted {
+		// weighted files are usually sorted by weight, not by word
+		for i, w := range words {
+			if w == s {
+				return i
+			}
+		}
+		return -1
+	}
 	index := sort.Search(len(words), func(i int) bool { return strings.ToLower(words[i]) >= strings.ToLower(s) })
 
 	if index < len(words) && words[index] == s {
@@ -270,6 +367,16 @@ func IndexOf(s string, name string) int {
 	return -1
 }
 
+// JsonEscape returns s escaped to be written between the quotes of a JSON string
+func JsonEscape(s string) string {
+	var b bytes.Buffer
+	e := json.NewEncoder(&b)
+	e.SetEscapeHTML(false)
+	_ = e.Encode(s)
+	// Encode writes the quotes and a newline
+	return string(b.Bytes()[1 : b.Len()-2])
+}
+
 // Len returns number of words (lines) in a word file
 func Len(name string) string {
 	_, err := Cache(name)
@@ -286,8 +393,7 @@ func RandomIndex(name string) string {
 	if err != nil {
 		return ""
 	}
-	words := data[name]
-	ctx.JrContext.LastIndex = Random.Intn(len(words))
+	ctx.JrContext.LastIndex = randomWordIndex(name)
 	return strconv.Itoa(ctx.JrContext.LastIndex)
 }
 
@@ -343,7 +449,7 @@ func Word(name string) string {
 		return ""
 	}
 	words := data[name]
-	ctx.JrContext.LastIndex = Random.Intn(len(words))
+	ctx.JrContext.LastIndex = randomWordIndex(name)
 	return words[ctx.JrContext.LastIndex]
 }
 
@@ -374,6 +480,10 @@ func WordShuffleN(name string, n int) []string {
 		return []string{""}
 	}
 	words := data[name]
+	if _, weighted := weights[name]; weighted {
+		// the cached words must stay aligned with their weights
+		words = append([]string(nil), words...)
+	}
 	Random.Shuffle(len(words), func(i, j int) {
 		words[i], words[j] = words[j], words[i]
 	})
@@ -397,22 +507,27 @@ func Maxint(a, b int) int {
 	return b
 }
 
-// Cache is used to internally Cache data from word files
+// Cache is used to internally Cache data from word files.
+// Lines can have a weight, as in 'Smith\t0.88', to pick words with realistic frequencies
 func Cache(name string) (bool, error) {
 
-	templateDir := fmt.Sprintf("%s/%s", constants.JR_SYSTEM_DIR, "templates")
-
 	v := data[name]
 	if v != nil {
 		return false, nil
 	}
 
-	locale := strings.ToLower(ctx.JrContext.Locale)
-	filename := fmt.Sprintf("%s/data/%s/%s", os.ExpandEnv(templateDir), locale, name)
-	if locale != "us" && !(fileExists(filename)) {
-		filename = fmt.Sprintf("%s/data/%s/%s", os.ExpandEnv(templateDir), "us", name)
+	filename, charset, err := datasetFile(name, ctx.JrContext.StrictLocale)
+	if err != nil {
+		if ctx.JrContext.StrictLocale {
+			setLocaleError(err)
+		}
+		return false, err
+	}
+	words, w, weighted := splitWeights(initialize(filename, charset))
+	data[name] = words
+	if weighted {
+		weights[name] = newAliasTable(w)
 	}
-	data[name] = initialize(filename)
 	if len(data[name]) == 0 {
 		return false, fmt.Errorf("no words found in %s", filename)
 	}
@@ -420,6 +535,12 @@ func Cache(name string) (bool, error) {
 	return true, nil
 }
 
+// ClearCache empties the word cache, to reload word files after a locale change
+func ClearCache() {
+	data = map[string][]string{}
+	weights = map[string]*aliasTable{}
+}
+
 func fileExists(filename string) bool {
 	if _, err := os.Stat(filename); err == nil {
 		return true
@@ -456,20 +577,20 @@ func contains(values []int, value int) bool {
 	return false
 }
 
-func initialize(filename string) []string {
-	file, err := os.Open(filename)
+func initialize(filename string, charset string) []string {
+	content, err := os.ReadFile(filename)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to open file")
+		return nil
+	}
+	content, err = decodeCharset(content, charset)
+	if err != nil {
+		log.Error().Err(err).Str("charset", charset).Msg("Failed to decode file")
+		return nil
 	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			log.Error().Err(err).Msg("Error in closing file")
-		}
-	}(file)
 
 	var words []string
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
 
 	for scanner.Scan() {
 		words = append(words, scanner.Text())
@@ -478,74 +599,57 @@ func initialize(filename string) []string {
 	return words
 }
 
-func InitCSV(csvpath string) {
-	// Loads the csv file in the context
+// InitCSV loads the csv file used by fromcsv in the context
+func InitCSV(csvpath string) error {
 	if len(csvpath) == 0 {
-		return
-	}
-
-	var csvHeaders = make(map[int]string)
-	csvValues := make(map[int]map[string]string)
-
-	if _, err := os.Stat(csvpath); err != nil {
-		println("File does not exist: ", csvpath)
-		os.Exit(1)
+		return nil
 	}
 
 	file, err := os.Open(csvpath)
-
 	if err != nil {
-		println("Error opening file:", csvpath, "error:", err)
-		os.Exit(1)
+		return fmt.Errorf("error opening csv file %s: %w", csvpath, err)
 	}
-
 	defer file.Close()
 
 	reader := csv.NewReader(file)
-
-	lines, err := reader.ReadAll()
+	csvHeaders, err := reader.Read()
 	if err != nil {
-		println("Error reading CSV file:", csvpath, "error:", err)
-		os.Exit(1)
-	}
-
-	for row := 0; row < len(lines); row++ {
-		var aRow = lines[row]
-		for col := 0; col < len(aRow); col++ {
-			var value = aRow[col]
-			// print(" ROW -> ",row)
-			if row == 0 {
-				// print(" H: ", value)
-				csvHeaders[col] = strings.Trim(value, " ")
-			} else {
-
-				val, exists := csvValues[row-1]
-				if exists {
-					val[csvHeaders[col]] = strings.Trim(value, " ")
-					csvValues[row-1] = val
-				} else {
-					var localmap = make(map[string]string)
-					localmap[csvHeaders[col]] = strings.Trim(value, " ")
-					csvValues[row-1] = localmap
-				}
-				//	print(" V: ", value)
-			}
+		return fmt.Errorf("error reading csv file %s: %w", csvpath, err)
+	}
+	for col := range csvHeaders {
+		csvHeaders[col] = strings.Trim(csvHeaders[col], " ")
+	}
+
+	csvValues := make(map[int]map[string]string)
+	for row := 0; ; row++ {
+		aRow, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
 		}
-		// println()
+		if err != nil {
+			return fmt.Errorf("error reading csv file %s: %w", csvpath, err)
+		}
+		localmap := make(map[string]string, len(aRow))
+		for col := 0; col < len(aRow) && col < len(csvHeaders); col++ {
+			localmap[csvHeaders[col]] = strings.Trim(aRow[col], " ")
+		}
+		csvValues[row] = localmap
 	}
 
+	ctx.JrContext.CtxCSVLock.Lock()
+	defer ctx.JrContext.CtxCSVLock.Unlock()
 	ctx.JrContext.CtxCSV = csvValues
+	return nil
 }
 
-func InitGeoJson(geojsonpath string) {
-	// Loads the csv file in the context
+func InitGeoJson(geojsonpath string) error {
+	// Loads the first polygon of the geojson file in the context
 	if len(geojsonpath) == 0 {
-		return
+		return nil
 	}
 	file, err := os.Open(geojsonpath)
 	if err != nil {
-		println("Error reading GeoJson file:", geojsonpath, "error:", err)
-		os.Exit(1)
+		return fmt.Errorf("error reading GeoJson file %s: %w", geojsonpath, err)
 	}
 	defer file.Close()
 
@@ -555,11 +659,25 @@ func InitGeoJson(geojsonpath string) {
 		CRS        map[string]interface{} `json:"crs,omitempty"`
 	}
 	if err := json.NewDecoder(file).Decode(&polygon); err != nil {
-		println("Error decoding GeoJson file:", geojsonpath, "error:", err)
-		os.Exit(1)
+		return fmt.Errorf("error decoding GeoJson file %s: %w", geojsonpath, err)
+	}
+	if len(polygon.Features) == 0 || polygon.Features[0].Geometry == nil {
+		return fmt.Errorf("no features in GeoJson file %s", geojsonpath)
 	}
 
+	var ctxgeojson [][]float64
 	geoTest := polygon.Features[0].Geometry
-	ctxgeojson := geoTest.Polygon[0]
+	switch {
+	case geoTest.IsPolygon() && len(geoTest.Polygon) > 0:
+		ctxgeojson = geoTest.Polygon[0]
+	case geoTest.IsMultiPolygon() && len(geoTest.MultiPolygon) > 0 && len(geoTest.MultiPolygon[0]) > 0:
+		ctxgeojson = geoTest.MultiPolygon[0][0]
+	default:
+		return fmt.Errorf("first feature of GeoJson file %s is not a polygon", geojsonpath)
+	}
+
+	ctx.JrContext.CtxGeoJsonLock.Lock()
+	defer ctx.JrContext.CtxGeoJsonLock.Unlock()
 	ctx.JrContext.CtxGeoJson = ctxgeojson
+	return nil
 }
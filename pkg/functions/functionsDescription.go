@@ -72,6 +72,16 @@ var funcDesc = map[string]FunctionDescription{
 		Example:     "jr template run --embedded '{{add_v_to_list \"ids\" \"12770\"}}{{random_v_from_list \"ids\"}}'",
 		Output:      "12770",
 	},
+	"address": {
+		Name:        "address",
+		Category:    "address",
+		Description: "returns a coherent address with Street, Number, City, State, StateShort, Zip, Country and Phone fields: zip and phone prefix match the city, and the city is in the state",
+		Parameters:  "",
+		Localizable: true,
+		Return:      "Address",
+		Example:     "jr template run --embedded '{{$a := address}}{{$a.City}} {{$a.Zip}} {{$a.StateShort}}'",
+		Output:      "Austin 78723 TX",
+	},
 	"amount": {
 		Name:        "amount",
 		Category:    "finance",
@@ -82,6 +92,16 @@ var funcDesc = map[string]FunctionDescription{
 		Example:     "jr template run --embedded '{{account 10 1000 \"$\"}}'",
 		Output:      "$7409.66",
 	},
+	"apache_log": {
+		Name:        "apache_log",
+		Category:    "logs",
+		Description: "returns an access log line in the Apache and Nginx combined format. Lines of the same client session share IP, user and user agent, and the referer is the previous page of the session",
+		Parameters:  "",
+		Localizable: false,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{apache_log}}'",
+		Output:      `28.233.175.91 - jclark [18/Oct/2026:14:25:36 +0000] "GET /images/logo.png HTTP/1.1" 200 38127 "-" "Mozilla/5.0 (Windows NT 10.0) ..."`,
+	},
 	"array": {
 		Name:        "array",
 		Category:    "utilities",
@@ -102,6 +122,136 @@ var funcDesc = map[string]FunctionDescription{
 		Example:     "jr template run --embedded '{{atoi \"123\"}}'",
 		Output:      "123",
 	},
+	"basket": {
+		Name:        "basket",
+		Category:    "e-commerce",
+		Description: "returns the basket of the current record, with line items from a named catalog where quantity, unit price, discount, tax and total add up, in the currency of the locale",
+		Parameters:  "catalog string",
+		Localizable: true,
+		Return:      "Basket",
+		Example:     `jr run --embedded '{{$b := basket "shop"}}{{len $b.Items}} {{$b.Total}} {{$b.Currency}}'`,
+		Output:      "3 215.64 USD",
+	},
+	"bic": {
+		Name:        "bic",
+		Category:    "finance",
+		Description: "returns a BIC for a bank of the country of the current locale, consistent with iban",
+		Parameters:  "",
+		Localizable: true,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{bic}}' --locale fr",
+		Output:      "BNPAFRPPXXX",
+	},
+	"bic_country": {
+		Name:        "bic_country",
+		Category:    "finance",
+		Description: "returns a BIC for a bank of the given country",
+		Parameters:  "country string",
+		Localizable: false,
+		Return:      "string",
+		Example:     `jr template run --embedded '{{bic_country "DE"}}'`,
+		Output:      "DEUTDEFF500",
+	},
+	"cef_log": {
+		Name:        "cef_log",
+		Category:    "logs",
+		Description: "returns a firewall or web event in the ArcSight Common Event Format, with escaped header and extension values",
+		Parameters:  "vendor string, product string",
+		Localizable: false,
+		Return:      "string",
+		Example:     `jr template run --embedded '{{cef_log "Acme" "Firewall"}}'`,
+		Output:      "CEF:0|Acme|Firewall|1.0|101|Connection denied|6|rt=1792333540494 src=76.142.223.175 spt=63361 dst=10.148.161.71 dpt=81 proto=TCP act=deny suser=acastillo dhost=web-03",
+	},
+	"cloudtrail_log": {
+		Name:        "cloudtrail_log",
+		Category:    "logs",
+		Description: "returns an AWS CloudTrail record as JSON, with the user and source IP of the client session",
+		Parameters:  "",
+		Localizable: false,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{cloudtrail_log}}'",
+		Output:      `{"awsRegion":"eu-west-1","eventName":"ConsoleLogin",...}`,
+	},
+	"dni": {
+		Name:        "dni",
+		Category:    "people",
+		Description: "returns a valid Spanish national identity number (DNI)",
+		Parameters:  "",
+		Localizable: false,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{dni}}'",
+		Output:      "12345678Z",
+	},
+	"dns_log": {
+		Name:        "dns_log",
+		Category:    "network",
+		Description: "returns a DNS query and its answers as JSON, with Zeek dns.log field names. Queries go from the internal clients of a network to its resolver",
+		Parameters:  "network string",
+		Localizable: false,
+		Return:      "string",
+		Example:     `jr template run --embedded '{{dns_log "corp"}}'`,
+		Output:      `{"id.orig_h":"10.148.202.154","id.resp_h":"10.136.167.90","id.resp_p":53,"qtype_name":"A","query":"static.example.com","rcode_name":"NOERROR","answers":["138.127.200.16"],...}`,
+	},
+	"ecs_log": {
+		Name:        "ecs_log",
+		Category:    "logs",
+		Description: "returns an access log as a JSON Elastic Common Schema document",
+		Parameters:  "",
+		Localizable: false,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{ecs_log}}'",
+		Output:      `{"@timestamp":"2026-10-18T14:25:43.281731417Z","ecs":{"version":"8.11.0"},...}`,
+	},
+	"flow": {
+		Name:        "flow",
+		Category:    "network",
+		Description: "returns the flow of the current record in a network, with Direction, IPVersion, SrcAddr, DstAddr, SrcPort, DstPort, Protocol, ProtocolName, Service, Packets, Bytes, TCPFlags, Start and End fields. Internal clients connect to external servers, external clients to internal servers and internal clients to internal servers",
+		Parameters:  "network string",
+		Localizable: false,
+		Return:      "*Flow",
+		Example:     `jr template run --embedded '{{$f := flow "corp"}}{{$f.SrcAddr}} -> {{$f.DstAddr}}:{{$f.DstPort}} {{$f.Service}}'`,
+		Output:      "10.1.13.160 -> 74.189.246.120:443 https",
+	},
+	"iban": {
+		Name:        "iban",
+		Category:    "finance",
+		Description: "returns a valid IBAN, with correct mod-97 and national check digits, for the country of the current locale: DE, ES, FR, GB and IT are supported",
+		Parameters:  "",
+		Localizable: true,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{iban}}' --locale de",
+		Output:      "DE89370400440532013000",
+	},
+	"iban_country": {
+		Name:        "iban_country",
+		Category:    "finance",
+		Description: "returns a valid IBAN, with correct mod-97 and national check digits, for a country: DE, ES, FR, GB and IT are supported",
+		Parameters:  "country string",
+		Localizable: false,
+		Return:      "string",
+		Example:     `jr template run --embedded '{{iban_country "IT"}}'`,
+		Output:      "IT60X0542811101000000123456",
+	},
+	"ip_private": {
+		Name:        "ip_private",
+		Category:    "network",
+		Description: "returns a random private IPv4 address, in one of the RFC 1918 ranges",
+		Parameters:  "",
+		Localizable: false,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{ip_private}}'",
+		Output:      "192.168.22.117",
+	},
+	"ip_public": {
+		Name:        "ip_public",
+		Category:    "network",
+		Description: "returns a random public unicast IPv4 address, outside private, reserved and multicast ranges",
+		Parameters:  "",
+		Localizable: false,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{ip_public}}'",
+		Output:      "53.236.207.229",
+	},
 	"itoa": {
 		Name:        "itoa",
 		Category:    "text",
@@ -322,6 +472,16 @@ var funcDesc = map[string]FunctionDescription{
 		Example:     "jr template run --embedded '{{fromcsv \"NAME\"}}' --csv testfiles/test2.csv",
 		Output:      "John",
 	},
+	"fromcsv_named": {
+		Name:        "fromcsv_named",
+		Category:    "utilities",
+		Description: "returns a value for given column label from the current row of a named csv dataset, typed as configured",
+		Parameters:  "dataset string, column string",
+		Localizable: false,
+		Return:      "any",
+		Example:     "jr template run --embedded '{{fromcsv_named \"people\" \"name\"}}' --csvFile people=testfiles/people.csv,mode=random",
+		Output:      "Mary White",
+	},
 	"cusip": {
 		Name:        "cusip",
 		Category:    "finance",
@@ -392,6 +552,76 @@ var funcDesc = map[string]FunctionDescription{
 		Example:     "jr template run --embedded '{{email_work}}'",
 		Output:      "paul.newman@bostonstatic.com",
 	},
+	"entity_heading": {
+		Name:        "entity_heading",
+		Category:    "entity",
+		Description: "returns the heading in degrees, clockwise from north, of an entity of a simulation. Entities advance by one tick for every generated value",
+		Parameters:  "simulation string, id string",
+		Localizable: false,
+		Return:      "float",
+		Example:     `jr template run --embedded '{{entity_heading "fleet" "1"}}' --entity fleet,geojson=zones,feature=park --geojsonFile zones=testfiles/zones.geojson`,
+		Output:      "87.35",
+	},
+	"entity_id": {
+		Name:        "entity_id",
+		Category:    "entity",
+		Description: "returns the ids of the entities of a simulation, from 1 to the simulation count, in round-robin",
+		Parameters:  "simulation string",
+		Localizable: false,
+		Return:      "string",
+		Example:     `jr template run --embedded '{{entity_id "fleet"}}' --entity fleet,geojson=zones,feature=park --geojsonFile zones=testfiles/zones.geojson`,
+		Output:      "1",
+	},
+	"entity_latitude": {
+		Name:        "entity_latitude",
+		Category:    "entity",
+		Description: "returns the latitude of an entity of a simulation. Entities advance by one tick for every generated value",
+		Parameters:  "simulation string, id string",
+		Localizable: false,
+		Return:      "float",
+		Example:     `jr template run --embedded '{{entity_latitude "fleet" "1"}}' --entity fleet,geojson=zones,feature=park --geojsonFile zones=testfiles/zones.geojson`,
+		Output:      "45.845120412356",
+	},
+	"entity_longitude": {
+		Name:        "entity_longitude",
+		Category:    "entity",
+		Description: "returns the longitude of an entity of a simulation. Entities advance by one tick for every generated value",
+		Parameters:  "simulation string, id string",
+		Localizable: false,
+		Return:      "float",
+		Example:     `jr template run --embedded '{{entity_longitude "fleet" "1"}}' --entity fleet,geojson=zones,feature=park --geojsonFile zones=testfiles/zones.geojson`,
+		Output:      "9.384521784512",
+	},
+	"entity_position": {
+		Name:        "entity_position",
+		Category:    "entity",
+		Description: "returns latitude and longitude of an entity of a simulation. Entities advance by one tick for every generated value",
+		Parameters:  "simulation string, id string",
+		Localizable: false,
+		Return:      "string",
+		Example:     `jr template run --embedded '{{entity_position "fleet" "1"}}' --entity fleet,geojson=zones,feature=park --geojsonFile zones=testfiles/zones.geojson`,
+		Output:      "45.845120412356 9.384521784512",
+	},
+	"entity_speed": {
+		Name:        "entity_speed",
+		Category:    "entity",
+		Description: "returns the speed in meters per second of an entity of a simulation. Entities advance by one tick for every generated value",
+		Parameters:  "simulation string, id string",
+		Localizable: false,
+		Return:      "float",
+		Example:     `jr template run --embedded '{{entity_speed "fleet" "1"}}' --entity fleet,geojson=zones,feature=park --geojsonFile zones=testfiles/zones.geojson`,
+		Output:      "12.5",
+	},
+	"entity_status": {
+		Name:        "entity_status",
+		Category:    "entity",
+		Description: "returns the status of an entity of a simulation, by default one of idle, moving and stopped. Entities advance by one tick for every generated value",
+		Parameters:  "simulation string, id string",
+		Localizable: false,
+		Return:      "string",
+		Example:     `jr template run --embedded '{{entity_status "fleet" "1"}}' --entity fleet,geojson=zones,feature=park --geojsonFile zones=testfiles/zones.geojson`,
+		Output:      "moving",
+	},
 	"ethereum": {
 		Name:        "ethereum",
 		Category:    "finance",
@@ -502,6 +732,26 @@ var funcDesc = map[string]FunctionDescription{
 		Example:     "jr template run --embedded '{{gender}}'",
 		Output:      "F",
 	},
+	"geo_feature": {
+		Name:        "geo_feature",
+		Category:    "address",
+		Description: "returns the name of a random feature of a named GeoJson dataset, weighted by the dataset weightProperty if set",
+		Parameters:  "dataset string",
+		Localizable: false,
+		Return:      "string",
+		Example:     `jr template run --embedded '{{geo_feature "zones"}}' --geojsonFile zones=testfiles/zones.geojson`,
+		Output:      "park",
+	},
+	"geo_property": {
+		Name:        "geo_property",
+		Category:    "address",
+		Description: "returns a property of a feature of a named GeoJson dataset",
+		Parameters:  "dataset string, feature string, property string",
+		Localizable: false,
+		Return:      "string",
+		Example:     `jr template run --embedded '{{geo_property "zones" "park" "kind"}}' --geojsonFile zones=testfiles/zones.geojson`,
+		Output:      "green",
+	},
 	"get_v": {
 		Name:        "get_v",
 		Category:    "context",
@@ -522,6 +772,16 @@ var funcDesc = map[string]FunctionDescription{
 		Example:     "jr template run --embedded '{{add_v_to_list \"ids\" \"12770\"}}{{get_v_from_list_at_index \"ids\" 0}}'",
 		Output:      "12770",
 	},
+	"gps_along_route": {
+		Name:        "gps_along_route",
+		Category:    "address",
+		Description: "returns the latitude longitude at a distance in meters along the LineString route of a feature of a named GeoJson dataset, restarting from the beginning at the end of the route",
+		Parameters:  "dataset string, feature string, meters int",
+		Localizable: false,
+		Return:      "string",
+		Example:     `jr template run --embedded '{{gps_along_route "zones" "bus" 250}}' --geojsonFile zones=testfiles/zones.geojson`,
+		Output:      "45.842248000000 9.380000000000",
+	},
 	"http_method": {
 		Name:        "http_method",
 		Category:    "network",
@@ -597,7 +857,7 @@ var funcDesc = map[string]FunctionDescription{
 	"ip": {
 		Name:        "ip",
 		Category:    "network",
-		Description: "returns a random Ip Address matching the given cidr",
+		Description: "returns a random Ip Address matching the given cidr, IPv4 or IPv6",
 		Parameters:  "cidr string",
 		Localizable: false,
 		Return:      "string",
@@ -607,12 +867,12 @@ var funcDesc = map[string]FunctionDescription{
 	"ipv6": {
 		Name:        "ipv6",
 		Category:    "network",
-		Description: "returns a random Ipv6 Address",
-		Parameters:  "",
+		Description: "returns a random Ipv6 Address, in the given prefix if any",
+		Parameters:  "[cidr string]",
 		Localizable: false,
 		Return:      "string",
-		Example:     "jr template run --embedded '{{ipv6}}'",
-		Output:      "2001:db8:85a3:8d3:1319:8a2e:370:7348",
+		Example:     "jr template run --embedded '{{ipv6 \"2001:db8::/32\"}}'",
+		Output:      "2001:db8:d130:4111:58a6:54a2:27ed:a26c",
 	},
 	"ip_known_protocol": {
 		Name:        "ip_known_protocol",
@@ -654,6 +914,16 @@ var funcDesc = map[string]FunctionDescription{
 		Example:     "jr template run --embedded '{{join \"hello,\" \"world\"}}'",
 		Output:      "hello,world",
 	},
+	"json_escape": {
+		Name:        "json_escape",
+		Category:    "text",
+		Description: "escapes quotes, backslashes and control characters of a string to write it in a JSON string",
+		Parameters:  "s string",
+		Localizable: false,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{json_escape \"say \\\"hi\\\"\"}}'",
+		Output:      "say \\\"hi\\\"",
+	},
 	"just_passed": {
 		Name:        "just_passed",
 		Category:    "time",
@@ -664,6 +934,106 @@ var funcDesc = map[string]FunctionDescription{
 		Example:     "jr template run --embedded '{{just_passed 60000}}'",
 		Output:      "2024-11-10 22:59:5",
 	},
+	"leef_log": {
+		Name:        "leef_log",
+		Category:    "logs",
+		Description: "returns a firewall event in the IBM QRadar Log Event Extended Format 1.0, with tab separated attributes",
+		Parameters:  "vendor string, product string",
+		Localizable: false,
+		Return:      "string",
+		Example:     `jr template run --embedded '{{leef_log "Acme" "Firewall"}}'`,
+		Output:      "LEEF:1.0|Acme|Firewall|1.0|300|devTime=Oct 18 2026 14:25:41\\tdevTimeFormat=MMM dd yyyy HH:mm:ss\\tsrc=151.68.199.237\\t...",
+	},
+	"log_session": {
+		Name:        "log_session",
+		Category:    "logs",
+		Description: "returns the client session of the current record, with ID, IP, Port, UserAgent, User, Host, ServerIP and Requests fields. A session makes a random number of requests, interleaved with the ones of the other active sessions",
+		Parameters:  "",
+		Localizable: false,
+		Return:      "*LogSession",
+		Example:     "jr template run --embedded '{{$s := log_session}}{{$s.IP}} {{$s.User}}'",
+		Output:      "28.233.175.91 jclark",
+	},
+	"markov_paragraph": {
+		Name:        "markov_paragraph",
+		Category:    "text",
+		Description: "returns a paragraph of n sentences generated with a Markov chain from a named corpus, configured with --corpus or read from the corpora directory of the locale",
+		Parameters:  "name string, n int",
+		Localizable: true,
+		Return:      "string",
+		Example:     `jr run --embedded '{{markov_paragraph "tickets" 2}}'`,
+		Output:      "My order has not arrived yet and the tracking number does not work. Please cancel my subscription at the end of the current billing period.",
+	},
+	"markov_sentence": {
+		Name:        "markov_sentence",
+		Category:    "text",
+		Description: "returns a sentence generated with a Markov chain from a named corpus, configured with --corpus or read from the corpora directory of the locale",
+		Parameters:  "name string",
+		Localizable: true,
+		Return:      "string",
+		Example:     `jr run --embedded '{{markov_sentence "reviews"}}'`,
+		Output:      "The battery lasts all day and it has never let me down.",
+	},
+	"national_id": {
+		Name:        "national_id",
+		Category:    "people",
+		Description: "returns a valid national identifier for the current locale: ssn for us, cf for it, steuer_id for de, nir for fr, dni for es and nino for uk",
+		Parameters:  "",
+		Localizable: true,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{national_id}}' --locale es",
+		Output:      "12345678Z",
+	},
+	"netflow_record": {
+		Name:        "netflow_record",
+		Category:    "network",
+		Description: "returns the flow of the current record in a network as JSON, with IPFIX information element names",
+		Parameters:  "network string",
+		Localizable: false,
+		Return:      "string",
+		Example:     `jr template run --embedded '{{netflow_record "corp"}}'`,
+		Output:      `{"sourceIPv4Address":"10.1.13.160","destinationIPv4Address":"74.189.246.120","destinationTransportPort":443,"protocolIdentifier":6,...}`,
+	},
+	"nginx_log": {
+		Name:        "nginx_log",
+		Category:    "logs",
+		Description: "returns an access log line in the Nginx combined format, the same as apache_log",
+		Parameters:  "",
+		Localizable: false,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{nginx_log}}'",
+		Output:      `28.233.175.91 - jclark [18/Oct/2026:14:25:36 +0000] "GET /images/logo.png HTTP/1.1" 200 38127 "-" "Mozilla/5.0 (Windows NT 10.0) ..."`,
+	},
+	"nie": {
+		Name:        "nie",
+		Category:    "people",
+		Description: "returns a valid Spanish foreigner identity number (NIE)",
+		Parameters:  "",
+		Localizable: false,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{nie}}'",
+		Output:      "X1234567L",
+	},
+	"nino": {
+		Name:        "nino",
+		Category:    "people",
+		Description: "returns a valid UK National Insurance number",
+		Parameters:  "",
+		Localizable: false,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{nino}}'",
+		Output:      "AB123456C",
+	},
+	"nir": {
+		Name:        "nir",
+		Category:    "people",
+		Description: "returns a valid French social security number (NIR) with its key",
+		Parameters:  "",
+		Localizable: false,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{nir}}'",
+		Output:      "255081416802538",
+	},
 	"now": {
 		Name:        "now",
 		Category:    "time",
@@ -907,21 +1277,21 @@ var funcDesc = map[string]FunctionDescription{
 	"nearby_gps_into_polygon": {
 		Name:        "nearby_gps_into_polygon",
 		Category:    "address",
-		Description: "returns a random latitude longitude within a given start point, radius in meters and poligon from a GeoJson file",
-		Parameters:  "string",
+		Description: "returns a random latitude longitude within a given start point, radius in meters and poligon from a GeoJson file. With a named GeoJson dataset and optionally a feature name, it walks inside the feature, outside of its holes, with a trail for every feature. Without feature name, a random weighted feature is used",
+		Parameters:  "latitude float64, longitude float64, radius int, [dataset string, [feature string]]",
 		Localizable: false,
 		Return:      "string",
 		Example:     `jr template run --embedded '{{nearby_gps_into_polygon 45.849539549943 9.3874341200659 10}}' --geojson testfiles/polygon.geojson`,
 		Output:      "41.8963 12.4975",
 	},
 	"nearby_gps_into_polygon_without_start": {
-		Name:        "nearby_gps_into_polygon",
+		Name:        "nearby_gps_into_polygon_without_start",
 		Category:    "address",
-		Description: "returns a random latitude longitude within a given start point, radius in meters and poligon from a GeoJson file",
-		Parameters:  "string",
+		Description: "returns a random latitude longitude within radius meters, in a poligon from a GeoJson file, starting from a random point. With a named GeoJson dataset and optionally a feature name, it walks inside the feature, outside of its holes, with a trail for every feature. Without feature name, a random weighted feature is used",
+		Parameters:  "radius int, [dataset string, [feature string]]",
 		Localizable: false,
 		Return:      "string",
-		Example:     `jr template run --embedded '{{nearby_gps_into_polygon_without_start 10}}' --geojson testfiles/polygon.geojson`,
+		Example:     `jr template run --embedded '{{nearby_gps_into_polygon_without_start 10 "zones" "park"}}' --geojsonFile zones=testfiles/zones.geojson`,
 		Output:      "41.8963 12.4975",
 	},
 	"now_add": {
@@ -964,6 +1334,16 @@ var funcDesc = map[string]FunctionDescription{
 		Example:     "jr template run --embedded '{{past 5}}'",
 		Output:      "2022-05-08",
 	},
+	"person": {
+		Name:        "person",
+		Category:    "people",
+		Description: "returns a coherent person with Name, Surname, Gender, Email, Username, Phone, BirthDate and Address fields, and FullName and CF methods: gender matches the name, email and username are derived from the name, and the phone prefix matches the city",
+		Parameters:  "",
+		Localizable: true,
+		Return:      "Person",
+		Example:     "jr template run --embedded '{{$p := person}}{{$p.FullName}} {{$p.Email}} {{$p.Address.City}}'",
+		Output:      "Carol Smith carol.smith@gmail.com Austin",
+	},
 	"phone": {
 		Name:        "phone",
 		Category:    "phone",
@@ -984,6 +1364,26 @@ var funcDesc = map[string]FunctionDescription{
 		Example:     "jr template run --embedded '{{phone_at 79}}'",
 		Output:      "06 72358749",
 	},
+	"port_service": {
+		Name:        "port_service",
+		Category:    "network",
+		Description: "returns the IANA name of the service on a port and transport protocol, from the services file",
+		Parameters:  "port int, protocol string",
+		Localizable: false,
+		Return:      "string",
+		Example:     `jr template run --embedded '{{port_service 443 "tcp"}}'`,
+		Output:      "https",
+	},
+	"product": {
+		Name:        "product",
+		Category:    "e-commerce",
+		Description: "returns a product of a named catalog, with SKU, name, category hierarchy, price, currency and tax rate of the locale. Popular products are returned more often",
+		Parameters:  "catalog string",
+		Localizable: true,
+		Return:      "Product",
+		Example:     `jr run --embedded '{{product "shop"}}'`,
+		Output:      `{"sku":"ELE-HEA-24076","name":"Ultra Headphones","category":"Headphones","category_path":["Electronics","Audio","Headphones"],"price":65.99,"currency":"USD","tax_class":"standard","tax_rate":0.0725}`,
+	},
 	"random": {
 		Name:        "random",
 		Category:    "text",
@@ -1154,6 +1554,16 @@ var funcDesc = map[string]FunctionDescription{
 		Example:     "jr template run --embedded '{{soon 15}}'",
 		Output:      "2023-04-25",
 	},
+	"span_id": {
+		Name:        "span_id",
+		Category:    "utilities",
+		Description: "returns the W3C span id of the record: the id of its span when tracing, or a random id, the same for the whole record",
+		Parameters:  "",
+		Localizable: false,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{span_id}}'",
+		Output:      "00f067aa0ba902b7",
+	},
 	"split": {
 		Name:        "split",
 		Category:    "text",
@@ -1164,6 +1574,16 @@ var funcDesc = map[string]FunctionDescription{
 		Example:     "jr template run --embedded '{{split \"hello,world\" \",\"}}'",
 		Output:      "[hello world]",
 	},
+	"steuer_id": {
+		Name:        "steuer_id",
+		Category:    "people",
+		Description: "returns a valid German tax identification number (Steuer-ID)",
+		Parameters:  "",
+		Localizable: false,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{steuer_id}}'",
+		Output:      "86095742719",
+	},
 	"stock_symbol": {
 		Name:        "stock_symbol",
 		Category:    "finance",
@@ -1294,6 +1714,26 @@ var funcDesc = map[string]FunctionDescription{
 		Example:     "jr template run --embedded '{{substr 0 5 \"hello world\"}}'",
 		Output:      "hello",
 	},
+	"syslog_3164": {
+		Name:        "syslog_3164",
+		Category:    "logs",
+		Description: "returns a RFC 3164 (BSD) syslog line",
+		Parameters:  "",
+		Localizable: false,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{syslog_3164}}'",
+		Output:      "<38>Oct 18 14:25:39 web-03 sshd[46107]: Accepted publickey for amorales from 194.53.25.15 port 60873 ssh2",
+	},
+	"syslog_5424": {
+		Name:        "syslog_5424",
+		Category:    "logs",
+		Description: "returns a RFC 5424 syslog line, with structured data",
+		Parameters:  "",
+		Localizable: false,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{syslog_5424}}'",
+		Output:      `<28>1 2026-10-18T14:25:37.883Z web-01 cron 57330 - [origin ip="10.185.246.110"][meta sequenceId="2"] (aalvarez) CMD (/usr/local/bin/backup.sh)`,
+	},
 	"title": {
 		Name:        "title",
 		Category:    "text",
@@ -1304,6 +1744,16 @@ var funcDesc = map[string]FunctionDescription{
 		Example:     "jr template run --embedded '{{title \"hello world\"}}'",
 		Output:      "Hello World",
 	},
+	"trace_id": {
+		Name:        "trace_id",
+		Category:    "utilities",
+		Description: "returns the W3C trace id of the record: the id of its trace when tracing, or a random id, the same for the whole record",
+		Parameters:  "",
+		Localizable: false,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{trace_id}}'",
+		Output:      "4bf92f3577b34da6a3ce929d0e0e4736",
+	},
 	"trim": {
 		Name:        "trim",
 		Category:    "text",
@@ -1324,6 +1774,36 @@ var funcDesc = map[string]FunctionDescription{
 		Example:     "jr template run --embedded '{{trimchars \"hello world\" \"hld\"}}'",
 		Output:      "ello wor",
 	},
+	"unique": {
+		Name:        "unique",
+		Category:    "utilities",
+		Description: "calls the function with the given name and arguments until it returns a value never seen in the scope, failing when the function is exhausted",
+		Parameters:  "scope string, function string, args ...any",
+		Localizable: false,
+		Return:      "any",
+		Example:     `jr run --embedded '{{unique "users" "from" "state_short"}}' -n 3`,
+		Output:      "\nCA\nNY\nTX",
+	},
+	"unique_count": {
+		Name:        "unique_count",
+		Category:    "utilities",
+		Description: "returns the number of values in a unique scope",
+		Parameters:  "scope string",
+		Localizable: false,
+		Return:      "int",
+		Example:     `jr run --embedded '{{unique "ids" "integer" 1 100}} {{unique_count "ids"}}' -n 2`,
+		Output:      "\n42 1\n7 2",
+	},
+	"unique_value": {
+		Name:        "unique_value",
+		Category:    "utilities",
+		Description: "returns the value if it was never seen in the scope: on duplicates, emitters generate the record again",
+		Parameters:  "scope string, value any",
+		Localizable: false,
+		Return:      "any",
+		Example:     `jr run --embedded '{{unique_value "emails" (email)}}'`,
+		Output:      "john.smith@gmail.com",
+	},
 	"unix_time_stamp": {
 		Name:        "unix_time_stamp",
 		Category:    "time",
@@ -1384,6 +1864,106 @@ var funcDesc = map[string]FunctionDescription{
 		Example:     "jr template run --embedded '{{uuid}}'",
 		Output:      "a6da3ed0-5fcb-4bb8-a6aa-654120a1e6e3",
 	},
+	"valid_bic": {
+		Name:        "valid_bic",
+		Category:    "finance",
+		Description: "checks the format of a BIC",
+		Parameters:  "bic string",
+		Localizable: false,
+		Return:      "bool",
+		Example:     `jr template run --embedded '{{valid_bic "DEUTDEFF"}}'`,
+		Output:      "true",
+	},
+	"valid_cf": {
+		Name:        "valid_cf",
+		Category:    "people",
+		Description: "checks format and control character of an Italian Codice Fiscale",
+		Parameters:  "cf string",
+		Localizable: false,
+		Return:      "bool",
+		Example:     "jr template run --embedded '{{valid_cf (cf)}}' --locale it",
+		Output:      "true",
+	},
+	"valid_dni": {
+		Name:        "valid_dni",
+		Category:    "people",
+		Description: "checks the control letter of a Spanish DNI or NIE",
+		Parameters:  "dni string",
+		Localizable: false,
+		Return:      "bool",
+		Example:     `jr template run --embedded '{{valid_dni "X1234567L"}}'`,
+		Output:      "true",
+	},
+	"valid_iban": {
+		Name:        "valid_iban",
+		Category:    "finance",
+		Description: "checks length, mod-97 checksum and national check digits of an IBAN",
+		Parameters:  "iban string",
+		Localizable: false,
+		Return:      "bool",
+		Example:     `jr template run --embedded '{{valid_iban "DE89370400440532013000"}}'`,
+		Output:      "true",
+	},
+	"valid_national_id": {
+		Name:        "valid_national_id",
+		Category:    "people",
+		Description: "checks a national identifier for the current locale",
+		Parameters:  "id string",
+		Localizable: true,
+		Return:      "bool",
+		Example:     `jr template run --embedded '{{valid_national_id "AB123456C"}}' --locale uk`,
+		Output:      "true",
+	},
+	"valid_nino": {
+		Name:        "valid_nino",
+		Category:    "people",
+		Description: "checks prefix and format of a UK National Insurance number",
+		Parameters:  "nino string",
+		Localizable: false,
+		Return:      "bool",
+		Example:     `jr template run --embedded '{{valid_nino "AB123456C"}}'`,
+		Output:      "true",
+	},
+	"valid_nir": {
+		Name:        "valid_nir",
+		Category:    "people",
+		Description: "checks format and key of a French social security number",
+		Parameters:  "nir string",
+		Localizable: false,
+		Return:      "bool",
+		Example:     `jr template run --embedded '{{valid_nir "255081416802538"}}'`,
+		Output:      "true",
+	},
+	"valid_ssn": {
+		Name:        "valid_ssn",
+		Category:    "people",
+		Description: "checks the format of a US Social Security Number",
+		Parameters:  "ssn string",
+		Localizable: false,
+		Return:      "bool",
+		Example:     `jr template run --embedded '{{valid_ssn "123-45-6789"}}'`,
+		Output:      "true",
+	},
+	"valid_steuer_id": {
+		Name:        "valid_steuer_id",
+		Category:    "people",
+		Description: "checks digits and check digit of a German tax identification number",
+		Parameters:  "id string",
+		Localizable: false,
+		Return:      "bool",
+		Example:     `jr template run --embedded '{{valid_steuer_id "86095742719"}}'`,
+		Output:      "true",
+	},
+	"valid_vat": {
+		Name:        "valid_vat",
+		Category:    "finance",
+		Description: "checks the check digits of a DE, ES, FR, GB or IT VAT number",
+		Parameters:  "vat string",
+		Localizable: false,
+		Return:      "bool",
+		Example:     `jr template run --embedded '{{valid_vat "GB980780684"}}'`,
+		Output:      "true",
+	},
 	"valor": {
 		Name:        "valor",
 		Category:    "finance",
@@ -1394,6 +1974,46 @@ var funcDesc = map[string]FunctionDescription{
 		Example:     "jr template run --embedded '{{valor}}'",
 		Output:      "0832047",
 	},
+	"vat": {
+		Name:        "vat",
+		Category:    "finance",
+		Description: "returns a valid VAT number for the country of the current locale: DE, ES, FR, GB and IT are supported",
+		Parameters:  "",
+		Localizable: true,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{vat}}' --locale it",
+		Output:      "IT00743110157",
+	},
+	"vat_country": {
+		Name:        "vat_country",
+		Category:    "finance",
+		Description: "returns a valid VAT number for a country: DE, ES, FR, GB and IT are supported",
+		Parameters:  "country string",
+		Localizable: false,
+		Return:      "string",
+		Example:     `jr template run --embedded '{{vat_country "FR"}}'`,
+		Output:      "FR40303265045",
+	},
+	"vpc_flow_log": {
+		Name:        "vpc_flow_log",
+		Category:    "logs",
+		Description: "returns an AWS VPC flow log record, in the default version 2 format",
+		Parameters:  "",
+		Localizable: false,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{vpc_flow_log}}'",
+		Output:      "2 102883843373 eni-00e24beb02ffe4d10 194.53.25.15 10.101.244.167 51835 22 6 15 17250 1792333519 1792333547 ACCEPT OK",
+	},
+	"windows_event_log": {
+		Name:        "windows_event_log",
+		Category:    "logs",
+		Description: "returns a Windows security event (logon, logoff, special logon or process creation) as JSON",
+		Parameters:  "",
+		Localizable: false,
+		Return:      "string",
+		Example:     "jr template run --embedded '{{windows_event_log}}'",
+		Output:      `{"Channel":"Security","EventID":4624,...}`,
+	},
 	"wkn": {
 		Name:        "wkn",
 		Category:    "finance",
@@ -0,0 +1,375 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	geojson "github.com/paulmach/go.geojson"
+	"github.com/rs/zerolog/log"
+)
+
+// GeoConfig describes a named GeoJSON dataset.
+// Features are named with the NameProperty (default "name") and picked randomly weighted with
+// the WeightProperty, or uniformly if it is not set.
+type GeoConfig struct {
+	Name           string `mapstructure:"name" json:"name"`
+	Path           string `mapstructure:"path" json:"path"`
+	NameProperty   string `mapstructure:"nameProperty" json:"nameProperty"`
+	WeightProperty string `mapstructure:"weightProperty" json:"weightProperty"`
+}
+
+// GeoFeature is a feature of a GeoJSON dataset: a set of polygons, each one with its holes, and/or a route
+type GeoFeature struct {
+	Name       string
+	Properties map[string]interface{}
+	Polygons   [][][][]float64
+	Route      [][]float64
+
+	weight    float64
+	distances []float64
+	trailLat  []float64
+	trailLon  []float64
+}
+
+type geoDataset struct {
+	features    []*GeoFeature
+	byName      map[string]*GeoFeature
+	totalWeight float64
+	lock        sync.Mutex
+}
+
+var geoDatasets = map[string]*geoDataset{}
+var geoDatasetsLock sync.RWMutex
+
+// InitGeoDataset loads a named GeoJSON dataset, replacing any dataset with the same name
+func InitGeoDataset(config GeoConfig) error {
+	if config.Name == "" {
+		return fmt.Errorf("geojson dataset without name: %s", config.Path)
+	}
+	if config.NameProperty == "" {
+		config.NameProperty = "name"
+	}
+
+	b, err := os.ReadFile(config.Path)
+	if err != nil {
+		return fmt.Errorf("geojson dataset %s: %w", config.Name, err)
+	}
+	fc, err := geojson.UnmarshalFeatureCollection(b)
+	if err != nil {
+		return fmt.Errorf("geojson dataset %s: %w", config.Name, err)
+	}
+
+	d := &geoDataset{byName: make(map[string]*GeoFeature)}
+	for i, f := range fc.Features {
+		if f.Geometry == nil {
+			continue
+		}
+		feature := &GeoFeature{Properties: f.Properties, weight: 1}
+		addGeometry(feature, f.Geometry)
+		if len(feature.Polygons) == 0 && len(feature.Route) < 2 {
+			log.Warn().Str("dataset", config.Name).Int("feature", i).Msg("Ignoring feature without polygons or routes")
+			continue
+		}
+
+		feature.Name = strconv.Itoa(i)
+		if n, ok := f.Properties[config.NameProperty]; ok {
+			feature.Name = fmt.Sprint(n)
+		}
+		if config.WeightProperty != "" {
+			w, ok := f.Properties[config.WeightProperty].(float64)
+			if !ok || w < 0 {
+				return fmt.Errorf("geojson dataset %s: feature %s has no valid %s", config.Name, feature.Name, config.WeightProperty)
+			}
+			feature.weight = w
+		}
+		feature.distances = routeDistances(feature.Route)
+
+		d.features = append(d.features, feature)
+		d.byName[feature.Name] = feature
+		d.totalWeight += feature.weight
+	}
+	if len(d.features) == 0 {
+		return fmt.Errorf("geojson dataset %s: no polygons or routes found", config.Name)
+	}
+
+	geoDatasetsLock.Lock()
+	defer geoDatasetsLock.Unlock()
+	geoDatasets[config.Name] = d
+	return nil
+}
+
+func addGeometry(feature *GeoFeature, g *geojson.Geometry) {
+	switch g.Type {
+	case geojson.GeometryPolygon:
+		feature.Polygons = append(feature.Polygons, g.Polygon)
+	case geojson.GeometryMultiPolygon:
+		feature.Polygons = append(feature.Polygons, g.MultiPolygon...)
+	case geojson.GeometryLineString:
+		feature.Route = append(feature.Route, g.LineString...)
+	case geojson.GeometryMultiLineString:
+		for _, l := range g.MultiLineString {
+			feature.Route = append(feature.Route, l...)
+		}
+	case geojson.GeometryCollection:
+		for _, child := range g.Geometries {
+			addGeometry(feature, child)
+		}
+	}
+}
+
+// GeoFeatureByName returns a feature of a named dataset. If name is empty a random, weighted, feature is returned.
+func GeoFeatureByName(dataset string, name string) (*GeoFeature, error) {
+	geoDatasetsLock.RLock()
+	d, exists := geoDatasets[dataset]
+	geoDatasetsLock.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("geojson dataset %s not found", dataset)
+	}
+
+	if name != "" {
+		f, ok := d.byName[name]
+		if !ok {
+			return nil, fmt.Errorf("feature %s not found in geojson dataset %s", name, dataset)
+		}
+		return f, nil
+	}
+
+	if d.totalWeight == 0 {
+		return d.features[Random.Intn(len(d.features))], nil
+	}
+	r := Random.Float64() * d.totalWeight
+	for _, f := range d.features {
+		r -= f.weight
+		if r < 0 {
+			return f, nil
+		}
+	}
+	return d.features[len(d.features)-1], nil
+}
+
+// Contains checks if a point is inside one of the feature polygons and outside of their holes
+func (f *GeoFeature) Contains(latitude, longitude float64) bool {
+	point := []float64{latitude, longitude}
+	for _, polygon := range f.Polygons {
+		if len(polygon) == 0 || !isPointInPolygon(point, polygon[0]) {
+			continue
+		}
+		inHole := false
+		for _, hole := range polygon[1:] {
+			if isPointInPolygon(point, hole) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// RandomPoint returns a random point inside the feature polygons, or along its route
+func (f *GeoFeature) RandomPoint() (float64, float64) {
+	if len(f.Polygons) == 0 {
+		lat, lon, _ := f.RoutePosition(Random.Float64() * f.RouteLength())
+		return lat, lon
+	}
+
+	// polygons are picked proportionally to their bounding box, then points are rejected if outside
+	areas := make([]float64, len(f.Polygons))
+	total := 0.0
+	for i, polygon := range f.Polygons {
+		minX, minY, maxX, maxY := boundingBox(polygon[0])
+		total += (maxX - minX) * (maxY - minY)
+		areas[i] = total
+	}
+	for attempts := 0; attempts < 10000; attempts++ {
+		i := sort.SearchFloat64s(areas, Random.Float64()*total)
+		if i == len(areas) {
+			i--
+		}
+		minX, minY, maxX, maxY := boundingBox(f.Polygons[i][0])
+		lon := minX + Random.Float64()*(maxX-minX)
+		lat := minY + Random.Float64()*(maxY-minY)
+		if f.Contains(lat, lon) {
+			return lat, lon
+		}
+	}
+	log.Warn().Str("feature", f.Name).Msg("Cannot find a random point inside the feature")
+	return f.Polygons[0][0][0][1], f.Polygons[0][0][0][0]
+}
+
+// RouteLength returns the length in meters of the feature route
+func (f *GeoFeature) RouteLength() float64 {
+	if len(f.distances) == 0 {
+		return 0
+	}
+	return f.distances[len(f.distances)-1]
+}
+
+// RoutePosition returns latitude, longitude and bearing in degrees at a distance in meters along the route.
+// The route is followed cyclically.
+func (f *GeoFeature) RoutePosition(meters float64) (float64, float64, float64) {
+	if len(f.Route) == 0 {
+		return 0, 0, 0
+	}
+	length := f.RouteLength()
+	if len(f.Route) == 1 || length == 0 {
+		return f.Route[0][1], f.Route[0][0], 0
+	}
+
+	meters = math.Mod(meters, length)
+	if meters < 0 {
+		meters += length
+	}
+	i := sort.SearchFloat64s(f.distances, meters)
+	if i == 0 {
+		i = 1
+	}
+	if i >= len(f.Route) {
+		i = len(f.Route) - 1
+	}
+	from, to := f.Route[i-1], f.Route[i]
+	segment := f.distances[i] - f.distances[i-1]
+	ratio := 0.0
+	if segment > 0 {
+		ratio = (meters - f.distances[i-1]) / segment
+	}
+	lat := from[1] + (to[1]-from[1])*ratio
+	lon := from[0] + (to[0]-from[0])*ratio
+	return lat, lon, bearing(from[1], from[0], to[1], to[0])
+}
+
+// routeDistances returns the cumulative distance of each route vertex from the start of the route
+func routeDistances(route [][]float64) []float64 {
+	if len(route) == 0 {
+		return nil
+	}
+	distances := make([]float64, len(route))
+	for i := 1; i < len(route); i++ {
+		distances[i] = distances[i-1] + haversine(route[i-1][1], route[i-1][0], route[i][1], route[i][0])
+	}
+	return distances
+}
+
+// haversine returns the distance in meters between two points
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// bearing returns the initial bearing in degrees from the first to the second point
+func bearing(lat1, lon1, lat2, lon2 float64) float64 {
+	φ1, φ2 := lat1*math.Pi/180, lat2*math.Pi/180
+	Δλ := (lon2 - lon1) * math.Pi / 180
+	y := math.Sin(Δλ) * math.Cos(φ2)
+	x := math.Cos(φ1)*math.Sin(φ2) - math.Sin(φ1)*math.Cos(φ2)*math.Cos(Δλ)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+// GeoFeatureName returns the name of a random feature of a GeoJSON dataset, weighted if configured
+func GeoFeatureName(dataset string) string {
+	f, err := GeoFeatureByName(dataset, "")
+	if err != nil {
+		log.Error().Err(err).Msg("Error picking geojson feature")
+		return ""
+	}
+	return f.Name
+}
+
+// GeoProperty returns a property of a feature of a GeoJSON dataset
+func GeoProperty(dataset string, feature string, property string) string {
+	f, err := GeoFeatureByName(dataset, feature)
+	if err != nil {
+		log.Error().Err(err).Msg("Error reading geojson property")
+		return ""
+	}
+	v, ok := f.Properties[property]
+	if !ok || v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// nearbyGPSIntoFeature returns a point within radius meters from the last one generated for a feature, inside one
+// of the feature polygons. The selectors are the name of a dataset and optionally the name of the feature: without it,
+// a random, weighted, feature is used. The first point is the start point if it is inside the feature, or a random one.
+func nearbyGPSIntoFeature(selectors []string, radius int, startLat, startLon float64, hasStart bool) string {
+	if len(selectors) > 2 {
+		log.Error().Strs("selectors", selectors).Msg("Too many geojson selectors, expected dataset and feature")
+		return ""
+	}
+	dataset, feature := selectors[0], ""
+	if len(selectors) == 2 {
+		feature = selectors[1]
+	}
+	f, err := GeoFeatureByName(dataset, feature)
+	if err != nil {
+		log.Error().Err(err).Msg("Error picking geojson feature")
+		return ""
+	}
+	geoDatasetsLock.RLock()
+	d := geoDatasets[dataset]
+	geoDatasetsLock.RUnlock()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if len(f.Polygons) == 0 {
+		lat, lon := f.RandomPoint()
+		return fmt.Sprintf("%.12f %.12f", lat, lon)
+	}
+	if len(f.trailLat) == 0 {
+		lat, lon := startLat, startLon
+		if !hasStart || !f.Contains(lat, lon) {
+			lat, lon = f.RandomPoint()
+		}
+		f.trailLat, f.trailLon = []float64{lat}, []float64{lon}
+		return fmt.Sprintf("%.12f %.12f", lat, lon)
+	}
+
+	lat, lon := nearbyPointInto(f.trailLat, f.trailLon, radius, f.Contains)
+	f.trailLat, f.trailLon = appendToTrail(f.trailLat, f.trailLon, lat, lon)
+	return fmt.Sprintf("%.12f %.12f", lat, lon)
+}
+
+// GPSAlongRoute returns the latitude and longitude at a distance in meters along the route of a feature
+func GPSAlongRoute(dataset string, feature string, meters int) string {
+	f, err := GeoFeatureByName(dataset, feature)
+	if err != nil {
+		log.Error().Err(err).Msg("Error picking geojson feature")
+		return ""
+	}
+	if len(f.Route) == 0 {
+		log.Error().Str("feature", f.Name).Msg("Geojson feature has no route")
+		return ""
+	}
+	lat, lon, _ := f.RoutePosition(float64(meters))
+	return fmt.Sprintf("%.12f %.12f", lat, lon)
+}
@@ -0,0 +1,553 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/rs/zerolog/log"
+	"github.com/squeeze69/codicefiscale"
+)
+
+const (
+	upperLetters   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	dniLetters     = "TRWAGMYFPDXBNJZSQVHLCKE"
+	cifLetters     = "JABCDEFGHI"
+	ninoFirstBad   = "DFIQUV"
+	ninoSecondBad  = "DFIOQUV"
+	italianOddCIN  = "BAKPLCQDREVOSFTGUHMINJWZYX"
+	italianEvenCIN = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+)
+
+// ibanLengths are the IBAN lengths of the most common countries, used by the validator
+var ibanLengths = map[string]int{
+	"AD": 24, "AT": 20, "BE": 16, "BG": 22, "CH": 21, "CY": 28, "CZ": 24, "DE": 22, "DK": 18, "EE": 20,
+	"ES": 24, "FI": 18, "FR": 27, "GB": 22, "GR": 27, "HR": 21, "HU": 28, "IE": 22, "IS": 26, "IT": 27,
+	"LI": 21, "LT": 20, "LU": 20, "LV": 21, "MC": 27, "MT": 31, "NL": 18, "NO": 15, "PL": 28, "PT": 25,
+	"RO": 24, "SE": 24, "SI": 19, "SK": 24, "SM": 27,
+}
+
+var (
+	bicRegex  = regexp.MustCompile(`^[A-Z]{4}[A-Z]{2}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+	ninoRegex = regexp.MustCompile(`^([A-Z])([A-Z])[0-9]{6}[A-D]$`)
+	nirRegex  = regexp.MustCompile(`^[12][0-9]{4}(2A|2B|[0-9]{2})[0-9]{8}$`)
+	dniRegex  = regexp.MustCompile(`^[XYZ0-9][0-9]{7}[A-Z]$`)
+)
+
+// localeCountry returns the ISO 3166 country code of the current locale
+func localeCountry() string {
+	if c, ok := localeCountries[strings.ToLower(ctx.JrContext.Locale)]; ok {
+		return c
+	}
+	return "US"
+}
+
+// randomDigits returns n random digits
+func randomDigits(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = digits[Random.Intn(len(digits))]
+	}
+	return string(b)
+}
+
+// randomLetters returns n random uppercase letters
+func randomLetters(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = upperLetters[Random.Intn(len(upperLetters))]
+	}
+	return string(b)
+}
+
+// mod97 returns the remainder of the division by 97 of an alphanumeric string, with letters converted to 10-35
+func mod97(s string) int {
+	var sb strings.Builder
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			sb.WriteRune(c)
+		case c >= 'A' && c <= 'Z':
+			sb.WriteString(strconv.Itoa(int(c-'A') + 10))
+		}
+	}
+	n, ok := new(big.Int).SetString(sb.String(), 10)
+	if !ok {
+		return -1
+	}
+	return int(new(big.Int).Mod(n, big.NewInt(97)).Int64())
+}
+
+// mod1110CheckDigit calculates the ISO 7064 MOD 11,10 check digit, used by German tax identifiers
+func mod1110CheckDigit(code string) string {
+	product := 10
+	for _, c := range code {
+		sum := (int(c-'0') + product) % 10
+		if sum == 0 {
+			sum = 10
+		}
+		product = (2 * sum) % 11
+	}
+	check := 11 - product
+	if check == 10 {
+		check = 0
+	}
+	return strconv.Itoa(check)
+}
+
+// isDigits checks if a string contains only digits
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// normalizeIdentifier removes spaces and dashes, and converts to uppercase
+func normalizeIdentifier(s string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "", ".", "").Replace(s))
+}
+
+// Iban returns a valid IBAN for the country of the current locale
+func Iban() string {
+	return IbanCountry(localeCountry())
+}
+
+// IbanCountry returns a valid IBAN for a country: DE, ES, FR, GB and IT are supported
+func IbanCountry(country string) string {
+	var bban string
+	switch strings.ToUpper(country) {
+	case "DE":
+		bban = randomDigits(8) + randomDigits(10)
+	case "ES":
+		bank, branch, account := randomDigits(4), randomDigits(4), randomDigits(10)
+		bban = bank + branch + spanishAccountCheckDigit("00"+bank+branch) + spanishAccountCheckDigit(account) + account
+	case "FR":
+		bank, branch, account := randomDigits(5), randomDigits(5), randomDigits(11)
+		bban = bank + branch + account + ribKey(bank, branch, account)
+	case "GB":
+		bban = randomLetters(4) + randomDigits(6) + randomDigits(8)
+	case "IT":
+		code := randomDigits(5) + randomDigits(5) + randomDigits(12)
+		bban = italianCIN(code) + code
+	default:
+		log.Error().Str("country", country).Msg("IBAN not supported for country")
+		return ""
+	}
+	country = strings.ToUpper(country)
+	check := 98 - mod97(bban+country+"00")
+	return fmt.Sprintf("%s%02d%s", country, check, bban)
+}
+
+// ValidIban checks length and mod-97 checksum of an IBAN, and the national check digits for ES, FR and IT
+func ValidIban(iban string) bool {
+	iban = normalizeIdentifier(iban)
+	if len(iban) < 15 {
+		return false
+	}
+	country := iban[:2]
+	if l, ok := ibanLengths[country]; ok && l != len(iban) {
+		return false
+	}
+	if !isDigits(iban[2:4]) || mod97(iban[4:]+iban[:4]) != 1 {
+		return false
+	}
+	bban := iban[4:]
+	switch country {
+	case "ES":
+		return isDigits(bban) && bban[8:9] == spanishAccountCheckDigit("00"+bban[:8]) && bban[9:10] == spanishAccountCheckDigit(bban[10:])
+	case "FR":
+		return isDigits(bban[:10]) && bban[21:] == ribKey(bban[:5], bban[5:10], bban[10:21])
+	case "IT":
+		return bban[:1] == italianCIN(bban[1:])
+	}
+	return true
+}
+
+// spanishAccountCheckDigit calculates one of the two check digits of a Spanish bank account
+func spanishAccountCheckDigit(code string) string {
+	weights := [10]int{1, 2, 4, 8, 5, 10, 9, 7, 3, 6}
+	sum := 0
+	for i, c := range code {
+		sum += int(c-'0') * weights[i]
+	}
+	check := 11 - sum%11
+	switch check {
+	case 11:
+		check = 0
+	case 10:
+		check = 1
+	}
+	return strconv.Itoa(check)
+}
+
+// ribKey calculates the key of a French RIB, where letters of the account count as digits
+func ribKey(bank, branch, account string) string {
+	account = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'I':
+			return '1' + (r - 'A')
+		case r >= 'J' && r <= 'R':
+			return '1' + (r - 'J')
+		case r >= 'S' && r <= 'Z':
+			return '2' + (r - 'S')
+		}
+		return r
+	}, account)
+	b, _ := strconv.ParseInt(bank, 10, 64)
+	g, _ := strconv.ParseInt(branch, 10, 64)
+	a, _ := strconv.ParseInt(account, 10, 64)
+	return fmt.Sprintf("%02d", 97-(89*b+15*g+3*a)%97)
+}
+
+// italianCIN calculates the CIN check character of an Italian bank account: ABI, CAB and account number
+func italianCIN(code string) string {
+	sum := 0
+	for i, c := range code {
+		var v int
+		switch {
+		case c >= '0' && c <= '9':
+			v = int(c - '0')
+		case c >= 'A' && c <= 'Z':
+			v = int(c - 'A')
+		}
+		if i%2 == 0 {
+			sum += strings.IndexByte(italianOddCIN, italianEvenCIN[v])
+		} else {
+			sum += v
+		}
+	}
+	return string(italianEvenCIN[sum%26])
+}
+
+// Bic returns a BIC for a bank of the country of the current locale
+func Bic() string {
+	return BicCountry(localeCountry())
+}
+
+// BicCountry returns a BIC for a bank of the given country
+func BicCountry(country string) string {
+	location := string(upperLetters[Random.Intn(len(upperLetters))]) + string(digits[1+Random.Intn(len(digits)-1)])
+	bic := randomLetters(4) + strings.ToUpper(country) + location
+	if Random.Intn(2) == 0 {
+		return bic
+	}
+	return bic + randomDigits(3)
+}
+
+// ValidBic checks the format of a BIC
+func ValidBic(bic string) bool {
+	return bicRegex.MatchString(normalizeIdentifier(bic))
+}
+
+// Vat returns a valid VAT number for the country of the current locale
+func Vat() string {
+	return VatCountry(localeCountry())
+}
+
+// VatCountry returns a valid VAT number for a country: DE, ES, FR, GB and IT are supported
+func VatCountry(country string) string {
+	switch strings.ToUpper(country) {
+	case "DE":
+		code := string(digits[1+Random.Intn(9)]) + randomDigits(7)
+		return "DE" + code + mod1110CheckDigit(code)
+	case "ES":
+		code := string("AB"[Random.Intn(2)]) + randomDigits(7)
+		return "ES" + code + cifCheckDigit(code[1:], false)
+	case "FR":
+		siren := randomDigits(8)
+		siren += LuhnCheckDigit(siren)
+		n, _ := strconv.Atoi(siren)
+		return fmt.Sprintf("FR%02d%s", (12+3*(n%97))%97, siren)
+	case "GB":
+		code := randomDigits(7)
+		check := (97 - ukVatSum(code)%97) % 97
+		return fmt.Sprintf("GB%s%02d", code, check)
+	case "IT":
+		code := randomDigits(7) + fmt.Sprintf("%03d", 1+Random.Intn(100))
+		return "IT" + code + LuhnCheckDigit(code)
+	default:
+		log.Error().Str("country", country).Msg("VAT not supported for country")
+		return ""
+	}
+}
+
+// ValidVat checks the check digits of a VAT number of DE, ES, FR, GB and IT
+func ValidVat(vat string) bool {
+	vat = normalizeIdentifier(vat)
+	if len(vat) < 4 {
+		return false
+	}
+	code := vat[2:]
+	switch vat[:2] {
+	case "DE":
+		return len(code) == 9 && isDigits(code) && code[0] != '0' && code[8:] == mod1110CheckDigit(code[:8])
+	case "ES":
+		if len(code) != 9 {
+			return false
+		}
+		if strings.ContainsRune("ABCDEFGHJNPQRSUVW", rune(code[0])) && isDigits(code[1:8]) {
+			return code[8:] == cifCheckDigit(code[1:8], false) || code[8:] == cifCheckDigit(code[1:8], true)
+		}
+		return ValidDni(code)
+	case "FR":
+		if len(code) != 11 || !isDigits(code) || code[10:] != LuhnCheckDigit(code[2:10]) {
+			return false
+		}
+		n, _ := strconv.Atoi(code[2:])
+		return code[:2] == fmt.Sprintf("%02d", (12+3*(n%97))%97)
+	case "GB":
+		if len(code) != 9 || !isDigits(code) {
+			return false
+		}
+		check, _ := strconv.Atoi(code[7:])
+		sum := ukVatSum(code[:7]) + check
+		return check < 97 && (sum%97 == 0 || (sum+55)%97 == 0)
+	case "IT":
+		return len(code) == 11 && isDigits(code) && code[10:] == LuhnCheckDigit(code[:10])
+	}
+	return false
+}
+
+// cifCheckDigit calculates the check character of a Spanish CIF from its 7 digits, as a digit or as a letter
+func cifCheckDigit(code string, letter bool) string {
+	sum := 0
+	for i, c := range code {
+		d := int(c - '0')
+		if i%2 == 0 {
+			d *= 2
+			d = d/10 + d%10
+		}
+		sum += d
+	}
+	check := (10 - sum%10) % 10
+	if letter {
+		return string(cifLetters[check])
+	}
+	return strconv.Itoa(check)
+}
+
+// ukVatSum calculates the weighted sum of the first 7 digits of a UK VAT number
+func ukVatSum(code string) int {
+	sum := 0
+	for i, c := range code {
+		sum += int(c-'0') * (8 - i)
+	}
+	return sum
+}
+
+// SteuerID returns a valid German tax identification number (Steuerliche Identifikationsnummer)
+func SteuerID() string {
+	for {
+		// ten digits where exactly one digit appears twice, the first one not being zero
+		perm := Random.Perm(10)[:9]
+		if perm[0] == 0 {
+			continue
+		}
+		twice := 1 + Random.Intn(8)
+		code := make([]byte, 0, 10)
+		for _, d := range perm {
+			code = append(code, byte('0'+d))
+		}
+		dup := code[Random.Intn(9)]
+		code = append(code[:twice], append([]byte{dup}, code[twice:]...)...)
+		if code[0] == '0' {
+			continue
+		}
+		return string(code) + mod1110CheckDigit(string(code))
+	}
+}
+
+// ValidSteuerID checks digits distribution and check digit of a German tax identification number
+func ValidSteuerID(id string) bool {
+	id = normalizeIdentifier(id)
+	if len(id) != 11 || !isDigits(id) || id[0] == '0' {
+		return false
+	}
+	counts := map[rune]int{}
+	for _, c := range id[:10] {
+		counts[c]++
+	}
+	repeated := 0
+	for _, n := range counts {
+		if n > 1 {
+			repeated++
+		}
+	}
+	switch len(counts) {
+	case 9:
+	case 8:
+		// a digit can appear three times, but not three times in a row
+		for i := 0; i < 8; i++ {
+			if id[i] == id[i+1] && id[i] == id[i+2] {
+				return false
+			}
+		}
+	default:
+		return false
+	}
+	return repeated == 1 && id[10:] == mod1110CheckDigit(id[:10])
+}
+
+// Nir returns a valid French social security number (NIR), with its key
+func Nir() string {
+	department := fmt.Sprintf("%02d", 1+Random.Intn(95))
+	if department == "20" {
+		department = []string{"2A", "2B"}[Random.Intn(2)]
+	}
+	code := fmt.Sprintf("%d%02d%02d%s%03d%03d", 1+Random.Intn(2), Random.Intn(100), 1+Random.Intn(12), department, 1+Random.Intn(990), 1+Random.Intn(999))
+	return code + nirKey(code)
+}
+
+// ValidNir checks format and key of a French social security number
+func ValidNir(nir string) bool {
+	nir = normalizeIdentifier(nir)
+	if !nirRegex.MatchString(nir) {
+		return false
+	}
+	month, _ := strconv.Atoi(nir[3:5])
+	if month < 1 || (month > 12 && month < 20) || month > 42 {
+		return false
+	}
+	return nir[13:] == nirKey(nir[:13])
+}
+
+// nirKey calculates the key of a NIR, where Corsican departments 2A and 2B count as 19 and 18
+func nirKey(code string) string {
+	code = strings.NewReplacer("2A", "19", "2B", "18").Replace(code)
+	n, _ := strconv.ParseInt(code, 10, 64)
+	return fmt.Sprintf("%02d", 97-n%97)
+}
+
+// Dni returns a valid Spanish national identity number (DNI)
+func Dni() string {
+	n := Random.Intn(100000000)
+	return fmt.Sprintf("%08d%c", n, dniLetters[n%23])
+}
+
+// Nie returns a valid Spanish foreigner identity number (NIE)
+func Nie() string {
+	prefix := Random.Intn(3)
+	n := Random.Intn(10000000)
+	return fmt.Sprintf("%c%07d%c", "XYZ"[prefix], n, dniLetters[(prefix*10000000+n)%23])
+}
+
+// ValidDni checks the control letter of a Spanish DNI or NIE
+func ValidDni(dni string) bool {
+	dni = normalizeIdentifier(dni)
+	if !dniRegex.MatchString(dni) {
+		return false
+	}
+	number := strings.NewReplacer("X", "0", "Y", "1", "Z", "2").Replace(dni[:8])
+	n, _ := strconv.Atoi(number)
+	return dni[8] == dniLetters[n%23]
+}
+
+// Nino returns a valid UK National Insurance number
+func Nino() string {
+	for {
+		prefix := randomLetters(2)
+		if !validNinoPrefix(prefix) {
+			continue
+		}
+		return prefix + randomDigits(6) + string("ABCD"[Random.Intn(4)])
+	}
+}
+
+// ValidNino checks prefix and format of a UK National Insurance number
+func ValidNino(nino string) bool {
+	nino = normalizeIdentifier(nino)
+	return ninoRegex.MatchString(nino) && validNinoPrefix(nino[:2])
+}
+
+func validNinoPrefix(prefix string) bool {
+	if strings.ContainsRune(ninoFirstBad, rune(prefix[0])) || strings.ContainsRune(ninoSecondBad, rune(prefix[1])) {
+		return false
+	}
+	switch prefix {
+	case "BG", "GB", "KN", "NK", "NT", "TN", "ZZ":
+		return false
+	}
+	return true
+}
+
+// NationalID returns a valid national identifier for the current locale
+func NationalID() string {
+	switch localeCountry() {
+	case "DE":
+		return SteuerID()
+	case "ES":
+		return Dni()
+	case "FR":
+		return Nir()
+	case "GB":
+		return Nino()
+	case "IT":
+		return CodiceFiscale()
+	default:
+		return Ssn()
+	}
+}
+
+// ValidNationalID checks a national identifier for the current locale
+func ValidNationalID(id string) bool {
+	switch localeCountry() {
+	case "DE":
+		return ValidSteuerID(id)
+	case "ES":
+		return ValidDni(id)
+	case "FR":
+		return ValidNir(id)
+	case "GB":
+		return ValidNino(id)
+	case "IT":
+		return ValidCodiceFiscale(id)
+	default:
+		return ValidSsn(id)
+	}
+}
+
+// ValidCodiceFiscale checks format and control character of an Italian Codice Fiscale
+func ValidCodiceFiscale(cf string) bool {
+	ok, err := codicefiscale.CodiceFiscale(normalizeIdentifier(cf))
+	return ok && err == nil
+}
+
+// ValidSsn checks the format of a US Social Security Number
+func ValidSsn(ssn string) bool {
+	parts := strings.Split(ssn, "-")
+	if len(parts) != 3 || len(parts[0]) != 3 || len(parts[1]) != 2 || len(parts[2]) != 4 {
+		return false
+	}
+	for _, p := range parts {
+		if !isDigits(p) || strings.Trim(p, "0") == "" {
+			return false
+		}
+	}
+	return parts[0] != "666" && parts[0][0] != '9'
+}
@@ -0,0 +1,338 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jrnd-io/jr/pkg/constants"
+	"github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// LocaleManifestFile is the name of the optional manifest of a locale pack
+const LocaleManifestFile = "locale.json"
+
+// ErrStrictLocale is returned for a dataset outside the locale chain of a strict locale
+var ErrStrictLocale = errors.New("dataset not found in strict locale")
+
+// LocaleManifest describes a locale pack, a directory in '$JR_SYSTEM_DIR/templates/data'.
+// Parent is the locale used for the datasets missing in the pack: when it is not set,
+// the parent of a regional locale like 'de-at' is 'de'. Charset is the encoding of
+// the word files, and defaults to UTF-8.
+type LocaleManifest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Parent      string `json:"parent"`
+	Charset     string `json:"charset"`
+	// Currency is the ISO 4217 code of the currency of the locale, inherited from the parent when empty
+	Currency string `json:"currency"`
+	// TaxRates are the sales tax rates by tax class, inherited from the parent when empty
+	TaxRates map[string]float64 `json:"taxRates"`
+}
+
+// DatasetSource tells where a dataset of a locale is read from
+type DatasetSource struct {
+	Dataset string
+	// Locale is the locale of the chain providing the dataset, or the default locale
+	// when the dataset is found only with the implicit fallback
+	Locale string
+	// Fallback is true when the dataset is not provided by the locale chain
+	Fallback bool
+	// Missing is true when the dataset is not found anywhere
+	Missing bool
+}
+
+var fallbackWarnings = map[string]bool{}
+var fallbackWarningsLock sync.Mutex
+
+// localeError is the first dataset missing from a strict locale since the last call of LocaleError
+var localeError error
+var localeErrorLock sync.Mutex
+
+func localeDir(locale string) string {
+	templateDir := fmt.Sprintf("%s/%s", constants.JR_SYSTEM_DIR, "templates")
+	return fmt.Sprintf("%s/data/%s", os.ExpandEnv(templateDir), strings.ToLower(locale))
+}
+
+// checkLocale fails with locale names that could be paths of directories outside of the JR data directory
+func checkLocale(locale string) error {
+	if locale == "" || locale == "." || strings.Contains(locale, "..") || strings.ContainsAny(locale, `/\`) {
+		return fmt.Errorf("locale %q is not allowed", locale)
+	}
+	return nil
+}
+
+// LoadLocale reads the manifest of a locale pack, filling the defaults when the manifest is missing
+func LoadLocale(locale string) (*LocaleManifest, error) {
+	locale = strings.ToLower(locale)
+	if err := checkLocale(locale); err != nil {
+		return nil, err
+	}
+	dir := localeDir(locale)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("locale %s not found in %s", locale, dir)
+	}
+
+	manifest := &LocaleManifest{}
+	content, err := os.ReadFile(filepath.Join(dir, LocaleManifestFile))
+	if err == nil {
+		if err = json.Unmarshal(content, manifest); err != nil {
+			return nil, fmt.Errorf("error parsing manifest of locale %s: %w", locale, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading manifest of locale %s: %w", locale, err)
+	}
+
+	manifest.Name = locale
+	manifest.Parent = strings.ToLower(manifest.Parent)
+	if manifest.Parent == "" {
+		if i := strings.LastIndex(locale, "-"); i > 0 {
+			manifest.Parent = locale[:i]
+		}
+	}
+	if manifest.Charset == "" {
+		manifest.Charset = "UTF-8"
+	}
+	if _, err = htmlindex.Get(manifest.Charset); err != nil {
+		return nil, fmt.Errorf("unknown charset %s in locale %s", manifest.Charset, locale)
+	}
+	return manifest, nil
+}
+
+// LocaleChain returns the manifests of a locale and of all its parents, in fallback order
+func LocaleChain(locale string) ([]*LocaleManifest, error) {
+	var chain []*LocaleManifest
+	seen := map[string]bool{}
+	for l := strings.ToLower(locale); l != ""; {
+		if seen[l] {
+			return nil, fmt.Errorf("locale %s has a cyclic parent chain", locale)
+		}
+		seen[l] = true
+		manifest, err := LoadLocale(l)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, manifest)
+		l = manifest.Parent
+	}
+	return chain, nil
+}
+
+// IsLocale reports whether a locale pack is installed
+func IsLocale(locale string) bool {
+	locales, err := Locales()
+	if err != nil {
+		return false
+	}
+	i := sort.SearchStrings(locales, strings.ToLower(locale))
+	return i < len(locales) && locales[i] == strings.ToLower(locale)
+}
+
+// Locales returns the names of all the installed locale packs, sorted
+func Locales() ([]string, error) {
+	entries, err := os.ReadDir(localeDir(""))
+	if err != nil {
+		return nil, err
+	}
+	var locales []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			locales = append(locales, entry.Name())
+		}
+	}
+	sort.Strings(locales)
+	return locales, nil
+}
+
+// LocaleCurrency returns the currency and the tax rates of a locale, following the locale chain.
+// Locales without a currency in the chain use USD without taxes.
+func LocaleCurrency(locale string) (string, map[string]float64) {
+	currency, rates := "", map[string]float64(nil)
+	chain, err := LocaleChain(locale)
+	if err != nil {
+		log.Warn().Err(err).Str("locale", locale).Msg("Error loading locale, using USD")
+	}
+	for _, l := range chain {
+		if currency == "" {
+			currency = l.Currency
+		}
+		if rates == nil {
+			rates = l.TaxRates
+		}
+	}
+	if currency == "" {
+		currency = "USD"
+	}
+	if rates == nil {
+		rates = map[string]float64{}
+	}
+	return currency, rates
+}
+
+// LocaleDatasets returns the names of the datasets provided by a locale pack, without its parents
+func LocaleDatasets(locale string) ([]string, error) {
+	if err := checkLocale(strings.ToLower(locale)); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(localeDir(locale))
+	if err != nil {
+		return nil, err
+	}
+	var datasets []string
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == LocaleManifestFile || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		datasets = append(datasets, entry.Name())
+	}
+	sort.Strings(datasets)
+	return datasets, nil
+}
+
+// ResolveDataset finds the locale providing a dataset, following the locale chain and then
+// the default locale
+func ResolveDataset(locale string, dataset string) (DatasetSource, error) {
+	chain, err := LocaleChain(locale)
+	if err != nil {
+		return DatasetSource{}, err
+	}
+	source := DatasetSource{Dataset: dataset}
+	for _, l := range chain {
+		if fileExists(filepath.Join(localeDir(l.Name), dataset)) {
+			source.Locale = l.Name
+			return source, nil
+		}
+	}
+	source.Locale = constants.LOCALE
+	source.Fallback = true
+	source.Missing = !fileExists(filepath.Join(localeDir(constants.LOCALE), dataset))
+	return source, nil
+}
+
+// LocaleReport returns where every dataset of a locale is read from. The datasets are the ones
+// of the default locale plus the ones provided by the locale chain.
+func LocaleReport(locale string) ([]DatasetSource, error) {
+	chain, err := LocaleChain(locale)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, l := range append([]string{constants.LOCALE}, chainNames(chain)...) {
+		datasets, err := LocaleDatasets(l)
+		if err != nil {
+			continue
+		}
+		for _, d := range datasets {
+			names[d] = true
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for n := range names {
+		sorted = append(sorted, n)
+	}
+	sort.Strings(sorted)
+
+	report := make([]DatasetSource, 0, len(sorted))
+	for _, n := range sorted {
+		source, err := ResolveDataset(locale, n)
+		if err != nil {
+			return nil, err
+		}
+		report = append(report, source)
+	}
+	return report, nil
+}
+
+func chainNames(chain []*LocaleManifest) []string {
+	names := make([]string, len(chain))
+	for i, l := range chain {
+		names[i] = l.Name
+	}
+	return names
+}
+
+// LocaleError returns, and clears, the first dataset missing from a strict locale since its last call.
+// Word functions return an empty string for them, so the caller of the template fails the record.
+func LocaleError() error {
+	localeErrorLock.Lock()
+	defer localeErrorLock.Unlock()
+	err := localeError
+	localeError = nil
+	return err
+}
+
+func setLocaleError(err error) {
+	localeErrorLock.Lock()
+	defer localeErrorLock.Unlock()
+	if localeError == nil {
+		localeError = err
+	}
+}
+
+// datasetFile returns the file and the charset of a dataset for the current locale.
+// Outside the locale chain, the dataset is read from the default locale with a warning,
+// or it is an error if strict.
+func datasetFile(name string, strict bool) (string, string, error) {
+	locale := strings.ToLower(ctx.JrContext.Locale)
+	source, err := ResolveDataset(locale, name)
+	if err != nil {
+		return "", "", err
+	}
+	if source.Fallback {
+		if strict {
+			return "", "", fmt.Errorf("%w %s: %s", ErrStrictLocale, locale, name)
+		}
+		if locale != constants.LOCALE {
+			fallbackWarningsLock.Lock()
+			if !fallbackWarnings[locale+"/"+name] {
+				fallbackWarnings[locale+"/"+name] = true
+				log.Warn().Str("locale", locale).Str("dataset", name).Msg("Dataset not found in locale, using default locale")
+			}
+			fallbackWarningsLock.Unlock()
+		}
+	}
+	manifest, err := LoadLocale(source.Locale)
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Join(localeDir(source.Locale), name), manifest.Charset, nil
+}
+
+// decodeCharset converts the content of a word file to UTF-8
+func decodeCharset(content []byte, charset string) ([]byte, error) {
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, err
+	}
+	if name, _ := htmlindex.Name(enc); name == "utf-8" {
+		return content, nil
+	}
+	return enc.NewDecoder().Bytes(content)
+}
@@ -0,0 +1,476 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jrnd-io/jr/pkg/ctx"
+)
+
+// LogSessions is the number of client sessions active at the same time in the generated logs
+const LogSessions = 10
+
+// LogSession is a client making a series of requests to a server: all the log lines of the same session
+// share the client address, port, user agent and user
+type LogSession struct {
+	ID        string
+	IP        string
+	Port      int
+	UserAgent string
+	User      string
+	Host      string
+	ServerIP  string
+	Requests  int
+
+	remaining int
+	lastPath  string
+}
+
+var logSessions []*LogSession
+var currentLogSession *LogSession
+var logSessionRecord = -1
+var logSessionsLock sync.Mutex
+
+var logServers = []string{"web-01", "web-02", "web-03", "app-01", "app-02", "fw-01"}
+
+var logPaths = []string{
+	"/", "/index.html", "/login", "/logout", "/cart", "/checkout", "/search?q=%s", "/products/%d", "/api/v1/users/%d",
+	"/api/v1/orders/%d", "/static/css/main.css", "/static/js/app.js", "/images/logo.png", "/favicon.ico",
+}
+
+// logStatuses are the http status codes of the access logs, with their weights
+var logStatuses = newAliasTable([]float64{80, 3, 5, 4, 2, 1, 1, 2, 1, 1})
+var logStatusCodes = []int{200, 201, 204, 304, 301, 401, 403, 404, 500, 503}
+
+// ResetLogSessions forgets all the active log sessions
+func ResetLogSessions() {
+	logSessionsLock.Lock()
+	defer logSessionsLock.Unlock()
+	logSessions = nil
+	currentLogSession = nil
+	logSessionRecord = -1
+}
+
+// NewLogSession returns the session of the current record: a session makes a random number of requests,
+// interleaved with the requests of the other active sessions, then it is replaced by a new one
+func NewLogSession() *LogSession {
+	logSessionsLock.Lock()
+	defer logSessionsLock.Unlock()
+
+	if currentLogSession != nil && logSessionRecord == ctx.JrContext.CurrentIterationLoopIndex {
+		return currentLogSession
+	}
+
+	i := Random.Intn(LogSessions)
+	for len(logSessions) <= i {
+		logSessions = append(logSessions, nil)
+	}
+	if logSessions[i] == nil || logSessions[i].remaining == 0 {
+		logSessions[i] = newLogSession()
+	}
+	s := logSessions[i]
+	s.remaining--
+	s.Requests++
+
+	currentLogSession = s
+	logSessionRecord = ctx.JrContext.CurrentIterationLoopIndex
+	return s
+}
+
+func newLogSession() *LogSession {
+	user := "-"
+	if name, surname := emailPart(randomWord("nameM")), emailPart(randomWord("surname")); name != "" && surname != "" {
+		user = name[:1] + surname
+	}
+	return &LogSession{
+		ID:        strings.ReplaceAll(uuid.NewString(), "-", "")[:16],
+		IP:        publicIPv4(),
+		Port:      49152 + Random.Intn(16384),
+		UserAgent: UserAgent(),
+		User:      user,
+		Host:      logServers[Random.Intn(len(logServers))],
+		ServerIP:  Ip("10.0.0.0/8"),
+		remaining: 1 + Random.Intn(20),
+	}
+}
+
+// publicIPv4 returns a random public unicast IPv4 address, not in private, loopback,
+// link local, shared, multicast or reserved ranges
+func publicIPv4() string {
+	reserved := []string{"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+		"192.0.2.0/24", "192.168.0.0/16", "198.18.0.0/15", "198.51.100.0/24", "203.0.113.0/24", "224.0.0.0/3"}
+	for {
+		ip := net.IPv4(byte(Random.Intn(256)), byte(Random.Intn(256)), byte(Random.Intn(256)), byte(1+Random.Intn(254)))
+		public := true
+		for _, cidr := range reserved {
+			if _, ipnet, _ := net.ParseCIDR(cidr); ipnet.Contains(ip) {
+				public = false
+				break
+			}
+		}
+		if public {
+			return ip.String()
+		}
+	}
+}
+
+// logRequest is a random http request of a session
+type logRequest struct {
+	Method string
+	Path   string
+	Status int
+	Bytes  int
+}
+
+func newLogRequest() logRequest {
+	path := logPaths[Random.Intn(len(logPaths))]
+	switch {
+	case strings.Contains(path, "%s"):
+		path = fmt.Sprintf(path, strings.ToLower(RandomString(3, 10)))
+	case strings.Contains(path, "%d"):
+		path = fmt.Sprintf(path, 1+Random.Intn(10000))
+	}
+	method := "GET"
+	if strings.HasPrefix(path, "/api") || path == "/login" || path == "/checkout" {
+		method = HttpMethod()
+	}
+	status := logStatusCodes[logStatuses.pick()]
+	bytes := 0
+	if status != 204 && status != 304 {
+		bytes = 200 + Random.Intn(50000)
+	}
+	return logRequest{Method: method, Path: path, Status: status, Bytes: bytes}
+}
+
+// ApacheLog returns an access log line in the Apache and Nginx combined format
+func ApacheLog() string {
+	s := NewLogSession()
+	r := newLogRequest()
+	referer := "-"
+	if s.lastPath != "" {
+		referer = fmt.Sprintf("https://%s.example.com%s", s.Host, s.lastPath)
+	}
+	s.lastPath = r.Path
+	return fmt.Sprintf("%s - %s [%s] \"%s %s HTTP/1.1\" %d %d \"%s\" \"%s\"",
+		s.IP, s.User, time.Now().Format("02/Jan/2006:15:04:05 -0700"), r.Method, r.Path, r.Status, r.Bytes, referer, s.UserAgent)
+}
+
+// syslogPriority returns the priority of a syslog message and its severity
+func syslogPriority() (int, int) {
+	facilities := []int{1, 3, 4, 10, 16}
+	severities := []int{2, 3, 4, 5, 6, 6, 6, 7}
+	facility, severity := facilities[Random.Intn(len(facilities))], severities[Random.Intn(len(severities))]
+	return facility*8 + severity, severity
+}
+
+var syslogApps = []string{"sshd", "sudo", "nginx", "cron", "kernel", "systemd"}
+
+func syslogMessage(app string, s *LogSession) string {
+	switch app {
+	case "sshd":
+		if Random.Intn(4) == 0 {
+			return fmt.Sprintf("Failed password for %s from %s port %d ssh2", s.User, s.IP, s.Port)
+		}
+		return fmt.Sprintf("Accepted publickey for %s from %s port %d ssh2", s.User, s.IP, s.Port)
+	case "sudo":
+		return fmt.Sprintf("%s : TTY=pts/%d ; PWD=/home/%s ; USER=root ; COMMAND=/usr/bin/systemctl restart nginx", s.User, Random.Intn(5), s.User)
+	case "nginx":
+		r := newLogRequest()
+		return fmt.Sprintf("%s %s %s %d", s.IP, r.Method, r.Path, r.Status)
+	case "cron":
+		return fmt.Sprintf("(%s) CMD (/usr/local/bin/backup.sh)", s.User)
+	case "kernel":
+		return fmt.Sprintf("[UFW BLOCK] IN=eth0 OUT= SRC=%s DST=%s PROTO=TCP SPT=%d DPT=%s", s.IP, s.ServerIP, s.Port, IpKnownPort())
+	default:
+		return "Started Session of user " + s.User
+	}
+}
+
+// Syslog5424 returns a RFC 5424 syslog line
+func Syslog5424() string {
+	s := NewLogSession()
+	pri, _ := syslogPriority()
+	app := syslogApps[Random.Intn(len(syslogApps))]
+	return fmt.Sprintf("<%d>1 %s %s %s %d - [origin ip=\"%s\"][meta sequenceId=\"%d\"] %s",
+		pri, time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00"), s.Host, app, 1000+Random.Intn(60000), s.ServerIP,
+		ctx.JrContext.CurrentIterationLoopIndex, syslogMessage(app, s))
+}
+
+// Syslog3164 returns a RFC 3164 (BSD) syslog line
+func Syslog3164() string {
+	s := NewLogSession()
+	pri, _ := syslogPriority()
+	app := syslogApps[Random.Intn(len(syslogApps))]
+	return fmt.Sprintf("<%d>%s %s %s[%d]: %s", pri, time.Now().Format(time.Stamp), s.Host, app, 1000+Random.Intn(60000), syslogMessage(app, s))
+}
+
+// cefEscapeHeader escapes a CEF header field
+func cefEscapeHeader(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`).Replace(s)
+}
+
+// cefEscapeValue escapes a CEF extension value
+func cefEscapeValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`).Replace(s)
+}
+
+// logFirewallEvent is a random firewall or web event, shared by the CEF and LEEF formats
+type logFirewallEvent struct {
+	ID       string
+	Name     string
+	Severity int
+	Action   string
+	Port     string
+	Protocol string
+	Request  logRequest
+}
+
+func newLogFirewallEvent() logFirewallEvent {
+	events := []logFirewallEvent{
+		{ID: "100", Name: "Connection allowed", Severity: 3, Action: "allow"},
+		{ID: "101", Name: "Connection denied", Severity: 6, Action: "deny"},
+		{ID: "200", Name: "Web request", Severity: 2, Action: "allow"},
+		{ID: "300", Name: "Port scan detected", Severity: 8, Action: "deny"},
+	}
+	e := events[Random.Intn(len(events))]
+	e.Port = IpKnownPort()
+	e.Protocol = "TCP"
+	e.Request = newLogRequest()
+	return e
+}
+
+// CefLog returns an ArcSight Common Event Format line
+func CefLog(vendor string, product string) string {
+	s := NewLogSession()
+	e := newLogFirewallEvent()
+	ext := []string{
+		"rt=" + strconv.FormatInt(time.Now().UnixMilli(), 10),
+		"src=" + s.IP,
+		"spt=" + strconv.Itoa(s.Port),
+		"dst=" + s.ServerIP,
+		"dpt=" + e.Port,
+		"proto=" + e.Protocol,
+		"act=" + e.Action,
+		"suser=" + cefEscapeValue(s.User),
+		"dhost=" + s.Host,
+	}
+	if e.ID == "200" {
+		ext = append(ext, "requestMethod="+e.Request.Method, "request="+cefEscapeValue(e.Request.Path),
+			"requestClientApplication="+cefEscapeValue(s.UserAgent))
+	}
+	return fmt.Sprintf("CEF:0|%s|%s|1.0|%s|%s|%d|%s", cefEscapeHeader(vendor), cefEscapeHeader(product), e.ID,
+		cefEscapeHeader(e.Name), e.Severity, strings.Join(ext, " "))
+}
+
+// LeefLog returns an IBM QRadar Log Event Extended Format 1.0 line, with tab separated attributes
+func LeefLog(vendor string, product string) string {
+	s := NewLogSession()
+	e := newLogFirewallEvent()
+	attributes := []string{
+		"devTime=" + time.Now().Format("Jan 02 2006 15:04:05"),
+		"devTimeFormat=MMM dd yyyy HH:mm:ss",
+		"src=" + s.IP,
+		"srcPort=" + strconv.Itoa(s.Port),
+		"dst=" + s.ServerIP,
+		"dstPort=" + e.Port,
+		"proto=" + e.Protocol,
+		"action=" + e.Action,
+		"usrName=" + s.User,
+		"sev=" + strconv.Itoa(e.Severity),
+	}
+	clean := strings.NewReplacer("|", "", "\t", " ")
+	return fmt.Sprintf("LEEF:1.0|%s|%s|1.0|%s|%s", clean.Replace(vendor), clean.Replace(product), e.ID, strings.Join(attributes, "\t"))
+}
+
+// EcsLog returns an access log as a JSON Elastic Common Schema document
+func EcsLog() string {
+	s := NewLogSession()
+	r := newLogRequest()
+	outcome := "success"
+	if r.Status >= 400 {
+		outcome = "failure"
+	}
+	doc := map[string]any{
+		"@timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+		"ecs":        map[string]any{"version": "8.11.0"},
+		"event": map[string]any{
+			"kind":     "event",
+			"category": []string{"web"},
+			"type":     []string{"access"},
+			"outcome":  outcome,
+			"dataset":  "nginx.access",
+		},
+		"source":      map[string]any{"ip": s.IP, "port": s.Port},
+		"destination": map[string]any{"ip": s.ServerIP, "port": 443},
+		"host":        map[string]any{"name": s.Host},
+		"http": map[string]any{
+			"version":  "1.1",
+			"request":  map[string]any{"method": r.Method},
+			"response": map[string]any{"status_code": r.Status, "body": map[string]any{"bytes": r.Bytes}},
+		},
+		"url":        map[string]any{"path": r.Path},
+		"user":       map[string]any{"name": s.User},
+		"user_agent": map[string]any{"original": s.UserAgent},
+		"session":    map[string]any{"id": s.ID},
+	}
+	return marshalLog(doc)
+}
+
+// WindowsEventLog returns a Windows security event as JSON, like the ones exported by Winlogbeat or wevtutil
+func WindowsEventLog() string {
+	s := NewLogSession()
+	events := []struct {
+		id       int
+		task     string
+		keywords string
+	}{
+		{4624, "Logon", "Audit Success"},
+		{4625, "Logon", "Audit Failure"},
+		{4634, "Logoff", "Audit Success"},
+		{4672, "Special Logon", "Audit Success"},
+		{4688, "Process Creation", "Audit Success"},
+	}
+	e := events[Random.Intn(len(events))]
+	data := map[string]any{
+		"SubjectUserSid":   fmt.Sprintf("S-1-5-21-%d-%d-%d-%d", 1000000000+Random.Intn(999999999), 1000000000+Random.Intn(999999999), 1000000000+Random.Intn(999999999), 1000+Random.Intn(9000)),
+		"TargetUserName":   s.User,
+		"TargetDomainName": "CORP",
+	}
+	switch e.id {
+	case 4624, 4625:
+		data["LogonType"] = []int{2, 3, 10}[Random.Intn(3)]
+		data["IpAddress"] = s.IP
+		data["IpPort"] = strconv.Itoa(s.Port)
+		data["WorkstationName"] = strings.ToUpper(s.Host)
+	case 4688:
+		data["NewProcessName"] = []string{`C:\Windows\System32\cmd.exe`, `C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe`, `C:\Program Files\Google\Chrome\Application\chrome.exe`}[Random.Intn(3)]
+		data["ProcessId"] = fmt.Sprintf("0x%x", 1000+Random.Intn(60000))
+	}
+	doc := map[string]any{
+		"EventID":     e.id,
+		"TimeCreated": time.Now().UTC().Format(time.RFC3339Nano),
+		"Computer":    strings.ToUpper(s.Host) + ".corp.example.com",
+		"Channel":     "Security",
+		"Provider":    "Microsoft-Windows-Security-Auditing",
+		"Level":       "Information",
+		"Task":        e.task,
+		"Keywords":    e.keywords,
+		"RecordID":    ctx.JrContext.CurrentIterationLoopIndex,
+		"EventData":   data,
+	}
+	return marshalLog(doc)
+}
+
+var cloudTrailEvents = []struct {
+	source   string
+	name     string
+	readOnly bool
+}{
+	{"s3.amazonaws.com", "GetObject", true},
+	{"s3.amazonaws.com", "PutObject", false},
+	{"ec2.amazonaws.com", "DescribeInstances", true},
+	{"ec2.amazonaws.com", "RunInstances", false},
+	{"iam.amazonaws.com", "CreateAccessKey", false},
+	{"sts.amazonaws.com", "AssumeRole", true},
+	{"signin.amazonaws.com", "ConsoleLogin", false},
+}
+
+// CloudTrailLog returns an AWS CloudTrail record as JSON
+func CloudTrailLog() string {
+	s := NewLogSession()
+	e := cloudTrailEvents[Random.Intn(len(cloudTrailEvents))]
+	account := logAccount(s)
+	doc := map[string]any{
+		"eventVersion": "1.08",
+		"userIdentity": map[string]any{
+			"type":        "IAMUser",
+			"principalId": "AIDA" + strings.ToUpper(s.ID),
+			"arn":         fmt.Sprintf("arn:aws:iam::%s:user/%s", account, s.User),
+			"accountId":   account,
+			"userName":    s.User,
+		},
+		"eventTime":          time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		"eventSource":        e.source,
+		"eventName":          e.name,
+		"awsRegion":          []string{"us-east-1", "us-west-2", "eu-west-1", "eu-central-1"}[Random.Intn(4)],
+		"sourceIPAddress":    s.IP,
+		"userAgent":          s.UserAgent,
+		"requestParameters":  nil,
+		"responseElements":   nil,
+		"requestID":          uuid.NewString(),
+		"eventID":            uuid.NewString(),
+		"readOnly":           e.readOnly,
+		"eventType":          "AwsApiCall",
+		"managementEvent":    e.source != "s3.amazonaws.com",
+		"recipientAccountId": account,
+	}
+	if e.name == "ConsoleLogin" {
+		doc["eventType"] = "AwsConsoleSignIn"
+		doc["responseElements"] = map[string]any{"ConsoleLogin": []string{"Success", "Success", "Failure"}[Random.Intn(3)]}
+	}
+	return marshalLog(doc)
+}
+
+// logAccount returns the AWS account of the server of a session
+func logAccount(s *LogSession) string {
+	sum := 0
+	for _, c := range s.Host {
+		sum = sum*31 + int(c)
+	}
+	return fmt.Sprintf("%012d", 100000000000+sum%899999999999)
+}
+
+// VpcFlowLog returns an AWS VPC flow log record, in the default version 2 format
+func VpcFlowLog() string {
+	s := NewLogSession()
+	protocol := []int{6, 6, 6, 17, 1}[Random.Intn(5)]
+	port, _ := strconv.Atoi(IpKnownPort())
+	srcPort := s.Port
+	if protocol == 1 {
+		srcPort, port = 0, 0
+	}
+	action, status := "ACCEPT", "OK"
+	if Random.Intn(10) == 0 {
+		action = "REJECT"
+	}
+	packets := 1 + Random.Intn(200)
+	end := time.Now().Unix()
+	start := end - int64(1+Random.Intn(60))
+	return fmt.Sprintf("2 %s eni-%s %s %s %d %d %d %d %d %d %d %s %s",
+		logAccount(s), "0"+s.ID, s.IP, s.ServerIP, srcPort, port, protocol, packets, packets*(40+Random.Intn(1400)),
+		start, end, action, status)
+}
+
+func marshalLog(doc map[string]any) string {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
@@ -31,7 +31,7 @@ func HttpMethod() string {
 	return method[Random.Intn(len(method))]
 }
 
-// Ip returns a random Ip Address matching the given cidr
+// Ip returns a random Ip Address matching the given cidr, IPv4 or IPv6
 func Ip(cidr string) string {
 
 GENERATE:
@@ -40,6 +40,9 @@ GENERATE:
 	if err != nil {
 		return "0.0.0.0"
 	}
+	if ipnet.IP.To4() == nil {
+		return randomIPInNet(ipnet).String()
+	}
 
 	ones, _ := ipnet.Mask.Size()
 	quotient := ones / 8
@@ -51,7 +54,7 @@ GENERATE:
 	for i := 0; i <= quotient; i++ {
 		if i == quotient {
 			shifted := (r[i]) >> remainder
-			r[i] = ^ipnet.IP[i] & shifted
+			r[i] = ipnet.IP[i] | shifted
 		} else {
 			r[i] = ipnet.IP[i]
 		}
@@ -76,8 +79,15 @@ func IpKnownProtocol() string {
 	return protocols[Random.Intn(len(protocols))]
 }
 
-// Ipv6 returns a random Ipv6 Address
-func Ipv6() string {
+// Ipv6 returns a random Ipv6 Address, in the given prefix if any
+func Ipv6(cidr ...string) string {
+	if len(cidr) > 0 {
+		_, ipnet, err := net.ParseCIDR(cidr[0])
+		if err != nil {
+			return "::"
+		}
+		return randomIPInNet(ipnet).String()
+	}
 	ip := make(net.IP, net.IPv6len)
 	for i := 0; i < net.IPv6len; i++ {
 		ip[i] = byte(Random.Intn(256))
@@ -27,6 +27,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 )
 
 const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
@@ -208,9 +209,35 @@ func SentencePrefix(prefixLen, numWords int) string {
 
 // Nonsense generates a random Sentence of numWords wordsm using a prefixLen and a baseText to start from
 func Nonsense(prefixLen, numWords int, baseText string) string {
+	return textChain(prefixLen, baseText).Generate(numWords)
+}
+
+// maxTextChains limits the chains cached by textChain
+const maxTextChains = 64
+
+type textChainKey struct {
+	prefixLen int
+	text      string
+}
+
+var textChains = map[textChainKey]*Chain{}
+var textChainsLock sync.Mutex
+
+// textChain returns the chain of a base text, building it only the first time
+func textChain(prefixLen int, baseText string) *Chain {
+	key := textChainKey{prefixLen, baseText}
+	textChainsLock.Lock()
+	defer textChainsLock.Unlock()
+	if c, exists := textChains[key]; exists {
+		return c
+	}
+	if len(textChains) >= maxTextChains {
+		textChains = map[textChainKey]*Chain{}
+	}
 	c := NewChain(prefixLen)
 	c.Build(strings.NewReader(baseText))
-	return c.Generate(numWords)
+	textChains[key] = c
+	return c
 }
 
 // RandomString returns a random string long between min and max characters
@@ -56,6 +56,15 @@ func CodiceFiscale() string {
 		city = City()
 	}
 
+	cf, err := codiceFiscale(name, surname, gender, birthdate, city)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error in generating Codice Fiscale")
+	}
+	return cf
+}
+
+// codiceFiscale returns the Italian Codice Fiscale of a person born in an Italian city
+func codiceFiscale(name, surname, gender, birthdate, city string) (string, error) {
 	if city == "Bolzano" {
 		city = "Bolzano/Bozen"
 	}
@@ -68,13 +77,13 @@ func CodiceFiscale() string {
 
 	codicecitta, erc := generacodicefiscale.CercaComune(city)
 	if erc != nil {
-		log.Fatal().Err(erc).Msg("Error in searching city")
+		return "", fmt.Errorf("error in searching city %s: %s", city, erc.Error())
 	}
 	cf, erg := generacodicefiscale.Genera(surname, name, gender, codicecitta.Codice, birthdate)
 	if erg != nil {
-		log.Fatal().Err(erg).Msg("Error in generating Codice Fiscale")
+		return "", fmt.Errorf("error in generating Codice Fiscale: %s", erg.Error())
 	}
-	return cf
+	return cf, nil
 }
 
 // Company returns a random Company Name
@@ -170,6 +179,9 @@ func NameF() string {
 // Ssn return a valid Social Security Number id
 func Ssn() string {
 	first := Random.Intn(899) + 1
+	if first == 666 {
+		first = 665
+	}
 	second := Random.Intn(99) + 1
 	third := Random.Intn(9999) + 1
 	return fmt.Sprintf("%03d-%02d-%04d", first, second, third)
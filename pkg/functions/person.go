@@ -0,0 +1,167 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// localeCountries maps the provided locales to their ISO 3166 country codes
+var localeCountries = map[string]string{
+	"de": "DE",
+	"es": "ES",
+	"fr": "FR",
+	"it": "IT",
+	"uk": "GB",
+	"us": "US",
+}
+
+// Address is a coherent address: zip and phone prefix match the city, and the city is in the state
+type Address struct {
+	Street     string
+	Number     string
+	City       string
+	State      string
+	StateShort string
+	Zip        string
+	Country    string
+	Phone      string
+	locale     string
+}
+
+// String returns the address on one line, in the format of its locale
+func (a Address) String() string {
+	switch a.locale {
+	case "us":
+		return fmt.Sprintf("%s %s, %s, %s %s", a.Number, a.Street, a.City, a.StateShort, a.Zip)
+	case "uk":
+		return fmt.Sprintf("%s %s, %s %s", a.Number, a.Street, a.City, a.Zip)
+	case "it":
+		return fmt.Sprintf("%s %s, %s %s (%s)", a.Street, a.Number, a.Zip, a.City, a.StateShort)
+	default:
+		return fmt.Sprintf("%s %s, %s %s", a.Street, a.Number, a.Zip, a.City)
+	}
+}
+
+// Person is a coherent person: the gender matches the name, the email and the username are derived from the name,
+// and the phone prefix matches the city of the address
+type Person struct {
+	Name      string
+	Surname   string
+	Gender    string
+	Email     string
+	Username  string
+	Phone     string
+	BirthDate string
+	Address   Address
+}
+
+// FullName returns name and surname of the person
+func (p Person) FullName() string {
+	return p.Name + " " + p.Surname
+}
+
+// CF returns the Italian Codice Fiscale of the person, if born in an Italian city
+func (p Person) CF() string {
+	if p.Address.locale != "it" {
+		return ""
+	}
+	cf, err := codiceFiscale(p.Name, p.Surname, p.Gender, p.BirthDate, p.Address.City)
+	if err != nil {
+		log.Error().Err(err).Msg("Error in generating Codice Fiscale")
+		return ""
+	}
+	return cf
+}
+
+// NewAddress returns a random coherent address in the current locale
+func NewAddress() Address {
+	locale := strings.ToLower(ctx.JrContext.Locale)
+	if _, ok := localeCountries[locale]; !ok {
+		locale = "us"
+	}
+	a := Address{
+		Street:  randomWord("street"),
+		Number:  strconv.Itoa(Random.Intn(199) + 1),
+		Country: localeCountries[locale],
+		locale:  locale,
+	}
+
+	fields := strings.Split(randomWord("address"), "\t")
+	if len(fields) < 5 {
+		log.Error().Str("locale", locale).Msg("Invalid address data")
+		return a
+	}
+	a.City, a.State, a.StateShort = fields[0], fields[1], fields[2]
+	a.Zip, _ = Regex(fields[3])
+	a.Phone, _ = Regex(fields[4])
+	return a
+}
+
+// NewPerson returns a random coherent person living in a random address of the current locale
+func NewPerson() Person {
+	p := Person{
+		Surname:   randomWord("surname"),
+		BirthDate: BirthDate(18, 75),
+		Address:   NewAddress(),
+	}
+	if Random.Intn(2) == 0 {
+		p.Name, p.Gender = randomWord("nameM"), "M"
+	} else {
+		p.Name, p.Gender = randomWord("nameF"), "F"
+	}
+
+	name, surname := emailPart(p.Name), emailPart(p.Surname)
+	p.Email = fmt.Sprintf("%s.%s@%s", name, surname, strings.ToLower(randomWord("mail_provider")))
+	p.Username = Username(name, surname)
+	p.Phone = p.Address.Phone
+	return p
+}
+
+// randomWord returns a random word without touching the shared context indexes
+func randomWord(name string) string {
+	if _, err := Cache(name); err != nil {
+		return ""
+	}
+	return data[name][randomWordIndex(name)]
+}
+
+// emailPart returns a lowercase ASCII version of a name, without accents, spaces and punctuation
+func emailPart(s string) string {
+	s = strings.NewReplacer("ß", "ss", "æ", "ae", "ø", "o", "œ", "oe").Replace(strings.ToLower(s))
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	s, _, _ = transform.String(t, s)
+	return strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return -1
+		}
+		return r
+	}, s)
+}
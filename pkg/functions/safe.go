@@ -0,0 +1,128 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// maxSafeSentences is the maximum number of sentences of markov_paragraph for remote callers
+const maxSafeSentences = 100
+
+// maxSafeScopes is the maximum number of unique scopes, and of catalogs, remote callers can create by name
+const maxSafeScopes = 100
+
+// localFileFunctions return the content of local files loaded with flags, like CSV and GeoJSON files
+var localFileFunctions = []string{"fromcsv", "fromcsv_named", "geo_feature", "geo_property"}
+
+// SafeFunctionsMap returns the template functions for remote callers, like the clients of jr server.
+// Functions returning the content of local files are missing, and functions reading datasets
+// fail with dataset names outside of the JR data directory.
+func SafeFunctionsMap() map[string]interface{} {
+	safe := make(map[string]interface{}, len(fmap))
+	for name, f := range fmap {
+		safe[name] = f
+	}
+	for _, name := range localFileFunctions {
+		delete(safe, name)
+	}
+
+	safe["from"] = func(name string) (string, error) {
+		return checked(name, func() string { return Word(name) })
+	}
+	safe["from_at"] = func(name string, index int) (string, error) {
+		return checked(name, func() string { return WordAt(name, index) })
+	}
+	safe["from_shuffle"] = func(name string) ([]string, error) {
+		return checked(name, func() []string { return WordShuffle(name) })
+	}
+	safe["from_n"] = func(name string, n int) ([]string, error) {
+		return checked(name, func() []string { return WordShuffleN(name, n) })
+	}
+	safe["len"] = func(name string) (string, error) {
+		return checked(name, func() string { return Len(name) })
+	}
+	safe["random_index"] = func(name string) (string, error) {
+		return checked(name, func() string { return RandomIndex(name) })
+	}
+	safe["index_of"] = func(s string, name string) (int, error) {
+		return checked(name, func() int { return IndexOf(s, name) })
+	}
+	safe["markov_sentence"] = func(name string) (string, error) {
+		if err := checkDataset(name); err != nil {
+			return "", err
+		}
+		return MarkovSentence(name)
+	}
+	safe["markov_paragraph"] = func(name string, n int) (string, error) {
+		if err := checkDataset(name); err != nil {
+			return "", err
+		}
+		if n > maxSafeSentences {
+			return "", fmt.Errorf("at most %d sentences are allowed", maxSafeSentences)
+		}
+		return MarkovParagraph(name, n)
+	}
+	safe["unique"] = func(scope string, function string, args ...any) (any, error) {
+		if err := checkUniqueScope(scope, maxSafeScopes); err != nil {
+			return nil, err
+		}
+		return uniqueOf(safe, scope, function, args)
+	}
+	safe["unique_value"] = func(scope string, value any) (any, error) {
+		if err := checkUniqueScope(scope, maxSafeScopes); err != nil {
+			return nil, err
+		}
+		return UniqueValue(scope, value)
+	}
+	safe["basket"] = func(name string) (*Basket, error) {
+		if err := checkCatalog(name, maxSafeScopes); err != nil {
+			return nil, err
+		}
+		return GetBasket(name)
+	}
+	safe["product"] = func(name string) (*Product, error) {
+		if err := checkCatalog(name, maxSafeScopes); err != nil {
+			return nil, err
+		}
+		return CatalogProduct(name)
+	}
+	return safe
+}
+
+// checked calls f if the dataset name is allowed
+func checked[T any](name string, f func() T) (T, error) {
+	if err := checkDataset(name); err != nil {
+		var zero T
+		return zero, err
+	}
+	return f(), nil
+}
+
+// checkDataset fails with dataset names that could be paths of files outside of the JR data directory
+func checkDataset(name string) error {
+	if name == "" || filepath.IsAbs(name) || strings.Contains(name, "..") || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("dataset %q is not allowed", name)
+	}
+	return nil
+}
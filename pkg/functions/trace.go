@@ -0,0 +1,87 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions
+
+import (
+	"encoding/hex"
+	"sync"
+)
+
+// traceContext has the trace and span ids of the record being generated, returned by trace_id and span_id.
+// Emitters set them from the span of the record when tracing, or reset them for every record
+var traceContext struct {
+	lock    sync.Mutex
+	traceID string
+	spanID  string
+}
+
+// traceRender serializes the records rendered with a trace context, as emitters run concurrently
+var traceRender sync.Mutex
+
+// WithTraceContext renders a record with the ids returned by trace_id and span_id. Records of other
+// emitters wait for it, so they can't return the ids of this one
+func WithTraceContext(traceID string, spanID string, render func() error) error {
+	traceRender.Lock()
+	defer traceRender.Unlock()
+	SetTraceContext(traceID, spanID)
+	return render()
+}
+
+// SetTraceContext sets the ids returned by trace_id and span_id: with empty ids, new random ids are returned
+func SetTraceContext(traceID string, spanID string) {
+	traceContext.lock.Lock()
+	defer traceContext.lock.Unlock()
+	traceContext.traceID = traceID
+	traceContext.spanID = spanID
+}
+
+// TraceId returns the W3C trace id of the record, 32 hex digits
+func TraceId() string {
+	traceContext.lock.Lock()
+	defer traceContext.lock.Unlock()
+	if traceContext.traceID == "" {
+		traceContext.traceID = randomHex(16)
+	}
+	return traceContext.traceID
+}
+
+// SpanId returns the W3C span id of the record, 16 hex digits
+func SpanId() string {
+	traceContext.lock.Lock()
+	defer traceContext.lock.Unlock()
+	if traceContext.spanID == "" {
+		traceContext.spanID = randomHex(8)
+	}
+	return traceContext.spanID
+}
+
+// randomHex returns n random bytes in hex, not all zero as W3C ids
+func randomHex(n int) string {
+	b := make([]byte, n)
+	for {
+		Random.Read(b)
+		for _, c := range b {
+			if c != 0 {
+				return hex.EncodeToString(b)
+			}
+		}
+	}
+}
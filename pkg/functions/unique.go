@@ -0,0 +1,341 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	UniqueExact   = "exact"
+	UniqueSharded = "sharded"
+	UniqueBloom   = "bloom"
+)
+
+// ErrUniqueExhausted is returned by unique when no new value is found in the retries of the scope
+var ErrUniqueExhausted = errors.New("unique scope exhausted")
+
+// DuplicateError is returned by unique_value for a value already seen in the scope: emitters generate the record
+// again, up to the retries of the scope
+type DuplicateError struct {
+	Scope   string
+	Value   string
+	Retries int
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("unique: duplicate value %s in scope %s", e.Value, e.Scope)
+}
+
+// UniqueConfig is the configuration of a named unique scope.
+// Exact scopes keep every value, sharded scopes keep a 64 bit hash of the values in locked shards,
+// bloom scopes use a bloom filter sized for capacity values with the given false positive rate.
+// Hashes and bloom filters never let a duplicate through, but can reject a new value as already seen.
+type UniqueConfig struct {
+	Name     string  `mapstructure:"name" json:"name"`
+	Mode     string  `mapstructure:"mode" json:"mode"`
+	Retries  int     `mapstructure:"retries" json:"retries"`
+	Shards   int     `mapstructure:"shards" json:"shards"`
+	Capacity int64   `mapstructure:"capacity" json:"capacity"`
+	FPRate   float64 `mapstructure:"fpRate" json:"fpRate"`
+}
+
+// seenSet adds values to a set, returning false if the value was already there
+type seenSet interface {
+	add(value string) bool
+}
+
+type uniqueScope struct {
+	config UniqueConfig
+	set    seenSet
+	count  atomic.Int64
+	warned atomic.Bool
+}
+
+var uniques = map[string]*uniqueScope{}
+var uniquesLock sync.RWMutex
+
+// templateFuncs are the functions unique can call by name, set in init to avoid an initialization cycle with fmap
+var templateFuncs map[string]interface{}
+
+func init() {
+	templateFuncs = fmap
+}
+
+// InitUnique creates a named unique scope, replacing the one with the same name
+func InitUnique(config UniqueConfig) error {
+	if config.Name == "" {
+		return fmt.Errorf("unique scope without name")
+	}
+	if config.Mode == "" {
+		config.Mode = UniqueExact
+	}
+	if config.Retries <= 0 {
+		config.Retries = 100
+	}
+
+	s := &uniqueScope{config: config}
+	switch config.Mode {
+	case UniqueExact:
+		s.set = &exactSet{values: map[string]struct{}{}}
+	case UniqueSharded:
+		if s.config.Shards <= 0 {
+			s.config.Shards = 64
+		}
+		set := &shardedSet{shards: make([]hashShard, s.config.Shards)}
+		for i := range set.shards {
+			set.shards[i].hashes = map[uint64]struct{}{}
+		}
+		s.set = set
+	case UniqueBloom:
+		if s.config.Capacity <= 0 {
+			s.config.Capacity = 10_000_000
+		}
+		if s.config.FPRate == 0 {
+			s.config.FPRate = 0.001
+		}
+		if s.config.FPRate < 0 || s.config.FPRate >= 1 {
+			return fmt.Errorf("unique scope %s: fpRate must be between 0 and 1", config.Name)
+		}
+		s.set = newBloomSet(s.config.Capacity, s.config.FPRate)
+	default:
+		return fmt.Errorf("unique scope %s: unknown mode %s", config.Name, config.Mode)
+	}
+
+	uniquesLock.Lock()
+	defer uniquesLock.Unlock()
+	uniques[config.Name] = s
+	return nil
+}
+
+// ResetUniques removes all the unique scopes
+func ResetUniques() {
+	uniquesLock.Lock()
+	defer uniquesLock.Unlock()
+	uniques = map[string]*uniqueScope{}
+}
+
+// getUnique returns a named unique scope, creating an exact one if it doesn't exist
+func getUnique(name string) *uniqueScope {
+	uniquesLock.RLock()
+	s, exists := uniques[name]
+	uniquesLock.RUnlock()
+	if exists {
+		return s
+	}
+
+	uniquesLock.Lock()
+	defer uniquesLock.Unlock()
+	if s, exists = uniques[name]; !exists {
+		s = &uniqueScope{config: UniqueConfig{Name: name, Mode: UniqueExact, Retries: 100}, set: &exactSet{values: map[string]struct{}{}}}
+		uniques[name] = s
+	}
+	return s
+}
+
+// add adds a value to the scope, returning false if it was already seen
+func (s *uniqueScope) add(value string) bool {
+	if !s.set.add(value) {
+		return false
+	}
+	n := s.count.Add(1)
+	if s.config.Mode == UniqueBloom && n > s.config.Capacity && !s.warned.Swap(true) {
+		log.Warn().Str("scope", s.config.Name).Int64("capacity", s.config.Capacity).Msg("Unique bloom filter over capacity, false positives will grow")
+	}
+	return true
+}
+
+// Unique calls the template function named function with args until it returns a value never seen in scope.
+// It fails when no new value is found after the retries of the scope, that is when the generator is exhausted.
+func Unique(scope string, function string, args ...any) (any, error) {
+	return uniqueOf(templateFuncs, scope, function, args)
+}
+
+// uniqueOf calls function, looked up in funcs, until it returns a value never seen in scope
+func uniqueOf(funcs map[string]interface{}, scope string, function string, args []any) (any, error) {
+	f, exists := funcs[function]
+	if !exists {
+		return nil, fmt.Errorf("unique: unknown function %s", function)
+	}
+	s := getUnique(scope)
+	for i := 0; i <= s.config.Retries; i++ {
+		v, err := call(f, args)
+		if err != nil {
+			return nil, fmt.Errorf("unique: %s: %w", function, err)
+		}
+		if s.add(fmt.Sprint(v)) {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s, no new value from %s in %d retries after %d values", ErrUniqueExhausted, scope, function, s.config.Retries, s.count.Load())
+}
+
+// UniqueValue returns value if it was never seen in scope, and fails otherwise with a DuplicateError
+func UniqueValue(scope string, value any) (any, error) {
+	s := getUnique(scope)
+	if !s.add(fmt.Sprint(value)) {
+		return nil, &DuplicateError{Scope: scope, Value: fmt.Sprint(value), Retries: s.config.Retries}
+	}
+	return value, nil
+}
+
+// UniqueCount returns the number of values in scope
+func UniqueCount(scope string) int64 {
+	uniquesLock.RLock()
+	s, exists := uniques[scope]
+	uniquesLock.RUnlock()
+	if !exists {
+		return 0
+	}
+	return s.count.Load()
+}
+
+// checkUniqueScope fails with the name of a new scope when there are already max scopes
+func checkUniqueScope(name string, max int) error {
+	uniquesLock.RLock()
+	defer uniquesLock.RUnlock()
+	if _, exists := uniques[name]; exists || len(uniques) < max {
+		return nil
+	}
+	return fmt.Errorf("unique scope %q is not allowed: at most %d scopes", name, max)
+}
+
+// call calls a template function with args converted to its parameter types
+func call(f any, args []any) (any, error) {
+	fv := reflect.ValueOf(f)
+	ft := fv.Type()
+	if ft.IsVariadic() && len(args) < ft.NumIn()-1 || !ft.IsVariadic() && len(args) != ft.NumIn() {
+		return nil, fmt.Errorf("wrong number of arguments: %d", len(args))
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var t reflect.Type
+		if ft.IsVariadic() && i >= ft.NumIn()-1 {
+			t = ft.In(ft.NumIn() - 1).Elem()
+		} else {
+			t = ft.In(i)
+		}
+		v := reflect.ValueOf(arg)
+		switch {
+		case !v.IsValid():
+			in[i] = reflect.Zero(t)
+		case v.Type().AssignableTo(t):
+			in[i] = v
+		case v.Type().ConvertibleTo(t):
+			in[i] = v.Convert(t)
+		default:
+			return nil, fmt.Errorf("argument %d: can't use %v as %s", i+1, arg, t)
+		}
+	}
+
+	out := fv.Call(in)
+	if len(out) == 2 && !out[1].IsNil() {
+		return nil, out[1].Interface().(error)
+	}
+	return out[0].Interface(), nil
+}
+
+func hashValue(value string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(value))
+	return h.Sum64()
+}
+
+type exactSet struct {
+	values map[string]struct{}
+	lock   sync.Mutex
+}
+
+func (s *exactSet) add(value string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, seen := s.values[value]; seen {
+		return false
+	}
+	s.values[value] = struct{}{}
+	return true
+}
+
+type hashShard struct {
+	hashes map[uint64]struct{}
+	lock   sync.Mutex
+}
+
+type shardedSet struct {
+	shards []hashShard
+}
+
+func (s *shardedSet) add(value string) bool {
+	h := hashValue(value)
+	shard := &s.shards[h%uint64(len(s.shards))]
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	if _, seen := shard.hashes[h]; seen {
+		return false
+	}
+	shard.hashes[h] = struct{}{}
+	return true
+}
+
+// bloomSet is a bloom filter, with k bit positions derived from one hash by double hashing
+type bloomSet struct {
+	bits []uint64
+	m    uint64
+	k    int
+	lock sync.Mutex
+}
+
+func newBloomSet(capacity int64, fpRate float64) *bloomSet {
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := int(math.Round(float64(m) / float64(capacity) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomSet{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+func (s *bloomSet) add(value string) bool {
+	h1 := hashValue(value)
+	h2 := (h1>>33 | h1<<31) | 1
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	added := false
+	for i := 0; i < s.k; i++ {
+		bit := (h1 + uint64(i)*h2) % s.m
+		if s.bits[bit/64]&(1<<(bit%64)) == 0 {
+			s.bits[bit/64] |= 1 << (bit % 64)
+			added = true
+		}
+	}
+	return added
+}
@@ -105,7 +105,8 @@ func FromCsv(c string) string {
 	defer ctx.JrContext.CtxCSVLock.Unlock()
 
 	if len(ctx.JrContext.CtxCSV) > 0 {
-		return ctx.JrContext.CtxCSV[(ctx.JrContext.CurrentIterationLoopIndex-1)%len(ctx.JrContext.CtxCSV)][c]
+		record := ctx.JrContext.CurrentIterationLoopIndex - ctx.JrContext.PreloadedRecords
+		return ctx.JrContext.CtxCSV[(record-1)%len(ctx.JrContext.CtxCSV)][c]
 	}
 
 	return ""
@@ -0,0 +1,122 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions
+
+import (
+	"strconv"
+	"strings"
+)
+
+// weights holds the alias tables of the weighted word files, by name
+var weights = map[string]*aliasTable{}
+
+// aliasTable samples an index with probability proportional to its weight in O(1),
+// with Vose's alias method
+type aliasTable struct {
+	prob  []float64
+	alias []int
+}
+
+// newAliasTable builds the alias table for the given non negative weights
+func newAliasTable(w []float64) *aliasTable {
+	n := len(w)
+	t := &aliasTable{prob: make([]float64, n), alias: make([]int, n)}
+
+	total := 0.0
+	for _, v := range w {
+		total += v
+	}
+
+	scaled := make([]float64, n)
+	var small, large []int
+	for i, v := range w {
+		scaled[i] = v * float64(n) / total
+		if scaled[i] < 1 {
+			small = append(small, i)
+		} else {
+			large = append(large, i)
+		}
+	}
+
+	for len(small) > 0 && len(large) > 0 {
+		s, l := small[len(small)-1], large[len(large)-1]
+		small = small[:len(small)-1]
+		t.prob[s] = scaled[s]
+		t.alias[s] = l
+		scaled[l] = scaled[l] + scaled[s] - 1
+		if scaled[l] < 1 {
+			large = large[:len(large)-1]
+			small = append(small, l)
+		}
+	}
+	// what is left has probability 1, up to rounding errors
+	for _, i := range append(small, large...) {
+		t.prob[i] = 1
+		t.alias[i] = i
+	}
+	return t
+}
+
+// pick returns a random index
+func (t *aliasTable) pick() int {
+	i := Random.Intn(len(t.prob))
+	if Random.Float64() < t.prob[i] {
+		return i
+	}
+	return t.alias[i]
+}
+
+// splitWeights separates words and weights in a word file where every line is 'word\tweight'.
+// Empty lines are skipped. Files with lines without a weight, or with more than one tab, are not weighted
+// and are returned as they are.
+func splitWeights(lines []string) ([]string, []float64, bool) {
+	words := make([]string, 0, len(lines))
+	w := make([]float64, 0, len(lines))
+	total := 0.0
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		word, weight, found := strings.Cut(line, "\t")
+		if !found || strings.Contains(weight, "\t") {
+			return lines, nil, false
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(weight), 64)
+		if err != nil || v < 0 {
+			return lines, nil, false
+		}
+		words = append(words, word)
+		w = append(w, v)
+		total += v
+	}
+	if total == 0 {
+		return lines, nil, false
+	}
+	return words, w, true
+}
+
+// randomWordIndex returns a random index in a cached word file, following its weights if it has them
+func randomWordIndex(name string) int {
+	if t, ok := weights[name]; ok {
+		return t.pick()
+	}
+	return Random.Intn(len(data[name]))
+}
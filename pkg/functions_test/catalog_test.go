@@ -0,0 +1,158 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions_test
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/stretchr/testify/require"
+)
+
+// cents converts an amount to cents, failing if it has more than two decimals
+func cents(t *testing.T, amount float64) int64 {
+	c := math.Round(amount * 100)
+	require.InDelta(t, c, amount*100, 1e-6, "%v has more than two decimals", amount)
+	return int64(c)
+}
+
+func rate(r float64) *float64 {
+	return &r
+}
+
+func TestBasket(t *testing.T) {
+	keepRecord(t)
+	useLocale(t, "it")
+	functions.ResetCatalogs()
+	defer functions.ResetCatalogs()
+	functions.SetSeed(1)
+	require.NoError(t, functions.InitCatalog(functions.CatalogConfig{Name: "shop", Products: 50, MaxItems: 4, DiscountRate: rate(0.5)}))
+
+	discounted := 0
+	for i := 0; i < 200; i++ {
+		nextRecord()
+		b, err := functions.GetBasket("shop")
+		require.NoError(t, err)
+		same, _ := functions.GetBasket("shop")
+		require.Same(t, b, same)
+		require.Equal(t, "EUR", b.Currency)
+		require.NotEmpty(t, b.Items)
+		require.LessOrEqual(t, len(b.Items), 4)
+
+		var subtotal, discount, tax, total int64
+		count := 0
+		skus := map[string]bool{}
+		for _, item := range b.Items {
+			require.False(t, skus[item.SKU])
+			skus[item.SKU] = true
+			require.Contains(t, []float64{0.22, 0.1}, item.TaxRate)
+
+			lineSubtotal := cents(t, item.UnitPrice) * int64(item.Quantity)
+			require.Equal(t, lineSubtotal, cents(t, item.Subtotal))
+			require.Equal(t, int64(math.Round(float64(cents(t, item.Subtotal)-cents(t, item.Discount))*item.TaxRate)), cents(t, item.Tax))
+			require.Equal(t, cents(t, item.Subtotal)-cents(t, item.Discount)+cents(t, item.Tax), cents(t, item.Total))
+			if item.Discount > 0 {
+				discounted++
+			}
+			subtotal += cents(t, item.Subtotal)
+			discount += cents(t, item.Discount)
+			tax += cents(t, item.Tax)
+			total += cents(t, item.Total)
+			count += item.Quantity
+		}
+		require.Equal(t, subtotal, cents(t, b.Subtotal))
+		require.Equal(t, discount, cents(t, b.Discount))
+		require.Equal(t, tax, cents(t, b.Tax))
+		require.Equal(t, total, cents(t, b.Total))
+		require.Equal(t, count, b.ItemCount)
+	}
+	require.Greater(t, discounted, 0)
+
+	var doc map[string]any
+	b, err := functions.GetBasket("shop")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(b.String()), &doc))
+	require.Contains(t, doc, "items")
+
+	require.NoError(t, functions.InitCatalog(functions.CatalogConfig{Name: "full price", DiscountRate: rate(0)}))
+	for i := 0; i < 50; i++ {
+		nextRecord()
+		b, err := functions.GetBasket("full price")
+		require.NoError(t, err)
+		require.Zero(t, b.Discount)
+	}
+
+	_, err = functions.GetBasket("")
+	require.Error(t, err)
+}
+
+func TestCatalogProduct(t *testing.T) {
+	useLocale(t, "uk")
+	functions.ResetCatalogs()
+	defer functions.ResetCatalogs()
+	functions.SetSeed(2)
+	require.NoError(t, functions.InitCatalog(functions.CatalogConfig{Name: "shop", Products: 100}))
+
+	popularity := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		p, err := functions.CatalogProduct("shop")
+		require.NoError(t, err)
+		popularity[p.SKU]++
+		require.Equal(t, "GBP", p.Currency)
+		require.Len(t, p.CategoryPath, 3)
+		require.Equal(t, p.Category, p.CategoryPath[2])
+		require.Regexp(t, `^[A-Z]{3}-[A-Z]{3}-\d{5}$`, p.SKU)
+		require.Equal(t, 99, int(cents(t, p.Price)%100))
+		switch p.TaxClass {
+		case "standard":
+			require.Equal(t, 0.2, p.TaxRate)
+		case "reduced":
+			require.Equal(t, 0.05, p.TaxRate)
+		default:
+			require.Failf(t, "unknown tax class", p.TaxClass)
+		}
+	}
+	// popular products sell more
+	top := 0
+	for _, n := range popularity {
+		top = int(math.Max(float64(top), float64(n)))
+	}
+	require.Greater(t, top, 2000/100*5)
+
+	require.Error(t, functions.InitCatalog(functions.CatalogConfig{}))
+	require.Error(t, functions.InitCatalog(functions.CatalogConfig{Name: "x", DiscountRate: rate(2)}))
+	_, err := functions.CatalogProduct("")
+	require.Error(t, err)
+}
+
+func TestLocaleCurrency(t *testing.T) {
+	localePacks(t, "us")
+	currency, rates := functions.LocaleCurrency("de-at")
+	require.Equal(t, "USD", currency)
+	require.Empty(t, rates)
+
+	useLocale(t, "us")
+	currency, rates = functions.LocaleCurrency("fr")
+	require.Equal(t, "EUR", currency)
+	require.Equal(t, 0.2, rates["standard"])
+}
@@ -0,0 +1,143 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/stretchr/testify/require"
+)
+
+// vocabulary returns the words of a text
+func vocabulary(text string) map[string]bool {
+	words := map[string]bool{}
+	for _, w := range strings.Fields(text) {
+		words[strings.ToLower(w)] = true
+	}
+	return words
+}
+
+func requireSentence(t *testing.T, sentence string, words map[string]bool) {
+	require.NotEmpty(t, sentence)
+	require.True(t, unicode.IsUpper([]rune(sentence)[0]), sentence)
+	require.Contains(t, ".!?", sentence[len(sentence)-1:], sentence)
+	for _, w := range strings.Fields(sentence) {
+		require.True(t, words[strings.ToLower(w)] || words[strings.ToLower(strings.TrimSuffix(w, "."))], "%s not in corpus", w)
+	}
+}
+
+func TestCorpus(t *testing.T) {
+	defer functions.ResetCorpora()
+	dir := t.TempDir()
+	first := "the package arrived late. the box was damaged!\n\nwould you buy it again? yes, without doubt"
+	second := "the support team answered quickly and the refund arrived the next day."
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte(first), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte(second), 0644))
+	require.NoError(t, functions.InitCorpus(functions.CorpusConfig{Name: "shop", Path: dir}))
+
+	words := vocabulary(first + " " + second)
+	functions.SetSeed(1)
+	for i := 0; i < 50; i++ {
+		s, err := functions.MarkovSentence("shop")
+		require.NoError(t, err)
+		requireSentence(t, s, words)
+	}
+
+	p, err := functions.MarkovParagraph("shop", 3)
+	require.NoError(t, err)
+	require.Len(t, strings.FieldsFunc(p, func(r rune) bool { return r == '.' || r == '!' || r == '?' }), 3)
+
+	_, err = functions.MarkovParagraph("shop", -1)
+	require.Error(t, err)
+}
+
+func TestCorpusChainFile(t *testing.T) {
+	defer functions.ResetCorpora()
+	dir := t.TempDir()
+	text := filepath.Join(dir, "tickets.txt")
+	chain := filepath.Join(dir, "tickets.chain")
+	require.NoError(t, os.WriteFile(text, []byte("My order is late. My order is missing an item. Please refund my order."), 0644))
+
+	require.NoError(t, functions.InitCorpus(functions.CorpusConfig{Name: "built", Path: text, PrefixLen: 1, Chain: chain}))
+	require.NoError(t, functions.InitCorpus(functions.CorpusConfig{Name: "loaded", Path: chain}))
+
+	for i := int64(0); i < 10; i++ {
+		functions.SetSeed(i)
+		built, err := functions.MarkovSentence("built")
+		require.NoError(t, err)
+		functions.SetSeed(i)
+		loaded, err := functions.MarkovSentence("loaded")
+		require.NoError(t, err)
+		require.Equal(t, built, loaded)
+	}
+
+	_, err := functions.LoadChain(strings.NewReader("JRCHAIN1garbage"))
+	require.Error(t, err)
+}
+
+func TestLocaleCorpora(t *testing.T) {
+	defer functions.ResetCorpora()
+	functions.ResetCorpora()
+	for _, locale := range []string{"it", "us", "de"} {
+		useLocale(t, locale)
+		corpus := locale
+		if locale == "de" {
+			corpus = "us"
+		}
+		content, err := os.ReadFile("../../templates/data/" + corpus + "/corpora/reviews")
+		require.NoError(t, err)
+		words := vocabulary(string(content))
+
+		for i := 0; i < 20; i++ {
+			s, err := functions.MarkovSentence("reviews")
+			require.NoError(t, err)
+			requireSentence(t, s, words)
+		}
+	}
+}
+
+func TestCorpusErrors(t *testing.T) {
+	defer functions.ResetCorpora()
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty")
+	require.NoError(t, os.WriteFile(empty, []byte("\n\n"), 0644))
+
+	require.Error(t, functions.InitCorpus(functions.CorpusConfig{Path: empty}))
+	require.Error(t, functions.InitCorpus(functions.CorpusConfig{Name: "x"}))
+	require.Error(t, functions.InitCorpus(functions.CorpusConfig{Name: "x", Path: filepath.Join(dir, "missing")}))
+	require.Error(t, functions.InitCorpus(functions.CorpusConfig{Name: "x", Path: empty}))
+
+	useLocale(t, "us")
+	_, err := functions.MarkovSentence("nothing")
+	require.Error(t, err)
+}
+
+func TestSentenceWithoutPunctuation(t *testing.T) {
+	c := functions.NewChain(1)
+	c.BuildSentences(strings.NewReader("great product, would buy again"))
+	functions.SetSeed(1)
+	require.Equal(t, "Great product, would buy again.", c.GenerateSentence())
+}
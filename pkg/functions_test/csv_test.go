@@ -0,0 +1,102 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions_test
+
+import (
+	"testing"
+
+	"github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/stretchr/testify/require"
+)
+
+const peopleCsv = "../../testfiles/people.csv"
+
+// initPeople loads the people dataset, restoring the iteration index at the end of the test
+func initPeople(t *testing.T, config functions.CsvConfig) {
+	index := ctx.JrContext.CurrentIterationLoopIndex
+	t.Cleanup(func() {
+		functions.CloseCsvDatasets()
+		ctx.JrContext.CurrentIterationLoopIndex = index
+	})
+	config.Name = "people"
+	config.Path = peopleCsv
+	require.NoError(t, functions.InitCsvDataset(config))
+}
+
+func TestCsvDatasetSequential(t *testing.T) {
+	initPeople(t, functions.CsvConfig{})
+
+	tpl := `{{fromcsv_named "people" "id"}}:{{fromcsv_named "people" "name"}}:{{fromcsv_named "people" "id"}}`
+	expected := []string{"1:Brown, John:1", "2:Mary White:2", "3:Anna Green:3", "4:Luke Black:4", "1:Brown, John:1"}
+	for _, e := range expected {
+		ctx.JrContext.CurrentIterationLoopIndex++
+		require.NoError(t, runt(tpl, e))
+	}
+}
+
+func TestCsvDatasetPerCall(t *testing.T) {
+	initPeople(t, functions.CsvConfig{PerCall: true})
+
+	ctx.JrContext.CurrentIterationLoopIndex++
+	require.NoError(t, runt(`{{fromcsv_named "people" "id"}},{{fromcsv_named "people" "id"}}`, "1,2"))
+}
+
+func TestCsvDatasetShuffle(t *testing.T) {
+	functions.SetSeed(0)
+	initPeople(t, functions.CsvConfig{Mode: functions.CsvShuffle})
+
+	for cycle := 0; cycle < 3; cycle++ {
+		seen := map[string]bool{}
+		for i := 0; i < 4; i++ {
+			ctx.JrContext.CurrentIterationLoopIndex++
+			seen[functions.FromCsvNamed("people", "id").(string)] = true
+		}
+		require.Len(t, seen, 4)
+	}
+}
+
+func TestCsvDatasetRandomTyped(t *testing.T) {
+	functions.SetSeed(0)
+	initPeople(t, functions.CsvConfig{
+		Mode:  functions.CsvRandom,
+		Types: map[string]string{"age": "int", "active": "bool"},
+	})
+
+	for i := 0; i < 10; i++ {
+		ctx.JrContext.CurrentIterationLoopIndex++
+		require.IsType(t, 0, functions.FromCsvNamed("people", "age"))
+		require.IsType(t, true, functions.FromCsvNamed("people", "active"))
+		require.IsType(t, "", functions.FromCsvNamed("people", "name"))
+	}
+	require.NoError(t, runt(`{{if ge (fromcsv_named "people" "age") 25}}adult{{end}}`, "adult"))
+	require.Equal(t, "", functions.FromCsvNamed("people", "missing"))
+	require.Equal(t, "", functions.FromCsvNamed("nobody", "age"))
+}
+
+func TestCsvDatasetErrors(t *testing.T) {
+	require.Error(t, functions.InitCsvDataset(functions.CsvConfig{Path: peopleCsv}))
+	require.Error(t, functions.InitCsvDataset(functions.CsvConfig{Name: "x", Path: "does_not_exist.csv"}))
+	require.Error(t, functions.InitCsvDataset(functions.CsvConfig{Name: "x", Path: peopleCsv, Mode: "backwards"}))
+	require.Error(t, functions.InitCsvDataset(functions.CsvConfig{Name: "x", Path: peopleCsv, Types: map[string]string{"age": "decimal"}}))
+	require.Error(t, functions.InitCsvDataset(functions.CsvConfig{Name: "x", Path: peopleCsv, Types: map[string]string{"height": "int"}}))
+	require.Error(t, functions.InitCSV("does_not_exist.csv"))
+}
@@ -0,0 +1,149 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/stretchr/testify/require"
+)
+
+// tick simulates a new generated value
+func tick(t *testing.T) {
+	index := ctx.JrContext.CurrentIterationLoopIndex
+	t.Cleanup(func() { ctx.JrContext.CurrentIterationLoopIndex = index })
+	ctx.JrContext.CurrentIterationLoopIndex++
+}
+
+func TestEntitiesIntoFeature(t *testing.T) {
+	t.Cleanup(functions.ResetEntities)
+	initZones(t)
+	require.NoError(t, functions.InitEntities(functions.EntityConfig{
+		Name:          "fleet",
+		Count:         3,
+		GeoJson:       "zones",
+		Feature:       "lake",
+		InitialStatus: functions.EntityMoving,
+		Transitions:   map[string]map[string]float64{},
+	}))
+	lake, err := functions.GeoFeatureByName("zones", "lake")
+	require.NoError(t, err)
+
+	require.Equal(t, "1", functions.EntityID("fleet"))
+	require.Equal(t, "2", functions.EntityID("fleet"))
+	require.Equal(t, "3", functions.EntityID("fleet"))
+	require.Equal(t, "1", functions.EntityID("fleet"))
+
+	last := map[string]functions.Entity{}
+	for i := 0; i < 200; i++ {
+		tick(t)
+		for _, id := range []string{"1", "2", "3"} {
+			e := functions.GetEntity("fleet", id)
+			// the entity doesn't move again in the same generated value
+			require.Equal(t, e, functions.GetEntity("fleet", id))
+			require.True(t, lake.Contains(e.Latitude, e.Longitude))
+			require.Equal(t, functions.EntityMoving, e.Status)
+			require.LessOrEqual(t, e.Speed, 30.0)
+			if previous, ok := last[id]; ok {
+				require.Equal(t, previous.Ticks+1, e.Ticks)
+				require.LessOrEqual(t, math.Abs(e.Speed-previous.Speed), 2.0+1e-9)
+			}
+			last[id] = e
+		}
+	}
+	require.NotEqual(t, last["1"].Latitude, last["2"].Latitude)
+}
+
+func TestEntitiesStateMachine(t *testing.T) {
+	t.Cleanup(functions.ResetEntities)
+	require.NoError(t, functions.InitEntities(functions.EntityConfig{
+		Name:      "trucks",
+		Latitude:  45.84,
+		Longitude: 9.38,
+		Radius:    500,
+		Tick:      10 * time.Second,
+		Transitions: map[string]map[string]float64{
+			functions.EntityIdle:    {functions.EntityMoving: 1},
+			functions.EntityMoving:  {functions.EntityStopped: 0.5},
+			functions.EntityStopped: {functions.EntityMoving: 0.5},
+		},
+	}))
+
+	e := functions.GetEntity("trucks", "a")
+	require.Equal(t, functions.EntityIdle, e.Status)
+	require.Zero(t, e.Speed)
+
+	statuses := map[string]int{}
+	for i := 0; i < 200; i++ {
+		tick(t)
+		e = functions.GetEntity("trucks", "a")
+		require.NotEqual(t, functions.EntityIdle, e.Status)
+		// within the circle, with an equirectangular approximation of the distance
+		dy := (e.Latitude - 45.84) * 111195
+		dx := (e.Longitude - 9.38) * 111195 * math.Cos(45.84*math.Pi/180)
+		require.LessOrEqual(t, math.Hypot(dx, dy), 501.0)
+		statuses[e.Status]++
+	}
+	require.Positive(t, statuses[functions.EntityMoving])
+	require.Positive(t, statuses[functions.EntityStopped])
+}
+
+func TestEntitiesAlongRoute(t *testing.T) {
+	t.Cleanup(functions.ResetEntities)
+	initZones(t)
+	require.NoError(t, functions.InitEntities(functions.EntityConfig{
+		Name:          "buses",
+		GeoJson:       "zones",
+		Feature:       "bus",
+		MinSpeed:      10,
+		MaxSpeed:      10,
+		InitialStatus: functions.EntityMoving,
+		Transitions:   map[string]map[string]float64{},
+	}))
+	bus, err := functions.GeoFeatureByName("zones", "bus")
+	require.NoError(t, err)
+
+	start := functions.GetEntity("buses", "1")
+	tick(t)
+	e := functions.GetEntity("buses", "1")
+	require.InDelta(t, start.Distance+10, e.Distance, 1e-9)
+	lat, lon, heading := bus.RoutePosition(e.Distance)
+	require.Equal(t, lat, e.Latitude)
+	require.Equal(t, lon, e.Longitude)
+	require.Equal(t, heading, e.Heading)
+}
+
+func TestEntitiesErrors(t *testing.T) {
+	t.Cleanup(functions.ResetEntities)
+	require.Error(t, functions.InitEntities(functions.EntityConfig{}))
+	require.Error(t, functions.InitEntities(functions.EntityConfig{Name: "fleet", GeoJson: "does_not_exist"}))
+	require.Error(t, functions.InitEntities(functions.EntityConfig{
+		Name:        "fleet",
+		Transitions: map[string]map[string]float64{functions.EntityIdle: {functions.EntityMoving: 0.8, functions.EntityStopped: 0.8}},
+	}))
+
+	// unknown simulations are created with the default configuration
+	require.Equal(t, functions.EntityIdle, functions.EntityStatus("default", "1"))
+}
@@ -0,0 +1,143 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions_test
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIpRanges(t *testing.T) {
+	_, prefix, _ := net.ParseCIDR("2001:db8:1::/48")
+	for i := 0; i < 100; i++ {
+		require.True(t, prefix.Contains(net.ParseIP(functions.Ipv6("2001:db8:1::/48"))))
+		require.True(t, prefix.Contains(net.ParseIP(functions.Ip("2001:db8:1::/48"))))
+		require.True(t, net.ParseIP(functions.IpPrivate()).IsPrivate())
+		public := net.ParseIP(functions.IpPublic())
+		require.True(t, public.IsGlobalUnicast())
+		require.False(t, public.IsPrivate())
+	}
+	require.Equal(t, "::", functions.Ipv6("wrong"))
+}
+
+func TestPortService(t *testing.T) {
+	useLocale(t, "us")
+
+	require.Equal(t, "https", functions.PortService(443, "tcp"))
+	require.Equal(t, "domain", functions.PortService(53, "UDP"))
+	require.Equal(t, "postgresql", functions.PortService(5432, "tcp"))
+	require.Equal(t, "", functions.PortService(5432, "udp"))
+}
+
+func TestFlows(t *testing.T) {
+	keepRecord(t)
+	useLocale(t, "us")
+	functions.ResetNetworks()
+	require.NoError(t, functions.InitNetwork(functions.NetworkConfig{
+		Name:       "corp",
+		Internal:   []string{"10.1.0.0/16"},
+		External:   []string{"198.51.100.0/24"},
+		IPv6Prefix: "2001:db8:1::/48",
+		IPv6Ratio:  0.3,
+		Clients:    5,
+		Servers:    2,
+	}))
+	_, internal, _ := net.ParseCIDR("10.1.0.0/16")
+	_, external, _ := net.ParseCIDR("198.51.100.0/24")
+	_, prefix, _ := net.ParseCIDR("2001:db8:1::/48")
+
+	f := functions.GetFlow("corp")
+	require.Same(t, f, functions.GetFlow("corp"))
+
+	directions := map[string]int{}
+	versions := map[int]int{}
+	clients := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		nextRecord()
+		f := functions.GetFlow("corp")
+		directions[f.Direction]++
+		versions[f.IPVersion]++
+		src, dst := net.ParseIP(f.SrcAddr), net.ParseIP(f.DstAddr)
+		switch {
+		case f.IPVersion == 6 && f.Direction == functions.FlowOutbound:
+			require.True(t, prefix.Contains(src))
+			require.False(t, prefix.Contains(dst))
+		case f.IPVersion == 6 && f.Direction == functions.FlowInbound:
+			require.True(t, prefix.Contains(dst))
+		case f.IPVersion == 6:
+			require.True(t, prefix.Contains(src))
+			require.True(t, prefix.Contains(dst))
+		case f.Direction == functions.FlowOutbound:
+			require.True(t, internal.Contains(src), f.SrcAddr)
+			require.True(t, external.Contains(dst), f.DstAddr)
+			clients[f.SrcAddr] = true
+		case f.Direction == functions.FlowInbound:
+			require.True(t, external.Contains(src), f.SrcAddr)
+			require.True(t, internal.Contains(dst), f.DstAddr)
+		default:
+			require.True(t, internal.Contains(src))
+			require.True(t, internal.Contains(dst))
+		}
+		require.Equal(t, f.Service, functions.PortService(f.DstPort, f.ProtocolName))
+		require.GreaterOrEqual(t, f.SrcPort, 49152)
+		require.False(t, f.End.Before(f.Start))
+	}
+	require.Greater(t, directions[functions.FlowOutbound], directions[functions.FlowInbound])
+	require.Greater(t, directions[functions.FlowInternal], 0)
+	require.InDelta(t, 300, versions[6], 80)
+	// flows come from a fixed set of clients
+	require.LessOrEqual(t, len(clients), 5)
+
+	var record map[string]any
+	nextRecord()
+	f = functions.GetFlow("corp")
+	require.NoError(t, json.Unmarshal([]byte(functions.NetflowRecord("corp")), &record))
+	require.EqualValues(t, f.DstPort, record["destinationTransportPort"])
+	require.EqualValues(t, f.Protocol, record["protocolIdentifier"])
+
+	require.Error(t, functions.InitNetwork(functions.NetworkConfig{Name: "bad", Internal: []string{"2001:db8::/32"}}))
+	require.Error(t, functions.InitNetwork(functions.NetworkConfig{Name: "bad", IPv6Prefix: "10.0.0.0/8"}))
+}
+
+func TestDnsLog(t *testing.T) {
+	useLocale(t, "us")
+	functions.ResetNetworks()
+
+	resolvers := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(functions.DnsLog("default")), &record))
+		require.True(t, net.ParseIP(record["id.orig_h"].(string)).IsPrivate())
+		require.EqualValues(t, 53, record["id.resp_p"])
+		resolvers[record["id.resp_h"].(string)] = true
+		if record["rcode_name"] != "NOERROR" {
+			require.Empty(t, record["answers"])
+		} else {
+			require.NotEmpty(t, record["answers"])
+			require.Len(t, record["TTLs"], len(record["answers"].([]any)))
+		}
+	}
+	require.Len(t, resolvers, 1)
+}
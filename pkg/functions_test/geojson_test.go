@@ -0,0 +1,129 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/stretchr/testify/require"
+)
+
+const zonesGeoJson = "../../testfiles/zones.geojson"
+
+func initZones(t *testing.T) {
+	require.NoError(t, functions.InitGeoDataset(functions.GeoConfig{Name: "zones", Path: zonesGeoJson, WeightProperty: "weight"}))
+}
+
+func parseLatLon(t *testing.T, s string) (float64, float64) {
+	var lat, lon float64
+	_, err := fmt.Sscanf(s, "%f %f", &lat, &lon)
+	require.NoError(t, err)
+	return lat, lon
+}
+
+func TestGeoFeatureHoles(t *testing.T) {
+	initZones(t)
+	park, err := functions.GeoFeatureByName("zones", "park")
+	require.NoError(t, err)
+	require.Len(t, park.Polygons, 2)
+
+	require.True(t, park.Contains(45.841, 9.381))
+	require.True(t, park.Contains(45.845, 9.405))
+	require.False(t, park.Contains(45.845, 9.385), "point in the hole")
+	require.False(t, park.Contains(45.845, 9.395), "point between the polygons")
+
+	for i := 0; i < 50; i++ {
+		lat, lon := parseLatLon(t, functions.NearbyGPSIntoPolygonWithoutStart(200, "zones", "park"))
+		require.True(t, park.Contains(lat, lon), "%f %f", lat, lon)
+	}
+}
+
+func TestNearbyGPSIntoFeature(t *testing.T) {
+	initZones(t)
+	lake, err := functions.GeoFeatureByName("zones", "lake")
+	require.NoError(t, err)
+
+	// the walk starts from the start point, when it is inside the feature
+	require.Equal(t, "45.845000000000 9.425000000000", functions.NearbyGPSIntoPolygon(45.845, 9.425, 100, "zones", "lake"))
+	for i := 0; i < 50; i++ {
+		lat, lon := parseLatLon(t, functions.NearbyGPSIntoPolygon(0, 0, 100, "zones", "lake"))
+		require.True(t, lake.Contains(lat, lon), "%f %f", lat, lon)
+	}
+
+	// without feature name, the features are picked by weight
+	for i := 0; i < 50; i++ {
+		require.NotEmpty(t, functions.NearbyGPSIntoPolygonWithoutStart(100, "zones"))
+	}
+	require.Empty(t, functions.NearbyGPSIntoPolygonWithoutStart(100, "zones", "lake", "extra"))
+	require.Empty(t, functions.NearbyGPSIntoPolygonWithoutStart(100, "zones", "does_not_exist"))
+}
+
+func TestGeoFeatureWeights(t *testing.T) {
+	initZones(t)
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		counts[functions.GeoFeatureName("zones")]++
+	}
+	require.Zero(t, counts["bus"])
+	require.Greater(t, counts["park"], counts["lake"])
+	require.Equal(t, "water", functions.GeoProperty("zones", "lake", "kind"))
+	require.Equal(t, "", functions.GeoProperty("zones", "lake", "missing"))
+}
+
+func TestGPSAlongRoute(t *testing.T) {
+	initZones(t)
+	bus, err := functions.GeoFeatureByName("zones", "bus")
+	require.NoError(t, err)
+	length := bus.RouteLength()
+	require.InDelta(t, 1890, length, 10)
+
+	lat, lon := parseLatLon(t, functions.GPSAlongRoute("zones", "bus", 0))
+	require.InDelta(t, 45.84, lat, 1e-9)
+	require.InDelta(t, 9.38, lon, 1e-9)
+
+	_, _, heading := bus.RoutePosition(100)
+	require.InDelta(t, 0, heading, 1e-6)
+	lat, lon, heading = bus.RoutePosition(length - 1)
+	require.InDelta(t, 45.85, lat, 1e-4)
+	require.InDelta(t, 9.39, lon, 1e-4)
+	require.InDelta(t, 90, heading, 0.1)
+
+	// the route restarts at the end
+	lat, lon, _ = bus.RoutePosition(length + 100)
+	expectedLat, expectedLon := parseLatLon(t, functions.GPSAlongRoute("zones", "bus", 100))
+	require.InDelta(t, expectedLat, lat, 1e-9)
+	require.InDelta(t, expectedLon, lon, 1e-9)
+}
+
+func TestGeoDatasetErrors(t *testing.T) {
+	require.Error(t, functions.InitGeoDataset(functions.GeoConfig{Path: zonesGeoJson}))
+	require.Error(t, functions.InitGeoDataset(functions.GeoConfig{Name: "missing", Path: "missing.geojson"}))
+	require.Error(t, functions.InitGeoDataset(functions.GeoConfig{Name: "zones", Path: zonesGeoJson, WeightProperty: "kind"}))
+	_, err := functions.GeoFeatureByName("does_not_exist", "park")
+	require.Error(t, err)
+	initZones(t)
+	_, err = functions.GeoFeatureByName("zones", "does_not_exist")
+	require.Error(t, err)
+	require.Error(t, functions.InitGeoJson("missing.geojson"))
+	require.NoError(t, functions.InitGeoJson(zonesGeoJson))
+}
@@ -0,0 +1,133 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions_test
+
+import (
+	"testing"
+
+	"github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidators(t *testing.T) {
+	testCases := []struct {
+		name      string
+		validator func(string) bool
+		valid     []string
+		invalid   []string
+	}{
+		{
+			name:      "iban",
+			validator: functions.ValidIban,
+			valid:     []string{"DE89370400440532013000", "GB82 WEST 1234 5698 7654 32", "FR1420041010050500013M02606", "IT60X0542811101000000123456", "ES9121000418450200051332"},
+			invalid:   []string{"DE89370400440532013001", "GB82WEST123456987654", "IT60Y0542811101000000123456", "ES9121000418460200051332", "FR1420041010050500013M02607"},
+		},
+		{
+			name:      "bic",
+			validator: functions.ValidBic,
+			valid:     []string{"DEUTDEFF", "DEUTDEFF500", "BNPAFRPPXXX"},
+			invalid:   []string{"DEUTDEF", "DEU1DEFF", "DEUTDEFF50"},
+		},
+		{
+			name:      "vat",
+			validator: functions.ValidVat,
+			valid:     []string{"DE136695976", "FR40303265045", "GB980780684", "GB123461500", "IT00743110157", "ESA28015865", "ES12345678Z"},
+			invalid:   []string{"DE136695977", "FR41303265045", "GB980780685", "GB123461597", "IT00743110158", "ESA28015866", "US123456789"},
+		},
+		{
+			name:      "steuer id",
+			validator: functions.ValidSteuerID,
+			valid:     []string{"86095742719", "47036892816", "65929970489"},
+			invalid:   []string{"86095742718", "01234567890", "11234567891", "12345678901"},
+		},
+		{
+			name:      "dni",
+			validator: functions.ValidDni,
+			valid:     []string{"12345678Z", "X1234567L", "Y1234567X"},
+			invalid:   []string{"12345678A", "X1234567A", "1234567Z"},
+		},
+		{
+			name:      "nino",
+			validator: functions.ValidNino,
+			valid:     []string{"AB123456C", "JG 10 37 26 A"},
+			invalid:   []string{"QQ123456C", "GB123456A", "AB123456E", "AB12345C"},
+		},
+		{
+			name:      "nir",
+			validator: functions.ValidNir,
+			valid:     []string{"255081416802538", "1 89 05 2A 123 456 31"},
+			invalid:   []string{"255081416802539", "355081416802538", "2551314168025"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, v := range tc.valid {
+				require.True(t, tc.validator(v), v)
+			}
+			for _, v := range tc.invalid {
+				require.False(t, tc.validator(v), v)
+			}
+		})
+	}
+}
+
+func TestGeneratedIdentifiersAreValid(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		for _, country := range []string{"DE", "ES", "FR", "GB", "IT"} {
+			iban := functions.IbanCountry(country)
+			require.True(t, functions.ValidIban(iban), iban)
+			require.Equal(t, country, iban[:2])
+			vat := functions.VatCountry(country)
+			require.True(t, functions.ValidVat(vat), vat)
+			bic := functions.BicCountry(country)
+			require.True(t, functions.ValidBic(bic), bic)
+			require.Equal(t, country, bic[4:6])
+		}
+		id := functions.SteuerID()
+		require.True(t, functions.ValidSteuerID(id), id)
+		id = functions.Nir()
+		require.True(t, functions.ValidNir(id), id)
+		id = functions.Dni()
+		require.True(t, functions.ValidDni(id), id)
+		id = functions.Nie()
+		require.True(t, functions.ValidDni(id), id)
+		id = functions.Nino()
+		require.True(t, functions.ValidNino(id), id)
+	}
+}
+
+func TestIdentifiersFollowLocale(t *testing.T) {
+	locale := ctx.JrContext.Locale
+	t.Cleanup(func() { ctx.JrContext.Locale = locale })
+
+	ctx.JrContext.Locale = "de"
+	require.Equal(t, "DE", functions.Iban()[:2])
+	require.Equal(t, "DE", functions.Bic()[4:6])
+	require.True(t, functions.ValidNationalID(functions.NationalID()))
+
+	ctx.JrContext.Locale = "uk"
+	require.Equal(t, "GB", functions.Vat()[:2])
+	require.True(t, functions.ValidNationalID(functions.NationalID()))
+
+	ctx.JrContext.Locale = "us"
+	require.Empty(t, functions.Iban())
+}
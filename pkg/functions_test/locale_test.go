@@ -0,0 +1,162 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jrnd-io/jr/pkg/constants"
+	"github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/stretchr/testify/require"
+)
+
+// localePacks creates a system dir with a 'us' pack, a 'de' pack and a Latin-1 'de-at' pack
+func localePacks(t *testing.T, locale string) {
+	root := t.TempDir()
+	files := map[string]string{
+		"us/city":           "Springfield\n",
+		"us/state":          "Illinois\n",
+		"us/surname":        "Smith\n",
+		"de/locale.json":    `{"name": "de", "description": "Deutsch", "parent": "us"}`,
+		"de/city":           "Berlin\n",
+		"de/surname":        "Müller\n",
+		"de-at/locale.json": `{"name": "de-at", "description": "Deutsch (Österreich)", "charset": "ISO-8859-1"}`,
+		"de-at/city":        "Gr\xfcnau\n",
+		"fr/city":           "Paris\n",
+		"loop/locale.json":  `{"parent": "loop2"}`,
+		"loop2/locale.json": `{"parent": "loop"}`,
+		"wrong/locale.json": `{"charset": "KLINGON"}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(root, "templates", "data", name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	dir, previous, strict := constants.JR_SYSTEM_DIR, ctx.JrContext.Locale, ctx.JrContext.StrictLocale
+	t.Cleanup(func() {
+		constants.JR_SYSTEM_DIR = dir
+		ctx.JrContext.Locale = previous
+		ctx.JrContext.StrictLocale = strict
+		functions.ClearCache()
+	})
+	constants.JR_SYSTEM_DIR = root
+	ctx.JrContext.Locale = locale
+	ctx.JrContext.StrictLocale = false
+	functions.ClearCache()
+}
+
+func TestLocaleChain(t *testing.T) {
+	localePacks(t, "us")
+
+	chain, err := functions.LocaleChain("DE-AT")
+	require.NoError(t, err)
+	require.Len(t, chain, 3)
+	require.Equal(t, "de-at", chain[0].Name)
+	require.Equal(t, "ISO-8859-1", chain[0].Charset)
+	require.Equal(t, "de", chain[1].Name)
+	require.Equal(t, "UTF-8", chain[1].Charset)
+	require.Equal(t, "us", chain[2].Name)
+
+	chain, err = functions.LocaleChain("fr")
+	require.NoError(t, err)
+	require.Len(t, chain, 1)
+
+	_, err = functions.LocaleChain("loop")
+	require.Error(t, err)
+	_, err = functions.LocaleChain("wrong")
+	require.Error(t, err)
+	_, err = functions.LocaleChain("xx")
+	require.Error(t, err)
+}
+
+func TestLocaleFallback(t *testing.T) {
+	localePacks(t, "de-at")
+
+	// own dataset, decoded from Latin-1
+	require.Equal(t, "Grünau", functions.City())
+	// inherited from de and us
+	require.Equal(t, "Müller", functions.Surname())
+	require.Equal(t, "Illinois", functions.State())
+}
+
+func TestLocaleImplicitFallback(t *testing.T) {
+	localePacks(t, "fr")
+
+	require.Equal(t, "Illinois", functions.State())
+
+	// a strict locale never reads outside its chain
+	ctx.JrContext.StrictLocale = true
+	functions.ClearCache()
+	_, err := functions.Cache("city")
+	require.NoError(t, err)
+	require.Equal(t, "Paris", functions.City())
+}
+
+func TestLocaleReport(t *testing.T) {
+	localePacks(t, "us")
+
+	report, err := functions.LocaleReport("fr")
+	require.NoError(t, err)
+	require.Equal(t, []functions.DatasetSource{
+		{Dataset: "city", Locale: "fr"},
+		{Dataset: "state", Locale: "us", Fallback: true},
+		{Dataset: "surname", Locale: "us", Fallback: true},
+	}, report)
+
+	report, err = functions.LocaleReport("de-at")
+	require.NoError(t, err)
+	require.Equal(t, []functions.DatasetSource{
+		{Dataset: "city", Locale: "de-at"},
+		{Dataset: "state", Locale: "us"},
+		{Dataset: "surname", Locale: "de"},
+	}, report)
+
+	locales, err := functions.Locales()
+	require.NoError(t, err)
+	require.Len(t, locales, 7)
+	require.Equal(t, []string{"de", "de-at", "fr", "loop", "loop2", "us", "wrong"}, locales)
+}
+
+func TestLocaleStrictLookup(t *testing.T) {
+	localePacks(t, "fr")
+	path := filepath.Join(constants.JR_SYSTEM_DIR, "templates", "data", "us", "country")
+	require.NoError(t, os.WriteFile(path, []byte("DE\nIT\n"), 0644))
+	ctx.JrContext.StrictLocale = true
+
+	// a dataset outside the chain is an error, not an exit
+	_ = functions.LocaleError()
+	_, err := functions.Cache("country")
+	require.ErrorIs(t, err, functions.ErrStrictLocale)
+	require.ErrorIs(t, functions.LocaleError(), functions.ErrStrictLocale)
+	require.NoError(t, functions.LocaleError())
+
+	// the lenient lookup reads it from the default locale, without caching it
+	require.Equal(t, 0, functions.LenientIndexOf("DE", "country"))
+	require.Equal(t, 1, functions.LenientIndexOf("IT", "country"))
+	require.Equal(t, -1, functions.LenientIndexOf("XX", "country"))
+	_, err = functions.Cache("country")
+	require.ErrorIs(t, err, functions.ErrStrictLocale)
+	_ = functions.LocaleError()
+}
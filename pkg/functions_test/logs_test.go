@@ -0,0 +1,177 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions_test
+
+import (
+	"encoding/json"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/stretchr/testify/require"
+)
+
+// nextRecord moves to a new record, as the emitter loop does
+func nextRecord() {
+	ctx.JrContext.CurrentIterationLoopIndex++
+}
+
+// keepRecord restores the record index at the end of a test that moves through records
+func keepRecord(t *testing.T) {
+	index := ctx.JrContext.CurrentIterationLoopIndex
+	t.Cleanup(func() {
+		ctx.JrContext.CurrentIterationLoopIndex = index
+	})
+}
+
+func TestLogSessions(t *testing.T) {
+	keepRecord(t)
+	useLocale(t, "us")
+	functions.ResetLogSessions()
+
+	s := functions.NewLogSession()
+	require.Same(t, s, functions.NewLogSession())
+	require.True(t, net.ParseIP(s.IP).IsGlobalUnicast())
+	require.False(t, net.ParseIP(s.IP).IsPrivate())
+	require.True(t, net.ParseIP(s.ServerIP).IsPrivate())
+
+	ips := map[string]int{}
+	for i := 0; i < 500; i++ {
+		nextRecord()
+		ips[functions.NewLogSession().IP]++
+	}
+	// sessions make a series of requests
+	require.Less(t, len(ips), 250)
+}
+
+func TestAccessLogs(t *testing.T) {
+	keepRecord(t)
+	useLocale(t, "us")
+	functions.ResetLogSessions()
+
+	re := regexp.MustCompile(`^(\S+) - (\S+) \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}] "(GET|POST|PUT|DELETE|PATCH) (\S+) HTTP/1.1" (\d{3}) (\d+) "([^"]*)" "([^"]+)"$`)
+	referers := 0
+	for i := 0; i < 200; i++ {
+		nextRecord()
+		s := functions.NewLogSession()
+		line := functions.ApacheLog()
+		m := re.FindStringSubmatch(line)
+		require.NotNil(t, m, line)
+		require.Equal(t, s.IP, m[1])
+		require.Equal(t, s.User, m[2])
+		require.Equal(t, s.UserAgent, m[8])
+		if m[7] != "-" {
+			referers++
+			require.Contains(t, m[7], s.Host)
+		}
+	}
+	require.Greater(t, referers, 0)
+}
+
+func TestSyslog(t *testing.T) {
+	keepRecord(t)
+	useLocale(t, "us")
+
+	rfc5424 := regexp.MustCompile(`^<\d{1,3}>1 \d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}Z \S+ \S+ \d+ - (\[[^]]+])+ .+$`)
+	rfc3164 := regexp.MustCompile(`^<\d{1,3}>\w{3} [ \d]\d \d{2}:\d{2}:\d{2} \S+ \w+\[\d+]: .+$`)
+	for i := 0; i < 50; i++ {
+		nextRecord()
+		line := functions.Syslog5424()
+		require.Regexp(t, rfc5424, line)
+		line = functions.Syslog3164()
+		require.Regexp(t, rfc3164, line)
+	}
+}
+
+func TestCefAndLeef(t *testing.T) {
+	keepRecord(t)
+	useLocale(t, "us")
+
+	for i := 0; i < 50; i++ {
+		nextRecord()
+		s := functions.NewLogSession()
+
+		line := functions.CefLog("Ac|me", "Fire\\wall")
+		require.True(t, strings.HasPrefix(line, `CEF:0|Ac\|me|Fire\\wall|1.0|`), line)
+		require.Contains(t, line, "src="+s.IP+" ")
+		require.Contains(t, line, "dst="+s.ServerIP+" ")
+
+		line = functions.LeefLog("Acme", "Firewall")
+		fields := strings.SplitN(line, "|", 6)
+		require.Len(t, fields, 6)
+		require.Equal(t, "LEEF:1.0", fields[0])
+		attributes := map[string]string{}
+		for _, a := range strings.Split(fields[5], "\t") {
+			k, v, found := strings.Cut(a, "=")
+			require.True(t, found, a)
+			attributes[k] = v
+		}
+		require.Equal(t, s.IP, attributes["src"])
+		require.Equal(t, s.User, attributes["usrName"])
+	}
+}
+
+func TestJsonLogs(t *testing.T) {
+	keepRecord(t)
+	useLocale(t, "us")
+
+	for i := 0; i < 20; i++ {
+		nextRecord()
+		s := functions.NewLogSession()
+
+		var doc map[string]any
+		require.NoError(t, json.Unmarshal([]byte(functions.EcsLog()), &doc))
+		require.Equal(t, s.IP, doc["source"].(map[string]any)["ip"])
+		require.Equal(t, s.ID, doc["session"].(map[string]any)["id"])
+		require.NotEmpty(t, doc["@timestamp"])
+
+		doc = nil
+		require.NoError(t, json.Unmarshal([]byte(functions.WindowsEventLog()), &doc))
+		require.Equal(t, "Security", doc["Channel"])
+		require.Equal(t, s.User, doc["EventData"].(map[string]any)["TargetUserName"])
+
+		doc = nil
+		require.NoError(t, json.Unmarshal([]byte(functions.CloudTrailLog()), &doc))
+		require.Equal(t, s.IP, doc["sourceIPAddress"])
+		require.Equal(t, s.UserAgent, doc["userAgent"])
+		require.Regexp(t, `^\d{12}$`, doc["recipientAccountId"])
+	}
+}
+
+func TestVpcFlowLog(t *testing.T) {
+	keepRecord(t)
+	useLocale(t, "us")
+
+	for i := 0; i < 50; i++ {
+		nextRecord()
+		s := functions.NewLogSession()
+		fields := strings.Fields(functions.VpcFlowLog())
+		require.Len(t, fields, 14)
+		require.Equal(t, "2", fields[0])
+		require.Regexp(t, `^eni-[0-9a-f]{17}$`, fields[2])
+		require.Equal(t, s.IP, fields[3])
+		require.Equal(t, s.ServerIP, fields[4])
+		require.Contains(t, []string{"ACCEPT", "REJECT"}, fields[12])
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions_test
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/jrnd-io/jr/pkg/constants"
+	"github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/stretchr/testify/require"
+)
+
+// useLocale loads the word files of a locale from the repository templates
+func useLocale(t *testing.T, locale string) {
+	dir, previous := constants.JR_SYSTEM_DIR, ctx.JrContext.Locale
+	t.Cleanup(func() {
+		constants.JR_SYSTEM_DIR = dir
+		ctx.JrContext.Locale = previous
+		functions.ClearCache()
+	})
+	constants.JR_SYSTEM_DIR = "../.."
+	ctx.JrContext.Locale = locale
+	functions.ClearCache()
+}
+
+// addresses reads the address file of a locale, by city
+func addresses(t *testing.T, locale string) map[string][]string {
+	f, err := os.Open("../../templates/data/" + locale + "/address")
+	require.NoError(t, err)
+	defer f.Close()
+	cities := map[string][]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		require.Len(t, fields, 5)
+		cities[fields[0]] = fields
+	}
+	return cities
+}
+
+func TestPersonIsCoherent(t *testing.T) {
+	for _, locale := range []string{"us", "it", "de", "fr", "es", "uk"} {
+		t.Run(locale, func(t *testing.T) {
+			useLocale(t, locale)
+			cities := addresses(t, locale)
+			for i := 0; i < 50; i++ {
+				p := functions.NewPerson()
+				a := p.Address
+				fields, ok := cities[a.City]
+				require.True(t, ok, a.City)
+				require.Equal(t, fields[1], a.State)
+				require.Equal(t, fields[2], a.StateShort)
+				require.Regexp(t, regexp.MustCompile("^("+fields[3]+")$"), a.Zip)
+				require.Regexp(t, regexp.MustCompile("^("+fields[4]+")$"), p.Phone)
+				require.Equal(t, a.Phone, p.Phone)
+				require.Regexp(t, `^[a-z0-9]+\.[a-z0-9]+@[a-z0-9.]+$`, p.Email)
+				require.Contains(t, []string{"M", "F"}, p.Gender)
+				require.NotEmpty(t, a.Street)
+				require.NotEmpty(t, a.Country)
+			}
+		})
+	}
+}
+
+func TestPersonGenderMatchesName(t *testing.T) {
+	useLocale(t, "us")
+	names := map[string][]string{}
+	for _, gender := range []string{"M", "F"} {
+		b, err := os.ReadFile("../../templates/data/us/name" + gender)
+		require.NoError(t, err)
+		names[gender] = strings.Split(strings.TrimSpace(string(b)), "\n")
+	}
+	for i := 0; i < 50; i++ {
+		p := functions.NewPerson()
+		require.Contains(t, names[p.Gender], p.Name)
+	}
+}
+
+func TestPersonCodiceFiscale(t *testing.T) {
+	useLocale(t, "it")
+	p := functions.NewPerson()
+	cf := p.CF()
+	require.Len(t, cf, 16)
+	require.Equal(t, strings.ToUpper(p.BirthDate[2:4]), cf[6:8])
+
+	useLocale(t, "us")
+	require.Empty(t, functions.NewPerson().CF())
+}
@@ -0,0 +1,131 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"text/template"
+
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/stretchr/testify/require"
+)
+
+func executeSafe(t *testing.T, text string) (string, error) {
+	tpl, err := template.New("safe").Funcs(functions.SafeFunctionsMap()).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	err = tpl.Execute(&b, nil)
+	return b.String(), err
+}
+
+func TestSafeFunctionsMap(t *testing.T) {
+	useLocale(t, "us")
+	functions.ResetUniques()
+	defer functions.ResetUniques()
+
+	safe := functions.SafeFunctionsMap()
+	for _, name := range []string{"fromcsv", "fromcsv_named", "geo_feature", "geo_property"} {
+		require.NotContains(t, safe, name)
+	}
+	require.Contains(t, functions.FunctionsMap(), "fromcsv")
+
+	city, err := executeSafe(t, `{{from "city"}} {{len "city"}} {{from_at "city" 0}}`)
+	require.NoError(t, err)
+	require.NotEmpty(t, city)
+
+	for _, text := range []string{
+		`{{from "../../../etc/passwd"}}`,
+		`{{from "/etc/passwd"}}`,
+		`{{len "data/city"}}`,
+		`{{from_n "..\\secret" 2}}`,
+		`{{markov_sentence "../corpora/x"}}`,
+		`{{index_of "x" "/tmp/x"}}`,
+	} {
+		_, err := executeSafe(t, text)
+		require.ErrorContains(t, err, "is not allowed", text)
+	}
+
+	_, err = executeSafe(t, `{{unique "s" "from" "../../../etc/passwd"}}`)
+	require.ErrorContains(t, err, "is not allowed")
+	_, err = executeSafe(t, `{{unique "s" "fromcsv" "NAME"}}`)
+	require.Error(t, err)
+	v, err := executeSafe(t, `{{unique "s" "integer" 0 10}}`)
+	require.NoError(t, err)
+	require.NotEmpty(t, v)
+
+	_, err = executeSafe(t, `{{markov_paragraph "reviews" 1000000}}`)
+	require.ErrorContains(t, err, "at most")
+	_, err = executeSafe(t, `{{markov_paragraph "reviews" -1}}`)
+	require.Error(t, err)
+	p, err := executeSafe(t, `{{markov_paragraph "reviews" 2}}`)
+	require.NoError(t, err)
+	require.NotEmpty(t, p)
+
+	_, err = executeSafe(t, `{{fromcsv "NAME"}}`)
+	require.ErrorContains(t, err, `function "fromcsv" not defined`)
+}
+
+func TestSafeFunctionsScopes(t *testing.T) {
+	// remote callers can't create unique scopes and catalogs without limit
+	useLocale(t, "us")
+	functions.ResetUniques()
+	functions.ResetCatalogs()
+	defer functions.ResetUniques()
+	defer functions.ResetCatalogs()
+
+	for i := 0; i < 100; i++ {
+		_, err := executeSafe(t, fmt.Sprintf(`{{unique_value "s%d" 1}}{{product "c%d"}}`, i, i))
+		require.NoError(t, err)
+	}
+	for _, text := range []string{
+		`{{unique_value "new" 1}}`,
+		`{{unique "new" "integer" 0 10}}`,
+		`{{basket "new"}}`,
+		`{{product "new"}}`,
+	} {
+		_, err := executeSafe(t, text)
+		require.ErrorContains(t, err, "is not allowed", text)
+	}
+	_, err := executeSafe(t, `{{unique_value "s0" 2}} {{basket "c0"}} {{unique_count "other"}}`)
+	require.NoError(t, err)
+	require.Zero(t, functions.UniqueCount("other"))
+}
+
+func TestSafeFunctionsLocaleTraversal(t *testing.T) {
+	useLocale(t, "../../../../../../../../etc")
+
+	passwd, err := executeSafe(t, `{{from "passwd"}}`)
+	require.NoError(t, err)
+	require.Empty(t, passwd)
+
+	for _, locale := range []string{"../../etc", `..\etc`, "us/../../etc", "/etc"} {
+		_, err = functions.LoadLocale(locale)
+		require.ErrorContains(t, err, "is not allowed", locale)
+		_, err = functions.LocaleDatasets(locale)
+		require.ErrorContains(t, err, "is not allowed", locale)
+	}
+	require.True(t, functions.IsLocale("US"))
+	require.False(t, functions.IsLocale("../../etc"))
+}
@@ -0,0 +1,111 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnique(t *testing.T) {
+	functions.ResetUniques()
+	defer functions.ResetUniques()
+	functions.SetSeed(1)
+
+	seen := map[any]bool{}
+	for i := 0; i < 50; i++ {
+		v, err := functions.Unique("ids", "integer", 0, 100)
+		require.NoError(t, err)
+		require.False(t, seen[v], "duplicate %v", v)
+		seen[v] = true
+	}
+	require.Equal(t, int64(50), functions.UniqueCount("ids"))
+
+	// scopes are independent
+	_, err := functions.Unique("other", "integer", 0, 100)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), functions.UniqueCount("other"))
+
+	_, err = functions.Unique("ids", "nothing")
+	require.Error(t, err)
+	_, err = functions.Unique("ids", "integer", "a", "b")
+	require.Error(t, err)
+}
+
+func TestUniqueExhaustion(t *testing.T) {
+	functions.ResetUniques()
+	defer functions.ResetUniques()
+	require.NoError(t, functions.InitUnique(functions.UniqueConfig{Name: "bool", Retries: 10}))
+
+	for i := 0; i < 2; i++ {
+		_, err := functions.Unique("bool", "bool")
+		require.NoError(t, err)
+	}
+	_, err := functions.Unique("bool", "bool")
+	require.ErrorContains(t, err, "exhausted")
+}
+
+func TestUniqueValue(t *testing.T) {
+	functions.ResetUniques()
+	defer functions.ResetUniques()
+
+	v, err := functions.UniqueValue("emails", "a@b.com")
+	require.NoError(t, err)
+	require.Equal(t, "a@b.com", v)
+	_, err = functions.UniqueValue("emails", "a@b.com")
+	require.Error(t, err)
+}
+
+func TestUniqueModes(t *testing.T) {
+	for _, c := range []functions.UniqueConfig{
+		{Name: "sharded", Mode: functions.UniqueSharded, Shards: 8},
+		{Name: "bloom", Mode: functions.UniqueBloom, Capacity: 100_000, FPRate: 0.001},
+	} {
+		t.Run(c.Name, func(t *testing.T) {
+			functions.ResetUniques()
+			defer functions.ResetUniques()
+			require.NoError(t, functions.InitUnique(c))
+
+			rejected := 0
+			for i := 0; i < 100_000; i++ {
+				if _, err := functions.UniqueValue(c.Name, fmt.Sprintf("user%d", i)); err != nil {
+					rejected++
+				}
+			}
+			// new values can be rejected as false positives, but never more than the expected rate
+			require.LessOrEqual(t, rejected, 200)
+			for i := 0; i < 1000; i++ {
+				_, err := functions.UniqueValue(c.Name, fmt.Sprintf("user%d", i))
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestUniqueConfig(t *testing.T) {
+	defer functions.ResetUniques()
+	require.Error(t, functions.InitUnique(functions.UniqueConfig{}))
+	require.Error(t, functions.InitUnique(functions.UniqueConfig{Name: "x", Mode: "fuzzy"}))
+	require.Error(t, functions.InitUnique(functions.UniqueConfig{Name: "x", Mode: functions.UniqueBloom, FPRate: 2}))
+}
@@ -0,0 +1,77 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package functions_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jrnd-io/jr/pkg/constants"
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/stretchr/testify/require"
+)
+
+// writeDataset adds a word file to the 'us' locale pack created by localePacks
+func writeDataset(t *testing.T, name string, content string) {
+	path := filepath.Join(constants.JR_SYSTEM_DIR, "templates", "data", "us", name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestWeightedWords(t *testing.T) {
+	localePacks(t, "us")
+	writeDataset(t, "surname", "Smith\t0.88\nJohnson\t0.1\nZappa\t0.02\nNever\t0\n\n")
+	functions.SetSeed(42)
+
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		counts[functions.Surname()]++
+	}
+	require.InDelta(t, 8800, counts["Smith"], 300)
+	require.InDelta(t, 1000, counts["Johnson"], 200)
+	require.InDelta(t, 200, counts["Zappa"], 100)
+	require.Zero(t, counts["Never"])
+
+	// words are cached without their weights
+	require.Equal(t, "4", functions.Len("surname"))
+	require.Equal(t, "Johnson", functions.WordAt("surname", 1))
+	require.Equal(t, 2, functions.IndexOf("Zappa", "surname"))
+
+	// shuffling does not break the weights
+	require.Len(t, functions.WordShuffle("surname"), 4)
+	require.Equal(t, "Smith", functions.WordAt("surname", 0))
+}
+
+func TestUnweightedWords(t *testing.T) {
+	localePacks(t, "us")
+	writeDataset(t, "state", "Alabama\nAlaska\n")
+	writeDataset(t, "address", "Springfield\tIllinois\t1\n")
+	writeDataset(t, "tag", "a\t1\nb\tnot a weight\n")
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		counts[functions.State()]++
+	}
+	require.InDelta(t, 500, counts["Alabama"], 100)
+	require.Equal(t, "Springfield\tIllinois\t1", functions.Word("address"))
+	require.Equal(t, "2", functions.Len("tag"))
+	require.Equal(t, "b\tnot a weight", functions.WordAt("tag", 1))
+}
@@ -0,0 +1,206 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+const namespace = "jr"
+
+// Registry has the metrics of jr, and the ones of the Go runtime and of the process
+var Registry = prometheus.NewRegistry()
+
+var (
+	records = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "records_generated_total",
+		Help:      "Records generated by the emitter.",
+	}, []string{"emitter"})
+	skipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "records_skipped_total",
+		Help:      "Records skipped by the emitter, as a unique scope was exhausted.",
+	}, []string{"emitter"})
+	recordBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_generated_total",
+		Help:      "Bytes of the values generated by the emitter.",
+	}, []string{"emitter"})
+	produceDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "produce_duration_seconds",
+		Help:      "Time taken by the producer to accept a record: asynchronous producers, like kafka, only queue it.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+	}, []string{"emitter", "output"})
+	tickLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tick_lag_seconds",
+		Help:      "Delay of the last generation pass of the emitter after its tick: a growing lag means the emitter can't keep its frequency.",
+	}, []string{"emitter"})
+	producers = &producerCollector{
+		producers: map[string]trackedProducer{},
+		errors: prometheus.NewDesc(prometheus.BuildFQName(namespace, "producer", "errors_total"),
+			"Records the producer failed to send.", []string{"emitter", "output"}, nil),
+		queueDepth: prometheus.NewDesc(prometheus.BuildFQName(namespace, "producer", "queue_depth"),
+			"Records queued by the producer and not sent yet.", []string{"emitter", "output"}, nil),
+	}
+	ready atomic.Bool
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		records, skipped, recordBytes, produceDuration, tickLag, producers,
+	)
+}
+
+// ErrorReporter is implemented by producers counting the records they failed to send
+type ErrorReporter interface {
+	Errors() int64
+}
+
+// QueueReporter is implemented by producers queueing records before sending them
+type QueueReporter interface {
+	QueueDepth() int
+}
+
+// Produced records a record of the emitter and the time taken by the producer to accept it
+func Produced(emitter string, output string, size int, elapsed time.Duration) {
+	records.WithLabelValues(emitter).Inc()
+	recordBytes.WithLabelValues(emitter).Add(float64(size))
+	produceDuration.WithLabelValues(emitter, output).Observe(elapsed.Seconds())
+}
+
+// Skipped records a record skipped by the emitter
+func Skipped(emitter string) {
+	skipped.WithLabelValues(emitter).Inc()
+}
+
+// TickLag records the delay of a generation pass of the emitter after its tick
+func TickLag(emitter string, lag time.Duration) {
+	tickLag.WithLabelValues(emitter).Set(lag.Seconds())
+}
+
+// Track exposes the errors and the queue depth of the producer of the emitter, if it reports them
+func Track(emitter string, output string, producer any) {
+	producers.lock.Lock()
+	defer producers.lock.Unlock()
+	producers.producers[emitter] = trackedProducer{output: output, producer: producer}
+}
+
+// SetReady sets the readiness reported on /readyz
+func SetReady(r bool) {
+	ready.Store(r)
+}
+
+// Ready reports whether jr is ready to generate records
+func Ready() bool {
+	return ready.Load()
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Healthz answers 200 while jr is running
+func Healthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// Readyz answers 200 when jr is ready, and 503 while it starts or stops
+func Readyz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("not ready\n"))
+		return
+	}
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// NewServeMux returns a mux serving /metrics, /healthz and /readyz
+func NewServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	mux.HandleFunc("/healthz", Healthz)
+	mux.HandleFunc("/readyz", Readyz)
+	return mux
+}
+
+// Serve starts a listener for /metrics, /healthz and /readyz on addr, like :9090
+func Serve(addr string) *http.Server {
+	s := &http.Server{
+		Addr:              addr,
+		Handler:           NewServeMux(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := s.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Str("addr", addr).Msg("Error starting metrics listener")
+		}
+	}()
+	log.Info().Str("addr", addr).Msg("Serving metrics")
+	return s
+}
+
+type trackedProducer struct {
+	output   string
+	producer any
+}
+
+// producerCollector collects the errors and the queue depth of the tracked producers when scraped
+type producerCollector struct {
+	lock       sync.Mutex
+	producers  map[string]trackedProducer
+	errors     *prometheus.Desc
+	queueDepth *prometheus.Desc
+}
+
+func (c *producerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.errors
+	ch <- c.queueDepth
+}
+
+func (c *producerCollector) Collect(ch chan<- prometheus.Metric) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for emitter, p := range c.producers {
+		if r, ok := p.producer.(ErrorReporter); ok {
+			ch <- prometheus.MustNewConstMetric(c.errors, prometheus.CounterValue, float64(r.Errors()), emitter, p.output)
+		}
+		if r, ok := p.producer.(QueueReporter); ok {
+			ch <- prometheus.MustNewConstMetric(c.queueDepth, prometheus.GaugeValue, float64(r.QueueDepth()), emitter, p.output)
+		}
+	}
+}
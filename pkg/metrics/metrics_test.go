@@ -0,0 +1,90 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jrnd-io/jr/pkg/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+type reportingProducer struct{}
+
+func (reportingProducer) Errors() int64   { return 3 }
+func (reportingProducer) QueueDepth() int { return 42 }
+
+func get(t *testing.T, url string) (int, string) {
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(b)
+}
+
+func TestMetrics(t *testing.T) {
+	s := httptest.NewServer(metrics.NewServeMux())
+	defer s.Close()
+
+	metrics.Produced("orders", "kafka", 100, 2*time.Millisecond)
+	metrics.Produced("orders", "kafka", 50, 3*time.Millisecond)
+	metrics.TickLag("orders", 250*time.Millisecond)
+	metrics.Track("orders", "kafka", reportingProducer{})
+	metrics.Track("console", "stdout", struct{}{})
+
+	status, body := get(t, s.URL+"/metrics")
+	require.Equal(t, http.StatusOK, status)
+	for _, line := range []string{
+		`jr_records_generated_total{emitter="orders"} 2`,
+		`jr_bytes_generated_total{emitter="orders"} 150`,
+		`jr_produce_duration_seconds_count{emitter="orders",output="kafka"} 2`,
+		`jr_tick_lag_seconds{emitter="orders"} 0.25`,
+		`jr_producer_errors_total{emitter="orders",output="kafka"} 3`,
+		`jr_producer_queue_depth{emitter="orders",output="kafka"} 42`,
+		`go_goroutines`,
+	} {
+		require.Contains(t, body, line)
+	}
+	require.NotContains(t, body, `emitter="console"`)
+}
+
+func TestHealth(t *testing.T) {
+	s := httptest.NewServer(metrics.NewServeMux())
+	defer s.Close()
+	defer metrics.SetReady(false)
+
+	status, _ := get(t, s.URL+"/healthz")
+	require.Equal(t, http.StatusOK, status)
+
+	metrics.SetReady(false)
+	status, body := get(t, s.URL+"/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	require.Equal(t, "not ready\n", body)
+
+	metrics.SetReady(true)
+	status, _ = get(t, s.URL+"/readyz")
+	require.Equal(t, http.StatusOK, status)
+}
@@ -0,0 +1,424 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package openapi reads OpenAPI 3 documents, to generate jr templates from their
+// schemas and to validate JSON values against them.
+package openapi
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Methods are the HTTP methods of the operations of a path item, in the order they are served
+var Methods = []string{"get", "post", "put", "patch", "delete", "head", "options"}
+
+// Document is an OpenAPI 3 document, in YAML or JSON
+type Document struct {
+	OpenAPI    string               `yaml:"openapi"`
+	Servers    []Server             `yaml:"servers"`
+	Paths      map[string]*PathItem `yaml:"paths"`
+	Components Components           `yaml:"components"`
+}
+
+type Server struct {
+	URL string `yaml:"url"`
+}
+
+type Components struct {
+	Schemas       Properties              `yaml:"schemas"`
+	Responses     map[string]*Response    `yaml:"responses"`
+	RequestBodies map[string]*RequestBody `yaml:"requestBodies"`
+	Parameters    map[string]*Parameter   `yaml:"parameters"`
+}
+
+type PathItem struct {
+	Get        *Operation   `yaml:"get"`
+	Post       *Operation   `yaml:"post"`
+	Put        *Operation   `yaml:"put"`
+	Patch      *Operation   `yaml:"patch"`
+	Delete     *Operation   `yaml:"delete"`
+	Head       *Operation   `yaml:"head"`
+	Options    *Operation   `yaml:"options"`
+	Parameters []*Parameter `yaml:"parameters"`
+}
+
+type Operation struct {
+	OperationID string               `yaml:"operationId"`
+	Parameters  []*Parameter         `yaml:"parameters"`
+	RequestBody *RequestBody         `yaml:"requestBody"`
+	Responses   map[string]*Response `yaml:"responses"`
+}
+
+type Parameter struct {
+	Ref      string  `yaml:"$ref"`
+	Name     string  `yaml:"name"`
+	In       string  `yaml:"in"`
+	Required bool    `yaml:"required"`
+	Schema   *Schema `yaml:"schema"`
+}
+
+type RequestBody struct {
+	Ref      string                `yaml:"$ref"`
+	Required bool                  `yaml:"required"`
+	Content  map[string]*MediaType `yaml:"content"`
+}
+
+type Response struct {
+	Ref     string                `yaml:"$ref"`
+	Content map[string]*MediaType `yaml:"content"`
+}
+
+type MediaType struct {
+	Schema  *Schema `yaml:"schema"`
+	Example any     `yaml:"example"`
+}
+
+// Schema is an OpenAPI schema object. After Load, $ref schemas point to the referenced ones.
+type Schema struct {
+	Ref                  string      `yaml:"$ref"`
+	Type                 SchemaType  `yaml:"type"`
+	Format               string      `yaml:"format"`
+	Enum                 []any       `yaml:"enum"`
+	Pattern              string      `yaml:"pattern"`
+	Minimum              *float64    `yaml:"minimum"`
+	Maximum              *float64    `yaml:"maximum"`
+	ExclusiveMinimum     any         `yaml:"exclusiveMinimum"`
+	ExclusiveMaximum     any         `yaml:"exclusiveMaximum"`
+	MultipleOf           *float64    `yaml:"multipleOf"`
+	MinLength            *int        `yaml:"minLength"`
+	MaxLength            *int        `yaml:"maxLength"`
+	MinItems             *int        `yaml:"minItems"`
+	MaxItems             *int        `yaml:"maxItems"`
+	UniqueItems          bool        `yaml:"uniqueItems"`
+	Items                *Schema     `yaml:"items"`
+	Properties           Properties  `yaml:"properties"`
+	Required             []string    `yaml:"required"`
+	AdditionalProperties *Additional `yaml:"additionalProperties"`
+	AllOf                []*Schema   `yaml:"allOf"`
+	OneOf                []*Schema   `yaml:"oneOf"`
+	AnyOf                []*Schema   `yaml:"anyOf"`
+	Nullable             bool        `yaml:"nullable"`
+	ReadOnly             bool        `yaml:"readOnly"`
+	WriteOnly            bool        `yaml:"writeOnly"`
+	Example              any         `yaml:"example"`
+	Examples             []any       `yaml:"examples"`
+	Default              any         `yaml:"default"`
+	// JrTemplate is the x-jr-template extension: a jr template expression that generates the value
+	JrTemplate string `yaml:"x-jr-template"`
+
+	pattern *regexp.Regexp
+}
+
+// SchemaType is the type of a schema: a single type, or a list of types in OpenAPI 3.1
+type SchemaType []string
+
+func (t *SchemaType) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*t = SchemaType{node.Value}
+		return nil
+	}
+	var types []string
+	if err := node.Decode(&types); err != nil {
+		return err
+	}
+	*t = types
+	return nil
+}
+
+// Is tells if the schema type is, or includes, t
+func (t SchemaType) Is(name string) bool {
+	return slices.Contains(t, name)
+}
+
+// Properties are the named schemas of an object, in the order of the document
+type Properties struct {
+	Names   []string
+	Schemas map[string]*Schema
+}
+
+func (p *Properties) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: properties must be a map", node.Line)
+	}
+	p.Schemas = make(map[string]*Schema)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name := node.Content[i].Value
+		var s Schema
+		if err := node.Content[i+1].Decode(&s); err != nil {
+			return err
+		}
+		p.Names = append(p.Names, name)
+		p.Schemas[name] = &s
+	}
+	return nil
+}
+
+// Additional is the additionalProperties of an object: a boolean or a schema
+type Additional struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+func (a *Additional) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&a.Allowed)
+	}
+	a.Allowed = true
+	return node.Decode(&a.Schema)
+}
+
+// Load reads an OpenAPI 3 document and resolves its local references
+func Load(path string) (*Document, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse parses an OpenAPI 3 document and resolves its local references
+func Parse(b []byte) (*Document, error) {
+	var d Document
+	if err := yaml.Unmarshal(b, &d); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(d.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q", d.OpenAPI)
+	}
+	if err := d.resolve(); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// BasePath is the path of the URL of the first server, like /v1
+func (d *Document) BasePath() string {
+	if len(d.Servers) == 0 {
+		return ""
+	}
+	u, err := url.Parse(d.Servers[0].URL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// Operations returns the operations of a path item by lowercase method
+func (p *PathItem) Operations() map[string]*Operation {
+	operations := make(map[string]*Operation)
+	for method, o := range map[string]*Operation{"get": p.Get, "post": p.Post, "put": p.Put, "patch": p.Patch,
+		"delete": p.Delete, "head": p.Head, "options": p.Options} {
+		if o != nil {
+			operations[method] = o
+		}
+	}
+	return operations
+}
+
+// Property returns the schema of a property of an object, including the properties of allOf
+func (s *Schema) Property(name string) (*Schema, bool) {
+	if s == nil {
+		return nil, false
+	}
+	if p, ok := s.Properties.Schemas[name]; ok {
+		return p, true
+	}
+	for _, sub := range s.AllOf {
+		if p, ok := sub.Property(name); ok {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// JSONSchema returns the schema of the JSON media type of a content map, if any
+func JSONSchema(content map[string]*MediaType) (*MediaType, bool) {
+	for contentType, m := range content {
+		if contentType == "application/json" || strings.HasSuffix(contentType, "+json") {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// resolve replaces the references with the components they point to and compiles the patterns
+func (d *Document) resolve() error {
+	seen := make(map[*Schema]bool)
+	for _, name := range d.Components.Schemas.Names {
+		if err := d.resolveSchema(d.Components.Schemas.Schemas[name], seen); err != nil {
+			return fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+	for _, name := range d.Components.Schemas.Names {
+		d.Components.Schemas.Schemas[name] = d.deref(d.Components.Schemas.Schemas[name])
+	}
+	for path, item := range d.Paths {
+		if item == nil {
+			continue
+		}
+		if err := d.resolveParameters(item.Parameters, seen); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for method, o := range item.Operations() {
+			if err := d.resolveOperation(o, seen); err != nil {
+				return fmt.Errorf("%s %s: %w", strings.ToUpper(method), path, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (d *Document) resolveOperation(o *Operation, seen map[*Schema]bool) error {
+	if err := d.resolveParameters(o.Parameters, seen); err != nil {
+		return err
+	}
+	if o.RequestBody != nil && o.RequestBody.Ref != "" {
+		rb, ok := d.Components.RequestBodies[strings.TrimPrefix(o.RequestBody.Ref, "#/components/requestBodies/")]
+		if !ok {
+			return fmt.Errorf("unresolved reference %s", o.RequestBody.Ref)
+		}
+		o.RequestBody = rb
+	}
+	if o.RequestBody != nil {
+		if err := d.resolveContent(o.RequestBody.Content, seen); err != nil {
+			return err
+		}
+	}
+	for code, r := range o.Responses {
+		if r != nil && r.Ref != "" {
+			resolved, ok := d.Components.Responses[strings.TrimPrefix(r.Ref, "#/components/responses/")]
+			if !ok {
+				return fmt.Errorf("unresolved reference %s", r.Ref)
+			}
+			o.Responses[code] = resolved
+			r = resolved
+		}
+		if r != nil {
+			if err := d.resolveContent(r.Content, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *Document) resolveParameters(parameters []*Parameter, seen map[*Schema]bool) error {
+	for i, p := range parameters {
+		if p.Ref != "" {
+			resolved, ok := d.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+			if !ok {
+				return fmt.Errorf("unresolved reference %s", p.Ref)
+			}
+			parameters[i] = resolved
+			p = resolved
+		}
+		if err := d.resolveSchema(p.Schema, seen); err != nil {
+			return err
+		}
+		p.Schema = d.deref(p.Schema)
+	}
+	return nil
+}
+
+func (d *Document) resolveContent(content map[string]*MediaType, seen map[*Schema]bool) error {
+	for _, m := range content {
+		if m == nil {
+			continue
+		}
+		if err := d.resolveSchema(m.Schema, seen); err != nil {
+			return err
+		}
+		m.Schema = d.deref(m.Schema)
+	}
+	return nil
+}
+
+// resolveSchema replaces the $ref subschemas of s with the component schemas.
+// References can be cyclic, so every schema is resolved once.
+func (d *Document) resolveSchema(s *Schema, seen map[*Schema]bool) error {
+	if s == nil || seen[s] {
+		return nil
+	}
+	seen[s] = true
+	if s.Ref != "" {
+		if !strings.HasPrefix(s.Ref, "#/components/schemas/") {
+			return fmt.Errorf("unsupported reference %s", s.Ref)
+		}
+		if _, ok := d.Components.Schemas.Schemas[schemaName(s.Ref)]; !ok {
+			return fmt.Errorf("unresolved reference %s", s.Ref)
+		}
+		return nil
+	}
+	if s.Pattern != "" {
+		var err error
+		if s.pattern, err = regexp.Compile(s.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	resolve := func(sub **Schema) error {
+		if err := d.resolveSchema(*sub, seen); err != nil {
+			return err
+		}
+		*sub = d.deref(*sub)
+		return nil
+	}
+	if err := resolve(&s.Items); err != nil {
+		return err
+	}
+	for _, name := range s.Properties.Names {
+		sub := s.Properties.Schemas[name]
+		if err := resolve(&sub); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		s.Properties.Schemas[name] = sub
+	}
+	if s.AdditionalProperties != nil {
+		if err := resolve(&s.AdditionalProperties.Schema); err != nil {
+			return err
+		}
+	}
+	for _, list := range [][]*Schema{s.AllOf, s.OneOf, s.AnyOf} {
+		for i := range list {
+			if err := resolve(&list[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deref follows the references of a schema to the component schema
+func (d *Document) deref(s *Schema) *Schema {
+	for i := 0; s != nil && s.Ref != "" && i < 16; i++ {
+		s = d.Components.Schemas.Schemas[schemaName(s.Ref)]
+	}
+	return s
+}
+
+func schemaName(ref string) string {
+	return strings.TrimPrefix(ref, "#/components/schemas/")
+}
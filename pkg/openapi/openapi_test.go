@@ -0,0 +1,192 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package openapi_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"text/template"
+
+	"github.com/jrnd-io/jr/pkg/constants"
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/jrnd-io/jr/pkg/openapi"
+	"github.com/stretchr/testify/require"
+)
+
+const petstore = "../../testfiles/petstore.yaml"
+
+func TestLoad(t *testing.T) {
+	d, err := openapi.Load(petstore)
+	require.NoError(t, err)
+	require.Equal(t, "/v1", d.BasePath())
+
+	schemas := d.Components.Schemas
+	require.Equal(t, []string{"NewPet", "Pet", "Owner", "Error"}, schemas.Names)
+	pet := schemas.Schemas["Pet"]
+	require.Same(t, schemas.Schemas["NewPet"], pet.AllOf[1])
+	require.Same(t, pet, schemas.Schemas["Owner"].Properties.Schemas["pets"].Items)
+
+	item := d.Paths["/pets/{petId}"]
+	require.Equal(t, "petId", item.Parameters[0].Name)
+	require.Same(t, schemas.Schemas["Error"], item.Get.Responses["404"].Content["application/json"].Schema)
+	require.True(t, d.Paths["/pets"].Post.RequestBody.Required)
+
+	for name, content := range map[string]string{
+		"version":    "openapi: 2.0\n",
+		"reference":  "openapi: 3.0.0\ncomponents:\n  schemas:\n    A:\n      $ref: '#/components/schemas/B'\n",
+		"remote":     "openapi: 3.0.0\ncomponents:\n  schemas:\n    A:\n      $ref: 'other.yaml#/A'\n",
+		"pattern":    "openapi: 3.0.0\ncomponents:\n  schemas:\n    A:\n      type: string\n      pattern: '('\n",
+		"properties": "openapi: 3.0.0\ncomponents:\n  schemas:\n    A:\n      properties: [a]\n",
+	} {
+		_, err := openapi.Parse([]byte(content))
+		require.Error(t, err, name)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	constants.JR_SYSTEM_DIR = "../.."
+	d, err := openapi.Load(petstore)
+	require.NoError(t, err)
+
+	for _, name := range d.Components.Schemas.Names {
+		schema := d.Components.Schemas.Schemas[name]
+		tpl, err := template.New(name).Funcs(functions.FunctionsMap()).Parse(openapi.Template(schema, nil))
+		require.NoError(t, err, name)
+		for i := 0; i < 50; i++ {
+			var b bytes.Buffer
+			require.NoError(t, tpl.Execute(&b, nil), name)
+			var v any
+			require.NoError(t, json.Unmarshal(b.Bytes(), &v), b.String())
+			require.NoError(t, schema.Validate(v), b.String())
+		}
+	}
+
+	template := openapi.Template(d.Components.Schemas.Schemas["NewPet"], map[string]string{"name": `"Rex"`})
+	require.Contains(t, template, `"name": "Rex"`)
+	require.Contains(t, template, `"species": {{randoms "\"dog\"|\"cat\"|\"parrot\""}}`)
+	require.Contains(t, template, `"tag": "{{json_escape (regex "^[A-Z]{2}-[0-9]{4}$")}}"`)
+	require.Contains(t, template, `"birthday": "{{json_escape (past 2)}}"`)
+	require.Contains(t, template, `"weight": {{format_float "%.2f" (floating 0.01 80)}}`)
+
+	template = openapi.Template(d.Components.Schemas.Schemas["Pet"], nil)
+	require.Contains(t, template, `"petId": {{integer64 1 1002}}`)
+	require.Contains(t, template, `"chip": "{{json_escape (uuid)}}"`)
+	require.Contains(t, template, `"email": "{{json_escape (email)}}"`)
+	require.Contains(t, openapi.Template(d.Components.Schemas.Schemas["Error"], nil), `"message": "not found"`)
+}
+
+func TestTemplateEscaping(t *testing.T) {
+	quoted := &openapi.Schema{Type: openapi.SchemaType{"string"}, Pattern: `^say "[a-z]{2}\\[a-z]{2}"$`}
+	tpl, err := template.New("quoted").Funcs(functions.FunctionsMap()).Parse(openapi.Template(quoted, nil))
+	require.NoError(t, err)
+	var b bytes.Buffer
+	require.NoError(t, tpl.Execute(&b, nil))
+	var v string
+	require.NoError(t, json.Unmarshal(b.Bytes(), &v), b.String())
+	require.Regexp(t, `^say "[a-z]{2}\\[a-z]{2}"$`, v)
+}
+
+func TestTemplateMultipleOf(t *testing.T) {
+	d, err := openapi.Parse([]byte(`
+openapi: 3.0.3
+info:
+  title: Prices
+  version: 1.0.0
+paths: {}
+components:
+  schemas:
+    Price:
+      type: object
+      properties:
+        quantity:
+          type: integer
+          minimum: 1
+          maximum: 100
+          multipleOf: 5
+        step:
+          type: integer
+          multipleOf: 1.5
+        amount:
+          type: number
+          minimum: 0.3
+          exclusiveMinimum: true
+          maximum: 10
+          multipleOf: 0.1
+        fraction:
+          type: number
+          multipleOf: 0.25
+`))
+	require.NoError(t, err)
+	schema := d.Components.Schemas.Schemas["Price"]
+	text := openapi.Template(schema, nil)
+	require.Contains(t, text, `"quantity": {{mul 5 (integer 1 21)}}`)
+	require.Contains(t, text, `"step": {{mul 3 (integer 0 334)}}`)
+	require.Contains(t, text, `"amount": {{mul 1 (integer 4 101)}}e-1`)
+	require.Contains(t, text, `"fraction": {{mul 25 (integer 0 4001)}}e-2`)
+
+	tpl, err := template.New("price").Funcs(functions.FunctionsMap()).Parse(text)
+	require.NoError(t, err)
+	for i := 0; i < 50; i++ {
+		var b bytes.Buffer
+		require.NoError(t, tpl.Execute(&b, nil))
+		var v any
+		require.NoError(t, json.Unmarshal(b.Bytes(), &v), b.String())
+		require.NoError(t, schema.Validate(v), b.String())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	d, err := openapi.Load(petstore)
+	require.NoError(t, err)
+	pet := d.Components.Schemas.Schemas["Pet"]
+
+	valid := `{"petId":3,"name":"Rex","species":"dog","tag":"AB-1234","birthday":"2020-02-29","weight":12.5,
+		"chip":"0b4e4a1c-3c2f-4d5e-9f60-7a8b9c0d1e2f","owner":{"email":"ada@example.com","pets":[]}}`
+	var v any
+	require.NoError(t, json.Unmarshal([]byte(valid), &v))
+	require.NoError(t, pet.Validate(v))
+
+	invalid := `{"petId":1.5,"name":7,"species":"cow","tag":"ab-1","birthday":"2020-02-30","weight":0,
+		"chip":"x","owner":{"email":"ada","pets":[{"name":"Tom"}]}}`
+	require.NoError(t, json.Unmarshal([]byte(invalid), &v))
+	err = pet.Validate(v)
+	require.Error(t, err)
+	errors := err.(*openapi.ValidationError).Errors
+	for _, e := range []string{
+		"body.petId: must be integer",
+		"body.name: must be string",
+		`body.species: must be one of ["dog","cat","parrot"]`,
+		"body.tag: must match pattern ^[A-Z]{2}-[0-9]{4}$",
+		"body.birthday: must be a valid date",
+		"body.weight: must be greater than 0",
+		"body.chip: must be a valid uuid",
+		"body.owner.email: must be a valid email",
+		"body.owner.pets[0].species: is required",
+	} {
+		require.Contains(t, errors, e)
+	}
+
+	owner := d.Components.Schemas.Schemas["Owner"]
+	require.NoError(t, json.Unmarshal([]byte(`{"name":"Ada","age":36}`), &v))
+	require.EqualError(t, owner.Validate(v), "body.age: is not allowed")
+	require.EqualError(t, owner.Validate([]any{}), "body: must be object")
+}
@@ -0,0 +1,434 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxDepth limits the nesting of recursive schemas in templates
+const maxDepth = 8
+
+// formats are the jr template pipelines of the string formats
+var formats = map[string]string{
+	"email":     `email`,
+	"uuid":      `uuid`,
+	"date":      `past 2`,
+	"date-time": `format_timestamp (integer64 1577836800000 (now)) "2006-01-02T15:04:05Z07:00"`,
+	"time":      `format_timestamp (integer64 1577836800000 (now)) "15:04:05"`,
+	"ipv4":      `ip "10.0.0.0/8"`,
+	"ipv6":      `ipv6`,
+	"uri":       `printf "https://%s/%s" (email_provider) (lower (random_string 4 10))`,
+	"url":       `printf "https://%s/%s" (email_provider) (lower (random_string 4 10))`,
+	"hostname":  `email_provider`,
+	"password":  `password 12 false "" ""`,
+	"phone":     `phone`,
+	"iban":      `iban`,
+}
+
+// names are the jr template pipelines of strings with well known property names, without format
+var names = map[string]string{
+	"name":        `printf "%s %s" (name) (surname)`,
+	"fullname":    `printf "%s %s" (name) (surname)`,
+	"firstname":   `name`,
+	"lastname":    `surname`,
+	"surname":     `surname`,
+	"username":    `username (name) (surname)`,
+	"email":       `email`,
+	"phone":       `phone`,
+	"phonenumber": `phone`,
+	"company":     `company`,
+	"street":      `street`,
+	"city":        `city`,
+	"state":       `state`,
+	"zip":         `zip`,
+	"zipcode":     `zip`,
+	"postalcode":  `zip`,
+	"country":     `country`,
+	"description": `sentence 8`,
+}
+
+// Template returns a jr template generating JSON values of the schema.
+// Values maps top level properties to template expressions that replace the generated ones.
+func Template(s *Schema, values map[string]string) string {
+	var b strings.Builder
+	g := &generator{b: &b, values: values, stack: make(map[*Schema]int)}
+	g.schema(s, "", 0)
+	return b.String()
+}
+
+type generator struct {
+	b      *strings.Builder
+	values map[string]string
+	// stack counts the schemas being generated, to stop recursive schemas
+	stack map[*Schema]int
+}
+
+// recursive tells if s is being generated, so generating it again would never end
+func (g *generator) recursive(s *Schema) bool {
+	return s != nil && g.stack[s] > 0
+}
+
+func (g *generator) schema(s *Schema, name string, depth int) {
+	if s == nil || depth > maxDepth {
+		g.b.WriteString("null")
+		return
+	}
+	g.stack[s]++
+	defer func() { g.stack[s]-- }()
+
+	if s.JrTemplate != "" {
+		if s.Type.Is("string") {
+			g.b.WriteString(`"` + s.JrTemplate + `"`)
+		} else {
+			g.b.WriteString(s.JrTemplate)
+		}
+		return
+	}
+	if len(s.Enum) > 0 {
+		g.enum(s.Enum)
+		return
+	}
+	if len(s.AllOf) > 0 {
+		g.schema(mergeAllOf(s), name, depth)
+		return
+	}
+	if len(s.OneOf) > 0 {
+		g.schema(s.OneOf[0], name, depth)
+		return
+	}
+	if len(s.AnyOf) > 0 {
+		g.schema(s.AnyOf[0], name, depth)
+		return
+	}
+
+	switch {
+	case s.Type.Is("object") || len(s.Properties.Names) > 0:
+		g.object(s, depth)
+	case s.Type.Is("array"):
+		g.array(s, name, depth)
+	case s.Type.Is("string"):
+		g.b.WriteString(stringExpression(s, name))
+	case s.Type.Is("integer"):
+		g.b.WriteString(integerExpression(s))
+	case s.Type.Is("number"):
+		g.b.WriteString(numberExpression(s))
+	case s.Type.Is("boolean"):
+		g.b.WriteString("{{bool}}")
+	case example(s) != nil:
+		g.literal(example(s))
+	default:
+		g.b.WriteString("null")
+	}
+}
+
+func (g *generator) object(s *Schema, depth int) {
+	indent := strings.Repeat("  ", depth)
+	var properties []string
+	for _, name := range s.Properties.Names {
+		p := s.Properties.Schemas[name]
+		if p.WriteOnly || g.recursive(p) && !slices.Contains(s.Required, name) {
+			continue
+		}
+		properties = append(properties, name)
+	}
+	if len(properties) == 0 {
+		g.b.WriteString("{}")
+		return
+	}
+	g.b.WriteString("{\n")
+	for i, name := range properties {
+		key, _ := json.Marshal(name)
+		fmt.Fprintf(g.b, "%s  %s: ", indent, key)
+		if v, ok := g.values[name]; ok && depth == 0 {
+			g.b.WriteString(v)
+		} else {
+			g.schema(s.Properties.Schemas[name], name, depth+1)
+		}
+		if i < len(properties)-1 {
+			g.b.WriteString(",")
+		}
+		g.b.WriteString("\n")
+	}
+	g.b.WriteString(indent + "}")
+}
+
+func (g *generator) array(s *Schema, name string, depth int) {
+	if g.recursive(s.Items) {
+		g.b.WriteString("[]")
+		return
+	}
+	minItems, maxItems := 1, 3
+	if s.MinItems != nil {
+		minItems = *s.MinItems
+		maxItems = max(maxItems, minItems)
+	}
+	if s.MaxItems != nil {
+		maxItems = *s.MaxItems
+		minItems = min(minItems, maxItems)
+	}
+	fmt.Fprintf(g.b, "[{{range $i, $_ := array (integer %d %d)}}{{if $i}},{{end}}", minItems, maxItems+1)
+	g.schema(s.Items, strings.TrimSuffix(name, "s"), depth+1)
+	g.b.WriteString("{{end}}]")
+}
+
+// enum picks one of the values of the enum
+func (g *generator) enum(values []any) {
+	literals := make([]string, len(values))
+	for i, v := range values {
+		b, _ := json.Marshal(v)
+		literals[i] = string(b)
+	}
+	fmt.Fprintf(g.b, "{{randoms %s}}", strconv.Quote(strings.Join(literals, "|")))
+	for _, l := range literals {
+		if strings.Contains(l, "|") {
+			// randoms splits on |, so values with | are picked by index
+			g.b.Reset()
+			fmt.Fprintf(g.b, "{{$e := integer 0 %d}}", len(literals))
+			for i, l := range literals {
+				fmt.Fprintf(g.b, "{{if eq $e %d}}%s{{end}}", i, l)
+			}
+			return
+		}
+	}
+}
+
+func (g *generator) literal(v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		g.b.WriteString("null")
+		return
+	}
+	g.b.WriteString(strings.ReplaceAll(string(b), "{{", `{{"{{"}}`))
+}
+
+// stringExpression returns the template of a JSON string: the pattern, format, property name
+// or example of the schema, or a random string within its length bounds
+func stringExpression(s *Schema, name string) string {
+	if s.Pattern != "" {
+		return escaped(fmt.Sprintf("regex %s", strconv.Quote(s.Pattern)))
+	}
+	if e, ok := formats[s.Format]; ok {
+		return escaped(e)
+	}
+	if s.MinLength == nil && s.MaxLength == nil {
+		key := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+		if e, ok := names[key]; ok {
+			return escaped(e)
+		}
+		if v, ok := example(s).(string); ok {
+			b, _ := json.Marshal(v)
+			return strings.ReplaceAll(string(b), "{{", `{{"{{"}}`)
+		}
+		return escaped("lorem 3")
+	}
+	minLength, maxLength := 5, 15
+	if s.MinLength != nil {
+		minLength = *s.MinLength
+		maxLength = max(maxLength, minLength)
+	}
+	if s.MaxLength != nil {
+		maxLength = *s.MaxLength
+		minLength = min(minLength, maxLength)
+	}
+	return escaped(fmt.Sprintf("random_string %d %d", minLength, maxLength))
+}
+
+// escaped returns the template of a JSON string with the value of a pipeline
+func escaped(pipeline string) string {
+	return `"{{json_escape (` + pipeline + `)}}"`
+}
+
+func integerExpression(s *Schema) string {
+	low, lowExclusive, high, highExclusive := bounds(s, 0, 1000)
+	if factor, decimals, ok := multiple(s); ok {
+		// the smallest integer multiple of factor/10^decimals
+		factor /= gcd(factor, pow10(decimals))
+		return multipleExpression(factor, 0, low, lowExclusive, high, highExclusive)
+	}
+	lowInt, highInt := int64(math.Ceil(low)), int64(math.Floor(high))
+	if lowExclusive && float64(lowInt) == low {
+		lowInt++
+	}
+	if highExclusive && float64(highInt) == high {
+		highInt--
+	}
+	if highInt < lowInt {
+		highInt = lowInt
+	}
+	return fmt.Sprintf("{{integer64 %d %d}}", lowInt, highInt+1)
+}
+
+func numberExpression(s *Schema) string {
+	low, lowExclusive, high, highExclusive := bounds(s, 0, 1000)
+	if factor, decimals, ok := multiple(s); ok {
+		return multipleExpression(factor, decimals, low, lowExclusive, high, highExclusive)
+	}
+	// values are rounded to cents, which must not reach exclusive bounds
+	if lowExclusive {
+		low += 0.01
+	}
+	if highExclusive {
+		high -= 0.01
+	}
+	return fmt.Sprintf(`{{format_float "%%.2f" (floating %s %s)}}`, formatFloat(low), formatFloat(high))
+}
+
+// multiple returns the multipleOf of a number as factor/10^decimals, if it has one
+// with few enough digits to be multiplied by integers in templates
+func multiple(s *Schema) (int64, int, bool) {
+	if s.MultipleOf == nil || *s.MultipleOf <= 0 {
+		return 0, 0, false
+	}
+	digits := strconv.FormatFloat(*s.MultipleOf, 'f', -1, 64)
+	integer, fraction, _ := strings.Cut(digits, ".")
+	if len(integer)+len(fraction) > 9 {
+		return 0, 0, false
+	}
+	factor, err := strconv.ParseInt(integer+fraction, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return factor, len(fraction), true
+}
+
+// multipleExpression returns the template expression of a multiple of factor/10^decimals
+// between the bounds. Multiples with decimals are written with an exponent, so they are exact.
+func multipleExpression(factor int64, decimals int, low float64, lowExclusive bool, high float64, highExclusive bool) string {
+	m := float64(factor) / float64(pow10(decimals))
+	lowQuotient, highQuotient := quotient(low, m), quotient(high, m)
+	lowCount, highCount := int64(math.Ceil(lowQuotient)), int64(math.Floor(highQuotient))
+	if lowExclusive && float64(lowCount) == lowQuotient {
+		lowCount++
+	}
+	if highExclusive && float64(highCount) == highQuotient {
+		highCount--
+	}
+	if highCount < lowCount {
+		highCount = lowCount
+	}
+	e := fmt.Sprintf("{{mul %d (integer %d %d)}}", factor, lowCount, highCount+1)
+	if decimals > 0 {
+		e += fmt.Sprintf("e-%d", decimals)
+	}
+	return e
+}
+
+// quotient returns v/m, rounded when it is an integer but for float errors, as in validateNumber
+func quotient(v float64, m float64) float64 {
+	q := v / m
+	if math.Abs(q-math.Round(q)) <= 1e-9 {
+		return math.Round(q)
+	}
+	return q
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
+
+// bounds returns the minimum and maximum of a number and if they are exclusive,
+// with defaults when they are missing
+func bounds(s *Schema, defaultMin float64, defaultMax float64) (float64, bool, float64, bool) {
+	low, high := defaultMin, defaultMax
+	lowExclusive, highExclusive := false, false
+	if s.Minimum != nil {
+		low = *s.Minimum
+		lowExclusive = s.ExclusiveMinimum == true
+	}
+	if n, ok := number(s.ExclusiveMinimum); ok && (s.Minimum == nil || n >= low) {
+		low, lowExclusive = n, true
+	}
+	if s.Maximum != nil {
+		high = *s.Maximum
+		highExclusive = s.ExclusiveMaximum == true
+	}
+	if n, ok := number(s.ExclusiveMaximum); ok && (s.Maximum == nil || n <= high) {
+		high, highExclusive = n, true
+	}
+	_, exclusiveMin := number(s.ExclusiveMinimum)
+	_, exclusiveMax := number(s.ExclusiveMaximum)
+	hasMin, hasMax := s.Minimum != nil || exclusiveMin, s.Maximum != nil || exclusiveMax
+	if hasMin && !hasMax {
+		high = max(high, low+defaultMax-defaultMin)
+	}
+	if hasMax && !hasMin {
+		low = min(low, high-(defaultMax-defaultMin))
+	}
+	return low, lowExclusive, high, highExclusive
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func example(s *Schema) any {
+	if s.Example != nil {
+		return s.Example
+	}
+	if len(s.Examples) > 0 {
+		return s.Examples[0]
+	}
+	return s.Default
+}
+
+// mergeAllOf merges the properties and the required fields of the schemas of allOf
+func mergeAllOf(s *Schema) *Schema {
+	merged := *s
+	merged.AllOf = nil
+	merged.Properties = Properties{Schemas: make(map[string]*Schema)}
+	merged.Required = nil
+	for _, sub := range append([]*Schema{s}, s.AllOf...) {
+		if sub == nil {
+			continue
+		}
+		if len(sub.AllOf) > 0 && sub != s {
+			sub = mergeAllOf(sub)
+		}
+		if len(merged.Type) == 0 {
+			merged.Type = sub.Type
+		}
+		for _, name := range sub.Properties.Names {
+			if _, ok := merged.Properties.Schemas[name]; !ok {
+				merged.Properties.Names = append(merged.Properties.Names, name)
+			}
+			merged.Properties.Schemas[name] = sub.Properties.Schemas[name]
+		}
+		merged.Required = append(merged.Required, sub.Required...)
+	}
+	return &merged
+}
@@ -0,0 +1,279 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ValidationError lists the values that don't match a schema, by path
+type ValidationError struct {
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Errors, "; ")
+}
+
+// Validate checks a value decoded from JSON against the schema.
+// Read only properties are allowed, as clients often send back what they got.
+func (s *Schema) Validate(v any) error {
+	e := &ValidationError{}
+	s.validate(v, "body", e)
+	if len(e.Errors) > 0 {
+		return e
+	}
+	return nil
+}
+
+func (s *Schema) validate(v any, path string, e *ValidationError) {
+	if s == nil {
+		return
+	}
+	fail := func(format string, args ...any) {
+		e.Errors = append(e.Errors, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if v == nil {
+		if !s.Nullable && len(s.Type) > 0 && !s.Type.Is("null") {
+			fail("must not be null")
+		}
+		return
+	}
+	if len(s.Enum) > 0 && !inEnum(v, s.Enum) {
+		fail("must be one of %s", enumString(s.Enum))
+	}
+	for _, sub := range s.AllOf {
+		sub.validate(v, path, e)
+	}
+	if len(s.AnyOf) > 0 && matching(s.AnyOf, v) == 0 {
+		fail("must match at least a schema of anyOf")
+	}
+	if len(s.OneOf) > 0 {
+		if n := matching(s.OneOf, v); n != 1 {
+			fail("must match exactly a schema of oneOf, matches %d", n)
+		}
+	}
+
+	switch v := v.(type) {
+	case string:
+		if !s.allows("string") {
+			fail("must be %s", s.typeString())
+			return
+		}
+		s.validateString(v, fail)
+	case float64:
+		integer := v == math.Trunc(v)
+		if !s.allows("number") && !(integer && s.allows("integer")) {
+			fail("must be %s", s.typeString())
+			return
+		}
+		s.validateNumber(v, fail)
+	case bool:
+		if !s.allows("boolean") {
+			fail("must be %s", s.typeString())
+		}
+	case []any:
+		if !s.allows("array") {
+			fail("must be %s", s.typeString())
+			return
+		}
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.UniqueItems {
+			seen := make(map[string]bool)
+			for _, item := range v {
+				b, _ := json.Marshal(item)
+				if seen[string(b)] {
+					fail("must have unique items")
+					break
+				}
+				seen[string(b)] = true
+			}
+		}
+		for i, item := range v {
+			s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i), e)
+		}
+	case map[string]any:
+		if !s.allows("object") {
+			fail("must be %s", s.typeString())
+			return
+		}
+		s.validateObject(v, path, e)
+	}
+}
+
+func (s *Schema) validateString(v string, fail func(string, ...any)) {
+	length := utf8.RuneCountInString(v)
+	if s.MinLength != nil && length < *s.MinLength {
+		fail("must be at least %d characters long", *s.MinLength)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		fail("must be at most %d characters long", *s.MaxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(v) {
+		fail("must match pattern %s", s.Pattern)
+	}
+	var err error
+	switch s.Format {
+	case "email":
+		_, err = mail.ParseAddress(v)
+	case "uuid":
+		if !uuidPattern.MatchString(v) {
+			err = fmt.Errorf("invalid")
+		}
+	case "date":
+		_, err = time.Parse(time.DateOnly, v)
+	case "date-time":
+		_, err = time.Parse(time.RFC3339, v)
+	case "ipv4":
+		if ip := net.ParseIP(v); ip == nil || ip.To4() == nil {
+			err = fmt.Errorf("invalid")
+		}
+	case "ipv6":
+		if ip := net.ParseIP(v); ip == nil || ip.To4() != nil {
+			err = fmt.Errorf("invalid")
+		}
+	case "uri", "url":
+		_, err = url.ParseRequestURI(v)
+	}
+	if err != nil {
+		fail("must be a valid %s", s.Format)
+	}
+}
+
+func (s *Schema) validateNumber(v float64, fail func(string, ...any)) {
+	if s.Minimum != nil {
+		if s.ExclusiveMinimum == true && v <= *s.Minimum {
+			fail("must be greater than %v", *s.Minimum)
+		} else if v < *s.Minimum {
+			fail("must be at least %v", *s.Minimum)
+		}
+	}
+	if s.Maximum != nil {
+		if s.ExclusiveMaximum == true && v >= *s.Maximum {
+			fail("must be less than %v", *s.Maximum)
+		} else if v > *s.Maximum {
+			fail("must be at most %v", *s.Maximum)
+		}
+	}
+	// OpenAPI 3.1 exclusive bounds are numbers
+	if low, ok := number(s.ExclusiveMinimum); ok && v <= low {
+		fail("must be greater than %v", low)
+	}
+	if high, ok := number(s.ExclusiveMaximum); ok && v >= high {
+		fail("must be less than %v", high)
+	}
+	if s.MultipleOf != nil && *s.MultipleOf > 0 {
+		q := v / *s.MultipleOf
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			fail("must be a multiple of %v", *s.MultipleOf)
+		}
+	}
+}
+
+func (s *Schema) validateObject(v map[string]any, path string, e *ValidationError) {
+	for _, name := range s.Required {
+		if p, ok := s.Properties.Schemas[name]; ok && p.ReadOnly {
+			continue
+		}
+		if _, ok := v[name]; !ok {
+			e.Errors = append(e.Errors, fmt.Sprintf("%s.%s: is required", path, name))
+		}
+	}
+	for name, value := range v {
+		if p, ok := s.Properties.Schemas[name]; ok {
+			p.validate(value, path+"."+name, e)
+			continue
+		}
+		if a := s.AdditionalProperties; a != nil {
+			if !a.Allowed {
+				e.Errors = append(e.Errors, fmt.Sprintf("%s.%s: is not allowed", path, name))
+			} else {
+				a.Schema.validate(value, path+"."+name, e)
+			}
+		}
+	}
+}
+
+// allows tells if a value of type t is allowed: schemas without a type allow any value
+func (s *Schema) allows(t string) bool {
+	if len(s.Type) == 0 {
+		return true
+	}
+	return s.Type.Is(t)
+}
+
+func (s *Schema) typeString() string {
+	return strings.Join(s.Type, " or ")
+}
+
+// matching returns the number of schemas the value matches
+func matching(schemas []*Schema, v any) int {
+	n := 0
+	for _, s := range schemas {
+		if s.Validate(v) == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// inEnum compares JSON values with the values of the enum, which are decoded from YAML
+func inEnum(v any, enum []any) bool {
+	b, _ := json.Marshal(v)
+	for _, value := range enum {
+		if e, _ := json.Marshal(value); string(e) == string(b) {
+			return true
+		}
+	}
+	return false
+}
+
+func enumString(enum []any) string {
+	b, _ := json.Marshal(enum)
+	return string(b)
+}
+
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
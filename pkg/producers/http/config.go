@@ -30,18 +30,40 @@ const (
 	BearerAuth AuthType = "bearer"
 	APIKeyAuth AuthType = "api_key"
 	DigestAuth AuthType = "digest"
+	OAuth2Auth AuthType = "oauth2"
 
-	POST Method = "POST"
-	PUT  Method = "PUT"
+	GET    Method = "GET"
+	POST   Method = "POST"
+	PUT    Method = "PUT"
+	PATCH  Method = "PATCH"
+	DELETE Method = "DELETE"
 )
 
+// Endpoint URL, Method, Query and the Headers of the Config are templates, rendered for every record with
+// .K, the key, .V, the value, and .Record, the value decoded from JSON: https://jr.io/users/{{.Record.id}}
 type Endpoint struct {
-	URL     string `json:"url"`
-	Method  Method `json:"method"`
-	Timeout string `json:"timeout"`
+	URL     string            `json:"url"`
+	Method  Method            `json:"method"`
+	Query   map[string]string `json:"query"`
+	Timeout string            `json:"timeout"`
 	timeout time.Duration
 }
 
+// Retry of the requests failing with a 5xx or 429 status code, or a transport error: the backoff is exponential
+// with jitter from InitialBackoff to MaxBackoff, or the Retry-After of the response, up to MaxBackoff
+type Retry struct {
+	MaxRetries     int    `json:"max_retries"`
+	InitialBackoff string `json:"initial_backoff"`
+	MaxBackoff     string `json:"max_backoff"`
+}
+
+// Concurrency of the requests: Workers send them, with at most MaxInFlight requests queued or being sent.
+// Without workers, the requests are sent one at a time by the emitter
+type Concurrency struct {
+	Workers     int `json:"workers"`
+	MaxInFlight int `json:"max_in_flight"`
+}
+
 type Session struct {
 	UseCookieJar bool `json:"use_cookie_jar"`
 }
@@ -72,12 +94,25 @@ type Basic struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
+
+// OAuth2 client credentials: the token is requested with the client certificate of the TLS config, if any,
+// and refreshed RefreshBefore its expiry, 10s by default
+type OAuth2 struct {
+	TokenURL      string   `json:"token_url"`
+	ClientID      string   `json:"client_id"`
+	ClientSecret  string   `json:"client_secret"`
+	Scopes        []string `json:"scopes"`
+	Audience      string   `json:"audience"`
+	RefreshBefore string   `json:"refresh_before"`
+}
+
 type Authentication struct {
 	Type   AuthType `json:"type"`
 	Basic  Basic    `json:"basic"`
 	Digest Basic    `json:"digest"`
 	Bearer Bearer   `json:"bearer"`
 	APIKey APIKey   `json:"api_key"`
+	OAuth2 OAuth2   `json:"oauth2"`
 }
 
 type Config struct {
@@ -87,4 +122,6 @@ type Config struct {
 	Headers        Headers        `json:"headers"`
 	TLS            TLS            `json:"tls"`
 	Authentication Authentication `json:"authentication"`
+	Retry          Retry          `json:"retry"`
+	Concurrency    Concurrency    `json:"concurrency"`
 }
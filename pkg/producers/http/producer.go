@@ -21,16 +21,28 @@
 package http
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/go-resty/resty/v2"
+	jrctx "github.com/jrnd-io/jr/pkg/ctx"
+	"github.com/jrnd-io/jr/pkg/functions"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
 )
 
 type Producer struct {
@@ -39,6 +51,33 @@ type Producer struct {
 	certificate tls.Certificate
 	client      *resty.Client
 	cookiejar   http.CookieJar
+
+	url      field
+	method   field
+	query    map[string]field
+	headers  map[string]field
+	decoding bool
+
+	requests chan request
+	workers  sync.WaitGroup
+	closing  sync.Once
+	errors   atomic.Int64
+}
+
+// field is a part of the requests that can be a template
+type field struct {
+	static   string
+	template *template.Template
+}
+
+// request is a request rendered for a record
+type request struct {
+	ctx     context.Context
+	method  string
+	url     string
+	query   map[string]string
+	headers map[string]string
+	body    []byte
 }
 
 func (p *Producer) Initialize(configFile string) {
@@ -101,8 +140,7 @@ func (p *Producer) InitializeFromConfig(config Config) {
 		SetTLSClientConfig(&tls.Config{
 			InsecureSkipVerify: p.configuration.TLS.InsecureSkipVerify,
 			Certificates:       certificates,
-		}).
-		SetHeaders(p.configuration.Headers)
+		})
 
 	if p.configuration.Session.UseCookieJar {
 		p.client.SetCookieJar(p.cookiejar)
@@ -124,6 +162,8 @@ func (p *Producer) InitializeFromConfig(config Config) {
 	case DigestAuth:
 		p.client.SetDigestAuth(p.configuration.Authentication.Digest.Username,
 			p.configuration.Authentication.Digest.Password)
+	case OAuth2Auth:
+		p.initializeOAuth2()
 	default:
 
 	}
@@ -132,42 +172,297 @@ func (p *Producer) InitializeFromConfig(config Config) {
 		p.configuration.Endpoint.Method = POST
 	}
 
+	p.initializeTemplates()
+	p.initializeRetry()
+	p.initializeWorkers()
 }
 
-func (p *Producer) Produce(_ context.Context, _ []byte, v []byte, _ any) {
+// initializeOAuth2 sets the token of the client credentials in every request: the token is requested
+// with the TLS config of the requests, for mutual TLS, and refreshed before its expiry
+func (p *Producer) initializeOAuth2() {
+	config := p.configuration.Authentication.OAuth2
+	if config.TokenURL == "" || config.ClientID == "" {
+		log.Fatal().Msg("OAuth2 token_url and client_id are required")
+	}
+
+	refreshBefore := 10 * time.Second
+	if config.RefreshBefore != "" {
+		var err error
+		if refreshBefore, err = time.ParseDuration(config.RefreshBefore); err != nil {
+			log.Fatal().Err(err).Msg("Failed to parse OAuth2 refresh_before")
+		}
+	}
 
+	credentials := clientcredentials.Config{
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		TokenURL:     config.TokenURL,
+		Scopes:       config.Scopes,
+	}
+	if config.Audience != "" {
+		credentials.EndpointParams = url.Values{"audience": {config.Audience}}
+	}
+
+	transport, err := p.client.Transport()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to get transport for OAuth2")
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{
+		Transport: transport,
+		Timeout:   p.configuration.Endpoint.timeout,
+	})
+	tokens := oauth2.ReuseTokenSourceWithExpiry(nil, credentials.TokenSource(ctx), refreshBefore)
+
+	p.client.OnBeforeRequest(func(_ *resty.Client, req *resty.Request) error {
+		token, err := tokens.Token()
+		if err != nil {
+			return fmt.Errorf("failed to get OAuth2 token: %w", err)
+		}
+		req.SetAuthScheme(token.Type())
+		req.SetAuthToken(token.AccessToken)
+		return nil
+	})
+}
+
+// initializeTemplates parses the templates of the requests: the static headers are set once in the client
+func (p *Producer) initializeTemplates() {
 	var err error
+	if p.url, err = p.newField("url", p.configuration.Endpoint.URL); err != nil {
+		log.Fatal().Err(err).Msg("Failed to parse url template")
+	}
+	if p.method, err = p.newField("method", string(p.configuration.Endpoint.Method)); err != nil {
+		log.Fatal().Err(err).Msg("Failed to parse method template")
+	}
 
-	// creating request
-	req := p.client.R().
-		SetBody(v)
+	p.query = make(map[string]field, len(p.configuration.Endpoint.Query))
+	for k, v := range p.configuration.Endpoint.Query {
+		if p.query[k], err = p.newField("query "+k, v); err != nil {
+			log.Fatal().Err(err).Str("query", k).Msg("Failed to parse query template")
+		}
+	}
+
+	p.headers = make(map[string]field)
+	for k, v := range p.configuration.Headers {
+		f, err := p.newField("header "+k, v)
+		if err != nil {
+			log.Fatal().Err(err).Str("header", k).Msg("Failed to parse header template")
+		}
+		if f.template == nil {
+			p.client.SetHeader(k, v)
+		} else {
+			p.headers[k] = f
+		}
+	}
+}
+
+func (p *Producer) newField(name string, text string) (field, error) {
+	if !strings.Contains(text, "{{") {
+		return field{static: text}, nil
+	}
+	t, err := template.New(name).Funcs(functions.FunctionsMap()).Parse(text)
+	if err != nil {
+		return field{}, err
+	}
+	p.decoding = p.decoding || strings.Contains(text, ".Record")
+	return field{template: t}, nil
+}
+
+func (f field) render(data any) (string, error) {
+	if f.template == nil {
+		return f.static, nil
+	}
+	var buffer bytes.Buffer
+	err := f.template.Execute(&buffer, data)
+	return buffer.String(), err
+}
+
+// initializeRetry sets the retries of the requests failing with a 5xx or 429 status code, or a transport error
+func (p *Producer) initializeRetry() {
+	retry := p.configuration.Retry
+	if retry.MaxRetries <= 0 {
+		return
+	}
+
+	initialBackoff, maxBackoff := 100*time.Millisecond, 10*time.Second
+	var err error
+	if retry.InitialBackoff != "" {
+		if initialBackoff, err = time.ParseDuration(retry.InitialBackoff); err != nil {
+			log.Fatal().Err(err).Msg("Failed to parse initial backoff")
+		}
+	}
+	if retry.MaxBackoff != "" {
+		if maxBackoff, err = time.ParseDuration(retry.MaxBackoff); err != nil {
+			log.Fatal().Err(err).Msg("Failed to parse max backoff")
+		}
+	}
+
+	p.client.
+		SetRetryCount(retry.MaxRetries).
+		SetRetryWaitTime(initialBackoff).
+		SetRetryMaxWaitTime(maxBackoff).
+		SetRetryAfter(retryAfter).
+		AddRetryCondition(func(resp *resty.Response, err error) bool {
+			if err != nil {
+				return true
+			}
+			status := resp.StatusCode()
+			return !p.accepted(status) && (status == http.StatusTooManyRequests || status >= 500)
+		})
+}
+
+// retryAfter returns the wait of the Retry-After header, in seconds or as a date, or 0 for the backoff
+func retryAfter(_ *resty.Client, resp *resty.Response) (time.Duration, error) {
+	header := resp.Header().Get("Retry-After")
+	if header == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait, nil
+		}
+	}
+	return 0, nil
+}
+
+func (p *Producer) initializeWorkers() {
+	workers := p.configuration.Concurrency.Workers
+	if workers <= 0 {
+		return
+	}
+	inFlight := p.configuration.Concurrency.MaxInFlight
+	if inFlight < workers {
+		inFlight = workers
+	}
 
-	var resp *resty.Response
+	p.requests = make(chan request, inFlight-workers)
+	p.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer p.workers.Done()
+			for r := range p.requests {
+				p.send(r)
+			}
+		}()
+	}
+}
+
+// Produce renders the request of the record and sends it, or queues it for the workers
+func (p *Producer) Produce(ctx context.Context, key []byte, v []byte, _ any) {
+
+	r, err := p.render(ctx, key, v)
+	if err != nil {
+		p.errors.Add(1)
+		log.Error().Err(err).Msg("Failed to render request")
+		return
+	}
+
+	if p.requests != nil {
+		p.requests <- r
+		return
+	}
+	p.send(r)
+}
+
+func (p *Producer) render(ctx context.Context, key []byte, v []byte) (request, error) {
+	data := struct {
+		K      string
+		V      string
+		Record any
+	}{K: string(key), V: string(v)}
+	if p.decoding {
+		// numbers keep their text, so that large ids are not rendered like 1e+06
+		d := json.NewDecoder(bytes.NewReader(v))
+		d.UseNumber()
+		_ = d.Decode(&data.Record)
+	}
 
-	switch p.configuration.Endpoint.Method {
-	case POST:
-		resp, err = req.Post(p.configuration.Endpoint.URL)
-	case PUT:
-		resp, err = req.Put(p.configuration.Endpoint.URL)
+	r := request{
+		ctx:     ctx,
+		body:    v,
+		query:   make(map[string]string, len(p.query)),
+		headers: make(map[string]string, len(p.headers)),
+	}
+	var err error
+	if r.url, err = p.url.render(data); err != nil {
+		return r, fmt.Errorf("url: %w", err)
+	}
+	if r.method, err = p.method.render(data); err != nil {
+		return r, fmt.Errorf("method: %w", err)
+	}
+	r.method = strings.ToUpper(strings.TrimSpace(r.method))
+	switch Method(r.method) {
+	case GET, POST, PUT, PATCH, DELETE:
 	default:
-		resp, err = req.Post(p.configuration.Endpoint.URL)
+		return r, fmt.Errorf("method %s is not one of GET, POST, PUT, PATCH, DELETE", r.method)
+	}
+
+	for k, f := range p.query {
+		if r.query[k], err = f.render(data); err != nil {
+			return r, fmt.Errorf("query %s: %w", k, err)
+		}
+	}
+	for k, f := range p.headers {
+		if r.headers[k], err = f.render(data); err != nil {
+			return r, fmt.Errorf("header %s: %w", k, err)
+		}
+	}
+	for k, v := range jrctx.Headers(ctx) {
+		r.headers[k] = v
+	}
+	return r, nil
+}
+
+// send sends a request, with its retries: failures are logged and counted
+func (p *Producer) send(r request) {
+
+	req := p.client.R().
+		SetContext(r.ctx).
+		SetQueryParams(r.query).
+		SetHeaders(r.headers)
+	if r.method != string(GET) {
+		req.SetBody(r.body)
 	}
 
+	resp, err := req.Execute(r.method, r.url)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to send request")
+		p.errors.Add(1)
+		log.Error().Err(err).Str("method", r.method).Str("url", r.url).Msg("Failed to send request")
+		return
 	}
 
-	if resp.StatusCode() != p.configuration.ErrorHandling.ExpectStatusCode &&
-		!p.configuration.ErrorHandling.IgnoreStatusCode {
-		log.Fatal().Int("statusCode", resp.StatusCode()).Msg("Unexpected status code")
+	if !p.accepted(resp.StatusCode()) {
+		p.errors.Add(1)
+		log.Error().Int("statusCode", resp.StatusCode()).Str("method", r.method).Str("url", r.url).Msg("Unexpected status code")
 	}
 
 }
 
+func (p *Producer) accepted(status int) bool {
+	return status == p.configuration.ErrorHandling.ExpectStatusCode || p.configuration.ErrorHandling.IgnoreStatusCode
+}
+
+// Close waits for the requests queued for the workers
 func (p *Producer) Close(_ context.Context) error {
+	if p.requests != nil {
+		p.closing.Do(func() { close(p.requests) })
+		p.workers.Wait()
+	}
 	return nil
 }
 
+// Errors returns the number of records whose request could not be rendered or failed
+func (p *Producer) Errors() int64 {
+	return p.errors.Load()
+}
+
+// QueueDepth returns the number of requests waiting for a worker
+func (p *Producer) QueueDepth() int {
+	return len(p.requests)
+}
+
 func (p *Producer) GetClient() *resty.Client {
 	return p.client
 }
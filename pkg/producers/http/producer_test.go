@@ -22,12 +22,26 @@ package http_test
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 	"io"
+	"math/big"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/jarcoal/httpmock"
@@ -257,3 +271,376 @@ func TestProducer(t *testing.T) {
 	}
 
 }
+
+func TestProducerTemplates(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		got = append(got, fmt.Sprintf("%s %s %s %s", req.Method, req.URL.RequestURI(), req.Header.Get("Idempotency-Key"), body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	producer := phttp.Producer{}
+	producer.InitializeFromConfig(phttp.Config{
+		Endpoint: phttp.Endpoint{
+			URL:    server.URL + "/users/{{.Record.id}}",
+			Method: `{{if eq .Record.action "delete"}}DELETE{{else}}patch{{end}}`,
+			Query:  map[string]string{"tenant": "{{.Record.tenant}}", "source": "jr"},
+		},
+		Headers: map[string]string{"Idempotency-Key": "{{.K}}"},
+	})
+
+	producer.Produce(context.TODO(), []byte("k1"), []byte(`{"id":1,"tenant":"a","action":"update"}`), nil)
+	producer.Produce(context.TODO(), []byte("k2"), []byte(`{"id":2,"tenant":"b","action":"delete"}`), nil)
+	producer.Produce(context.TODO(), []byte("k3"), []byte(`{"id":12345678,"tenant":"c","action":"update"}`), nil)
+	_ = producer.Close(context.TODO())
+
+	want := []string{
+		`PATCH /users/1?source=jr&tenant=a k1 {"id":1,"tenant":"a","action":"update"}`,
+		`DELETE /users/2?source=jr&tenant=b k2 {"id":2,"tenant":"b","action":"delete"}`,
+		`PATCH /users/12345678?source=jr&tenant=c k3 {"id":12345678,"tenant":"c","action":"update"}`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch requests (-want +got):\n%s", diff)
+	}
+	if producer.Errors() != 0 {
+		t.Errorf("expected no errors, got %d", producer.Errors())
+	}
+}
+
+func TestProducerRetry(t *testing.T) {
+	testCases := []struct {
+		name       string
+		statuses   []int
+		retryAfter string
+		maxRetries int
+		requests   int
+		errors     int64
+		minElapsed time.Duration
+	}{
+		{name: "test_retry_5xx", statuses: []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK}, maxRetries: 3, requests: 3},
+		{name: "test_retry_after", statuses: []int{http.StatusTooManyRequests, http.StatusOK}, retryAfter: "1", maxRetries: 3, requests: 2, minElapsed: time.Second},
+		{name: "test_retries_exhausted", statuses: []int{http.StatusInternalServerError}, maxRetries: 2, requests: 3, errors: 1},
+		{name: "test_no_retry_4xx", statuses: []int{http.StatusBadRequest}, maxRetries: 3, requests: 1, errors: 1},
+		{name: "test_no_retry", statuses: []int{http.StatusInternalServerError}, requests: 1, errors: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				i := int(requests.Add(1)) - 1
+				status := tc.statuses[min(i, len(tc.statuses)-1)]
+				if status == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", tc.retryAfter)
+				}
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			producer := phttp.Producer{}
+			producer.InitializeFromConfig(phttp.Config{
+				Endpoint: phttp.Endpoint{URL: server.URL},
+				Retry: phttp.Retry{
+					MaxRetries:     tc.maxRetries,
+					InitialBackoff: "1ms",
+					MaxBackoff:     "2s",
+				},
+			})
+
+			start := time.Now()
+			producer.Produce(context.TODO(), []byte("key"), defaultBody, nil)
+			elapsed := time.Since(start)
+
+			if int(requests.Load()) != tc.requests {
+				t.Errorf("expected %d requests, got %d", tc.requests, requests.Load())
+			}
+			if producer.Errors() != tc.errors {
+				t.Errorf("expected %d errors, got %d", tc.errors, producer.Errors())
+			}
+			if elapsed < tc.minElapsed {
+				t.Errorf("expected to wait %s, waited %s", tc.minElapsed, elapsed)
+			}
+		})
+	}
+}
+
+func TestProducerWorkers(t *testing.T) {
+	var inFlight, maxInFlight, requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := inFlight.Add(1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		<-release
+		inFlight.Add(-1)
+		requests.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	producer := phttp.Producer{}
+	producer.InitializeFromConfig(phttp.Config{
+		Endpoint:    phttp.Endpoint{URL: server.URL},
+		Concurrency: phttp.Concurrency{Workers: 3, MaxInFlight: 5},
+	})
+
+	var produced sync.WaitGroup
+	produced.Add(1)
+	go func() {
+		defer produced.Done()
+		for i := 0; i < 10; i++ {
+			producer.Produce(context.TODO(), []byte("key"), defaultBody, nil)
+		}
+	}()
+
+	// three requests are sent and two are queued: the next records wait for a worker
+	deadline := time.Now().Add(5 * time.Second)
+	for (inFlight.Load() < 3 || producer.QueueDepth() < 2) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if inFlight.Load() != 3 || producer.QueueDepth() != 2 {
+		t.Errorf("expected 3 requests in flight and 2 queued, got %d and %d", inFlight.Load(), producer.QueueDepth())
+	}
+
+	close(release)
+	produced.Wait()
+	_ = producer.Close(context.TODO())
+
+	if requests.Load() != 10 {
+		t.Errorf("expected 10 requests, got %d", requests.Load())
+	}
+	if maxInFlight.Load() != 3 {
+		t.Errorf("expected 3 concurrent requests, got %d", maxInFlight.Load())
+	}
+}
+
+func TestProducerErrors(t *testing.T) {
+	producer := phttp.Producer{}
+	producer.InitializeFromConfig(phttp.Config{
+		Endpoint: phttp.Endpoint{URL: "http://127.0.0.1:1", Method: "{{.K}}"},
+	})
+
+	// an invalid method and a refused connection: the run goes on
+	producer.Produce(context.TODO(), []byte("OPTIONS"), defaultBody, nil)
+	producer.Produce(context.TODO(), []byte("POST"), defaultBody, nil)
+
+	if producer.Errors() != 2 {
+		t.Errorf("expected 2 errors, got %d", producer.Errors())
+	}
+}
+
+// tokenServer is an OAuth2 token endpoint for client credentials, issuing token-1, token-2, ...
+type tokenServer struct {
+	t         *testing.T
+	expiresIn int
+	status    int
+	requests  atomic.Int32
+	form      sync.Map
+}
+
+func (s *tokenServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	n := s.requests.Add(1)
+	if err := req.ParseForm(); err != nil {
+		s.t.Errorf("cannot parse token request: %v", err)
+	}
+	id, secret, ok := req.BasicAuth()
+	if !ok {
+		id, secret = req.PostForm.Get("client_id"), req.PostForm.Get("client_secret")
+	}
+	s.form.Store("client", id+":"+secret)
+	for _, k := range []string{"grant_type", "scope", "audience"} {
+		s.form.Store(k, req.PostForm.Get(k))
+	}
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":%d}`, n, s.expiresIn)
+}
+
+func (s *tokenServer) value(k string) string {
+	v, _ := s.form.Load(k)
+	return fmt.Sprint(v)
+}
+
+func TestProducerOAuth2(t *testing.T) {
+	testCases := []struct {
+		name          string
+		expiresIn     int
+		refreshBefore string
+		status        int
+		tokens        []string
+		tokenRequests int32
+		errors        int64
+	}{
+		{name: "test_token_reused", expiresIn: 3600, tokens: []string{"Bearer token-1", "Bearer token-1", "Bearer token-1"}, tokenRequests: 1},
+		{name: "test_token_refreshed_before_expiry", expiresIn: 5, tokens: []string{"Bearer token-1", "Bearer token-2", "Bearer token-3"}, tokenRequests: 3},
+		{name: "test_token_refresh_before", expiresIn: 5, refreshBefore: "1s", tokens: []string{"Bearer token-1", "Bearer token-1", "Bearer token-1"}, tokenRequests: 1},
+		// the credentials are sent in the header, then in the body after a failure
+		{name: "test_token_error", status: http.StatusUnauthorized, tokenRequests: 6, errors: 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := &tokenServer{t: t, expiresIn: tc.expiresIn, status: tc.status}
+			tokenServer := httptest.NewServer(ts)
+			defer tokenServer.Close()
+
+			var tokens []string
+			api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				tokens = append(tokens, req.Header.Get("Authorization"))
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer api.Close()
+
+			producer := phttp.Producer{}
+			producer.InitializeFromConfig(phttp.Config{
+				Endpoint: phttp.Endpoint{URL: api.URL},
+				Authentication: phttp.Authentication{
+					Type: phttp.OAuth2Auth,
+					OAuth2: phttp.OAuth2{
+						TokenURL:      tokenServer.URL,
+						ClientID:      "jr",
+						ClientSecret:  "secret",
+						Scopes:        []string{"orders:write", "users:write"},
+						Audience:      "https://api.jr.io",
+						RefreshBefore: tc.refreshBefore,
+					},
+				},
+			})
+
+			for i := 0; i < 3; i++ {
+				producer.Produce(context.TODO(), []byte("key"), defaultBody, nil)
+			}
+
+			if diff := cmp.Diff(tc.tokens, tokens); diff != "" {
+				t.Errorf("mismatch tokens (-want +got):\n%s", diff)
+			}
+			if ts.requests.Load() != tc.tokenRequests {
+				t.Errorf("expected %d token requests, got %d", tc.tokenRequests, ts.requests.Load())
+			}
+			if producer.Errors() != tc.errors {
+				t.Errorf("expected %d errors, got %d", tc.errors, producer.Errors())
+			}
+
+			want := map[string]string{
+				"client":     "jr:secret",
+				"grant_type": "client_credentials",
+				"scope":      "orders:write users:write",
+				"audience":   "https://api.jr.io",
+			}
+			for k, v := range want {
+				if ts.value(k) != v {
+					t.Errorf("expected %s %q in token request, got %q", k, v, ts.value(k))
+				}
+			}
+		})
+	}
+}
+
+func TestProducerOAuth2MTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, clientCert := writeClientCert(t, dir)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	// the token endpoint and the API both require the client certificate
+	newTLSServer := func(h http.Handler) *httptest.Server {
+		s := httptest.NewUnstartedServer(h)
+		s.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+		s.StartTLS()
+		return s
+	}
+	ts := &tokenServer{t: t, expiresIn: 3600}
+	tokenServer := newTLSServer(ts)
+	defer tokenServer.Close()
+
+	var got []string
+	api := newTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = append(got, req.TLS.PeerCertificates[0].Subject.CommonName+" "+req.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer api.Close()
+
+	// both servers share the httptest certificate
+	rootCAFile := filepath.Join(dir, "ca.pem")
+	writePEM(t, rootCAFile, "CERTIFICATE", api.Certificate().Raw)
+
+	producer := phttp.Producer{}
+	producer.InitializeFromConfig(phttp.Config{
+		Endpoint: phttp.Endpoint{URL: api.URL},
+		TLS: phttp.TLS{
+			CertFile:   certFile,
+			KeyFile:    keyFile,
+			RootCAFile: rootCAFile,
+		},
+		Authentication: phttp.Authentication{
+			Type: phttp.OAuth2Auth,
+			OAuth2: phttp.OAuth2{
+				TokenURL:     tokenServer.URL,
+				ClientID:     "jr",
+				ClientSecret: "secret",
+			},
+		},
+	})
+	producer.Produce(context.TODO(), []byte("key"), defaultBody, nil)
+	producer.Produce(context.TODO(), []byte("key"), defaultBody, nil)
+
+	if diff := cmp.Diff([]string{"jr-client Bearer token-1", "jr-client Bearer token-1"}, got); diff != "" {
+		t.Errorf("mismatch requests (-want +got):\n%s", diff)
+	}
+	if producer.Errors() != 0 {
+		t.Errorf("expected no errors, got %d", producer.Errors())
+	}
+}
+
+// writeClientCert writes a self-signed client certificate and its key
+func writeClientCert(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "jr-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDer)
+	return certFile, keyFile, cert
+}
+
+func writePEM(t *testing.T, file string, kind string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -32,6 +32,8 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
@@ -44,6 +46,7 @@ import (
 	"github.com/confluentinc/confluent-kafka-go/v2/schemaregistry/serde"
 	"github.com/confluentinc/confluent-kafka-go/v2/schemaregistry/serde/avrov2"
 	"github.com/confluentinc/confluent-kafka-go/v2/schemaregistry/serde/jsonschema"
+	jrctx "github.com/jrnd-io/jr/pkg/ctx"
 	"github.com/jrnd-io/jr/pkg/types"
 
 	"github.com/rs/zerolog/log"
@@ -58,6 +61,8 @@ type Manager struct {
 	Serializer     string
 	TemplateType   string
 	fleEnabled     bool
+	listen         sync.Once
+	errors         atomic.Int64
 }
 
 func (k *Manager) Initialize(configFile string) {
@@ -187,9 +192,11 @@ func (k *Manager) Close(_ context.Context) error {
 	return nil
 }
 
-func (k *Manager) Produce(_ context.Context, key []byte, data []byte, _ any) {
+func (k *Manager) Produce(ctx context.Context, key []byte, data []byte, _ any) {
 
-	go listenToEventsFrom(k.producer, k.Topic)
+	k.listen.Do(func() {
+		go k.listenToEvents()
+	})
 
 	var ser serde.Serializer
 
@@ -237,11 +244,16 @@ func (k *Manager) Produce(_ context.Context, key []byte, data []byte, _ any) {
 		key = nil
 	}
 
+	var headers []kafka.Header
+	for hk, hv := range jrctx.Headers(ctx) {
+		headers = append(headers, kafka.Header{Key: hk, Value: []byte(hv)})
+	}
+
 	err := k.producer.Produce(&kafka.Message{
 		TopicPartition: kafka.TopicPartition{Topic: &k.Topic, Partition: kafka.PartitionAny},
 		Key:            key,
 		Value:          data,
-		// Headers:        []kafka.Header{{Key: "myTestHeader", Value: []byte("header values are binary")}},
+		Headers:        headers,
 	}, nil)
 
 	if err != nil {
@@ -251,11 +263,22 @@ func (k *Manager) Produce(_ context.Context, key []byte, data []byte, _ any) {
 			// time.Sleep(time.Second)
 			// continue
 		}
+		k.errors.Add(1)
 		log.Error().Err(err).Msg("Failed to produce message")
 	}
 
 }
 
+// Errors returns the number of messages not produced or not delivered
+func (k *Manager) Errors() int64 {
+	return k.errors.Load()
+}
+
+// QueueDepth returns the number of messages waiting to be delivered
+func (k *Manager) QueueDepth() int {
+	return k.producer.Len()
+}
+
 func (k *Manager) CreateTopic(ctx context.Context, topic string) {
 	k.CreateTopicFull(ctx, topic, 6, 3)
 }
@@ -298,13 +321,14 @@ func (k *Manager) CreateTopicFull(ctx context.Context, topic string, partitions
 
 }
 
-func listenToEventsFrom(k *kafka.Producer, topic string) {
+func (k *Manager) listenToEvents() {
 
-	for e := range k.Events() {
+	for e := range k.producer.Events() {
 		switch ev := e.(type) {
 		case *kafka.Message:
 			m := ev
 			if m.TopicPartition.Error != nil {
+				k.errors.Add(1)
 				log.Error().Err(m.TopicPartition.Error).Msg("Delivery failed")
 			} else {
 				// fmt.Printf("Delivered message to topic %s [%d] at offset %v\n", *m.TopicPartition.Topic, m.TopicPartition.Partition, m.TopicPartition.Offset)
@@ -324,7 +348,7 @@ func listenToEventsFrom(k *kafka.Producer, topic string) {
 			if b > 0 {
 				log.Info().
 					Str("bytes", txbytes).
-					Str("topic", topic).
+					Str("topic", k.Topic).
 					Msg("Bytes produced to topic")
 			}
 		default:
@@ -0,0 +1,54 @@
+//Copyright © 2022 Vincenzo Marchese <vincenzo.marchese@gmail.com>
+//
+//Permission is hereby granted, free of charge, to any person obtaining a copy
+//of this software and associated documentation files (the "Software"), to deal
+//in the Software without restriction, including without limitation the rights
+//to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//copies of the Software, and to permit persons to whom the Software is
+//furnished to do so, subject to the following conditions:
+//
+//The above copyright notice and this permission notice shall be included in
+//all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+//THE SOFTWARE.
+
+package otlp
+
+type Signal string
+
+const (
+	Logs    Signal = "logs"
+	Metrics Signal = "metrics"
+	Traces  Signal = "traces"
+
+	ProtocolHTTP = "http"
+	ProtocolGRPC = "grpc"
+
+	DefaultHTTPEndpoint = "http://localhost:4318"
+	DefaultGRPCEndpoint = "localhost:4317"
+	DefaultServiceName  = "jr"
+)
+
+type Config struct {
+	// Endpoint is the URL of the collector for http, like http://localhost:4318, or its address for grpc, like localhost:4317
+	Endpoint string `json:"endpoint"`
+	// Protocol is http, sending protobuf to /v1/logs, /v1/metrics or /v1/traces, or grpc
+	Protocol string `json:"protocol"`
+	// Signal is the kind of telemetry of the records: logs, metrics or traces
+	Signal Signal `json:"signal"`
+	// Insecure disables TLS for grpc
+	Insecure bool              `json:"insecure"`
+	Headers  map[string]string `json:"headers"`
+	Timeout  string            `json:"timeout"`
+	// BatchSize is the number of records of every export request
+	BatchSize   int    `json:"batch_size"`
+	ServiceName string `json:"service_name"`
+	// Resource has the resource attributes of all the records, with service.name
+	Resource map[string]any `json:"resource"`
+}
@@ -0,0 +1,242 @@
+//Copyright © 2022 Vincenzo Marchese <vincenzo.marchese@gmail.com>
+//
+//Permission is hereby granted, free of charge, to any person obtaining a copy
+//of this software and associated documentation files (the "Software"), to deal
+//in the Software without restriction, including without limitation the rights
+//to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//copies of the Software, and to permit persons to whom the Software is
+//furnished to do so, subject to the following conditions:
+//
+//The above copyright notice and this permission notice shall be included in
+//all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+//THE SOFTWARE.
+
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+type Producer struct {
+	configuration Config
+	timeout       time.Duration
+	start         time.Time
+
+	client *http.Client
+	conn   *grpc.ClientConn
+
+	lock    sync.Mutex
+	pending *batch
+	errors  atomic.Int64
+}
+
+func (p *Producer) Initialize(configFile string) {
+	cfgBytes, err := os.ReadFile(configFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to read config file")
+	}
+
+	config := Config{}
+	if err := json.Unmarshal(cfgBytes, &config); err != nil {
+		log.Fatal().Err(err).Msg("Failed to unmarshal config")
+	}
+
+	if err := p.InitializeFromConfig(config); err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize otlp producer")
+	}
+}
+
+func (p *Producer) InitializeFromConfig(config Config) error {
+	var err error
+	p.configuration = config
+	p.start = time.Now()
+
+	switch p.configuration.Signal {
+	case "":
+		p.configuration.Signal = Logs
+	case Logs, Metrics, Traces:
+	default:
+		return fmt.Errorf("signal %s is not one of logs, metrics, traces", p.configuration.Signal)
+	}
+
+	if p.configuration.BatchSize <= 0 {
+		p.configuration.BatchSize = 1
+	}
+	if p.configuration.ServiceName == "" {
+		p.configuration.ServiceName = DefaultServiceName
+	}
+	resource := map[string]any{"service.name": p.configuration.ServiceName}
+	for k, v := range p.configuration.Resource {
+		resource[k] = v
+	}
+	p.configuration.Resource = resource
+
+	p.timeout = 10 * time.Second
+	if p.configuration.Timeout != "" {
+		if p.timeout, err = time.ParseDuration(p.configuration.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+
+	switch p.configuration.Protocol {
+	case "", ProtocolHTTP:
+		p.configuration.Protocol = ProtocolHTTP
+		if p.configuration.Endpoint == "" {
+			p.configuration.Endpoint = DefaultHTTPEndpoint
+		}
+		p.configuration.Endpoint = strings.TrimSuffix(p.configuration.Endpoint, "/")
+		p.client = &http.Client{Timeout: p.timeout}
+	case ProtocolGRPC:
+		if p.configuration.Endpoint == "" {
+			p.configuration.Endpoint = DefaultGRPCEndpoint
+		}
+		creds := credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+		if p.configuration.Insecure {
+			creds = insecure.NewCredentials()
+		}
+		if p.conn, err = grpc.NewClient(p.configuration.Endpoint, grpc.WithTransportCredentials(creds)); err != nil {
+			return fmt.Errorf("failed to create grpc client: %w", err)
+		}
+	default:
+		return fmt.Errorf("protocol %s is not one of http, grpc", p.configuration.Protocol)
+	}
+
+	p.pending = newBatch(p.configuration.Signal, p.configuration.Resource, p.start)
+	return nil
+}
+
+// Produce maps the record onto a log, a metric or spans, and exports them when the batch is full
+func (p *Producer) Produce(ctx context.Context, _ []byte, v []byte, _ any) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if err := p.pending.add(v, time.Now()); err != nil {
+		p.errors.Add(1)
+		log.Error().Err(err).Str("signal", string(p.configuration.Signal)).Msg("Failed to map record onto OTLP")
+		return
+	}
+	if p.pending.size >= p.configuration.BatchSize {
+		p.flush(ctx)
+	}
+}
+
+// flush exports the pending batch; it must be called holding the lock
+func (p *Producer) flush(ctx context.Context) {
+	if p.pending.size == 0 {
+		return
+	}
+	b := p.pending
+	p.pending = newBatch(p.configuration.Signal, p.configuration.Resource, p.start)
+
+	if err := p.export(ctx, b.request()); err != nil {
+		p.errors.Add(int64(b.size))
+		log.Error().Err(err).Str("signal", string(p.configuration.Signal)).Int("records", b.size).Msg("Failed to export to OTLP collector")
+	}
+}
+
+func (p *Producer) export(ctx context.Context, req proto.Message) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	if p.conn != nil {
+		return p.exportGRPC(ctx, req)
+	}
+	return p.exportHTTP(ctx, req)
+}
+
+func (p *Producer) exportHTTP(ctx context.Context, req proto.Message) error {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	url := p.configuration.Endpoint + "/v1/" + string(p.configuration.Signal)
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range p.configuration.Headers {
+		r.Header.Set(k, v)
+	}
+
+	resp, err := p.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector answered %s", resp.Status)
+	}
+	return nil
+}
+
+func (p *Producer) exportGRPC(ctx context.Context, req proto.Message) error {
+	if len(p.configuration.Headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(p.configuration.Headers))
+	}
+
+	var err error
+	switch req := req.(type) {
+	case *collogspb.ExportLogsServiceRequest:
+		_, err = collogspb.NewLogsServiceClient(p.conn).Export(ctx, req)
+	case *colmetricspb.ExportMetricsServiceRequest:
+		_, err = colmetricspb.NewMetricsServiceClient(p.conn).Export(ctx, req)
+	case *coltracepb.ExportTraceServiceRequest:
+		_, err = coltracepb.NewTraceServiceClient(p.conn).Export(ctx, req)
+	}
+	return err
+}
+
+// Close exports the records still pending and closes the connection to the collector
+func (p *Producer) Close(ctx context.Context) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.flush(ctx)
+	if p.conn != nil {
+		return p.conn.Close()
+	}
+	return nil
+}
+
+// Errors returns the number of records that could not be mapped or exported
+func (p *Producer) Errors() int64 {
+	return p.errors.Load()
+}
+
+// QueueDepth returns the number of records waiting for a full batch
+func (p *Producer) QueueDepth() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.pending.size
+}
@@ -0,0 +1,335 @@
+//Copyright © 2022 Vincenzo Marchese <vincenzo.marchese@gmail.com>
+//
+//Permission is hereby granted, free of charge, to any person obtaining a copy
+//of this software and associated documentation files (the "Software"), to deal
+//in the Software without restriction, including without limitation the rights
+//to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//copies of the Software, and to permit persons to whom the Software is
+//furnished to do so, subject to the following conditions:
+//
+//The above copyright notice and this permission notice shall be included in
+//all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+//THE SOFTWARE.
+
+package otlp_test
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/jrnd-io/jr/pkg/producers/otlp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// receiver is an in-process OTLP collector, over HTTP and gRPC
+type receiver struct {
+	collogspb.UnimplementedLogsServiceServer
+	colmetricspb.UnimplementedMetricsServiceServer
+	coltracepb.UnimplementedTraceServiceServer
+
+	lock    sync.Mutex
+	logs    []*collogspb.ExportLogsServiceRequest
+	metrics []*colmetricspb.ExportMetricsServiceRequest
+	traces  []*coltracepb.ExportTraceServiceRequest
+	headers []string
+}
+
+func (r *receiver) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	md, _ := metadata.FromIncomingContext(ctx)
+	r.headers = append(r.headers, md.Get("x-api-key")...)
+	r.logs = append(r.logs, req)
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+type metricsReceiver struct{ *receiver }
+
+func (r metricsReceiver) Export(_ context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.metrics = append(r.metrics, req)
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+type traceReceiver struct{ *receiver }
+
+func (r traceReceiver) Export(_ context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.traces = append(r.traces, req)
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil || req.Header.Get("Content-Type") != "application/x-protobuf" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.headers = append(r.headers, req.Header.Get("X-Api-Key"))
+
+	switch req.URL.Path {
+	case "/v1/logs":
+		m := &collogspb.ExportLogsServiceRequest{}
+		err = proto.Unmarshal(body, m)
+		r.logs = append(r.logs, m)
+	case "/v1/metrics":
+		m := &colmetricspb.ExportMetricsServiceRequest{}
+		err = proto.Unmarshal(body, m)
+		r.metrics = append(r.metrics, m)
+	case "/v1/traces":
+		m := &coltracepb.ExportTraceServiceRequest{}
+		err = proto.Unmarshal(body, m)
+		r.traces = append(r.traces, m)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func newHTTPProducer(t *testing.T, r http.Handler, config otlp.Config) *otlp.Producer {
+	t.Helper()
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	config.Endpoint = server.URL
+	p := &otlp.Producer{}
+	require.NoError(t, p.InitializeFromConfig(config))
+	return p
+}
+
+func produce(t *testing.T, p *otlp.Producer, records ...string) {
+	t.Helper()
+	for _, r := range records {
+		p.Produce(context.Background(), nil, []byte(r), nil)
+	}
+	require.NoError(t, p.Close(context.Background()))
+}
+
+func attributes(kvs []*commonpb.KeyValue) map[string]any {
+	m := map[string]any{}
+	for _, kv := range kvs {
+		switch v := kv.Value.Value.(type) {
+		case *commonpb.AnyValue_StringValue:
+			m[kv.Key] = v.StringValue
+		case *commonpb.AnyValue_IntValue:
+			m[kv.Key] = v.IntValue
+		case *commonpb.AnyValue_DoubleValue:
+			m[kv.Key] = v.DoubleValue
+		case *commonpb.AnyValue_BoolValue:
+			m[kv.Key] = v.BoolValue
+		default:
+			m[kv.Key] = kv.Value
+		}
+	}
+	return m
+}
+
+func TestLogs(t *testing.T) {
+	r := &receiver{}
+	p := newHTTPProducer(t, r, otlp.Config{
+		Signal:    otlp.Logs,
+		BatchSize: 2,
+		Headers:   map[string]string{"x-api-key": "secret"},
+		Resource:  map[string]any{"deployment.environment": "test"},
+	})
+	produce(t, p,
+		`{"timestamp":"2024-05-01T10:00:00Z","severity":"warn","body":"disk almost full","trace_id":"0102030405060708090a0b0c0d0e0f10","host":{"name":"db-1"},"used":0.93}`,
+		`{"timestamp":1714557600000,"message":"login","user":"alice","resource":{"service.name":"auth"}}`,
+		`not json`,
+	)
+
+	require.Len(t, r.logs, 2)
+	assert.Equal(t, []string{"secret", "secret"}, r.headers)
+	assert.Equal(t, 0, p.QueueDepth())
+	assert.Equal(t, int64(0), p.Errors())
+
+	// the second record has its own resource: two resources in the first request
+	first := r.logs[0].ResourceLogs
+	require.Len(t, first, 2)
+	assert.Equal(t, map[string]any{"service.name": "jr", "deployment.environment": "test"}, attributes(first[0].Resource.Attributes))
+	assert.Equal(t, map[string]any{"service.name": "auth", "deployment.environment": "test"}, attributes(first[1].Resource.Attributes))
+
+	warn := first[0].ScopeLogs[0].LogRecords[0]
+	assert.Equal(t, "warn", warn.SeverityText)
+	assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_WARN, warn.SeverityNumber)
+	assert.Equal(t, "disk almost full", warn.Body.GetStringValue())
+	assert.Equal(t, uint64(1714557600000000000), warn.TimeUnixNano)
+	assert.Equal(t, "0102030405060708090a0b0c0d0e0f10", hex.EncodeToString(warn.TraceId))
+	assert.Equal(t, map[string]any{"host.name": "db-1", "used": 0.93}, attributes(warn.Attributes))
+
+	login := first[1].ScopeLogs[0].LogRecords[0]
+	assert.Equal(t, uint64(1714557600000000000), login.TimeUnixNano)
+	assert.Equal(t, map[string]any{"message": "login", "user": "alice"}, attributes(login.Attributes))
+	assert.Contains(t, login.Body.GetStringValue(), `"user":"alice"`)
+
+	// records that are not JSON are the body of the log
+	raw := r.logs[1].ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	assert.Equal(t, "not json", raw.Body.GetStringValue())
+}
+
+func TestMetrics(t *testing.T) {
+	r := &receiver{}
+	p := newHTTPProducer(t, r, otlp.Config{Signal: otlp.Metrics, BatchSize: 10})
+	produce(t, p,
+		`{"name":"cpu.utilization","unit":"1","value":0.42,"cpu":1}`,
+		`{"name":"http.requests","type":"sum","value":7,"temporality":"delta","attributes":{"http.route":"/orders"}}`,
+		`{"name":"http.duration","type":"histogram","unit":"ms","values":[3,7,120,4000],"http.method":"GET"}`,
+		`{"name":"queue.wait","type":"histogram","bounds":[1,10],"bucket_counts":[2,3,1],"sum":35.5}`,
+		`{"value":1}`,
+		`{"name":"bad","type":"summary","value":1}`,
+	)
+
+	assert.Equal(t, int64(2), p.Errors())
+	require.Len(t, r.metrics, 1)
+	metrics := r.metrics[0].ResourceMetrics[0].ScopeMetrics[0].Metrics
+	require.Len(t, metrics, 4)
+
+	gauge := metrics[0].GetGauge().DataPoints[0]
+	assert.Equal(t, "1", metrics[0].Unit)
+	assert.Equal(t, 0.42, gauge.GetAsDouble())
+	assert.Equal(t, map[string]any{"cpu": int64(1)}, attributes(gauge.Attributes))
+
+	sum := metrics[1].GetSum()
+	assert.True(t, sum.IsMonotonic)
+	assert.Equal(t, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, sum.AggregationTemporality)
+	assert.Equal(t, int64(7), sum.DataPoints[0].GetAsInt())
+	assert.Equal(t, map[string]any{"http.route": "/orders"}, attributes(sum.DataPoints[0].Attributes))
+
+	observed := metrics[2].GetHistogram().DataPoints[0]
+	assert.Equal(t, uint64(4), observed.Count)
+	assert.Equal(t, 4130.0, observed.GetSum())
+	assert.Equal(t, 3.0, observed.GetMin())
+	assert.Equal(t, 4000.0, observed.GetMax())
+	assert.Equal(t, []uint64{0, 1, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0}, observed.BucketCounts)
+	assert.Equal(t, map[string]any{"http.method": "GET"}, attributes(observed.Attributes))
+
+	counted := metrics[3].GetHistogram().DataPoints[0]
+	assert.Equal(t, []float64{1, 10}, counted.ExplicitBounds)
+	assert.Equal(t, []uint64{2, 3, 1}, counted.BucketCounts)
+	assert.Equal(t, uint64(6), counted.Count)
+	assert.Equal(t, 35.5, counted.GetSum())
+}
+
+func TestTraces(t *testing.T) {
+	r := &receiver{}
+	p := newHTTPProducer(t, r, otlp.Config{Signal: otlp.Traces})
+	produce(t, p, `{
+		"name": "GET /orders", "kind": "server", "start": "2024-05-01T10:00:00Z", "duration": "200ms", "status": "error",
+		"resource": {"service.name": "frontend"},
+		"children": [
+			{"name": "SELECT orders", "kind": "client", "duration": 30, "resource": {"service.name": "db"}},
+			{"name": "render", "events": [{"name": "cache miss"}], "children": [{"name": "template"}]}
+		]
+	}`)
+
+	require.Len(t, r.traces, 1)
+	resources := r.traces[0].ResourceSpans
+	require.Len(t, resources, 2)
+	assert.Equal(t, "frontend", attributes(resources[0].Resource.Attributes)["service.name"])
+	assert.Equal(t, "db", attributes(resources[1].Resource.Attributes)["service.name"])
+
+	spans := map[string]*tracepb.Span{}
+	for _, rs := range resources {
+		for _, s := range rs.ScopeSpans[0].Spans {
+			spans[s.Name] = s
+		}
+	}
+	require.Len(t, spans, 4)
+
+	root := spans["GET /orders"]
+	assert.Len(t, root.TraceId, 16)
+	assert.Len(t, root.SpanId, 8)
+	assert.Empty(t, root.ParentSpanId)
+	assert.Equal(t, tracepb.Span_SPAN_KIND_SERVER, root.Kind)
+	assert.Equal(t, tracepb.Status_STATUS_CODE_ERROR, root.Status.Code)
+	assert.Equal(t, uint64(200_000_000), root.EndTimeUnixNano-root.StartTimeUnixNano)
+
+	db := spans["SELECT orders"]
+	assert.Equal(t, root.TraceId, db.TraceId)
+	assert.Equal(t, root.SpanId, db.ParentSpanId)
+	assert.Equal(t, root.StartTimeUnixNano, db.StartTimeUnixNano)
+	assert.Equal(t, uint64(30_000_000), db.EndTimeUnixNano-db.StartTimeUnixNano)
+
+	render := spans["render"]
+	assert.Equal(t, root.EndTimeUnixNano, render.EndTimeUnixNano)
+	assert.Equal(t, "cache miss", render.Events[0].Name)
+	assert.Equal(t, render.SpanId, spans["template"].ParentSpanId)
+	assert.Equal(t, root.TraceId, spans["template"].TraceId)
+}
+
+func TestGRPC(t *testing.T) {
+	r := &receiver{}
+	server := grpc.NewServer()
+	collogspb.RegisterLogsServiceServer(server, r)
+	colmetricspb.RegisterMetricsServiceServer(server, metricsReceiver{r})
+	coltracepb.RegisterTraceServiceServer(server, traceReceiver{r})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	for _, signal := range []otlp.Signal{otlp.Logs, otlp.Metrics, otlp.Traces} {
+		p := &otlp.Producer{}
+		require.NoError(t, p.InitializeFromConfig(otlp.Config{
+			Endpoint: listener.Addr().String(),
+			Protocol: otlp.ProtocolGRPC,
+			Insecure: true,
+			Signal:   signal,
+			Headers:  map[string]string{"x-api-key": "secret"},
+		}))
+		produce(t, p, `{"name":"jr","value":1}`)
+		assert.Equal(t, int64(0), p.Errors(), signal)
+	}
+
+	assert.Len(t, r.logs, 1)
+	assert.Len(t, r.metrics, 1)
+	assert.Len(t, r.traces, 1)
+	assert.Equal(t, []string{"secret"}, r.headers)
+}
+
+func TestExportErrors(t *testing.T) {
+	p := newHTTPProducer(t, http.NotFoundHandler(), otlp.Config{BatchSize: 2})
+	produce(t, p, `{"body":"a"}`, `{"body":"b"}`, `{"body":"c"}`)
+	assert.Equal(t, int64(3), p.Errors())
+}
+
+func TestConfig(t *testing.T) {
+	for _, c := range []otlp.Config{
+		{Signal: "profiles"},
+		{Protocol: "thrift"},
+		{Timeout: "soon"},
+	} {
+		assert.Error(t, (&otlp.Producer{}).InitializeFromConfig(c))
+	}
+}
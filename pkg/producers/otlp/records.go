@@ -0,0 +1,624 @@
+//Copyright © 2022 Vincenzo Marchese <vincenzo.marchese@gmail.com>
+//
+//Permission is hereby granted, free of charge, to any person obtaining a copy
+//of this software and associated documentation files (the "Software"), to deal
+//in the Software without restriction, including without limitation the rights
+//to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//copies of the Software, and to permit persons to whom the Software is
+//furnished to do so, subject to the following conditions:
+//
+//The above copyright notice and this permission notice shall be included in
+//all copies or substantial portions of the Software.
+//
+//THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+//THE SOFTWARE.
+
+package otlp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// the fields of the records with a meaning: the other fields are attributes
+var (
+	logFields    = fields("timestamp", "observed_timestamp", "severity", "severity_number", "body", "trace_id", "span_id", "attributes", "resource")
+	metricFields = fields("name", "description", "unit", "type", "value", "monotonic", "temporality", "timestamp", "start_timestamp",
+		"count", "sum", "min", "max", "bounds", "bucket_counts", "values", "attributes", "resource")
+	spanFields = fields("name", "trace_id", "span_id", "parent_span_id", "kind", "start", "end", "duration", "status", "status_message",
+		"events", "children", "attributes", "resource")
+	eventFields = fields("name", "timestamp", "attributes")
+)
+
+// defaultBounds are the default explicit bounds of the OpenTelemetry histograms
+var defaultBounds = []float64{0, 5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000}
+
+var severities = map[string]logspb.SeverityNumber{
+	"TRACE": logspb.SeverityNumber_SEVERITY_NUMBER_TRACE,
+	"DEBUG": logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG,
+	"INFO":  logspb.SeverityNumber_SEVERITY_NUMBER_INFO,
+	"WARN":  logspb.SeverityNumber_SEVERITY_NUMBER_WARN,
+	"ERROR": logspb.SeverityNumber_SEVERITY_NUMBER_ERROR,
+	"FATAL": logspb.SeverityNumber_SEVERITY_NUMBER_FATAL,
+}
+
+var spanKinds = map[string]tracepb.Span_SpanKind{
+	"internal": tracepb.Span_SPAN_KIND_INTERNAL,
+	"server":   tracepb.Span_SPAN_KIND_SERVER,
+	"client":   tracepb.Span_SPAN_KIND_CLIENT,
+	"producer": tracepb.Span_SPAN_KIND_PRODUCER,
+	"consumer": tracepb.Span_SPAN_KIND_CONSUMER,
+}
+
+var statusCodes = map[string]tracepb.Status_StatusCode{
+	"unset": tracepb.Status_STATUS_CODE_UNSET,
+	"ok":    tracepb.Status_STATUS_CODE_OK,
+	"error": tracepb.Status_STATUS_CODE_ERROR,
+}
+
+type record map[string]any
+
+// batch groups the telemetry of the records by resource, for an export request
+type batch struct {
+	signal Signal
+	base   map[string]any
+	start  time.Time
+	groups []*resourceGroup
+	byKey  map[string]*resourceGroup
+	size   int
+	scope  *commonpb.InstrumentationScope
+}
+
+type resourceGroup struct {
+	resource *resourcepb.Resource
+	logs     []*logspb.LogRecord
+	metrics  []*metricspb.Metric
+	spans    []*tracepb.Span
+}
+
+func newBatch(signal Signal, resource map[string]any, start time.Time) *batch {
+	return &batch{
+		signal: signal,
+		base:   resource,
+		start:  start,
+		byKey:  map[string]*resourceGroup{},
+		scope:  &commonpb.InstrumentationScope{Name: "jr"},
+	}
+}
+
+// add maps a rendered record onto the telemetry of the signal of the batch
+func (b *batch) add(value []byte, now time.Time) error {
+	r, err := decodeRecord(value)
+	if err != nil && b.signal != Logs {
+		return err
+	}
+	switch b.signal {
+	case Logs:
+		err = b.addLog(r, value, now)
+	case Metrics:
+		err = b.addMetric(r, now)
+	case Traces:
+		err = b.addSpan(r, nil, nil, now)
+	}
+	if err == nil {
+		b.size++
+	}
+	return err
+}
+
+func (b *batch) addLog(r record, value []byte, now time.Time) error {
+	g, err := b.group(r, nil)
+	if err != nil {
+		return err
+	}
+	l := &logspb.LogRecord{
+		Attributes: attributes(r, logFields),
+	}
+	if l.TimeUnixNano, err = timestamp(r["timestamp"], now); err != nil {
+		return err
+	}
+	if l.ObservedTimeUnixNano, err = timestamp(r["observed_timestamp"], now); err != nil {
+		return err
+	}
+	if body, ok := r["body"]; ok {
+		l.Body = anyValue(body)
+	} else {
+		l.Body = anyValue(string(bytes.TrimSpace(value)))
+	}
+	if severity, ok := r["severity"].(string); ok {
+		l.SeverityText = severity
+		l.SeverityNumber = severities[strings.ToUpper(severity)]
+	}
+	if n, ok := number(r["severity_number"]); ok {
+		l.SeverityNumber = logspb.SeverityNumber(n)
+	}
+	if l.TraceId, err = id(r["trace_id"], 16, false); err != nil {
+		return err
+	}
+	if l.SpanId, err = id(r["span_id"], 8, false); err != nil {
+		return err
+	}
+	g.logs = append(g.logs, l)
+	return nil
+}
+
+func (b *batch) addMetric(r record, now time.Time) error {
+	name, _ := r["name"].(string)
+	if name == "" {
+		return fmt.Errorf("metric without name")
+	}
+	g, err := b.group(r, nil)
+	if err != nil {
+		return err
+	}
+	ts, err := timestamp(r["timestamp"], now)
+	if err != nil {
+		return err
+	}
+	start, err := timestamp(r["start_timestamp"], b.start)
+	if err != nil {
+		return err
+	}
+	temporality := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	if t, _ := r["temporality"].(string); t == "delta" {
+		temporality = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	}
+	m := &metricspb.Metric{Name: name}
+	m.Description, _ = r["description"].(string)
+	m.Unit, _ = r["unit"].(string)
+	attrs := attributes(r, metricFields)
+
+	kind, _ := r["type"].(string)
+	switch kind {
+	case "", "gauge", "sum":
+		p := &metricspb.NumberDataPoint{Attributes: attrs, StartTimeUnixNano: start, TimeUnixNano: ts}
+		switch v := r["value"].(type) {
+		case json.Number:
+			if i, err := v.Int64(); err == nil {
+				p.Value = &metricspb.NumberDataPoint_AsInt{AsInt: i}
+			} else {
+				f, _ := v.Float64()
+				p.Value = &metricspb.NumberDataPoint_AsDouble{AsDouble: f}
+			}
+		default:
+			return fmt.Errorf("metric %s without numeric value", name)
+		}
+		if kind == "sum" {
+			monotonic, ok := r["monotonic"].(bool)
+			m.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+				DataPoints:             []*metricspb.NumberDataPoint{p},
+				AggregationTemporality: temporality,
+				IsMonotonic:            monotonic || !ok,
+			}}
+		} else {
+			m.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{p}}}
+		}
+	case "histogram":
+		p, err := histogramPoint(r)
+		if err != nil {
+			return fmt.Errorf("metric %s: %w", name, err)
+		}
+		p.Attributes, p.StartTimeUnixNano, p.TimeUnixNano = attrs, start, ts
+		m.Data = &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+			DataPoints:             []*metricspb.HistogramDataPoint{p},
+			AggregationTemporality: temporality,
+		}}
+	default:
+		return fmt.Errorf("metric %s has type %s, not gauge, sum or histogram", name, kind)
+	}
+	g.metrics = append(g.metrics, m)
+	return nil
+}
+
+// histogramPoint returns the point of a histogram with the observed values, or with the bucket counts
+func histogramPoint(r record) (*metricspb.HistogramDataPoint, error) {
+	bounds, err := numbers(r["bounds"])
+	if err != nil {
+		return nil, fmt.Errorf("bounds: %w", err)
+	}
+	if bounds == nil {
+		bounds = defaultBounds
+	}
+	p := &metricspb.HistogramDataPoint{ExplicitBounds: bounds}
+
+	if _, ok := r["values"]; ok {
+		values, err := numbers(r["values"])
+		if err != nil {
+			return nil, fmt.Errorf("values: %w", err)
+		}
+		p.BucketCounts = make([]uint64, len(bounds)+1)
+		sum, min, max := 0.0, math.Inf(1), math.Inf(-1)
+		for _, v := range values {
+			p.BucketCounts[sort.SearchFloat64s(bounds, v)]++
+			sum += v
+			min, max = math.Min(min, v), math.Max(max, v)
+		}
+		p.Count = uint64(len(values))
+		p.Sum = &sum
+		if len(values) > 0 {
+			p.Min, p.Max = &min, &max
+		}
+		return p, nil
+	}
+
+	counts, err := numbers(r["bucket_counts"])
+	if err != nil {
+		return nil, fmt.Errorf("bucket_counts: %w", err)
+	}
+	if len(counts) != len(bounds)+1 {
+		return nil, fmt.Errorf("%d bucket counts, instead of %d for %d bounds", len(counts), len(bounds)+1, len(bounds))
+	}
+	for _, c := range counts {
+		p.BucketCounts = append(p.BucketCounts, uint64(c))
+		p.Count += uint64(c)
+	}
+	if c, ok := number(r["count"]); ok {
+		p.Count = uint64(c)
+	}
+	for field, target := range map[string]**float64{"sum": &p.Sum, "min": &p.Min, "max": &p.Max} {
+		if v, ok := number(r[field]); ok {
+			*target = &v
+		}
+	}
+	return p, nil
+}
+
+// addSpan adds the span of the record and the spans of its children, in the trace and resource of the parent if not set
+func (b *batch) addSpan(r record, parent *tracepb.Span, parentGroup *resourceGroup, now time.Time) error {
+	if r == nil {
+		return fmt.Errorf("span is not a JSON object")
+	}
+	g, err := b.group(r, parentGroup)
+	if err != nil {
+		return err
+	}
+	s := &tracepb.Span{
+		Name:       "span",
+		Kind:       tracepb.Span_SPAN_KIND_INTERNAL,
+		Attributes: attributes(r, spanFields),
+	}
+	if name, ok := r["name"].(string); ok {
+		s.Name = name
+	}
+	if kind, ok := r["kind"].(string); ok {
+		if s.Kind, ok = spanKinds[strings.ToLower(kind)]; !ok {
+			return fmt.Errorf("span kind %s is not one of internal, server, client, producer, consumer", kind)
+		}
+	}
+
+	if parent != nil {
+		s.TraceId, s.ParentSpanId = parent.TraceId, parent.SpanId
+		if _, ok := r["trace_id"]; ok {
+			if s.TraceId, err = id(r["trace_id"], 16, false); err != nil {
+				return err
+			}
+		}
+	} else {
+		if s.TraceId, err = id(r["trace_id"], 16, true); err != nil {
+			return err
+		}
+		if s.ParentSpanId, err = id(r["parent_span_id"], 8, false); err != nil {
+			return err
+		}
+	}
+	if s.SpanId, err = id(r["span_id"], 8, true); err != nil {
+		return err
+	}
+
+	defaultStart, defaultEnd := now, time.Time{}
+	if parent != nil {
+		defaultStart = time.Unix(0, int64(parent.StartTimeUnixNano))
+		defaultEnd = time.Unix(0, int64(parent.EndTimeUnixNano))
+	}
+	if s.StartTimeUnixNano, err = timestamp(r["start"], defaultStart); err != nil {
+		return err
+	}
+	switch {
+	case r["end"] != nil:
+		if s.EndTimeUnixNano, err = timestamp(r["end"], now); err != nil {
+			return err
+		}
+	case r["duration"] != nil:
+		d, err := duration(r["duration"])
+		if err != nil {
+			return err
+		}
+		s.EndTimeUnixNano = s.StartTimeUnixNano + uint64(d)
+	case parent != nil:
+		s.EndTimeUnixNano = uint64(defaultEnd.UnixNano())
+	default:
+		s.EndTimeUnixNano = s.StartTimeUnixNano
+	}
+
+	if status, ok := r["status"].(string); ok {
+		code, ok := statusCodes[strings.ToLower(status)]
+		if !ok {
+			return fmt.Errorf("span status %s is not one of unset, ok, error", status)
+		}
+		s.Status = &tracepb.Status{Code: code}
+		s.Status.Message, _ = r["status_message"].(string)
+	}
+
+	events, _ := r["events"].([]any)
+	for _, e := range events {
+		event, ok := e.(map[string]any)
+		if !ok {
+			return fmt.Errorf("span event is not a JSON object")
+		}
+		se := &tracepb.Span_Event{Attributes: attributes(event, eventFields)}
+		se.Name, _ = event["name"].(string)
+		if se.TimeUnixNano, err = timestamp(event["timestamp"], time.Unix(0, int64(s.StartTimeUnixNano))); err != nil {
+			return err
+		}
+		s.Events = append(s.Events, se)
+	}
+
+	g.spans = append(g.spans, s)
+
+	children, _ := r["children"].([]any)
+	for _, c := range children {
+		child, _ := c.(map[string]any)
+		if err := b.addSpan(child, s, g, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// group returns the resource group of the record: the one of the parent, if the record has no resource
+func (b *batch) group(r record, parent *resourceGroup) (*resourceGroup, error) {
+	own, hasOwn := r["resource"].(map[string]any)
+	if parent != nil && !hasOwn {
+		return parent, nil
+	}
+	attrs := map[string]any{}
+	flatten("", b.base, attrs)
+	if hasOwn {
+		flatten("", own, attrs)
+	}
+	key, err := json.Marshal(attrs)
+	if err != nil {
+		return nil, err
+	}
+	if g, ok := b.byKey[string(key)]; ok {
+		return g, nil
+	}
+	g := &resourceGroup{resource: &resourcepb.Resource{Attributes: keyValues(attrs)}}
+	b.byKey[string(key)] = g
+	b.groups = append(b.groups, g)
+	return g, nil
+}
+
+// request returns the export request of the batch
+func (b *batch) request() proto.Message {
+	switch b.signal {
+	case Metrics:
+		req := &colmetricspb.ExportMetricsServiceRequest{}
+		for _, g := range b.groups {
+			req.ResourceMetrics = append(req.ResourceMetrics, &metricspb.ResourceMetrics{
+				Resource:     g.resource,
+				ScopeMetrics: []*metricspb.ScopeMetrics{{Scope: b.scope, Metrics: g.metrics}},
+			})
+		}
+		return req
+	case Traces:
+		req := &coltracepb.ExportTraceServiceRequest{}
+		for _, g := range b.groups {
+			req.ResourceSpans = append(req.ResourceSpans, &tracepb.ResourceSpans{
+				Resource:   g.resource,
+				ScopeSpans: []*tracepb.ScopeSpans{{Scope: b.scope, Spans: g.spans}},
+			})
+		}
+		return req
+	default:
+		req := &collogspb.ExportLogsServiceRequest{}
+		for _, g := range b.groups {
+			req.ResourceLogs = append(req.ResourceLogs, &logspb.ResourceLogs{
+				Resource:  g.resource,
+				ScopeLogs: []*logspb.ScopeLogs{{Scope: b.scope, LogRecords: g.logs}},
+			})
+		}
+		return req
+	}
+}
+
+func fields(names ...string) map[string]bool {
+	m := make(map[string]bool, len(names))
+	for _, n := range names {
+		m[n] = true
+	}
+	return m
+}
+
+func decodeRecord(value []byte) (record, error) {
+	d := json.NewDecoder(bytes.NewReader(value))
+	d.UseNumber()
+	var r record
+	if err := d.Decode(&r); err != nil {
+		return nil, fmt.Errorf("record is not a JSON object: %w", err)
+	}
+	return r, nil
+}
+
+// attributes returns the attributes of a record: the ones in attributes and the fields without a meaning,
+// with nested objects flattened as dotted keys, like source.ip
+func attributes(r record, reserved map[string]bool) []*commonpb.KeyValue {
+	attrs := map[string]any{}
+	for k, v := range r {
+		if !reserved[k] {
+			flatten(k, v, attrs)
+		}
+	}
+	if explicit, ok := r["attributes"].(map[string]any); ok {
+		flatten("", explicit, attrs)
+	}
+	return keyValues(attrs)
+}
+
+func flatten(prefix string, v any, out map[string]any) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		out[prefix] = v
+		return
+	}
+	for k, nested := range m {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		flatten(k, nested, out)
+	}
+}
+
+func keyValues(m map[string]any) []*commonpb.KeyValue {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := make([]*commonpb.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, &commonpb.KeyValue{Key: k, Value: anyValue(m[k])})
+	}
+	return kvs
+}
+
+func anyValue(v any) *commonpb.AnyValue {
+	switch v := v.(type) {
+	case string:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}
+	case bool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v}}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: i}}
+		}
+		f, _ := v.Float64()
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: f}}
+	case float64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v}}
+	case []any:
+		values := make([]*commonpb.AnyValue, 0, len(v))
+		for _, item := range v {
+			values = append(values, anyValue(item))
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: values}}}
+	case map[string]any:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: keyValues(v)}}}
+	default:
+		return &commonpb.AnyValue{}
+	}
+}
+
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func numbers(v any) ([]float64, error) {
+	if v == nil {
+		return nil, nil
+	}
+	items, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("not an array")
+	}
+	values := make([]float64, 0, len(items))
+	for _, item := range items {
+		f, ok := number(item)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a number", item)
+		}
+		values = append(values, f)
+	}
+	return values, nil
+}
+
+// timestamp parses a RFC 3339 time, or a Unix time in seconds, milliseconds, microseconds or nanoseconds,
+// told apart by their magnitude
+func timestamp(v any, def time.Time) (uint64, error) {
+	if v == nil {
+		return uint64(def.UnixNano()), nil
+	}
+	if s, ok := v.(string); ok {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", s)
+		}
+		return uint64(t.UnixNano()), nil
+	}
+	f, ok := number(v)
+	if !ok || f < 0 {
+		return 0, fmt.Errorf("invalid timestamp %v", v)
+	}
+	switch {
+	case f < 1e11:
+		f *= 1e9
+	case f < 1e14:
+		f *= 1e6
+	case f < 1e17:
+		f *= 1e3
+	}
+	return uint64(f), nil
+}
+
+// duration parses a Go duration, like 120ms, or a number of milliseconds
+func duration(v any) (time.Duration, error) {
+	if s, ok := v.(string); ok {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return d, nil
+	}
+	f, ok := number(v)
+	if !ok || f < 0 {
+		return 0, fmt.Errorf("invalid duration %v", v)
+	}
+	return time.Duration(f * float64(time.Millisecond)), nil
+}
+
+// id decodes a hex trace or span id, or returns a new random id if generate is set
+func id(v any, size int, generate bool) ([]byte, error) {
+	s, _ := v.(string)
+	if s == "" {
+		if !generate {
+			return nil, nil
+		}
+		b := make([]byte, size)
+		_, err := rand.Read(b)
+		return b, err
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != size {
+		return nil, fmt.Errorf("invalid id %q: it must be %d hex digits", s, size*2)
+	}
+	return b, nil
+}
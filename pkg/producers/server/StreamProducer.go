@@ -0,0 +1,50 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package server
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Record is a key and a value produced to a stream
+type Record struct {
+	Key   []byte
+	Value []byte
+}
+
+// StreamProducer appends the produced records to a *[]Record, for the streaming endpoints of the server
+type StreamProducer struct{}
+
+func (c *StreamProducer) Close(_ context.Context) error {
+	// no need to close
+	return nil
+}
+
+func (c *StreamProducer) Produce(_ context.Context, key []byte, value []byte, o any) {
+	records, ok := o.(*[]Record)
+	if !ok {
+		log.Warn().Interface("o", o).Msg("Stream producer must produce to a *[]Record")
+		return
+	}
+	*records = append(*records, Record{Key: key, Value: value})
+}
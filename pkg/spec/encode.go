@@ -0,0 +1,191 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spec
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hamba/avro/v2"
+)
+
+// Encoder serializes records generated from a Spec
+type Encoder struct {
+	spec   *Spec
+	schema avro.Schema
+}
+
+// NewEncoder creates an Encoder for the Format of the Spec
+func NewEncoder(s *Spec) (*Encoder, error) {
+	e := &Encoder{spec: s}
+	if s.Format == Avro {
+		schema, err := avro.Parse(s.AvroSchema())
+		if err != nil {
+			return nil, err
+		}
+		e.schema = schema
+	}
+	return e, nil
+}
+
+// Encode serializes a record
+func (e *Encoder) Encode(o Object) ([]byte, error) {
+	switch e.spec.Format {
+	case CSV:
+		return EncodeCSV(Flatten(o).Values(), ',')
+	case Avro:
+		return avro.Marshal(e.schema, o.Map())
+	default:
+		return json.Marshal(o)
+	}
+}
+
+// Header returns the CSV header of the records generated by the Spec
+func (s *Spec) Header() []string {
+	return flattenFieldNames("", s.Fields)
+}
+
+func flattenFieldNames(prefix string, fields []*Field) []string {
+	var names []string
+	for _, f := range fields {
+		if f.Type == TypeObject {
+			names = append(names, flattenFieldNames(prefix+f.Name+".", f.Fields)...)
+		} else {
+			names = append(names, prefix+f.Name)
+		}
+	}
+	return names
+}
+
+// Flatten turns nested objects in dotted columns. Arrays are kept as a single JSON column.
+func Flatten(o Object) Object {
+	return flatten("", o, make(Object, 0, len(o)))
+}
+
+func flatten(prefix string, o Object, out Object) Object {
+	for _, m := range o {
+		if nested, ok := m.Value.(Object); ok {
+			out = flatten(prefix+m.Name+".", nested, out)
+			continue
+		}
+		out = append(out, Member{Name: prefix + m.Name, Value: m.Value})
+	}
+	return out
+}
+
+// Names returns the member names
+func (o Object) Names() []string {
+	names := make([]string, len(o))
+	for i := range o {
+		names[i] = o[i].Name
+	}
+	return names
+}
+
+// Values returns the member values formatted as strings, as needed by CSV
+func (o Object) Values() []string {
+	values := make([]string, len(o))
+	for i := range o {
+		values[i] = FormatValue(o[i].Value)
+	}
+	return values
+}
+
+// FormatValue formats a scalar as plain text, and objects and arrays as JSON
+func FormatValue(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	case json.Number:
+		return t.String()
+	default:
+		b, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Sprint(t)
+		}
+		return string(b)
+	}
+}
+
+// EncodeCSV writes a single RFC 4180 row, without the trailing newline
+func EncodeCSV(row []string, delimiter rune) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = delimiter
+	if err := w.Write(row); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// AvroSchema derives the Avro schema of the records generated by the Spec
+func (s *Spec) AvroSchema() string {
+	b, _ := json.Marshal(avroRecord(s.Name, s.Fields))
+	return string(b)
+}
+
+func avroRecord(name string, fields []*Field) map[string]any {
+	fs := make([]map[string]any, len(fields))
+	for i, f := range fields {
+		fs[i] = map[string]any{"name": f.Name, "type": avroType(name, f)}
+		if f.Nullable > 0 {
+			fs[i]["default"] = nil
+		}
+	}
+	return map[string]any{"type": "record", "name": name, "fields": fs}
+}
+
+func avroType(parent string, f *Field) any {
+	var t any
+	switch f.Type {
+	case TypeInt:
+		t = "long"
+	case TypeFloat:
+		t = "double"
+	case TypeBool:
+		t = "boolean"
+	case TypeObject:
+		t = avroRecord(parent+"_"+f.Name, f.Fields)
+	case TypeArray:
+		t = map[string]any{"type": "array", "items": avroType(parent+"_"+f.Name, f.Items)}
+	default:
+		t = "string"
+	}
+	if f.Nullable > 0 {
+		return []any{"null", t}
+	}
+	return t
+}
@@ -0,0 +1,203 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/jrnd-io/jr/pkg/functions"
+)
+
+// Member is a named value of an Object
+type Member struct {
+	Name  string
+	Value any
+}
+
+// Object is a record or nested object whose members keep the order of the spec
+type Object []Member
+
+// Get returns the value of the member called name
+func (o Object) Get(name string) (any, bool) {
+	for _, m := range o {
+		if m.Name == name {
+			return m.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Map converts the Object, and all the nested ones, in a map
+func (o Object) Map() map[string]any {
+	m := make(map[string]any, len(o))
+	for _, member := range o {
+		m[member.Name] = toMap(member.Value)
+	}
+	return m
+}
+
+func toMap(v any) any {
+	switch t := v.(type) {
+	case Object:
+		return t.Map()
+	case []any:
+		a := make([]any, len(t))
+		for i := range t {
+			a[i] = toMap(t[i])
+		}
+		return a
+	default:
+		return v
+	}
+}
+
+func (o Object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(m.Name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Compile parses all the field expressions with the given function map
+func (s *Spec) Compile(fmap template.FuncMap) error {
+	return compileFields(s.Fields, fmap)
+}
+
+func compileFields(fields []*Field, fmap template.FuncMap) error {
+	for _, f := range fields {
+		if err := compileField(f, fmap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func compileField(f *Field, fmap template.FuncMap) error {
+	switch f.Type {
+	case TypeObject:
+		return compileFields(f.Fields, fmap)
+	case TypeArray:
+		return compileField(f.Items, fmap)
+	}
+	t, err := template.New(f.Name).Funcs(fmap).Parse(f.Value)
+	if err != nil {
+		return fmt.Errorf("field '%s': %w", f.Name, err)
+	}
+	f.tpl = t
+	return nil
+}
+
+// Generate builds a new record. ctx is passed as data to all the field expressions.
+func (s *Spec) Generate(ctx any) (Object, error) {
+	return generateObject(s.Fields, ctx)
+}
+
+func generateObject(fields []*Field, ctx any) (Object, error) {
+	o := make(Object, 0, len(fields))
+	for _, f := range fields {
+		v, err := generate(f, ctx)
+		if err != nil {
+			return nil, err
+		}
+		o = append(o, Member{Name: f.Name, Value: v})
+	}
+	return o, nil
+}
+
+func generate(f *Field, ctx any) (any, error) {
+	if f.Nullable > 0 && functions.Random.Float64() < f.Nullable {
+		return nil, nil
+	}
+
+	switch f.Type {
+	case TypeObject:
+		return generateObject(f.Fields, ctx)
+	case TypeArray:
+		n := f.Min
+		if f.Max > f.Min {
+			n += functions.Random.Intn(f.Max - f.Min + 1)
+		}
+		a := make([]any, n)
+		for i := range a {
+			v, err := generate(f.Items, ctx)
+			if err != nil {
+				return nil, err
+			}
+			a[i] = v
+		}
+		return a, nil
+	}
+
+	if f.tpl == nil {
+		return nil, fmt.Errorf("field '%s' is not compiled", f.Name)
+	}
+	var buf bytes.Buffer
+	if err := f.tpl.Execute(&buf, ctx); err != nil {
+		return nil, err
+	}
+	return convert(f, buf.String())
+}
+
+func convert(f *Field, s string) (any, error) {
+	switch f.Type {
+	case TypeInt:
+		i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("field '%s': '%s' is not an int", f.Name, s)
+		}
+		return i, nil
+	case TypeFloat:
+		fl, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, fmt.Errorf("field '%s': '%s' is not a float", f.Name, s)
+		}
+		return fl, nil
+	case TypeBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("field '%s': '%s' is not a bool", f.Name, s)
+		}
+		return b, nil
+	default:
+		return s, nil
+	}
+}
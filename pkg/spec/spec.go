@@ -0,0 +1,220 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spec
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+type FieldType string
+
+const (
+	TypeString FieldType = "string"
+	TypeInt    FieldType = "int"
+	TypeFloat  FieldType = "float"
+	TypeBool   FieldType = "bool"
+	TypeObject FieldType = "object"
+	TypeArray  FieldType = "array"
+)
+
+type Format string
+
+const (
+	JSON Format = "json"
+	CSV  Format = "csv"
+	Avro Format = "avro"
+)
+
+// Field describes how a single value of a record is generated.
+// Scalar fields are rendered from Value, which is a jr template expression,
+// objects from Fields and arrays from Items, repeated between Min and Max times.
+type Field struct {
+	Name     string
+	Type     FieldType
+	Value    string
+	Nullable float64
+	Min      int
+	Max      int
+	Fields   []*Field
+	Items    *Field
+
+	tpl *template.Template
+}
+
+// Spec is a record specification: an ordered list of fields, which jr builds
+// as a typed value and serializes in the given Format.
+type Spec struct {
+	Name   string
+	Format Format
+	Fields []*Field
+}
+
+// Load reads a record spec from a YAML or JSON file
+func Load(path string) (*Spec, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse parses a record spec in YAML or JSON format. Field order is preserved.
+func Parse(b []byte) (*Spec, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(b, &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("record spec must be a mapping")
+	}
+
+	s := &Spec{Name: "record", Format: JSON}
+	doc := root.Content[0]
+	for i := 0; i < len(doc.Content); i += 2 {
+		key, value := doc.Content[i].Value, doc.Content[i+1]
+		switch key {
+		case "name":
+			s.Name = value.Value
+		case "format":
+			s.Format = Format(strings.ToLower(value.Value))
+		case "fields":
+			fields, err := parseFields(value)
+			if err != nil {
+				return nil, err
+			}
+			s.Fields = fields
+		default:
+			return nil, fmt.Errorf("unknown record spec key '%s' at line %d", key, doc.Content[i].Line)
+		}
+	}
+
+	switch s.Format {
+	case JSON, CSV, Avro:
+	default:
+		return nil, fmt.Errorf("unsupported record spec format '%s'", s.Format)
+	}
+	if len(s.Fields) == 0 {
+		return nil, fmt.Errorf("record spec '%s' has no fields", s.Name)
+	}
+	return s, nil
+}
+
+func parseFields(n *yaml.Node) ([]*Field, error) {
+	if n.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("fields must be a mapping at line %d", n.Line)
+	}
+	fields := make([]*Field, 0, len(n.Content)/2)
+	for i := 0; i < len(n.Content); i += 2 {
+		f, err := parseField(n.Content[i].Value, n.Content[i+1])
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func parseField(name string, n *yaml.Node) (*Field, error) {
+	f := &Field{Name: name, Type: TypeString}
+
+	// shorthand: a scalar is a string expression
+	if n.Kind == yaml.ScalarNode {
+		f.Value = n.Value
+		return f, nil
+	}
+	if n.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("field '%s' must be a scalar or a mapping at line %d", name, n.Line)
+	}
+
+	for i := 0; i < len(n.Content); i += 2 {
+		key, value := n.Content[i].Value, n.Content[i+1]
+		var err error
+		switch key {
+		case "type":
+			f.Type = FieldType(strings.ToLower(value.Value))
+		case "value":
+			f.Value = value.Value
+		case "nullable":
+			f.Nullable, err = parseNullable(value.Value)
+		case "min":
+			f.Min, err = strconv.Atoi(value.Value)
+		case "max":
+			f.Max, err = strconv.Atoi(value.Value)
+		case "fields":
+			f.Fields, err = parseFields(value)
+			if f.Type == TypeString {
+				f.Type = TypeObject
+			}
+		case "items":
+			f.Items, err = parseField(name, value)
+			if f.Type == TypeString {
+				f.Type = TypeArray
+			}
+		default:
+			err = fmt.Errorf("unknown key '%s' at line %d", key, n.Content[i].Line)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("field '%s': %w", name, err)
+		}
+	}
+
+	switch f.Type {
+	case TypeString, TypeInt, TypeFloat, TypeBool:
+	case TypeObject:
+		if len(f.Fields) == 0 {
+			return nil, fmt.Errorf("object field '%s' has no fields", name)
+		}
+	case TypeArray:
+		if f.Items == nil {
+			return nil, fmt.Errorf("array field '%s' has no items", name)
+		}
+		if f.Max < f.Min {
+			return nil, fmt.Errorf("array field '%s' has max < min", name)
+		}
+	default:
+		return nil, fmt.Errorf("field '%s' has unknown type '%s'", name, f.Type)
+	}
+	return f, nil
+}
+
+// parseNullable accepts a probability or a boolean, true meaning 50%
+func parseNullable(s string) (float64, error) {
+	if p, err := strconv.ParseFloat(s, 64); err == nil {
+		if p < 0 || p > 1 {
+			return 0, fmt.Errorf("nullable must be a probability between 0 and 1")
+		}
+		return p, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return 0, fmt.Errorf("nullable must be a boolean or a probability between 0 and 1")
+	}
+	if b {
+		return 0.5, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,174 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package spec_test
+
+import (
+	"testing"
+
+	"github.com/hamba/avro/v2"
+	"github.com/jrnd-io/jr/pkg/functions"
+	"github.com/jrnd-io/jr/pkg/spec"
+	"github.com/stretchr/testify/require"
+)
+
+const userSpec = `
+name: user
+fields:
+  id:
+    type: int
+    value: '{{add 40 2}}'
+  name: '{{"Ugo"}}'
+  score:
+    type: float
+    value: '3.5'
+  active:
+    type: bool
+    value: 'true'
+  address:
+    fields:
+      city: 'Roma'
+      zip: '00100'
+  tags:
+    min: 2
+    max: 2
+    items: 'a,"b"'
+`
+
+func compile(t *testing.T, s string) *spec.Spec {
+	t.Helper()
+	sp, err := spec.Parse([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, sp.Compile(functions.FunctionsMap()))
+	return sp
+}
+
+func TestJSON(t *testing.T) {
+	sp := compile(t, userSpec)
+	o, err := sp.Generate(nil)
+	require.NoError(t, err)
+
+	e, err := spec.NewEncoder(sp)
+	require.NoError(t, err)
+	b, err := e.Encode(o)
+	require.NoError(t, err)
+	require.Equal(t, `{"id":42,"name":"Ugo","score":3.5,"active":true,"address":{"city":"Roma","zip":"00100"},"tags":["a,\"b\"","a,\"b\""]}`, string(b))
+}
+
+func TestCSV(t *testing.T) {
+	sp := compile(t, "format: csv\n"+userSpec)
+	require.Equal(t, []string{"id", "name", "score", "active", "address.city", "address.zip", "tags"}, sp.Header())
+
+	o, err := sp.Generate(nil)
+	require.NoError(t, err)
+	e, err := spec.NewEncoder(sp)
+	require.NoError(t, err)
+	b, err := e.Encode(o)
+	require.NoError(t, err)
+	require.Equal(t, `42,Ugo,3.5,true,Roma,00100,"[""a,\""b\"""",""a,\""b\""""]"`, string(b))
+}
+
+func TestAvro(t *testing.T) {
+	sp := compile(t, `
+format: avro
+fields:
+  id:
+    type: int
+    value: '7'
+  nickname:
+    value: 'ugol'
+    nullable: 1
+  address:
+    fields:
+      city: 'Roma'
+`)
+	o, err := sp.Generate(nil)
+	require.NoError(t, err)
+	e, err := spec.NewEncoder(sp)
+	require.NoError(t, err)
+	b, err := e.Encode(o)
+	require.NoError(t, err)
+
+	var decoded map[string]any
+	require.NoError(t, avro.Unmarshal(avro.MustParse(sp.AvroSchema()), b, &decoded))
+	require.Equal(t, int64(7), decoded["id"])
+	require.Nil(t, decoded["nickname"])
+	require.Equal(t, map[string]any{"city": "Roma"}, decoded["address"])
+}
+
+func TestNullableAndArrayLength(t *testing.T) {
+	functions.SetSeed(0)
+	sp := compile(t, `
+fields:
+  maybe:
+    value: 'x'
+    nullable: 0.5
+  list:
+    min: 1
+    max: 4
+    items: 'y'
+`)
+	nulls := 0
+	for i := 0; i < 200; i++ {
+		o, err := sp.Generate(nil)
+		require.NoError(t, err)
+		if v, _ := o.Get("maybe"); v == nil {
+			nulls++
+		}
+		l, _ := o.Get("list")
+		require.GreaterOrEqual(t, len(l.([]any)), 1)
+		require.LessOrEqual(t, len(l.([]any)), 4)
+	}
+	require.Greater(t, nulls, 50)
+	require.Less(t, nulls, 150)
+}
+
+func TestInvalidSpecs(t *testing.T) {
+	invalid := []string{
+		`fields: {}`,
+		`format: xml
+fields:
+  a: 'x'`,
+		`fields:
+  a:
+    type: decimal`,
+		`fields:
+  a:
+    type: array`,
+		`fields:
+  a:
+    nullable: 2`,
+		`fields:
+  a:
+    items: 'x'
+    min: 3
+    max: 1`,
+	}
+	for _, s := range invalid {
+		_, err := spec.Parse([]byte(s))
+		require.Error(t, err, s)
+	}
+
+	sp, err := spec.Parse([]byte("fields:\n  n:\n    type: int\n    value: 'abc'"))
+	require.NoError(t, err)
+	require.NoError(t, sp.Compile(functions.FunctionsMap()))
+	_, err = sp.Generate(nil)
+	require.Error(t, err)
+}
@@ -47,6 +47,13 @@ func (t *Tpl) Execute() string {
 	return t.ExecuteWith(t.Context)
 }
 
+// TryExecute executes the template, returning the error instead of stopping jr
+func (t *Tpl) TryExecute() (string, error) {
+	var buffer bytes.Buffer
+	err := t.Template.Execute(&buffer, t.Context)
+	return buffer.String(), err
+}
+
 func (t *Tpl) ExecuteWith(data any) string {
 	var buffer bytes.Buffer
 	err := t.Template.Execute(&buffer, data)
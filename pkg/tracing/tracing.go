@@ -0,0 +1,151 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	// ModeNone doesn't create spans
+	ModeNone = ""
+	// ModeRecord creates a span for every produced record
+	ModeRecord = "record"
+	// ModeBatch creates a span for every generation pass of an emitter, shared by its records
+	ModeBatch = "batch"
+
+	// DefaultServiceName is the service name of the spans of jr
+	DefaultServiceName = "jr"
+	tracesPath         = "/v1/traces"
+)
+
+// Config configures the spans of jr and their export over OTLP/HTTP
+type Config struct {
+	// Mode is record, batch or empty, for no spans
+	Mode string
+	// Endpoint is the URL of the OTLP/HTTP collector, like http://localhost:4318.
+	// If empty, the OTEL_EXPORTER_OTLP_ENDPOINT environment variable or http://localhost:4318 is used
+	Endpoint string
+	// ServiceName is the service name of the spans, jr by default
+	ServiceName string
+	// Exporter replaces the OTLP exporter, for tests
+	Exporter sdktrace.SpanExporter
+}
+
+var (
+	lock       sync.RWMutex
+	mode                    = ModeNone
+	tracer     trace.Tracer = noop.NewTracerProvider().Tracer(DefaultServiceName)
+	provider   *sdktrace.TracerProvider
+	propagator = propagation.TraceContext{}
+)
+
+// Init creates the tracer of jr. With ModeNone, no spans are created and nothing is exported
+func Init(ctx context.Context, c Config) error {
+	switch c.Mode {
+	case ModeNone:
+		return nil
+	case ModeRecord, ModeBatch:
+	default:
+		return fmt.Errorf("tracing mode %q is not one of %s, %s", c.Mode, ModeRecord, ModeBatch)
+	}
+	if c.ServiceName == "" {
+		c.ServiceName = DefaultServiceName
+	}
+
+	exporter := c.Exporter
+	if exporter == nil {
+		var options []otlptracehttp.Option
+		if c.Endpoint != "" {
+			u, err := url.Parse(c.Endpoint)
+			if err != nil || u.Host == "" {
+				return fmt.Errorf("invalid tracing endpoint %q", c.Endpoint)
+			}
+			if u.Path == "" || u.Path == "/" {
+				u.Path = tracesPath
+			}
+			options = append(options, otlptracehttp.WithEndpointURL(u.String()))
+		}
+		var err error
+		exporter, err = otlptracehttp.New(ctx, options...)
+		if err != nil {
+			return fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+	}
+
+	r, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(c.ServiceName)))
+	if err != nil {
+		return err
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	provider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(r))
+	tracer = provider.Tracer(DefaultServiceName)
+	mode = c.Mode
+	return nil
+}
+
+// Shutdown exports the pending spans and stops the tracer
+func Shutdown(ctx context.Context) error {
+	lock.Lock()
+	defer lock.Unlock()
+	if provider == nil {
+		return nil
+	}
+	err := provider.Shutdown(ctx)
+	provider = nil
+	tracer = noop.NewTracerProvider().Tracer(DefaultServiceName)
+	mode = ModeNone
+	return err
+}
+
+// Mode returns the tracing mode: record, batch or empty if spans are not created
+func Mode() string {
+	lock.RLock()
+	defer lock.RUnlock()
+	return mode
+}
+
+// Start starts a span
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	lock.RLock()
+	t := tracer
+	lock.RUnlock()
+	return t.Start(ctx, name, trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(attributes...))
+}
+
+// Inject adds the W3C traceparent of the span of the context to headers, if any
+func Inject(ctx context.Context, headers map[string]string) {
+	propagator.Inject(ctx, propagation.MapCarrier(headers))
+}
@@ -0,0 +1,97 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tracing_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/jrnd-io/jr/pkg/tracing"
+	"github.com/stretchr/testify/require"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector is an OTLP/HTTP collector stub, keeping the exported spans
+type collector struct {
+	lock  sync.Mutex
+	paths []string
+	spans []string
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := io.ReadAll(r.Body)
+	var request coltracepb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(b, &request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.paths = append(c.paths, r.URL.Path)
+	for _, rs := range request.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				c.spans = append(c.spans, s.Name)
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	b, _ = proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	_, _ = w.Write(b)
+}
+
+func TestOTLPExport(t *testing.T) {
+	c := &collector{}
+	s := httptest.NewServer(c)
+	defer s.Close()
+
+	ctx := context.Background()
+	require.NoError(t, tracing.Init(ctx, tracing.Config{Mode: tracing.ModeRecord, Endpoint: s.URL}))
+	require.Equal(t, tracing.ModeRecord, tracing.Mode())
+
+	spanCtx, span := tracing.Start(ctx, "orders record")
+	headers := map[string]string{}
+	tracing.Inject(spanCtx, headers)
+	require.Regexp(t, `^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`, headers["traceparent"])
+	span.End()
+
+	require.NoError(t, tracing.Shutdown(ctx))
+	require.Equal(t, tracing.ModeNone, tracing.Mode())
+	require.Equal(t, []string{"/v1/traces"}, c.paths)
+	require.Equal(t, []string{"orders record"}, c.spans)
+
+	headers = map[string]string{}
+	tracing.Inject(ctx, headers)
+	require.Empty(t, headers)
+}
+
+func TestConfig(t *testing.T) {
+	ctx := context.Background()
+	require.Error(t, tracing.Init(ctx, tracing.Config{Mode: "everything"}))
+	require.Error(t, tracing.Init(ctx, tracing.Config{Mode: tracing.ModeBatch, Endpoint: "localhost"}))
+	require.NoError(t, tracing.Init(ctx, tracing.Config{}))
+	require.Equal(t, tracing.ModeNone, tracing.Mode())
+}
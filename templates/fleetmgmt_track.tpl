@@ -0,0 +1,11 @@
+{{$id := entity_id "fleet"}}{
+  "vehicle_id" : {{add 1000 (atoi $id)}},
+  "status" : "{{entity_status "fleet" $id}}",
+  "location" : {
+    "latitude" : {{entity_latitude "fleet" $id}},
+    "longitude" : {{entity_longitude "fleet" $id}}
+  },
+  "heading" : {{entity_heading "fleet" $id}},
+  "speed" : {{entity_speed "fleet" $id}},
+  "ts" : {{counter "ts" 1609459200000 1000 }}
+}
\ No newline at end of file
@@ -0,0 +1,16 @@
+{
+  "timestamp": {{now}},
+  "severity": "{{randoms "INFO|INFO|INFO|WARN|ERROR|DEBUG"}}",
+  "body": "{{http_method}} /api/{{randoms "orders|customers|payments|products"}} from {{ip "10.0.0.0/8"}}",
+  "trace_id": "{{trace_id}}",
+  "span_id": "{{span_id}}",
+  "http": {
+    "method": "{{http_method}}",
+    "status_code": {{randoms "200|200|201|204|400|404|500"}}
+  },
+  "user_agent.original": "{{useragent}}",
+  "resource": {
+    "service.name": "{{randoms "checkout|payments|catalog"}}",
+    "host.name": "node-{{integer 1 9}}"
+  }
+}
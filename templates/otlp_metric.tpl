@@ -0,0 +1,13 @@
+{
+  "name": "http.server.request.duration",
+  "description": "Duration of HTTP server requests",
+  "unit": "ms",
+  "type": "histogram",
+  "temporality": "delta",
+  "values": [{{integer 1 50}}, {{integer 5 120}}, {{integer 10 400}}, {{integer 20 2000}}],
+  "http.request.method": "{{http_method}}",
+  "http.route": "/api/{{randoms "orders|customers|payments|products"}}",
+  "resource": {
+    "service.name": "{{randoms "checkout|payments|catalog"}}"
+  }
+}
@@ -0,0 +1,37 @@
+{
+  "name": "{{randoms "GET|POST"}} /api/orders",
+  "kind": "server",
+  "duration": "{{integer 50 500}}ms",
+  "status": "{{randoms "ok|ok|ok|error"}}",
+  "http.response.status_code": {{randoms "200|201|500"}},
+  "client.address": "{{ip "10.0.0.0/8"}}",
+  "resource": {
+    "service.name": "frontend"
+  },
+  "children": [
+    {
+      "name": "SELECT orders",
+      "kind": "client",
+      "duration": "{{integer 5 40}}ms",
+      "db.system": "postgresql",
+      "resource": {
+        "service.name": "orders-db"
+      }
+    },
+    {
+      "name": "POST /charge",
+      "kind": "client",
+      "duration": "{{integer 10 45}}ms",
+      "children": [
+        {
+          "name": "POST /charge",
+          "kind": "server",
+          "duration": "{{integer 5 10}}ms",
+          "resource": {
+            "service.name": "payments"
+          }
+        }
+      ]
+    }
+  ]
+}
@@ -0,0 +1,26 @@
+{{- $b := basket "shop" -}}
+{
+  "order_id": {{counter "order_id" 1000 1}},
+  "basket_id": "{{$b.ID}}",
+  "customer_id": "{{uuid}}",
+  "ts": {{counter "ts" 1609459200000 100000}},
+  "currency": "{{$b.Currency}}",
+  "items": [
+  {{- range $i, $item := $b.Items}}{{if $i}},{{end}}
+    {
+      "sku": "{{$item.SKU}}",
+      "name": "{{$item.Name}}",
+      "category": "{{$item.Category}}",
+      "quantity": {{$item.Quantity}},
+      "unit_price": {{printf "%.2f" $item.UnitPrice}},
+      "discount": {{printf "%.2f" $item.Discount}},
+      "tax": {{printf "%.2f" $item.Tax}},
+      "total": {{printf "%.2f" $item.Total}}
+    }
+  {{- end}}
+  ],
+  "subtotal": {{printf "%.2f" $b.Subtotal}},
+  "discount": {{printf "%.2f" $b.Discount}},
+  "tax": {{printf "%.2f" $b.Tax}},
+  "total": {{printf "%.2f" $b.Total}}
+}